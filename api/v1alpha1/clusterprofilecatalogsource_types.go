@@ -0,0 +1,64 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Profiles",type="integer",JSONPath=".status.profiles",description=""
+// +kubebuilder:printcolumn:name="Versions",type="integer",JSONPath=".status.versions",description=""
+// +kubebuilder:printcolumn:name="Last Scan",type="date",JSONPath=".status.lastScanTime",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// ClusterProfileCatalogSource is the Schema for the ClusterProfileCatalogSources API.
+// The profiles it lists are visible to callers from all namespaces.
+type ClusterProfileCatalogSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ProfileCatalogSourceSpec   `json:"spec,omitempty"`
+	Status ProfileCatalogSourceStatus `json:"status,omitempty"`
+}
+
+// GetCatalogSourceSpec returns the spec of the catalog source.
+func (in *ClusterProfileCatalogSource) GetCatalogSourceSpec() ProfileCatalogSourceSpec {
+	return in.Spec
+}
+
+// GetCatalogSourceStatus returns a pointer to the status of the catalog source.
+func (in *ClusterProfileCatalogSource) GetCatalogSourceStatus() *ProfileCatalogSourceStatus {
+	return &in.Status
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterProfileCatalogSourceList contains a list of ClusterProfileCatalogSource
+type ClusterProfileCatalogSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterProfileCatalogSource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterProfileCatalogSource{}, &ClusterProfileCatalogSourceList{})
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the validating webhook of ClusterProfileCatalogSources with the manager.
+func (in *ClusterProfileCatalogSource) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-weave-works-v1alpha1-clusterprofilecatalogsource,mutating=false,failurePolicy=fail,sideEffects=None,groups=weave.works,resources=clusterprofilecatalogsources,verbs=create;update,versions=v1alpha1,name=vclusterprofilecatalogsource.weave.works,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterProfileCatalogSource{}
+
+// ValidateCreate validates the spec of a new ClusterProfileCatalogSource.
+func (in *ClusterProfileCatalogSource) ValidateCreate() error {
+	return invalid("ClusterProfileCatalogSource", in.Name, validateCatalogSourceSpec(in.Spec, ""))
+}
+
+// ValidateUpdate validates the spec of an updated ClusterProfileCatalogSource.
+func (in *ClusterProfileCatalogSource) ValidateUpdate(old runtime.Object) error {
+	return invalid("ClusterProfileCatalogSource", in.Name, validateCatalogSourceSpec(in.Spec, ""))
+}
+
+// ValidateDelete allows all deletions.
+func (in *ClusterProfileCatalogSource) ValidateDelete() error {
+	return nil
+}
@@ -55,6 +55,7 @@ type ProfileDescription struct {
 // Artifact defines a bundled resource of the components for this profile
 type Artifact struct {
 	// Name is the name of the Artifact
+	// +required
 	Name string `json:"name,omitempty"`
 	// DependsOn is an optional field which defines dependency on other artifacts.
 	// +optional
@@ -74,12 +75,14 @@ type Artifact struct {
 // DependsOn defines an optional artifact name on which this artifact depends on.
 type DependsOn struct {
 	// Name of the artifact to depend on.
+	// +required
 	Name string `json:"name"`
 }
 
 // Kustomize defines properties to for a kustomize artifact.
 type Kustomize struct {
 	// Path is the local path to the Artifact in the Profile repo
+	// +required
 	Path string `json:"path,omitempty"`
 }
 
@@ -107,6 +110,7 @@ type Chart struct {
 // Profile defines properties for accessing a profile
 type Profile struct {
 	// Source defines properties of the source of the profile
+	// +required
 	Source *Source `json:"source,omitempty"`
 }
 
@@ -39,16 +39,65 @@ type Repository struct {
 	// must be in format 'ssh://git@github.com/stefanprodan/podinfo'
 	// When using username/password must be in format
 	// 'https://github.com/stefanprodan/podinfo'
+	// +required
 	URL string `json:"url,omitempty"`
 	// The secret name containing the Git credentials.
 	// For HTTPS repositories the secret must contain 'username' and 'password'
 	// fields.
 	// For SSH repositories the secret must contain 'identity', 'identity.pub' and
 	// 'known_hosts' fields.
+	// The namespace of the secret is required for a ClusterProfileCatalogSource.
+	// A ProfileCatalogSource can only reference secrets in its own namespace.
 	// +optional
-	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
+	SecretRef *meta.NamespacedObjectReference `json:"secretRef,omitempty"`
+	// AuthProvider is the provider of the credentials the repository is accessed with. Generic uses the
+	// fields of the secret like Flux does. Token uses the 'token' field, and the optional 'username'
+	// field, of the secret for basic auth. GitHubApp mints installation tokens of the GitHub App with
+	// the 'appID', 'installationID' and 'privateKey' fields, and the optional 'apiURL' field, of the secret.
+	// SSH uses the 'identity' and 'known_hosts' fields of the secret and only accepts the host keys
+	// listed for the host. Providers other than Generic require the git mirror of the controller.
+	// Defaults to Generic.
+	// +kubebuilder:validation:Enum=Generic;Token;GitHubApp;SSH
+	// +optional
+	AuthProvider string `json:"authProvider,omitempty"`
+	// Verification verifies the signatures of the tags of the repository with trusted public keys
+	// +optional
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// Verification defines the public keys the signatures of the tags of a repository are verified with
+type Verification struct {
+	// Mode is Record to list profiles without a trusted signature as unverified, or Enforce to only
+	// list profiles whose tag or commit is signed by a trusted key. Defaults to Record.
+	// +kubebuilder:validation:Enum=Record;Enforce
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	// The secret name containing the trusted public keys. Every field of the secret must contain
+	// ASCII armored GPG public keys or SSH public keys in authorized_keys format.
+	// The namespace of the secret is required for a ClusterProfileCatalogSource.
+	// A ProfileCatalogSource can only reference secrets in its own namespace.
+	// +required
+	SecretRef meta.NamespacedObjectReference `json:"secretRef"`
 }
 
+const (
+	// GenericAuthProvider reads the credentials of a repository from the fields of its secret like Flux
+	GenericAuthProvider = "Generic"
+	// TokenAuthProvider authenticates to a repository with the token of its secret
+	TokenAuthProvider = "Token"
+	// GitHubAppAuthProvider authenticates to a repository with installation tokens of a GitHub App
+	GitHubAppAuthProvider = "GitHubApp"
+	// SSHAuthProvider authenticates to a repository with an SSH key and only accepts known host keys
+	SSHAuthProvider = "SSH"
+)
+
+const (
+	// RecordVerificationMode lists profiles without a trusted signature as unverified
+	RecordVerificationMode = "Record"
+	// EnforceVerificationMode only lists profiles with a trusted signature
+	EnforceVerificationMode = "Enforce"
+)
+
 // ProfileCatalogEntry defines details about a given profile.
 type ProfileCatalogEntry struct {
 	// +kubebuilder:validation:Pattern=^([a-zA-Z\-]+\/)?(v)?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(\.(0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*)?(\+[0-9a-zA-Z-]+(\.[0-9a-zA-Z-]+)*)?$
@@ -59,16 +108,77 @@ type ProfileCatalogEntry struct {
 	// CatalogSource is the name of the catalog the profile is listed in
 	// +optional
 	CatalogSource string `json:"catalogSource,omitempty"`
+	// CatalogNamespace is the namespace of the catalog the profile is listed in
+	// +optional
+	CatalogNamespace string `json:"catalogNamespace,omitempty"`
+	// CatalogScope is the scope of the catalog the profile is listed in, either Namespaced or Cluster
+	// +optional
+	CatalogScope string `json:"catalogScope,omitempty"`
 	// URL is the full URL path to the profile.yaml
 	// +optional
 	URL string `json:"url,omitempty"`
+	// Verified is true when the tag of the profile, or the commit it references, is signed by one
+	// of the trusted keys of its repository
+	// +optional
+	Verified bool `json:"verified,omitempty"`
+	// SigningKey is the fingerprint of the trusted key the tag or commit of the profile is signed with
+	// +optional
+	SigningKey string `json:"signingKey,omitempty"`
+	// MirrorURL is the URL the git mirror of the catalog controller serves the repository of the
+	// profile at, if it is mirrored
+	// +optional
+	MirrorURL string `json:"mirrorURL,omitempty"`
 	// Profile name
+	// +required
 	Name               string `json:"name,omitempty"`
 	ProfileDescription `json:",inline"`
 }
 
+const (
+	// NamespacedCatalogScope is the scope of profiles listed in a ProfileCatalogSource
+	NamespacedCatalogScope = "Namespaced"
+	// ClusterCatalogScope is the scope of profiles listed in a ClusterProfileCatalogSource
+	ClusterCatalogScope = "Cluster"
+)
+
+const (
+	// ReadyCondition is true when the profiles of all repositories of the catalog source are listed in the catalog
+	ReadyCondition = "Ready"
+	// ScanningCondition is true while the repositories of the catalog source are scanned for profiles
+	ScanningCondition = "Scanning"
+	// ScanFailedCondition is true when the last scan of a repository failed
+	ScanFailedCondition = "ScanFailed"
+)
+
+const (
+	// ProfilesListedReason is the reason of a true Ready condition
+	ProfilesListedReason = "ProfilesListed"
+	// ScanFailedReason is the reason of conditions of a failed scan
+	ScanFailedReason = "ScanFailed"
+	// ScanStartedReason is the reason of a true Scanning condition
+	ScanStartedReason = "ScanStarted"
+	// ScanSucceededReason is the reason of conditions of a successful scan
+	ScanSucceededReason = "ScanSucceeded"
+)
+
 // ProfileCatalogSourceStatus defines the observed state of ProfileCatalogSource
 type ProfileCatalogSourceStatus struct {
+	// Conditions holds the Ready, Scanning and ScanFailed conditions of the catalog source
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Profiles is the number of profiles listed by the catalog source
+	// +optional
+	Profiles int `json:"profiles,omitempty"`
+	// Versions is the number of profile versions listed by the catalog source
+	// +optional
+	Versions int `json:"versions,omitempty"`
+	// LastScanTime is the time the repositories of the catalog source were last scanned
+	// +optional
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+	// ObservedGeneration is the generation of the catalog source the status was computed from
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	ScannedRepositories []ScannedRepository `json:"scannedRepositories,omitempty"`
 }
 
@@ -79,10 +189,27 @@ type ScannedRepository struct {
 	URL string `json:"url,omitempty"`
 	// Tags is the list of tags that have been scanned
 	Tags []string `json:"tags,omitempty"`
+	// Commits maps the scanned tags to the SHA they referenced when they were scanned.
+	// A tag which references a different SHA has been force-pushed and is scanned again
+	// +optional
+	Commits map[string]string `json:"commits,omitempty"`
+	// Verification is a digest of the verification mode and the trusted keys the tags were
+	// verified with. All tags are scanned again when it changes
+	// +optional
+	Verification string `json:"verification,omitempty"`
+	// Conditions holds the ScanFailed condition of the repository
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Profiles",type="integer",JSONPath=".status.profiles",description=""
+// +kubebuilder:printcolumn:name="Versions",type="integer",JSONPath=".status.versions",description=""
+// +kubebuilder:printcolumn:name="Last Scan",type="date",JSONPath=".status.lastScanTime",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
 
 // ProfileCatalogSource is the Schema for the ProfileCatalogSources API
 type ProfileCatalogSource struct {
@@ -93,6 +220,16 @@ type ProfileCatalogSource struct {
 	Status ProfileCatalogSourceStatus `json:"status,omitempty"`
 }
 
+// GetCatalogSourceSpec returns the spec of the catalog source.
+func (in *ProfileCatalogSource) GetCatalogSourceSpec() ProfileCatalogSourceSpec {
+	return in.Spec
+}
+
+// GetCatalogSourceStatus returns a pointer to the status of the catalog source.
+func (in *ProfileCatalogSource) GetCatalogSourceStatus() *ProfileCatalogSourceStatus {
+	return &in.Status
+}
+
 // +kubebuilder:object:root=true
 
 // ProfileCatalogSourceList contains a list of ProfileCatalogSource
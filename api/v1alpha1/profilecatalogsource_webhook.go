@@ -0,0 +1,162 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the validating webhook of ProfileCatalogSources with the manager.
+func (in *ProfileCatalogSource) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-weave-works-v1alpha1-profilecatalogsource,mutating=false,failurePolicy=fail,sideEffects=None,groups=weave.works,resources=profilecatalogsources,verbs=create;update,versions=v1alpha1,name=vprofilecatalogsource.weave.works,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ProfileCatalogSource{}
+
+// ValidateCreate validates the spec of a new ProfileCatalogSource.
+func (in *ProfileCatalogSource) ValidateCreate() error {
+	return invalid("ProfileCatalogSource", in.Name, validateCatalogSourceSpec(in.Spec, in.Namespace))
+}
+
+// ValidateUpdate validates the spec of an updated ProfileCatalogSource.
+func (in *ProfileCatalogSource) ValidateUpdate(old runtime.Object) error {
+	return invalid("ProfileCatalogSource", in.Name, validateCatalogSourceSpec(in.Spec, in.Namespace))
+}
+
+// ValidateDelete allows all deletions.
+func (in *ProfileCatalogSource) ValidateDelete() error {
+	return nil
+}
+
+// repositorySchemes are the URL schemes of repositories the catalog can scan.
+var repositorySchemes = []string{"https", "http", "ssh"}
+
+// validateCatalogSourceSpec validates the spec of a catalog source in the given namespace, which is
+// empty for cluster scoped catalog sources. Secrets of namespaced catalog sources are always in the
+// namespace of the catalog source, those of cluster scoped ones must name their namespace.
+func validateCatalogSourceSpec(spec ProfileCatalogSourceSpec, namespace string) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	if len(spec.Profiles) > 0 && len(spec.Repos) > 0 {
+		errs = append(errs, field.Forbidden(specPath.Child("repositories"), "profiles and repositories are mutually exclusive"))
+	}
+
+	seen := map[string]bool{}
+	for i, repo := range spec.Repos {
+		path := specPath.Child("repositories").Index(i)
+		errs = append(errs, validateURL(path.Child("url"), repo.URL, repositorySchemes)...)
+		if seen[repo.URL] {
+			errs = append(errs, field.Duplicate(path.Child("url"), repo.URL))
+		}
+		seen[repo.URL] = true
+		if repo.SecretRef != nil {
+			errs = append(errs, validateSecretNamespace(path.Child("secretRef", "namespace"), repo.SecretRef.Namespace, namespace)...)
+		}
+		errs = append(errs, validateAuthProvider(path, repo)...)
+		if repo.Verification != nil {
+			errs = append(errs, validateSecretNamespace(path.Child("verification", "secretRef", "namespace"), repo.Verification.SecretRef.Namespace, namespace)...)
+		}
+	}
+
+	seen = map[string]bool{}
+	for i, profile := range spec.Profiles {
+		path := specPath.Child("profiles").Index(i)
+		if profile.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), "the name of the profile must be set"))
+		}
+		if profile.URL != "" {
+			errs = append(errs, validateURL(path.Child("url"), profile.URL, repositorySchemes)...)
+		}
+		key := profile.Name + "/" + profile.Tag
+		if seen[key] {
+			errs = append(errs, field.Duplicate(path, fmt.Sprintf("profile %q with tag %q", profile.Name, profile.Tag)))
+		}
+		seen[key] = true
+	}
+	return errs
+}
+
+// validateSecretNamespace validates that the secret of a namespaced catalog source is in its
+// namespace, and that the secret of a cluster scoped catalog source names its namespace.
+func validateSecretNamespace(path *field.Path, secretNamespace, namespace string) field.ErrorList {
+	switch {
+	case namespace == "" && secretNamespace == "":
+		return field.ErrorList{field.Required(path, "the namespace of the secret of a cluster scoped catalog source must be set")}
+	case namespace != "" && secretNamespace != "" && secretNamespace != namespace:
+		return field.ErrorList{field.Forbidden(path, "the secret of a namespaced catalog source must be in the namespace of the catalog source")}
+	}
+	return nil
+}
+
+// validateAuthProvider validates that providers other than Generic have a secret to read the
+// credentials from, and that the provider supports the scheme of the URL of the repository.
+func validateAuthProvider(path *field.Path, repo Repository) field.ErrorList {
+	if repo.AuthProvider == "" || repo.AuthProvider == GenericAuthProvider {
+		return nil
+	}
+	var errs field.ErrorList
+	if repo.SecretRef == nil {
+		errs = append(errs, field.Required(path.Child("secretRef"), fmt.Sprintf("the %s auth provider requires a secret", repo.AuthProvider)))
+	}
+	u, err := url.Parse(repo.URL)
+	if err != nil {
+		return errs
+	}
+	if (repo.AuthProvider == SSHAuthProvider) != (u.Scheme == "ssh") {
+		errs = append(errs, field.Invalid(path.Child("authProvider"), repo.AuthProvider, fmt.Sprintf("the auth provider does not support %s URLs", u.Scheme)))
+	}
+	return errs
+}
+
+// validateURL returns an error unless rawURL is an absolute URL with one of the given schemes.
+func validateURL(path *field.Path, rawURL string, schemes []string) field.ErrorList {
+	if rawURL == "" {
+		return field.ErrorList{field.Required(path, "the URL must be set")}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, rawURL, err.Error())}
+	}
+	if u.Host == "" {
+		return field.ErrorList{field.Invalid(path, rawURL, "the URL must be absolute, for example https://github.com/weaveworks/profiles-examples")}
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(path, rawURL, schemes)}
+}
+
+// invalid returns an Invalid error for the object of the given kind if there are any errors.
+func invalid(kind, name string, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind(kind).GroupKind(), name, errs)
+}
@@ -52,6 +52,7 @@ type GitRepository struct {
 // Source defines the location of the profile
 type Source struct {
 	// URL is a fully qualified URL to a profile repo
+	// +required
 	URL string `json:"url,omitempty"`
 
 	// +kubebuilder:default:=main
@@ -75,9 +76,11 @@ type Catalog struct {
 	Version string `json:"version,omitempty"`
 
 	// Catalog defines the name of the catalog to get the profile from
+	// +required
 	Catalog string `json:"catalog,omitempty"`
 
 	// Profile defines the name of the profile
+	// +required
 	Profile string `json:"profile,omitempty"`
 }
 
@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	"github.com/fluxcd/pkg/version"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// DefaultBranch is the branch of a profile source which sets neither a branch nor a tag
+	DefaultBranch = "main"
+	// LatestVersion refers to the greatest version of a profile in a catalog
+	LatestVersion = "latest"
+)
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks of ProfileInstallations with the manager.
+func (in *ProfileInstallation) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-weave-works-v1alpha1-profileinstallation,mutating=true,failurePolicy=fail,sideEffects=None,groups=weave.works,resources=profileinstallations,verbs=create;update,versions=v1alpha1,name=mprofileinstallation.weave.works,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &ProfileInstallation{}
+
+// Default sets the branch of a source without branch or tag to main and its path to the directory
+// of a tag in the form <path>/<version>. The version of a catalog reference defaults to latest.
+func (in *ProfileInstallation) Default() {
+	if source := in.Spec.Source; source != nil {
+		if source.Branch == "" && source.Tag == "" {
+			source.Branch = DefaultBranch
+		}
+		if i := strings.LastIndex(source.Tag, "/"); source.Path == "" && i > 0 {
+			source.Path = source.Tag[:i]
+		}
+	}
+	if catalog := in.Spec.Catalog; catalog != nil && catalog.Version == "" {
+		catalog.Version = LatestVersion
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-weave-works-v1alpha1-profileinstallation,mutating=false,failurePolicy=fail,sideEffects=None,groups=weave.works,resources=profileinstallations,verbs=create;update,versions=v1alpha1,name=vprofileinstallation.weave.works,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ProfileInstallation{}
+
+// ValidateCreate validates the spec of a new ProfileInstallation.
+func (in *ProfileInstallation) ValidateCreate() error {
+	return invalid("ProfileInstallation", in.Name, validateInstallationSpec(in.Spec))
+}
+
+// ValidateUpdate validates the spec of an updated ProfileInstallation.
+func (in *ProfileInstallation) ValidateUpdate(old runtime.Object) error {
+	return invalid("ProfileInstallation", in.Name, validateInstallationSpec(in.Spec))
+}
+
+// ValidateDelete allows all deletions.
+func (in *ProfileInstallation) ValidateDelete() error {
+	return nil
+}
+
+// validateInstallationSpec validates that the spec installs a profile either from a source or from a catalog.
+func validateInstallationSpec(spec ProfileInstallationSpec) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+	switch {
+	case spec.Source == nil && spec.Catalog == nil:
+		errs = append(errs, field.Required(specPath, "one of source or catalog must be set"))
+	case spec.Source != nil && spec.Catalog != nil:
+		errs = append(errs, field.Forbidden(specPath.Child("catalog"), "source and catalog are mutually exclusive"))
+	}
+
+	if source := spec.Source; source != nil {
+		errs = append(errs, validateURL(specPath.Child("source", "url"), source.URL, repositorySchemes)...)
+	}
+
+	if catalog := spec.Catalog; catalog != nil {
+		path := specPath.Child("catalog")
+		if catalog.Catalog == "" {
+			errs = append(errs, field.Required(path.Child("catalog"), "the name of the catalog must be set"))
+		}
+		if catalog.Profile == "" {
+			errs = append(errs, field.Required(path.Child("profile"), "the name of the profile must be set"))
+		}
+		if catalog.Version != LatestVersion {
+			if _, err := version.ParseVersion(catalog.Version); err != nil {
+				errs = append(errs, field.Invalid(path.Child("version"), catalog.Version, "the version must be valid semver or latest"))
+			}
+		}
+	}
+	return errs
+}
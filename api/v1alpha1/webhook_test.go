@@ -0,0 +1,206 @@
+package v1alpha1_test
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+)
+
+// causes returns the fields of the causes of an Invalid error.
+func causes(err error) []string {
+	Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected an Invalid error, got %v", err)
+	var fields []string
+	for _, cause := range err.(apierrors.APIStatus).Status().Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	return fields
+}
+
+var _ = Describe("Webhooks", func() {
+	Describe("ProfileCatalogSource", func() {
+		var source *profilesv1.ProfileCatalogSource
+
+		BeforeEach(func() {
+			source = &profilesv1.ProfileCatalogSource{
+				ObjectMeta: metav1.ObjectMeta{Name: "catalog", Namespace: "default"},
+				Spec: profilesv1.ProfileCatalogSourceSpec{
+					Repos: []profilesv1.Repository{
+						{URL: "https://github.com/weaveworks/profiles-examples"},
+						{URL: "ssh://git@github.com/weaveworks/private-profiles", SecretRef: &meta.NamespacedObjectReference{Name: "git"}},
+					},
+				},
+			}
+		})
+
+		It("accepts a valid catalog source", func() {
+			Expect(source.ValidateCreate()).To(Succeed())
+			Expect(source.ValidateUpdate(source.DeepCopy())).To(Succeed())
+		})
+
+		It("rejects profiles and repositories in the same catalog source", func() {
+			source.Spec.Profiles = []profilesv1.ProfileCatalogEntry{{Name: "nginx", Tag: "v0.1.0"}}
+			Expect(causes(source.ValidateCreate())).To(ConsistOf("spec.repositories"))
+		})
+
+		It("rejects invalid and duplicate repository URLs", func() {
+			source.Spec.Repos = []profilesv1.Repository{
+				{URL: "github.com/weaveworks/profiles-examples"},
+				{URL: "ftp://github.com/weaveworks/profiles-examples"},
+				{URL: "https://github.com/weaveworks/profiles-examples"},
+				{URL: "https://github.com/weaveworks/profiles-examples"},
+				{},
+			}
+			Expect(causes(source.ValidateCreate())).To(ConsistOf(
+				"spec.repositories[0].url",
+				"spec.repositories[1].url",
+				"spec.repositories[3].url",
+				"spec.repositories[4].url",
+			))
+		})
+
+		It("requires a secret and a matching URL scheme for auth providers", func() {
+			source.Spec.Repos = []profilesv1.Repository{
+				{URL: "https://github.com/weaveworks/profiles-examples", AuthProvider: profilesv1.GenericAuthProvider},
+				{URL: "https://github.com/weaveworks/private-profiles", AuthProvider: profilesv1.GitHubAppAuthProvider, SecretRef: &meta.NamespacedObjectReference{Name: "github-app"}},
+				{URL: "https://gitlab.com/weaveworks/private-profiles", AuthProvider: profilesv1.TokenAuthProvider},
+				{URL: "https://github.com/weaveworks/ssh-profiles", AuthProvider: profilesv1.SSHAuthProvider, SecretRef: &meta.NamespacedObjectReference{Name: "git"}},
+				{URL: "ssh://git@github.com/weaveworks/token-profiles", AuthProvider: profilesv1.TokenAuthProvider, SecretRef: &meta.NamespacedObjectReference{Name: "token"}},
+			}
+			Expect(causes(source.ValidateCreate())).To(ConsistOf(
+				"spec.repositories[2].secretRef",
+				"spec.repositories[3].authProvider",
+				"spec.repositories[4].authProvider",
+			))
+		})
+
+		It("rejects profiles with the same name and tag", func() {
+			source.Spec.Repos = nil
+			source.Spec.Profiles = []profilesv1.ProfileCatalogEntry{
+				{Name: "nginx", Tag: "v0.1.0", URL: "https://github.com/weaveworks/nginx-profile"},
+				{Name: "nginx", Tag: "v0.2.0"},
+				{Name: "nginx", Tag: "v0.1.0"},
+				{Tag: "v0.1.0"},
+			}
+			Expect(causes(source.ValidateUpdate(source.DeepCopy()))).To(ConsistOf("spec.profiles[2]", "spec.profiles[3].name"))
+		})
+
+		It("rejects secrets in other namespaces", func() {
+			source.Spec.Repos[1].SecretRef.Namespace = "default"
+			source.Spec.Repos[0].Verification = &profilesv1.Verification{SecretRef: meta.NamespacedObjectReference{Name: "keys", Namespace: "default"}}
+			Expect(source.ValidateCreate()).To(Succeed())
+
+			source.Spec.Repos[1].SecretRef.Namespace = "profiles-system"
+			source.Spec.Repos[0].Verification.SecretRef.Namespace = "kube-system"
+			err := source.ValidateUpdate(source.DeepCopy())
+			Expect(causes(err)).To(ConsistOf(
+				"spec.repositories[1].secretRef.namespace",
+				"spec.repositories[0].verification.secretRef.namespace",
+			))
+			for _, cause := range err.(apierrors.APIStatus).Status().Details.Causes {
+				Expect(cause.Type).To(Equal(metav1.CauseType(field.ErrorTypeForbidden)))
+			}
+		})
+
+		It("allows deletion", func() {
+			source.Spec.Repos = []profilesv1.Repository{{}}
+			Expect(source.ValidateDelete()).To(Succeed())
+		})
+	})
+
+	Describe("ClusterProfileCatalogSource", func() {
+		It("requires the namespace of secrets", func() {
+			source := &profilesv1.ClusterProfileCatalogSource{
+				ObjectMeta: metav1.ObjectMeta{Name: "catalog"},
+				Spec: profilesv1.ProfileCatalogSourceSpec{
+					Repos: []profilesv1.Repository{
+						{URL: "ssh://git@github.com/weaveworks/private-profiles", SecretRef: &meta.NamespacedObjectReference{Name: "git"}},
+					},
+				},
+			}
+			Expect(causes(source.ValidateCreate())).To(ConsistOf("spec.repositories[0].secretRef.namespace"))
+
+			source.Spec.Repos[0].SecretRef.Namespace = "profiles-system"
+			Expect(source.ValidateCreate()).To(Succeed())
+
+			source.Spec.Repos[0].Verification = &profilesv1.Verification{SecretRef: meta.NamespacedObjectReference{Name: "keys"}}
+			Expect(causes(source.ValidateCreate())).To(ConsistOf("spec.repositories[0].verification.secretRef.namespace"))
+		})
+	})
+
+	Describe("ProfileInstallation", func() {
+		var installation *profilesv1.ProfileInstallation
+
+		BeforeEach(func() {
+			installation = &profilesv1.ProfileInstallation{
+				ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default"},
+			}
+		})
+
+		Describe("Default", func() {
+			It("defaults the branch of a source without tag", func() {
+				installation.Spec.Source = &profilesv1.Source{URL: "https://github.com/weaveworks/nginx-profile"}
+				installation.Default()
+				Expect(installation.Spec.Source.Branch).To(Equal("main"))
+				Expect(installation.Spec.Source.Path).To(BeEmpty())
+			})
+
+			It("defaults the path of a source to the directory of the tag", func() {
+				installation.Spec.Source = &profilesv1.Source{URL: "https://github.com/weaveworks/profiles-examples", Tag: "weaveworks-nginx/v0.1.0"}
+				installation.Default()
+				Expect(installation.Spec.Source.Branch).To(BeEmpty())
+				Expect(installation.Spec.Source.Path).To(Equal("weaveworks-nginx"))
+			})
+
+			It("keeps a set path", func() {
+				installation.Spec.Source = &profilesv1.Source{URL: "https://github.com/weaveworks/profiles-examples", Tag: "weaveworks-nginx/v0.1.0", Path: "profiles/nginx"}
+				installation.Default()
+				Expect(installation.Spec.Source.Path).To(Equal("profiles/nginx"))
+			})
+
+			It("defaults the version of a catalog reference to latest", func() {
+				installation.Spec.Catalog = &profilesv1.Catalog{Catalog: "nginx-catalog", Profile: "nginx"}
+				installation.Default()
+				Expect(installation.Spec.Catalog.Version).To(Equal("latest"))
+			})
+		})
+
+		Describe("validation", func() {
+			It("requires one of source or catalog", func() {
+				Expect(causes(installation.ValidateCreate())).To(ConsistOf("spec"))
+
+				installation.Spec.Source = &profilesv1.Source{URL: "https://github.com/weaveworks/nginx-profile"}
+				installation.Spec.Catalog = &profilesv1.Catalog{Catalog: "nginx-catalog", Profile: "nginx", Version: "latest"}
+				Expect(causes(installation.ValidateCreate())).To(ConsistOf("spec.catalog"))
+
+				installation.Spec.Catalog = nil
+				Expect(installation.ValidateCreate()).To(Succeed())
+			})
+
+			It("rejects an invalid source URL", func() {
+				installation.Spec.Source = &profilesv1.Source{URL: "nginx-profile"}
+				Expect(causes(installation.ValidateUpdate(installation.DeepCopy()))).To(ConsistOf("spec.source.url"))
+			})
+
+			It("accepts semver versions and latest", func() {
+				for _, version := range []string{"latest", "0.1.0", "v0.1.0", "v1.2.3-rc.1"} {
+					installation.Spec.Catalog = &profilesv1.Catalog{Catalog: "nginx-catalog", Profile: "nginx", Version: version}
+					Expect(installation.ValidateCreate()).To(Succeed(), version)
+				}
+			})
+
+			It("rejects incomplete catalog references", func() {
+				installation.Spec.Catalog = &profilesv1.Catalog{Version: "main"}
+				Expect(causes(installation.ValidateCreate())).To(ConsistOf(
+					"spec.catalog.catalog",
+					"spec.catalog.profile",
+					"spec.catalog.version",
+				))
+			})
+		})
+	})
+})
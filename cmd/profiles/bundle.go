@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/weaveworks/profiles/pkg/bundle"
+	"github.com/weaveworks/profiles/pkg/catalog"
+	"github.com/weaveworks/profiles/pkg/client"
+	"github.com/weaveworks/profiles/pkg/git"
+)
+
+// catalogExport writes the profiles listed by the catalog API to a bundle.
+func catalogExport(ctx context.Context, catalogClient client.Catalog, opts catalogOptions, stdout, stderr io.Writer) int {
+	entries, err := catalogClient.Search(ctx, "")
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	cat := catalog.New()
+	for _, entry := range entries {
+		cat.Append(types.NamespacedName{Namespace: entry.CatalogNamespace, Name: entry.CatalogSource}, entry)
+	}
+
+	file, err := os.Create(opts.file)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer file.Close()
+	// reading the repositories usually takes longer than the timeout of the API request
+	if err := bundle.New(&git.Client{}).Export(context.Background(), cat, file, bundle.ExportOptions{IncludeRepositories: opts.includeRepositories}); err != nil {
+		fmt.Fprintln(stderr, err)
+		_ = os.Remove(opts.file)
+		return 1
+	}
+	if err := file.Close(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "exported %d profiles to %s\n", len(entries), opts.file)
+	return 0
+}
+
+// catalogImportCmd prints the ProfileCatalogSource listing the profiles of a bundle and extracts its
+// repositories into the mirror directory.
+func catalogImportCmd(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("catalog import", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	opts := bundle.ImportOptions{}
+	flags.StringVar(&opts.Name, "name", "imported-catalog", "The name of the ProfileCatalogSource.")
+	flags.StringVar(&opts.Namespace, "namespace", "default", "The namespace of the ProfileCatalogSource.")
+	flags.StringVar(&opts.MirrorDir, "mirror-dir", "", "The directory the repositories of the bundle are extracted to. Repositories are not extracted if empty.")
+	flags.StringVar(&opts.MirrorURL, "mirror-url", "", "The URL the mirror directory is served at, which the profiles are installed from. Defaults to the mirror directory.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: profiles catalog import [flags] <bundle>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer file.Close()
+	source, err := bundle.New(&git.Client{}).Import(file, opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	data, err := yaml.Marshal(source)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "---\n%s", data)
+	return 0
+}
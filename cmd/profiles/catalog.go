@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/client"
+)
+
+const catalogUsage = `Usage: profiles catalog <command> [flags] [args]
+
+Commands:
+  search [name]                             List the profiles whose name contains name
+  show <catalog>/<profile>[/<version>]      Show a profile, the latest version by default
+  versions <catalog>/<profile>              List the versions of a profile
+  updates <catalog>/<profile>/<version>     List the versions of a profile greater than version
+  export [--file <bundle>]                  Export the profiles of the catalog to a bundle for air-gapped clusters
+  import [flags] <bundle>                   Print a ProfileCatalogSource listing the profiles of a bundle
+
+By default the catalog API is called through the Kubernetes API server proxy of its service, so it
+needs no port-forward. Use --address to call the gRPC API directly instead.
+`
+
+// catalogOptions configure the connection to the catalog and the output.
+type catalogOptions struct {
+	output     string
+	namespace  string
+	timeout    time.Duration
+	address    string
+	insecure   bool
+	caFile     string
+	token      string
+	kubeconfig string
+	context    string
+	service    string
+	// verified restricts the search command to verified profiles
+	verified bool
+	// file and includeRepositories configure the bundle of the export command
+	file                string
+	includeRepositories bool
+}
+
+// catalogCmd runs one of the commands querying the catalog API.
+func catalogCmd(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, catalogUsage)
+		return 2
+	}
+	command := args[0]
+	switch command {
+	case "search", "show", "versions", "updates", "export":
+	case "import":
+		return catalogImportCmd(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, catalogUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown catalog command %q\n%s", command, catalogUsage)
+		return 2
+	}
+
+	var opts catalogOptions
+	flags := flag.NewFlagSet("catalog "+command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.output, "output", "table", "The output format, one of table, json or yaml.")
+	flags.StringVar(&opts.namespace, "namespace", "", "The namespace of the catalog sources. Defaults to all namespaces visible to the caller.")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "The timeout of the request.")
+	flags.StringVar(&opts.address, "address", "", "The host:port of the gRPC API of the catalog. If empty, the Kubernetes API server proxy is used.")
+	flags.BoolVar(&opts.insecure, "insecure", false, "Connect to the gRPC API without TLS.")
+	flags.StringVar(&opts.caFile, "ca-file", "", "The CA certificate to verify the gRPC API with. Defaults to the system roots.")
+	flags.StringVar(&opts.token, "token", "", "The bearer token to authenticate to the gRPC API with. Requires --address.")
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "The kubeconfig of the Kubernetes API server proxy. Defaults to the standard locations.")
+	flags.StringVar(&opts.context, "context", "", "The kubeconfig context of the Kubernetes API server proxy.")
+	flags.StringVar(&opts.service, "service", "profiles-system/profiles-catalog-service:http",
+		"The <namespace>/<name>[:<port>] of the service of the catalog API, called through the Kubernetes API server proxy.")
+	if command == "search" {
+		flags.BoolVar(&opts.verified, "verified", false, "Only list profiles whose tag or commit is signed by a trusted key of their repository.")
+	}
+	if command == "export" {
+		flags.StringVar(&opts.file, "file", "catalog.tar.gz", "The file the bundle is written to.")
+		flags.BoolVar(&opts.includeRepositories, "include-repositories", false,
+			"Add a mirror of the tagged commits of the profile repositories to the bundle, so they can be installed without access to the repositories.")
+	}
+	flags.Usage = func() {
+		fmt.Fprint(stderr, catalogUsage)
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if opts.output != "table" && opts.output != "json" && opts.output != "yaml" {
+		fmt.Fprintf(stderr, "unsupported output %q, must be table, json or yaml\n", opts.output)
+		return 2
+	}
+
+	var ref []string
+	ok := true
+	switch command {
+	case "export":
+		if flags.NArg() > 0 {
+			flags.Usage()
+			return 2
+		}
+	case "search":
+		if flags.NArg() > 1 {
+			flags.Usage()
+			return 2
+		}
+	case "show":
+		ref, ok = parseProfileRef(flags, 2, 3)
+	case "versions":
+		ref, ok = parseProfileRef(flags, 2, 2)
+	case "updates":
+		ref, ok = parseProfileRef(flags, 3, 3)
+	}
+	if !ok {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	catalog, closeCatalog, err := connectCatalog(ctx, opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer closeCatalog()
+
+	if command == "export" {
+		return catalogExport(ctx, catalog, opts, stdout, stderr)
+	}
+
+	var response interface{}
+	var entries []profilesv1.ProfileCatalogEntry
+	switch {
+	case command == "search":
+		var searchOpts []client.SearchOption
+		if opts.verified {
+			searchOpts = append(searchOpts, client.Verified())
+		}
+		entries, err = catalog.Search(ctx, flags.Arg(0), searchOpts...)
+		response = catalogItems{Items: entries}
+	case command == "show":
+		var entry *profilesv1.ProfileCatalogEntry
+		if len(ref) == 2 {
+			entry, err = catalog.Get(ctx, ref[0], ref[1])
+		} else {
+			entry, err = catalog.GetWithVersion(ctx, ref[0], ref[1], ref[2])
+		}
+		if entry != nil {
+			response, entries = catalogItem{Item: *entry}, []profilesv1.ProfileCatalogEntry{*entry}
+		}
+	case command == "versions":
+		var found []profilesv1.ProfileCatalogEntry
+		found, err = catalog.Search(ctx, ref[1])
+		// search matches profiles whose name contains the name, keep the versions of the profile
+		for _, entry := range found {
+			if entry.CatalogSource == ref[0] && entry.Name == ref[1] {
+				entries = append(entries, entry)
+			}
+		}
+		sortByVersion(entries)
+		response = catalogItems{Items: entries}
+	case command == "updates":
+		entries, err = catalog.ProfilesGreaterThanVersion(ctx, ref[0], ref[1], ref[2])
+		sortByVersion(entries)
+		response = catalogItems{Items: entries}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if err := printCatalogResponse(stdout, opts.output, command, response, entries); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// catalogItems is the json and yaml output of commands listing profiles.
+type catalogItems struct {
+	Items []profilesv1.ProfileCatalogEntry `json:"items"`
+}
+
+// catalogItem is the json and yaml output of the show command.
+type catalogItem struct {
+	Item profilesv1.ProfileCatalogEntry `json:"item"`
+}
+
+// parseProfileRef parses the single argument <catalog>/<profile>[/<version>] into between min and max parts.
+func parseProfileRef(flags *flag.FlagSet, min, max int) ([]string, bool) {
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return nil, false
+	}
+	parts := strings.Split(flags.Arg(0), "/")
+	for _, part := range parts {
+		if part == "" {
+			parts = nil
+		}
+	}
+	if len(parts) < min || len(parts) > max {
+		fmt.Fprintf(flags.Output(), "invalid profile reference %q\n", flags.Arg(0))
+		flags.Usage()
+		return nil, false
+	}
+	return parts, true
+}
+
+// connectCatalog returns a client of the catalog API, either over gRPC or through the Kubernetes API server proxy.
+func connectCatalog(ctx context.Context, opts catalogOptions) (*client.Client, func(), error) {
+	if opts.address == "" {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = opts.kubeconfig
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: opts.context}).ClientConfig()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
+		parts := strings.Split(opts.service, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, fmt.Errorf("invalid service %q, must be <namespace>/<name>[:<port>]", opts.service)
+		}
+		nameAndPort := strings.SplitN(parts[1], ":", 2)
+		port := ""
+		if len(nameAndPort) == 2 {
+			port = nameAndPort[1]
+		}
+		if opts.token != "" {
+			return nil, nil, fmt.Errorf("--token requires --address, the Kubernetes API server proxy doesn't forward tokens to the catalog API")
+		}
+		service, err := client.NewServiceProxyProfilesServiceClient(config, parts[0], nameAndPort[0], port)
+		if err != nil {
+			return nil, nil, err
+		}
+		catalog, err := client.New(service, client.WithNamespace(opts.namespace))
+		return catalog, func() {}, err
+	}
+
+	clientOpts := []client.Option{client.WithNamespace(opts.namespace), client.WithToken(opts.token), client.WithDialOptions(grpc.WithBlock())}
+	if opts.insecure {
+		clientOpts = append(clientOpts, client.WithInsecure())
+	} else if opts.caFile != "" {
+		ca, err := ioutil.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: x509.NewCertPool()}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", opts.caFile)
+		}
+		clientOpts = append(clientOpts, client.WithTLS(tlsConfig))
+	}
+	catalog, err := client.Dial(ctx, opts.address, clientOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return catalog, func() { _ = catalog.Close() }, nil
+}
+
+// sortByVersion sorts the entries by their version, greatest first. Entries without a semver version go last.
+func sortByVersion(entries []profilesv1.ProfileCatalogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		vi, erri := semver.NewVersion(profilesv1.GetVersionFromTag(entries[i].Tag))
+		vj, errj := semver.NewVersion(profilesv1.GetVersionFromTag(entries[j].Tag))
+		if erri != nil || errj != nil {
+			return erri == nil
+		}
+		return vi.GreaterThan(vj)
+	})
+}
+
+// printCatalogResponse prints the response as JSON or YAML, or its entries as a table.
+func printCatalogResponse(w io.Writer, output, command string, response interface{}, entries []profilesv1.ProfileCatalogEntry) error {
+	switch output {
+	case "json", "yaml":
+		data, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return err
+		}
+		if output == "yaml" {
+			if data, err = yaml.JSONToYAML(data); err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	if command == "show" {
+		entry := entries[0]
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "Name:\t%s\n", entry.Name)
+		fmt.Fprintf(tw, "Version:\t%s\n", profilesv1.GetVersionFromTag(entry.Tag))
+		fmt.Fprintf(tw, "Catalog:\t%s\n", entry.CatalogSource)
+		fmt.Fprintf(tw, "Namespace:\t%s\n", entry.CatalogNamespace)
+		fmt.Fprintf(tw, "Scope:\t%s\n", entry.CatalogScope)
+		fmt.Fprintf(tw, "URL:\t%s\n", entry.URL)
+		fmt.Fprintf(tw, "Tag:\t%s\n", entry.Tag)
+		fmt.Fprintf(tw, "Description:\t%s\n", entry.Description)
+		fmt.Fprintf(tw, "Maintainer:\t%s\n", entry.Maintainer)
+		fmt.Fprintf(tw, "Prerequisites:\t%s\n", strings.Join(entry.Prerequisites, ", "))
+		return tw.Flush()
+	}
+
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "No profiles found")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CATALOG\tNAMESPACE\tPROFILE\tVERSION\tDESCRIPTION")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.CatalogSource, entry.CatalogNamespace, entry.Name,
+			profilesv1.GetVersionFromTag(entry.Tag), entry.Description)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,253 @@
+package main_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+const proxyPath = "/api/v1/namespaces/profiles-system/services/profiles-catalog-service:http/proxy"
+
+var _ = Describe("catalog", func() {
+	var (
+		server     *httptest.Server
+		kubeconfig string
+		responses  map[string]string
+		paths      []string
+	)
+
+	BeforeEach(func() {
+		paths = nil
+		responses = map[string]string{
+			"/v1/profiles": `{"items":[
+				{"tag":"nginx/v0.1.0","catalogSource":"nginx-catalog","catalogNamespace":"default","name":"nginx","description":"nginx 1"},
+				{"tag":"nginx/v0.2.0","catalogSource":"nginx-catalog","catalogNamespace":"default","name":"nginx","description":"nginx 2"},
+				{"tag":"nginx-extra/v1.0.0","catalogSource":"nginx-catalog","catalogNamespace":"default","name":"nginx-extra"}]}`,
+			"/v1/profiles/nginx-catalog/nginx": `{"item":{"tag":"nginx/v0.2.0","catalogSource":"nginx-catalog","name":"nginx",
+				"url":"https://github.com/weaveworks/profiles-examples","maintainer":"weaveworks","prerequisites":["kubernetes 1.19"]}}`,
+			"/v1/profiles/nginx-catalog/nginx/v0.1.0/available_updates": `{"items":[
+				{"tag":"nginx/v0.2.0","catalogSource":"nginx-catalog","name":"nginx"},
+				{"tag":"nginx/v0.10.0","catalogSource":"nginx-catalog","name":"nginx"}]}`,
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.RequestURI())
+			response, ok := responses[strings.TrimPrefix(r.URL.Path, proxyPath)]
+			if !strings.HasPrefix(r.URL.Path, proxyPath) || !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","message":"profile not found"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(response))
+		}))
+
+		dir, err := ioutil.TempDir("", "kubeconfig")
+		Expect(err).NotTo(HaveOccurred())
+		kubeconfig = filepath.Join(dir, "config")
+		Expect(ioutil.WriteFile(kubeconfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: kube-token
+`, server.URL)), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Expect(os.RemoveAll(filepath.Dir(kubeconfig))).To(Succeed())
+	})
+
+	It("searches profiles through the service proxy", func() {
+		session := runCmd("catalog", "search", "--kubeconfig", kubeconfig, "--namespace", "default", "nginx")
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`CATALOG\s+NAMESPACE\s+PROFILE\s+VERSION\s+DESCRIPTION`))
+		Expect(session.Out).To(gbytes.Say(`nginx-catalog\s+default\s+nginx\s+v0.1.0\s+nginx 1`))
+		Expect(session.Out).To(gbytes.Say(`nginx-catalog\s+default\s+nginx-extra\s+v1.0.0`))
+		Expect(paths).To(ConsistOf(proxyPath + "/v1/profiles?name=nginx&namespace=default"))
+	})
+
+	It("shows a profile", func() {
+		session := runCmd("catalog", "show", "--kubeconfig", kubeconfig, "nginx-catalog/nginx")
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`Name:\s+nginx\n`))
+		Expect(session.Out).To(gbytes.Say(`Version:\s+v0.2.0\n`))
+		Expect(session.Out).To(gbytes.Say(`URL:\s+https://github.com/weaveworks/profiles-examples\n`))
+		Expect(session.Out).To(gbytes.Say(`Prerequisites:\s+kubernetes 1.19\n`))
+	})
+
+	It("prints the response as json and yaml", func() {
+		session := runCmd("catalog", "show", "--kubeconfig", kubeconfig, "--output", "json", "nginx-catalog/nginx")
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`"item":\s+\{`))
+		Expect(session.Out).To(gbytes.Say(`"tag":\s+"nginx/v0.2.0"`))
+
+		session = runCmd("catalog", "show", "--kubeconfig", kubeconfig, "--output", "yaml", "nginx-catalog/nginx")
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`item:\n`))
+		Expect(session.Out).To(gbytes.Say(`  tag: nginx/v0.2.0\n`))
+	})
+
+	It("lists the versions of a profile, greatest first", func() {
+		session := runCmd("catalog", "versions", "--kubeconfig", kubeconfig, "nginx-catalog/nginx")
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`nginx\s+v0.2.0`))
+		Expect(session.Out).To(gbytes.Say(`nginx\s+v0.1.0`))
+		Expect(session.Out).NotTo(gbytes.Say(`nginx-extra`))
+	})
+
+	It("lists the available updates of a profile", func() {
+		session := runCmd("catalog", "updates", "--kubeconfig", kubeconfig, "nginx-catalog/nginx/v0.1.0")
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`nginx\s+v0.10.0`))
+		Expect(session.Out).To(gbytes.Say(`nginx\s+v0.2.0`))
+	})
+
+	When("the profile does not exist", func() {
+		It("fails", func() {
+			session := runCmd("catalog", "show", "--kubeconfig", kubeconfig, "nginx-catalog/unknown")
+			Eventually(session, 20).Should(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say(`code = NotFound desc = profile not found`))
+		})
+	})
+
+	When("the arguments are invalid", func() {
+		It("fails without calling the catalog", func() {
+			session := runCmd("catalog", "updates", "--kubeconfig", kubeconfig, "nginx-catalog/nginx")
+			Eventually(session, 20).Should(gexec.Exit(2))
+			Expect(session.Err).To(gbytes.Say(`invalid profile reference "nginx-catalog/nginx"`))
+
+			session = runCmd("catalog", "search", "--kubeconfig", kubeconfig, "--token", "my-token")
+			Eventually(session, 20).Should(gexec.Exit(2))
+			Expect(session.Err).To(gbytes.Say(`--token requires --address`))
+
+			session = runCmd("catalog", "list")
+			Eventually(session, 20).Should(gexec.Exit(2))
+			Expect(session.Err).To(gbytes.Say(`unknown catalog command "list"`))
+			Expect(paths).To(BeEmpty())
+		})
+	})
+
+	When("the catalog is exported", func() {
+		var repoDir string
+
+		BeforeEach(func() {
+			repoDir = filepath.Join(filepath.Dir(kubeconfig), "profiles-examples")
+			createRepository(repoDir, "testdata/nginx/profile.yaml", "nginx/v0.1.0")
+			responses["/v1/profiles"] = fmt.Sprintf(`{"items":[{"tag":"nginx/v0.1.0","catalogSource":"nginx-catalog","catalogNamespace":"default","name":"nginx","url":%q}]}`, repoDir)
+		})
+
+		It("imports the bundle", func() {
+			bundleFile := filepath.Join(filepath.Dir(kubeconfig), "catalog.tar.gz")
+			session := runCmd("catalog", "export", "--kubeconfig", kubeconfig, "--file", bundleFile, "--include-repositories")
+			Eventually(session, 20).Should(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say("exported 1 profiles to " + bundleFile))
+
+			mirrorDir := filepath.Join(filepath.Dir(kubeconfig), "mirror")
+			session = runCmd("catalog", "import", "--name", "offline", "--namespace", "team-a", "--mirror-dir", mirrorDir,
+				"--mirror-url", "http://git-mirror", bundleFile)
+			Eventually(session, 20).Should(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say("kind: ProfileCatalogSource\nmetadata:\n.*\n  name: offline\n  namespace: team-a\nspec:\n  profiles:\n"))
+			Expect(session.Out).To(gbytes.Say("tag: nginx/v0.1.0\n"))
+			Expect(session.Out).To(gbytes.Say("url: http://git-mirror/"))
+			Expect(filepath.Glob(filepath.Join(mirrorDir, "*.git", "HEAD"))).To(HaveLen(1))
+		})
+	})
+
+	When("the address of the gRPC api is set", func() {
+		var (
+			grpcServer *grpc.Server
+			address    string
+			catalog    *grpcCatalog
+		)
+
+		BeforeEach(func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			address = listener.Addr().String()
+			catalog = &grpcCatalog{}
+			grpcServer = grpc.NewServer()
+			protos.RegisterProfilesServiceServer(grpcServer, catalog)
+			go func() {
+				_ = grpcServer.Serve(listener)
+			}()
+		})
+
+		AfterEach(func() {
+			grpcServer.Stop()
+		})
+
+		It("calls the gRPC api", func() {
+			session := runCmd("catalog", "search", "--address", address, "--insecure", "--token", "my-token", "--verified", "nginx")
+			Eventually(session, 20).Should(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say(`nginx-catalog\s+default\s+nginx\s+v0.1.0`))
+			Expect(catalog.name).To(Equal("nginx"))
+			Expect(catalog.verified).To(BeTrue())
+			Expect(catalog.authorization).To(ConsistOf("Bearer my-token"))
+			Expect(paths).To(BeEmpty())
+		})
+	})
+})
+
+// grpcCatalog records the search request and its authorization metadata.
+type grpcCatalog struct {
+	protos.UnimplementedProfilesServiceServer
+	name          string
+	verified      bool
+	authorization []string
+}
+
+func (c *grpcCatalog) Search(ctx context.Context, in *protos.SearchRequest) (*protos.SearchResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.name, c.verified, c.authorization = in.Name, in.Verified, md.Get("authorization")
+	return &protos.SearchResponse{Items: []*protos.ProfileCatalogEntry{
+		{Tag: "nginx/v0.1.0", CatalogSource: "nginx-catalog", CatalogNamespace: "default", Name: "nginx"},
+	}}, nil
+}
+
+// createRepository creates a repository with the profile definition in the nginx directory and the tag.
+func createRepository(dir, profile, tag string) {
+	data, err := ioutil.ReadFile(profile)
+	Expect(err).NotTo(HaveOccurred())
+	repo, err := extgogit.PlainInit(dir, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.MkdirAll(filepath.Join(dir, "nginx"), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(dir, "nginx", "profile.yaml"), data, 0644)).To(Succeed())
+	worktree, err := repo.Worktree()
+	Expect(err).NotTo(HaveOccurred())
+	_, err = worktree.Add("nginx/profile.yaml")
+	Expect(err).NotTo(HaveOccurred())
+	hash, err := worktree.Commit("add nginx", &extgogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = repo.CreateTag(tag, hash, nil)
+	Expect(err).NotTo(HaveOccurred())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/weaveworks/profiles/pkg/validate"
+)
+
+const usage = `Usage: profiles <command> [flags] [args]
+
+Commands:
+  validate <profile.yaml>                               Validate the semantics of a profile definition
+  render <profile.yaml | catalog/profile[/version]>     Print the Flux objects which install a profile
+  catalog <search|show|versions|updates|export|import>  Query, export and import the profiles catalog
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command given by args and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "validate":
+		return validateCmd(args[1:], stdout, stderr)
+	case "render":
+		return renderCmd(args[1:], stdout, stderr)
+	case "catalog":
+		return catalogCmd(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// validateCmd validates a profile definition and prints the findings. It exits with 1 if any of
+// the findings is an error.
+func validateCmd(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("output", "text", "The format of the findings, either text or json.")
+	dir := flags.String("repo-dir", "",
+		"The directory of the profile in a checkout of the profile repository, which local artifact paths are resolved against. "+
+			"Defaults to the directory of the profile definition.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: profiles validate [flags] <profile.yaml>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(stderr, "unsupported output %q, must be text or json\n", *output)
+		return 2
+	}
+
+	path := flags.Arg(0)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *dir == "" {
+		*dir = filepath.Dir(path)
+	}
+	findings := validate.Bytes(data, validate.Options{Dir: *dir})
+
+	if *output == "json" {
+		if findings == nil {
+			findings = validate.Findings{}
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(findings); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Fprintln(stdout, finding)
+		}
+		if len(findings) == 0 {
+			fmt.Fprintf(stdout, "%s is valid\n", path)
+		}
+	}
+
+	if findings.HasErrors() {
+		return 1
+	}
+	return 0
+}
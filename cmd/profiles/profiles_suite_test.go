@@ -0,0 +1,28 @@
+package main_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var (
+	cliBin string
+)
+
+func TestProfiles(t *testing.T) {
+	RegisterFailHandler(Fail)
+	BeforeSuite(func() {
+		var err error
+		cliBin, err = gexec.Build("github.com/weaveworks/profiles/cmd/profiles")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterSuite(func() {
+		gexec.CleanupBuildArtifacts()
+	})
+
+	RunSpecs(t, "Profiles Suite")
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/client"
+	"github.com/weaveworks/profiles/pkg/git"
+	"github.com/weaveworks/profiles/pkg/mirror"
+	"github.com/weaveworks/profiles/pkg/render"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// renderCmd prints the Flux objects which install a local profile definition or a profile listed
+// in a catalog.
+func renderCmd(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	name := flags.String("name", "", "The name of the installation. Defaults to the name of the profile.")
+	namespace := flags.String("namespace", "default", "The namespace of the installation.")
+	source := profilesv1.Source{}
+	flags.StringVar(&source.URL, "url", "", "The URL of the repository of a local profile definition, which artifacts local to the repository are installed from.")
+	flags.StringVar(&source.Branch, "branch", "", "The branch of the repository of a local profile definition.")
+	flags.StringVar(&source.Tag, "tag", "", "The tag of the repository of a local profile definition.")
+	flags.StringVar(&source.Path, "path", "", "The directory of a local profile definition in its repository.")
+	valuesFile := flags.String("values", "", "A ConfigMap with values of the chart artifacts, keyed by artifact name.")
+	gitRepository := flags.String("git-repository", render.DefaultGitRepositoryNamespace+"/"+render.DefaultGitRepositoryName,
+		"The <namespace>/<name> of the GitRepository of the GitOps repository the installation is committed to.")
+	catalogURL := flags.String("catalog-url", "http://localhost:8000", "The URL of the profiles catalog API.")
+	token := flags.String("token", "", "The bearer token to authenticate to the profiles catalog API with.")
+	mirrorURL := flags.String("git-mirror-url", "", "The URL of the git mirror of the catalog controller to fetch the profile repositories from instead of the original repositories. "+
+		"Without it, profiles of the catalog are fetched from the mirror the catalog lists for them.")
+	authProvider := flags.String("git-auth-provider", profilesv1.GenericAuthProvider, "The provider of the credentials the profile repositories are fetched with, one of Generic, Token, GitHubApp or SSH.")
+	credentialsFile := flags.String("git-credentials", "", "A Secret with the credentials the profile repositories are fetched with, in the fields the auth provider reads.")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: profiles render [flags] <profile.yaml | catalog/profile[/version]>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	gitRepositoryParts := strings.Split(*gitRepository, "/")
+	if len(gitRepositoryParts) != 2 {
+		fmt.Fprintf(stderr, "invalid git repository %q, must be <namespace>/<name>\n", *gitRepository)
+		return 2
+	}
+
+	auth, err := gitAuthProvider(*authProvider, *credentialsFile)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	ctx := context.Background()
+	loader := &git.Client{Auth: auth}
+	installation := &profilesv1.ProfileInstallation{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ProfileInstallation",
+			APIVersion: profilesv1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      *name,
+			Namespace: *namespace,
+		},
+		Spec: profilesv1.ProfileInstallationSpec{
+			GitRepository: &profilesv1.GitRepository{Namespace: gitRepositoryParts[0], Name: gitRepositoryParts[1]},
+		},
+	}
+
+	var def *profilesv1.ProfileDefinition
+	var opts []render.Option
+	ref := flags.Arg(0)
+	if _, err := os.Stat(ref); err == nil {
+		data, err := ioutil.ReadFile(ref)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		def = &profilesv1.ProfileDefinition{}
+		if err := yaml.Unmarshal(data, def); err != nil {
+			fmt.Fprintf(stderr, "failed to decode %s: %s\n", ref, err)
+			return 2
+		}
+		if source.URL != "" {
+			installation.Spec.Source = &source
+		}
+	} else {
+		catalog, err := parseCatalogRef(ref)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s is neither a profile definition nor a catalog reference: %s\n", ref, err)
+			return 2
+		}
+		entry, err := getCatalogEntry(ctx, *catalogURL, *token, catalog)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		installation.Spec.Source = &profilesv1.Source{URL: entry.URL, Tag: entry.Tag}
+		if *mirrorURL == "" && entry.MirrorURL != "" {
+			opts = append(opts, render.WithRepositoryMirror(entry.URL, entry.MirrorURL))
+		}
+		installation.Default()
+		mirrored := *installation.Spec.Source
+		mirrored.URL = mirror.RepositoryURL(*mirrorURL, mirrored.URL)
+		def, err = loader.GetProfileDefinition(ctx, mirrored)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	if installation.Name == "" {
+		installation.Name = def.Name
+	}
+
+	var values *corev1.ConfigMap
+	if *valuesFile != "" {
+		data, err := ioutil.ReadFile(*valuesFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		values = &corev1.ConfigMap{}
+		if err := yaml.Unmarshal(data, values); err != nil {
+			fmt.Fprintf(stderr, "failed to decode %s: %s\n", *valuesFile, err)
+			return 2
+		}
+		if values.Namespace == "" {
+			values.Namespace = installation.Namespace
+		}
+		installation.Spec.ConfigMap = values.Name
+	}
+
+	objects, err := render.New(loader, append(opts, render.WithMirrorURL(*mirrorURL))...).Render(ctx, installation, def, values)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	documents := []interface{}{}
+	if values != nil {
+		documents = append(documents, values)
+	}
+	for _, obj := range objects {
+		documents = append(documents, obj)
+	}
+	for _, document := range documents {
+		data, err := yaml.Marshal(document)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "---\n%s", data)
+	}
+	return 0
+}
+
+// gitAuthProvider returns the auth provider reading the credentials from the Secret in the file, or
+// fetching the repositories anonymously if file is empty.
+func gitAuthProvider(provider, file string) (git.AuthProvider, error) {
+	var secret *corev1.Secret
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{}
+		if err := yaml.Unmarshal(data, secret); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+		}
+		// the API server merges stringData into data, the file isn't applied
+		for key, value := range secret.StringData {
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[key] = []byte(value)
+		}
+	}
+	auth, err := git.NewAuthProvider(provider, secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git credentials: %w", err)
+	}
+	return auth, nil
+}
+
+// parseCatalogRef parses a reference of the form catalog/profile[/version], the version defaults to latest.
+func parseCatalogRef(ref string) (profilesv1.Catalog, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return profilesv1.Catalog{}, fmt.Errorf("expected catalog/profile[/version]")
+	}
+	catalog := profilesv1.Catalog{Catalog: parts[0], Profile: parts[1], Version: profilesv1.LatestVersion}
+	if len(parts) == 3 && parts[2] != "" {
+		catalog.Version = parts[2]
+	}
+	return catalog, nil
+}
+
+// getCatalogEntry gets the catalog entry of the profile version from the profiles catalog API.
+func getCatalogEntry(ctx context.Context, catalogURL, token string, catalog profilesv1.Catalog) (*profilesv1.ProfileCatalogEntry, error) {
+	catalogClient, err := client.New(client.NewHTTPProfilesServiceClient(catalogURL, nil), client.WithToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *profilesv1.ProfileCatalogEntry
+	if catalog.Version == profilesv1.LatestVersion {
+		entry, err = catalogClient.Get(ctx, catalog.Catalog, catalog.Profile)
+	} else {
+		entry, err = catalogClient.GetWithVersion(ctx, catalog.Catalog, catalog.Profile, catalog.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile %s/%s from the catalog: %w", catalog.Catalog, catalog.Profile, err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,84 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("render", func() {
+	It("prints the Flux objects of a local profile definition", func() {
+		session := runCmd("render",
+			"--name", "my-nginx",
+			"--namespace", "team-a",
+			"--url", "https://github.com/weaveworks/profiles-examples",
+			"--tag", "nginx/v0.1.0",
+			"--values", "testdata/values.yaml",
+			"testdata/nginx/profile.yaml",
+		)
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("kind: ConfigMap\nmetadata:\n.*\n  name: nginx-values\n  namespace: team-a"))
+		Expect(session.Out).To(gbytes.Say("kind: HelmRepository\nmetadata:\n.*\n  name: my-nginx-chart"))
+		Expect(session.Out).To(gbytes.Say("kind: HelmRelease\nmetadata:\n.*\n  name: my-nginx-chart"))
+		Expect(session.Out).To(gbytes.Say("valuesKey: chart"))
+		Expect(session.Out).To(gbytes.Say("kind: Kustomization\nmetadata:\n.*\n  name: my-nginx-chart"))
+		Expect(session.Out).To(gbytes.Say("kind: GitRepository\nmetadata:\n.*\n  name: my-nginx-profiles-examples-nginx-v0-1-0"))
+		Expect(session.Out).To(gbytes.Say("kind: Kustomization\nmetadata:\n.*\n  name: my-nginx-config"))
+		Expect(session.Out).To(gbytes.Say("path: nginx/config"))
+	})
+
+	When("a local artifact has no source URL", func() {
+		It("fails", func() {
+			session := runCmd("render", "testdata/nginx/profile.yaml")
+			Eventually(session, 20).Should(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say(`artifact "config" is local to the profile repository`))
+		})
+	})
+
+	When("the catalog does not list the profile", func() {
+		var (
+			server      *httptest.Server
+			path, authz string
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path, authz = r.URL.Path, r.Header.Get("Authorization")
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"code":5,"message":"profile not found"}`))
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("fails", func() {
+			session := runCmd("render", "--catalog-url", server.URL, "--token", "secret", "nginx-catalog/nginx/v0.2.0")
+			Eventually(session, 20).Should(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say("failed to get profile nginx-catalog/nginx from the catalog: rpc error: code = NotFound"))
+			Expect(path).To(Equal("/v1/profiles/nginx-catalog/nginx/v0.2.0"))
+			Expect(authz).To(Equal("Bearer secret"))
+		})
+	})
+
+	When("the git credentials are incomplete", func() {
+		It("fails", func() {
+			session := runCmd("render", "--git-auth-provider", "GitHubApp", "--git-credentials", "testdata/github-app.yaml", "testdata/nginx/profile.yaml")
+			Eventually(session, 20).Should(gexec.Exit(2))
+			Expect(session.Err).To(gbytes.Say("invalid git credentials: secret /github-app has no valid privateKey field"))
+		})
+	})
+
+	When("the argument is neither a file nor a catalog reference", func() {
+		It("fails", func() {
+			session := runCmd("render", "missing.yaml")
+			Eventually(session, 20).Should(gexec.Exit(2))
+			Expect(session.Err).To(gbytes.Say("missing.yaml is neither a profile definition nor a catalog reference"))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/weaveworks/profiles/pkg/validate"
+)
+
+var _ = Describe("validate", func() {
+	It("accepts a valid profile definition", func() {
+		session := runCmd("validate", "testdata/nginx/profile.yaml")
+		Eventually(session, 20).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("testdata/nginx/profile.yaml is valid"))
+	})
+
+	It("prints the findings of an invalid profile definition and fails", func() {
+		session := runCmd("validate", "testdata/invalid/profile.yaml")
+		Eventually(session, 20).Should(gexec.Exit(1))
+		Expect(session.Out).To(gbytes.Say(`error: spec.artifacts\[0\].chart.path: the path "chart" does not exist \(local-path\)`))
+		Expect(session.Out).To(gbytes.Say(`error: spec.artifacts: the dependencies form a cycle: chart -> config -> chart \(dependency-cycle\)`))
+	})
+
+	It("prints the findings as json", func() {
+		session := runCmd("validate", "--output", "json", "testdata/invalid/profile.yaml")
+		Eventually(session, 20).Should(gexec.Exit(1))
+		var findings validate.Findings
+		Expect(json.Unmarshal(session.Out.Contents(), &findings)).To(Succeed())
+		Expect(findings).To(HaveLen(3))
+		Expect(findings[0]).To(Equal(validate.Finding{
+			Severity: validate.SeverityError,
+			Rule:     validate.RuleLocalPath,
+			Field:    "spec.artifacts[0].chart.path",
+			Artifact: "chart",
+			Message:  `the path "chart" does not exist`,
+		}))
+	})
+
+	It("resolves local paths against the given directory", func() {
+		session := runCmd("validate", "--repo-dir", "testdata/nginx", "testdata/invalid/profile.yaml")
+		Eventually(session, 20).Should(gexec.Exit(1))
+		Expect(session.Out).NotTo(gbytes.Say(`spec.artifacts\[1\].kustomize.path`))
+	})
+
+	When("the file does not exist", func() {
+		It("fails", func() {
+			session := runCmd("validate", "testdata/missing.yaml")
+			Eventually(session, 20).Should(gexec.Exit(2))
+			Expect(session.Err).To(gbytes.Say("no such file or directory"))
+		})
+	})
+
+	When("no command is given", func() {
+		It("fails with help message", func() {
+			session := runCmd()
+			Eventually(session, 20).Should(gexec.Exit(2))
+			Expect(session.Err).To(gbytes.Say("Usage: profiles <command>"))
+		})
+	})
+})
+
+func runCmd(args ...string) *gexec.Session {
+	session, err := gexec.Start(exec.Command(cliBin, args...), GinkgoWriter, GinkgoWriter)
+	Expect(err).NotTo(HaveOccurred())
+	return session
+}
@@ -1,53 +1,251 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/google/go-cmp/cmp"
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
 	"github.com/weaveworks/schemer/definition"
+	"github.com/weaveworks/schemer/importer"
 	schemapkg "github.com/weaveworks/schemer/schema"
 )
 
+const usage = `Usage: schema <object-name> <outfile>. Assumes path to file exists.
+       schema <outdir>. Generates the schemas of all objects into outdir.
+
+Flags:
+  --check  Compare the generated schemas with the existing files instead of writing them.
+`
+
+// object is an object which a schema is generated for.
+type object struct {
+	// name is the name of the type in the api package
+	name string
+	// file is the name of the schema file in the output directory
+	file string
+	// namespaced objects may set the namespace in their metadata
+	namespaced bool
+}
+
+// objects are the objects whose schemas are generated in one run.
+var objects = []object{
+	{name: "ProfileDefinition", file: "profiledef.json"},
+	{name: "ProfileCatalogSource", file: "catalogdef.json", namespaced: true},
+	{name: "ProfileInstallation", file: "installationdef.json", namespaced: true},
+}
+
+// oneOf lists the properties of definitions of which exactly one must be set.
+var oneOf = map[string][]string{
+	"Artifact":                {"chart", "profile", "kustomize"},
+	"ProfileInstallationSpec": {"source", "catalog"},
+}
+
 func main() {
-	if len(os.Args) != 3 {
-		fmt.Println("Usage: schema <object-name> <outfile>. Assumes path to file exists.")
+	check := flag.Bool("check", false, "Compare the generated schemas with the existing files instead of writing them.")
+	flag.Usage = func() { fmt.Print(usage) }
+	flag.Parse()
+
+	var targets []object
+	var dir string
+	switch flag.NArg() {
+	case 1:
+		dir = flag.Arg(0)
+		targets = objects
+	case 2:
+		dir = filepath.Dir(flag.Arg(1))
+		targets = []object{{name: flag.Arg(0), file: filepath.Base(flag.Arg(1))}}
+		for _, o := range objects {
+			if o.name == targets[0].name {
+				targets[0].namespaced = o.namespaced
+			}
+		}
+	default:
+		fmt.Print(usage)
 		os.Exit(1)
 	}
-	obj := os.Args[1]
-	outputFile := os.Args[2]
 
-	// generate the schema
-	schema, err := schemapkg.GenerateSchema("github.com/weaveworks/profiles/api", profilesv1.GroupVersion.Version, obj, false)
-	if err != nil {
-		fmt.Println(err)
+	outdated := false
+	for _, obj := range targets {
+		data, err := generate(obj)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		outputFile := filepath.Join(dir, obj.file)
+		if *check {
+			diff, err := compare(outputFile, data)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if diff != "" {
+				fmt.Printf("schema file %s for `%s` is out of date (-existing +generated):\n%s\n", outputFile, obj.name, diff)
+				outdated = true
+			}
+			continue
+		}
+
+		if err := ioutil.WriteFile(outputFile, data, 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("schema file generated for `%s`\n", obj.name)
+	}
+
+	if outdated {
+		fmt.Println("run `make docgen` to update the schema files")
 		os.Exit(1)
 	}
+}
+
+// apiPackage is the package of the objects.
+var apiPackage = "github.com/weaveworks/profiles/api/" + profilesv1.GroupVersion.Version
+
+// schemaVersion is the JSON schema draft of the generated schemas.
+const schemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// generate returns the JSON schema of the object.
+func generate(obj object) ([]byte, error) {
+	schema, err := generateSchema(obj.name)
+	if err != nil {
+		return nil, err
+	}
 
 	// edit some things
 	schema = editSchema(obj, schema)
 
-	// jsonify and write to the outputFile
-	bytes, err := schemapkg.ToJSON(schema)
+	return schemapkg.ToJSON(schema)
+}
+
+// generateSchema generates the schema of the named object in the api package, like schemer's GenerateSchema,
+// but with the packages of the definitions imported by importPackage.
+func generateSchema(name string) (schemapkg.Schema, error) {
+	info, err := importPackage(apiPackage)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return schemapkg.Schema{}, err
 	}
-	if err := ioutil.WriteFile(outputFile, bytes, 0644); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	imported := map[string]importer.PackageInfo{"": info, apiPackage: info}
+	generator := definition.Generator{
+		Definitions: map[string]*definition.Definition{},
+		Importer: func(path string) (importer.PackageInfo, error) {
+			if info, ok := imported[path]; ok {
+				return info, nil
+			}
+			info, err := importPackage(path)
+			if err != nil {
+				return importer.PackageInfo{}, err
+			}
+			imported[path] = info
+			return info, nil
+		},
+	}
+	generator.CollectDefinitionsFromStruct(name)
+	if _, ok := generator.Definitions[name]; !ok {
+		return schemapkg.Schema{}, fmt.Errorf("Couldn't find ref %s in definitions", name)
 	}
+	return schemapkg.Schema{
+		Version:     schemaVersion,
+		Definition:  &definition.Definition{Type: "object", Ref: definition.DefPrefix + name},
+		Definitions: generator.Definitions,
+	}, nil
+}
+
+// importPackage parses the package with the given import path. schemer's importer parses all files of the
+// directory of a package and picks any of the packages in it, like the generator next to the time package,
+// so only the files which are part of the package built for the current platform are parsed instead.
+func importPackage(path string) (importer.PackageInfo, error) {
+	pkg, err := build.Import(path, ".", 0)
+	if err != nil {
+		return importer.PackageInfo{}, fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	fset := token.NewFileSet()
+	files := map[string]*ast.File{}
+	for _, name := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		file := filepath.Join(pkg.Dir, name)
+		if files[file], err = parser.ParseFile(fset, file, nil, parser.ParseComments); err != nil {
+			return importer.PackageInfo{}, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+	}
+	// like go/doc, resolve the identifiers of the package without type checking its imports
+	astPkg, _ := ast.NewPackage(fset, files, func(imports map[string]*ast.Object, path string) (*ast.Object, error) {
+		if imports[path] == nil {
+			imports[path] = ast.NewObj(ast.Pkg, path[strings.LastIndex(path, "/")+1:])
+			imports[path].Data = ast.NewScope(nil)
+		}
+		return imports[path], nil
+	}, nil)
+	return importer.PackageInfo{
+		Pkg:      &ast.Object{Kind: ast.Pkg, Name: pkg.Name, Data: astPkg.Scope},
+		Variants: collectVariants(astPkg.Scope, files),
+	}, nil
+}
+
+// variantsDeclaration matches the comment of a const declaration listing the variants of an enum.
+var variantsDeclaration = regexp.MustCompile("[vV]alues for `(.*)`")
 
-	fmt.Printf("schema file generated for `%s`\n", obj)
+// collectVariants returns the enum variants declared in the files, as schemer's importer does. The
+// comments of type declarations are moved to their type specs, which the descriptions are read from.
+func collectVariants(scope *ast.Scope, files map[string]*ast.File) importer.VariantMap {
+	variants := importer.VariantMap{}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || len(genDecl.Specs) == 0 {
+				continue
+			}
+			switch genDecl.Tok {
+			case token.CONST:
+				if m := variantsDeclaration.FindStringSubmatch(genDecl.Doc.Text()); m != nil {
+					for _, spec := range genDecl.Specs {
+						variants[m[1]] = append(variants[m[1]], spec.(*ast.ValueSpec))
+					}
+				}
+			case token.TYPE:
+				if len(genDecl.Specs) != 1 && !genDecl.Lparen.IsValid() {
+					continue
+				}
+				typeSpec := genDecl.Specs[0].(*ast.TypeSpec)
+				if obj, ok := scope.Objects[typeSpec.Name.Name]; ok {
+					if scoped, ok := obj.Decl.(*ast.TypeSpec); ok && scoped.Doc.Text() == "" {
+						scoped.Doc = genDecl.Doc
+					}
+				}
+			}
+		}
+	}
+	return variants
+}
+
+// compare returns the line diff between the file and the generated schema, or an empty string if they are equal.
+func compare(file string, generated []byte) (string, error) {
+	existing, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Equal(existing, generated) {
+		return "", nil
+	}
+	return cmp.Diff(strings.Split(string(existing), "\n"), strings.Split(string(generated), "\n")), nil
 }
 
-func editSchema(obj string, schema schemapkg.Schema) schemapkg.Schema {
-	cc := schema.Definitions[obj]
+func editSchema(obj object, schema schemapkg.Schema) schemapkg.Schema {
+	cc := schema.Definitions[obj.name]
 
 	// clear the descriptions of kind and apiVersion
 	if t, ok := cc.Properties["kind"]; ok {
-		t.Enum = []string{obj}
+		t.Enum = []string{obj.name}
 		t.Description = ""
 		t.HTMLDescription = ""
 
@@ -62,24 +260,78 @@ func editSchema(obj string, schema schemapkg.Schema) schemapkg.Schema {
 	if t, ok := cc.Properties["metadata"]; ok {
 		t.Ref = "#/definitions/Meta"
 	}
-	schema.Definitions["Meta"] = &definition.Definition{
+	meta := &definition.Definition{
 		Properties: map[string]*definition.Definition{
 			"name": {
 				Type:            "string",
-				Description:     "profile name",
-				HTMLDescription: "profile name",
+				Description:     "name of the object",
+				HTMLDescription: "name of the object",
 			},
 		},
 		PreferredOrder:       []string{"name"},
 		AdditionalProperties: false,
 	}
+	if obj.namespaced {
+		meta.Properties["namespace"] = &definition.Definition{
+			Type:            "string",
+			Description:     "namespace of the object",
+			HTMLDescription: "namespace of the object",
+		}
+		meta.PreferredOrder = append(meta.PreferredOrder, "namespace")
+	}
+	schema.Definitions["Meta"] = meta
 
-	// delete various things which we don't want to render
-	delete(schema.Definitions, "k8s.io|apimachinery|pkg|apis|meta|v1.ObjectMeta")
-	delete(schema.Definitions, "k8s.io|apimachinery|pkg|types.UID")
-	delete(schema.Definitions, "ProfileDefinitionStatus")
+	// the status is set by the controllers, so users never write it
 	delete(cc.Properties, "status")
-	cc.PreferredOrder = cc.PreferredOrder[:len(cc.PreferredOrder)-1]
+	var order []string
+	for _, property := range cc.PreferredOrder {
+		if property != "status" {
+			order = append(order, property)
+		}
+	}
+	cc.PreferredOrder = order
+
+	// require exactly one of the properties listed in oneOf
+	for name, properties := range oneOf {
+		def, ok := schema.Definitions[name]
+		if !ok {
+			continue
+		}
+		def.OneOf = nil
+		for _, property := range properties {
+			def.OneOf = append(def.OneOf, &definition.Definition{Required: []string{property}})
+		}
+	}
+
+	// delete the definitions which are no longer referenced, like the kube ObjectMeta and the status
+	referenced := map[string]bool{}
+	collectRefs(schema.Definition, schema.Definitions, referenced)
+	for name := range schema.Definitions {
+		if !referenced[name] {
+			delete(schema.Definitions, name)
+		}
+	}
 
 	return schema
 }
+
+// collectRefs marks the definitions referenced by def and, recursively, by those definitions.
+func collectRefs(def *definition.Definition, definitions map[string]*definition.Definition, referenced map[string]bool) {
+	if def == nil {
+		return
+	}
+	if name := strings.TrimPrefix(def.Ref, definition.DefPrefix); def.Ref != "" && !referenced[name] {
+		referenced[name] = true
+		collectRefs(definitions[name], definitions, referenced)
+	}
+	collectRefs(def.Items, definitions, referenced)
+	if additional, ok := def.AdditionalProperties.(*definition.Definition); ok {
+		collectRefs(additional, definitions, referenced)
+	}
+	for _, property := range def.Properties {
+		collectRefs(property, definitions, referenced)
+	}
+	for _, alternative := range def.OneOf {
+		collectRefs(alternative, definitions, referenced)
+	}
+}
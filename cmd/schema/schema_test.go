@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -51,6 +52,73 @@ var _ = Describe("Schema", func() {
 		// To me, checking that a schema is generated is enough IDK
 	})
 
+	When("an output directory is given", func() {
+		It("writes the schemas of all objects to it", func() {
+			session, err := runCmd(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, 20).Should(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say("schema file generated for `ProfileDefinition`"))
+			Expect(session.Out).To(gbytes.Say("schema file generated for `ProfileCatalogSource`"))
+			Expect(session.Out).To(gbytes.Say("schema file generated for `ProfileInstallation`"))
+
+			s := readSchema(filepath.Join(tmpDir, "profiledef.json"))
+			artifact := s.Definitions["Artifact"]
+			Expect(artifact.Required).To(ConsistOf("name"))
+			Expect(artifact.OneOf).To(HaveLen(3))
+			Expect(artifact.OneOf[0].Required).To(ConsistOf("chart"))
+			Expect(artifact.OneOf[1].Required).To(ConsistOf("profile"))
+			Expect(artifact.OneOf[2].Required).To(ConsistOf("kustomize"))
+			Expect(s.Definitions["DependsOn"].Required).To(ConsistOf("name"))
+
+			s = readSchema(filepath.Join(tmpDir, "catalogdef.json"))
+			Expect(s.Definitions).NotTo(HaveKey("ProfileCatalogSourceStatus"))
+			Expect(s.Definitions["ProfileCatalogSource"].Properties).NotTo(HaveKey("status"))
+			Expect(s.Definitions["Meta"].Properties).To(HaveKey("namespace"))
+			Expect(s.Definitions["Repository"].Required).To(ConsistOf("url"))
+
+			s = readSchema(filepath.Join(tmpDir, "installationdef.json"))
+			spec := s.Definitions["ProfileInstallationSpec"]
+			Expect(spec.OneOf).To(HaveLen(2))
+			Expect(spec.OneOf[0].Required).To(ConsistOf("source"))
+			Expect(spec.OneOf[1].Required).To(ConsistOf("catalog"))
+			Expect(s.Definitions["Catalog"].Required).To(ConsistOf("catalog", "profile"))
+		})
+	})
+
+	When("--check is given", func() {
+		BeforeEach(func() {
+			session, err := runCmd(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, 20).Should(gexec.Exit(0))
+		})
+
+		It("succeeds when the schemas are up to date", func() {
+			session, err := runCmd("--check", tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, 20).Should(gexec.Exit(0))
+		})
+
+		It("fails with a diff when a schema is out of date", func() {
+			file := filepath.Join(tmpDir, "installationdef.json")
+			contents, err := ioutil.ReadFile(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(file, []byte(strings.Replace(string(contents), `"catalog"`, `"catalogue"`, 1)), 0644)).To(Succeed())
+
+			session, err := runCmd("--check", tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, 20).Should(gexec.Exit(1))
+			Expect(session.Out).To(gbytes.Say("schema file .*installationdef.json for `ProfileInstallation` is out of date"))
+			Expect(session.Out).To(gbytes.Say(`catalogue`))
+			Expect(session.Out).To(gbytes.Say("run `make docgen` to update the schema files"))
+		})
+
+		It("passes for the schemas in the docs", func() {
+			session, err := runCmd("--check", filepath.Join("..", "..", "userdocs", "profiles.dev", "docs", "assets", "schema"))
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, 20).Should(gexec.Exit(0))
+		})
+	})
+
 	When("object does not exist", func() {
 		It("fails", func() {
 			session, err := runCmd("nothing", "")
@@ -81,8 +149,15 @@ var _ = Describe("Schema", func() {
 	})
 })
 
-func runCmd(object, outFile string) (*gexec.Session, error) {
-	cliArgs := []string{object, outFile}
+func runCmd(cliArgs ...string) (*gexec.Session, error) {
 	cliCmd := exec.Command(cliBin, cliArgs...)
 	return gexec.Start(cliCmd, GinkgoWriter, GinkgoWriter)
 }
+
+func readSchema(file string) schemapkg.Schema {
+	contents, err := ioutil.ReadFile(file)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	s := schemapkg.Schema{}
+	ExpectWithOffset(1, json.Unmarshal(contents, &s)).To(Succeed())
+	return s
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/catalog"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterProfileCatalogSourceReconciler reconciles a ClusterProfileCatalogSource object. It shares the
+// reconciliation logic of the ProfileCatalogSourceReconciler.
+type ClusterProfileCatalogSourceReconciler struct {
+	*ProfileCatalogSourceReconciler
+}
+
+// NewClusterCatalogSourceReconciler returns a ClusterProfileCatalogSourceReconciler. The gitrepository
+// resources of repositories which don't reference a secret are created in `namespace`.
+func NewClusterCatalogSourceReconciler(c client.Client, log logr.Logger, scheme *runtime.Scheme, profiles *catalog.Catalog, namespace string) *ClusterProfileCatalogSourceReconciler {
+	r := NewCatalogSourceReconciler(c, log, scheme, profiles)
+	r.clusterNamespace = namespace
+	return &ClusterProfileCatalogSourceReconciler{ProfileCatalogSourceReconciler: r}
+}
+
+// +kubebuilder:rbac:groups=weave.works,resources=clusterprofilecatalogsources,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=weave.works,resources=clusterprofilecatalogsources/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=weave.works,resources=clusterprofilecatalogsources/finalizers,verbs=update
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *ClusterProfileCatalogSourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.log.WithValues("clusterprofilecatalogsource", req.Name)
+	return r.reconcile(ctx, logger, req, &profilesv1.ClusterProfileCatalogSource{})
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterProfileCatalogSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.recorder = mgr.GetEventRecorderFor("clusterprofilecatalogsource-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&profilesv1.ClusterProfileCatalogSource{}, builder.WithPredicates(catalogSourceChanged)).
+		Complete(r)
+}
@@ -0,0 +1,171 @@
+package controllers_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/scanner"
+	"github.com/weaveworks/profiles/pkg/scanner/fakes"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("ClusterProfileCatalogSourceController", func() {
+	var (
+		namespace   string
+		catalogName string
+		ctx         = context.Background()
+	)
+
+	BeforeEach(func() {
+		namespace = uuid.New().String()
+		catalogName = "cluster-" + uuid.New().String()
+		nsp := corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespace,
+			},
+		}
+		Expect(k8sClient.Create(ctx, &nsp)).To(Succeed())
+	})
+
+	When("providing a static list of profiles", func() {
+		It("lists the profiles with cluster scope", func() {
+			catalogSource := &profilesv1.ClusterProfileCatalogSource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: catalogName,
+				},
+				Spec: profilesv1.ProfileCatalogSourceSpec{
+					Profiles: []profilesv1.ProfileCatalogEntry{
+						{Name: "shared", ProfileDescription: profilesv1.ProfileDescription{Description: "for everyone"}},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, catalogSource)).Should(Succeed())
+
+			query := func() []profilesv1.ProfileCatalogEntry {
+				return clusterCatalogReconciler.Profiles.Search("shared")
+			}
+			Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{
+				ProfileDescription: profilesv1.ProfileDescription{Description: "for everyone"},
+				Name:               "shared",
+				CatalogSource:      catalogName,
+				CatalogScope:       profilesv1.ClusterCatalogScope,
+			}))
+
+			By("deleting the ClusterProfileCatalogSource")
+			Expect(k8sClient.Delete(ctx, catalogSource)).To(Succeed())
+			Eventually(query, 2*time.Second).Should(BeEmpty())
+		})
+	})
+
+	When("providing a repo to scan", func() {
+		var catalogSource *profilesv1.ClusterProfileCatalogSource
+
+		BeforeEach(func() {
+			fakeRepoScanner = new(fakes.FakeRepoScanner)
+			clusterCatalogReconciler.SetNewScanner(
+				func(gitRepositoryManager scanner.GitRepositoryManager, gitClient scanner.GitClient, httpClients scanner.HTTPClient, logger logr.Logger) scanner.RepoScanner {
+					return fakeRepoScanner
+				},
+			)
+			fakeRepoScanner.ScanRepositoryReturns(scanner.ScanResult{
+				Profiles: []profilesv1.ProfileCatalogEntry{
+					{Name: "bar", Tag: "bar", URL: "github.com/weaveworks/profiles-examples"},
+				},
+				Tags: map[string]string{"bar": "sha-bar"},
+			}, nil)
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "my-secret",
+					Namespace: namespace,
+				},
+				Data: map[string][]byte{"username": []byte("user"), "password": []byte("password")},
+			}
+			Expect(k8sClient.Create(ctx, secret)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, catalogSource)).Should(Succeed())
+		})
+
+		It("reads the secret from the referenced namespace", func() {
+			catalogSource = &profilesv1.ClusterProfileCatalogSource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: catalogName,
+				},
+				Spec: profilesv1.ProfileCatalogSourceSpec{
+					Repos: []profilesv1.Repository{
+						{
+							URL:       "github.com/weaveworks/profiles-examples",
+							SecretRef: &meta.NamespacedObjectReference{Name: "my-secret", Namespace: namespace},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, catalogSource)).Should(Succeed())
+
+			Eventually(func() []profilesv1.ProfileCatalogEntry {
+				return clusterCatalogReconciler.Profiles.Search("bar")
+			}, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{
+				Name:          "bar",
+				Tag:           "bar",
+				URL:           "github.com/weaveworks/profiles-examples",
+				CatalogSource: catalogName,
+				CatalogScope:  profilesv1.ClusterCatalogScope,
+			}))
+			_, _, auth, _, _ := fakeRepoScanner.ScanRepositoryArgsForCall(0)
+			Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(Equal(&githttp.BasicAuth{Username: "user", Password: "password"}))
+
+			Eventually(func() []profilesv1.ScannedRepository {
+				Expect(k8sClient.Get(context.Background(), client.ObjectKey{Name: catalogName}, catalogSource)).To(Succeed())
+				return catalogSource.Status.ScannedRepositories
+			}, 2*time.Second).Should(ConsistOf(MatchFields(IgnoreExtras, Fields{
+				"URL":     Equal("github.com/weaveworks/profiles-examples"),
+				"Tags":    Equal([]string{"bar"}),
+				"Commits": Equal(map[string]string{"bar": "sha-bar"}),
+			})))
+		})
+
+		When("the namespace of the secret is not set", func() {
+			It("does not scan the repository", func() {
+				catalogSource = &profilesv1.ClusterProfileCatalogSource{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: catalogName,
+					},
+					Spec: profilesv1.ProfileCatalogSourceSpec{
+						Repos: []profilesv1.Repository{
+							{
+								URL:       "github.com/weaveworks/profiles-examples",
+								SecretRef: &meta.NamespacedObjectReference{Name: "my-secret"},
+							},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, catalogSource)).Should(Succeed())
+
+				Consistently(func() int {
+					return fakeRepoScanner.ScanRepositoryCallCount()
+				}, time.Second).Should(Equal(0))
+
+				By("reporting the repository as failed")
+				Expect(k8sClient.Get(context.Background(), client.ObjectKey{Name: catalogName}, catalogSource)).To(Succeed())
+				Expect(apimeta.IsStatusConditionTrue(catalogSource.Status.Conditions, profilesv1.ScanFailedCondition)).To(BeTrue())
+				Expect(catalogSource.Status.ScannedRepositories).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+					"URL":  Equal("github.com/weaveworks/profiles-examples"),
+					"Tags": BeEmpty(),
+				})))
+			})
+		})
+	})
+})
@@ -3,3 +3,7 @@ package controllers
 func (r *ProfileCatalogSourceReconciler) SetNewScanner(s NewScanner) {
 	r.newScanner = s
 }
+
+func (r *ProfileCatalogSourceReconciler) SetNewMirrorScanner(s NewMirrorScanner) {
+	r.newMirrorScanner = s
+}
@@ -18,21 +18,36 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
 	"time"
 
+	"github.com/fluxcd/pkg/apis/meta"
 	"github.com/go-logr/logr"
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
 	"github.com/weaveworks/profiles/pkg/catalog"
 	"github.com/weaveworks/profiles/pkg/git"
 	"github.com/weaveworks/profiles/pkg/gitrepository"
+	"github.com/weaveworks/profiles/pkg/metrics"
 	"github.com/weaveworks/profiles/pkg/scanner"
+	"github.com/weaveworks/profiles/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // ProfileCatalogSourceReconciler reconciles a ProfileCatalogSource object
@@ -42,24 +57,40 @@ type ProfileCatalogSourceReconciler struct {
 	s          *runtime.Scheme
 	Profiles   *catalog.Catalog
 	newScanner NewScanner
-	timeout    time.Duration
-	interval   time.Duration
+	// mirror keeps local mirrors of the repositories which are scanned instead of the repositories, if set
+	mirror           scanner.Mirror
+	newMirrorScanner NewMirrorScanner
+	recorder         record.EventRecorder
+	timeout          time.Duration
+	interval         time.Duration
+	// clusterNamespace is the namespace gitrepository resources of cluster scoped catalog sources
+	// are created in, unless they reference a secret
+	clusterNamespace string
 }
 
 func NewCatalogSourceReconciler(c client.Client, log logr.Logger, scheme *runtime.Scheme, profiles *catalog.Catalog) *ProfileCatalogSourceReconciler {
 	return &ProfileCatalogSourceReconciler{
-		Client:     c,
-		log:        log,
-		s:          scheme,
-		Profiles:   profiles,
-		newScanner: scanner.New,
-		timeout:    time.Minute * 2,
-		interval:   time.Second * 5,
+		Client:           c,
+		log:              log,
+		s:                scheme,
+		Profiles:         profiles,
+		newScanner:       scanner.New,
+		newMirrorScanner: scanner.NewWithMirror,
+		timeout:          time.Minute * 2,
+		interval:         time.Second * 5,
 	}
 }
 
 type NewScanner func(gitRepositoryManager scanner.GitRepositoryManager, gitClient scanner.GitClient, httpClients scanner.HTTPClient, logger logr.Logger) scanner.RepoScanner
 
+type NewMirrorScanner func(mirror scanner.Mirror, gitClient scanner.GitClient, logger logr.Logger) scanner.RepoScanner
+
+// SetMirror makes the reconciler sync the mirrors of the repositories with their tags and scan the
+// mirrors instead of creating gitrepository resources for the tags.
+func (r *ProfileCatalogSourceReconciler) SetMirror(mirror scanner.Mirror) {
+	r.mirror = mirror
+}
+
 // +kubebuilder:rbac:groups=weave.works,resources=profilecatalogsources,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=weave.works,resources=profilecatalogsources/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=weave.works,resources=profilecatalogsources/finalizers,verbs=update
@@ -77,96 +108,381 @@ type NewScanner func(gitRepositoryManager scanner.GitRepositoryManager, gitClien
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.7.0/pkg/reconcile
 func (r *ProfileCatalogSourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := r.log.WithValues("profilecatalogsource", req.NamespacedName)
+	return r.reconcile(ctx, logger, req, &profilesv1.ProfileCatalogSource{})
+}
+
+// catalogSource is implemented by ProfileCatalogSource and ClusterProfileCatalogSource, which are
+// reconciled by the same logic.
+type catalogSource interface {
+	client.Object
+	GetCatalogSourceSpec() profilesv1.ProfileCatalogSourceSpec
+	GetCatalogSourceStatus() *profilesv1.ProfileCatalogSourceStatus
+}
 
-	pCatalog := profilesv1.ProfileCatalogSource{}
-	err := r.Client.Get(ctx, client.ObjectKey{Name: req.Name, Namespace: req.Namespace}, &pCatalog)
+func (r *ProfileCatalogSourceReconciler) reconcile(ctx context.Context, logger logr.Logger, req ctrl.Request, pCatalog catalogSource) (result ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, reflect.TypeOf(pCatalog).Elem().Name()+"Reconciler.Reconcile",
+		attribute.String("catalog.namespace", req.Namespace),
+		attribute.String("catalog.name", req.Name),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	err = r.Client.Get(ctx, req.NamespacedName, pCatalog)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Info("resource has been deleted")
-			r.Profiles.Remove(req.Name)
+			r.Profiles.Remove(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "failed to get resource")
 		return ctrl.Result{}, err
 	}
+	spec := pCatalog.GetCatalogSourceSpec()
+	status := pCatalog.GetCatalogSourceStatus()
 
 	//can configre spec.Profiles or spec.Repositories, not both.
-	if len(pCatalog.Spec.Profiles) > 0 {
-		logger.Info("updating catalog entries", "profiles", pCatalog.Spec.Profiles)
-		r.Profiles.AddOrReplace(pCatalog.Name, pCatalog.Spec.Profiles...)
-		return ctrl.Result{}, r.updateStatus(ctx, req, profilesv1.ProfileCatalogSourceStatus{})
+	if len(spec.Profiles) > 0 {
+		logger.Info("updating catalog entries", "profiles", spec.Profiles)
+		r.Profiles.AddOrReplace(req.NamespacedName, spec.Profiles...)
+		newStatus := profilesv1.ProfileCatalogSourceStatus{}
+		r.setListedStatus(&newStatus, req.NamespacedName, pCatalog.GetGeneration(), nil)
+		return ctrl.Result{}, r.updateStatus(ctx, req, pCatalog, newStatus)
+	}
+
+	if len(spec.Repos) > 0 {
+		apimeta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               profilesv1.ScanningCondition,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: pCatalog.GetGeneration(),
+			Reason:             profilesv1.ScanStartedReason,
+			Message:            fmt.Sprintf("scanning %d repositories for profiles", len(spec.Repos)),
+		})
+		r.recorder.Eventf(pCatalog, corev1.EventTypeNormal, profilesv1.ScanStartedReason, "Scanning %d repositories for profiles", len(spec.Repos))
+		if err := r.updateStatus(ctx, req, pCatalog, *status); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	gitRepoManager := gitrepository.NewManager(ctx, pCatalog.Namespace, r.Client, r.timeout, r.interval)
-	scanner := r.newScanner(gitRepoManager, &git.Client{}, http.DefaultClient, logger)
-	catalogExists := r.Profiles.CatalogExists(pCatalog.Name)
+	catalogExists := r.Profiles.CatalogExists(req.NamespacedName)
 
-	for _, repo := range pCatalog.Spec.Repos {
+	var scanErrs []error
+	for _, repo := range spec.Repos {
 		logger.Info("scan repo for profiles", "repo", repo)
-		var secret *corev1.Secret
-		if repo.SecretRef != nil {
-			secret = &corev1.Secret{}
-			objectKey := client.ObjectKey{Name: repo.SecretRef.Name, Namespace: pCatalog.Namespace}
-			if err := r.Client.Get(ctx, objectKey, secret); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to find secret for repo %v: %w", repo, err)
-			}
+		err := r.scanRepository(ctx, logger, req, pCatalog, repo, catalogExists)
+		condition := metav1.Condition{
+			Type:               profilesv1.ScanFailedCondition,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: pCatalog.GetGeneration(),
+			Reason:             profilesv1.ScanSucceededReason,
+			Message:            "repository scanned",
 		}
-
-		var alreadyScannedTags []string
-		if catalogExists {
-			for _, scannedRepo := range pCatalog.Status.ScannedRepositories {
-				if scannedRepo.URL == repo.URL {
-					alreadyScannedTags = scannedRepo.Tags
-				}
-			}
+		if err != nil {
+			logger.Error(err, "failed to scan repository", "repo", repo.URL)
+			r.recorder.Eventf(pCatalog, corev1.EventTypeWarning, profilesv1.ScanFailedReason, "Failed to scan repository %s: %v", repo.URL, err)
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = profilesv1.ScanFailedReason
+			condition.Message = err.Error()
+			scanErrs = append(scanErrs, fmt.Errorf("%s: %w", repo.URL, err))
 		}
+		setRepositoryCondition(status, repo.URL, condition)
+	}
+	r.pruneRemovedRepositories(req.NamespacedName, spec, status)
+
+	now := metav1.Now()
+	status.LastScanTime = &now
+	r.setListedStatus(status, req.NamespacedName, pCatalog.GetGeneration(), scanErrs)
+	if len(scanErrs) == 0 && len(spec.Repos) > 0 {
+		r.recorder.Eventf(pCatalog, corev1.EventTypeNormal, profilesv1.ScanSucceededReason,
+			"Listed %d versions of %d profiles from %d repositories", status.Versions, status.Profiles, len(spec.Repos))
+	}
 
-		profiles, newTags, err := scanner.ScanRepository(repo, secret, alreadyScannedTags)
+	logger.Info("updating status", "status", status)
+	if err := r.updateStatus(ctx, req, pCatalog, *status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, kerrors.NewAggregate(scanErrs)
+}
+
+// scanRepository scans the repository for profiles and syncs the catalog and the status of the
+// catalog source with the results.
+func (r *ProfileCatalogSourceReconciler) scanRepository(ctx context.Context, logger logr.Logger, req ctrl.Request, pCatalog catalogSource, repo profilesv1.Repository, catalogExists bool) error {
+	status := pCatalog.GetCatalogSourceStatus()
+	// the gitrepository resources must be created in the namespace of the secret they reference
+	namespace := r.gitRepositoryNamespace(pCatalog)
+	var secret *corev1.Secret
+	if repo.SecretRef != nil {
+		objectKey, err := secretKey(pCatalog, repo.SecretRef)
 		if err != nil {
-			return ctrl.Result{}, err
+			return fmt.Errorf("invalid secret for repo %v: %w", repo, err)
+		}
+		secret = &corev1.Secret{}
+		if err := r.Client.Get(ctx, objectKey, secret); err != nil {
+			return fmt.Errorf("failed to find secret for repo %v: %w", repo, err)
+		}
+		namespace = objectKey.Namespace
+	}
+	if r.mirror == nil && repo.AuthProvider != "" && repo.AuthProvider != profilesv1.GenericAuthProvider {
+		return fmt.Errorf("the %s auth provider of repo %v requires the git mirror", repo.AuthProvider, repo)
+	}
+	auth, err := git.NewAuthProvider(repo.AuthProvider, secret)
+	if err != nil {
+		return fmt.Errorf("invalid credentials for repo %v: %w", repo, err)
+	}
+	var keys *git.TrustedKeys
+	if repo.Verification != nil {
+		objectKey, err := secretKey(pCatalog, &repo.Verification.SecretRef)
+		if err != nil {
+			return fmt.Errorf("invalid verification secret for repo %v: %w", repo, err)
+		}
+		keysSecret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, objectKey, keysSecret); err != nil {
+			return fmt.Errorf("failed to find verification secret for repo %v: %w", repo, err)
 		}
+		if keys, err = git.ParseTrustedKeys(keysSecret); err != nil {
+			return fmt.Errorf("invalid verification secret for repo %v: %w", repo, err)
+		}
+	}
+
+	var repoScanner scanner.RepoScanner
+	if r.mirror != nil {
+		repoScanner = r.newMirrorScanner(r.mirror, &git.Client{}, logger)
+	} else {
+		gitRepoManager := gitrepository.NewManager(ctx, namespace, r.Client, r.timeout, r.interval)
+		repoScanner = r.newScanner(gitRepoManager, &git.Client{}, http.DefaultClient, logger)
+	}
 
-		updateScannedRepositoryStatus(&pCatalog, repo, newTags, catalogExists)
-		logger.Info("updating catalog with scanning reuslts", "profiles", profiles)
-		r.Profiles.Append(pCatalog.Name, profiles...)
+	// the tags are verified again when the verification mode or the trusted keys have changed
+	verification := verificationDigest(repo, keys)
+	var alreadyScannedTags map[string]string
+	if catalogExists && scannedVerification(*status, repo.URL) == verification {
+		alreadyScannedTags = scannedTags(*status, repo.URL)
 	}
 
-	logger.Info("updating status", "status", pCatalog.Status)
-	return ctrl.Result{}, r.updateStatus(ctx, req, pCatalog.Status)
+	scanResult, err := repoScanner.ScanRepository(ctx, repo, auth, keys, alreadyScannedTags)
+	if err != nil {
+		return err
+	}
+
+	staleTags := scanResult.StaleTags
+	if alreadyScannedTags == nil {
+		// all tags have been scanned, so the entries of all tags scanned before are replaced
+		staleTags = allTags(scanResult.Tags, scannedTags(*status, repo.URL))
+	}
+	updateScannedRepositoryStatus(status, repo, scanResult.Tags, verification)
+	logger.Info("updating catalog with scanning results", "profiles", scanResult.Profiles, "staleTags", staleTags)
+	r.Profiles.Sync(req.NamespacedName, repo.URL, staleTags, scanResult.Profiles...)
+	return nil
+}
+
+// setListedStatus records the number of profiles the catalog source lists and sets its Ready,
+// Scanning and ScanFailed conditions depending on the errors of scanning its repositories.
+func (r *ProfileCatalogSourceReconciler) setListedStatus(status *profilesv1.ProfileCatalogSourceStatus, source types.NamespacedName, generation int64, scanErrs []error) {
+	status.Profiles, status.Versions = r.Profiles.Count(source)
+	status.ObservedGeneration = generation
+
+	ready := metav1.Condition{
+		Type:               profilesv1.ReadyCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             profilesv1.ProfilesListedReason,
+		Message:            fmt.Sprintf("%d versions of %d profiles listed", status.Versions, status.Profiles),
+	}
+	scanFailed := metav1.Condition{
+		Type:               profilesv1.ScanFailedCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             profilesv1.ScanSucceededReason,
+		Message:            "all repositories scanned",
+	}
+	if len(scanErrs) > 0 {
+		message := fmt.Sprintf("failed to scan %d repositories: %v", len(scanErrs), kerrors.NewAggregate(scanErrs))
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = profilesv1.ScanFailedReason
+		ready.Message = message
+		scanFailed.Status = metav1.ConditionTrue
+		scanFailed.Reason = profilesv1.ScanFailedReason
+		scanFailed.Message = message
+	}
+	apimeta.SetStatusCondition(&status.Conditions, ready)
+	if apimeta.FindStatusCondition(status.Conditions, profilesv1.ScanningCondition) == nil {
+		// catalog sources listing their profiles in the spec are never scanned
+		return
+	}
+	apimeta.SetStatusCondition(&status.Conditions, scanFailed)
+	apimeta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               profilesv1.ScanningCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             scanFailed.Reason,
+		Message:            "scan finished",
+	})
 }
 
-func (r *ProfileCatalogSourceReconciler) updateStatus(ctx context.Context, req ctrl.Request, newStatus profilesv1.ProfileCatalogSourceStatus) error {
-	var latestCatalog profilesv1.ProfileCatalogSource
-	if err := r.Get(ctx, req.NamespacedName, &latestCatalog); err != nil {
+// gitRepositoryNamespace returns the namespace the gitrepository resources of the catalog source are
+// created in, unless they reference a secret.
+func (r *ProfileCatalogSourceReconciler) gitRepositoryNamespace(pCatalog catalogSource) string {
+	if pCatalog.GetNamespace() == "" {
+		return r.clusterNamespace
+	}
+	return pCatalog.GetNamespace()
+}
+
+// secretKey returns the key of the secret referenced by a repository of the catalog source. Cluster
+// scoped catalog sources must name the namespace of the secret, namespaced catalog sources can only
+// reference secrets in their own namespace.
+func secretKey(pCatalog catalogSource, ref *meta.NamespacedObjectReference) (client.ObjectKey, error) {
+	if pCatalog.GetNamespace() == "" {
+		if ref.Namespace == "" {
+			return client.ObjectKey{}, fmt.Errorf("namespace of secret %q must be set", ref.Name)
+		}
+		return client.ObjectKey{Name: ref.Name, Namespace: ref.Namespace}, nil
+	}
+	if ref.Namespace != "" && ref.Namespace != pCatalog.GetNamespace() {
+		return client.ObjectKey{}, fmt.Errorf("secret %s/%s is not in the namespace of the catalog source", ref.Namespace, ref.Name)
+	}
+	return client.ObjectKey{Name: ref.Name, Namespace: pCatalog.GetNamespace()}, nil
+}
+
+func (r *ProfileCatalogSourceReconciler) updateStatus(ctx context.Context, req ctrl.Request, pCatalog catalogSource, newStatus profilesv1.ProfileCatalogSourceStatus) error {
+	latestCatalog := pCatalog.DeepCopyObject().(catalogSource)
+	if err := r.Get(ctx, req.NamespacedName, latestCatalog); err != nil {
 		return err
 	}
 
-	patch := client.MergeFrom(latestCatalog.DeepCopy())
-	latestCatalog.Status = newStatus
+	patch := client.MergeFrom(latestCatalog.DeepCopyObject().(client.Object))
+	*latestCatalog.GetCatalogSourceStatus() = newStatus
+
+	return r.Status().Patch(ctx, latestCatalog, patch)
+}
 
-	return r.Status().Patch(ctx, &latestCatalog, patch)
+// pruneRemovedRepositories drops the status, catalog entries and scan metrics of repositories which are
+// no longer part of the spec.
+func (r *ProfileCatalogSourceReconciler) pruneRemovedRepositories(source types.NamespacedName, spec profilesv1.ProfileCatalogSourceSpec, status *profilesv1.ProfileCatalogSourceStatus) {
+	var kept []profilesv1.ScannedRepository
+	for _, scannedRepo := range status.ScannedRepositories {
+		if !hasRepository(spec.Repos, scannedRepo.URL) {
+			r.Profiles.RemoveRepository(source, scannedRepo.URL)
+			metrics.DeleteRepository(git.RedactURL(scannedRepo.URL))
+			continue
+		}
+		kept = append(kept, scannedRepo)
+	}
+	status.ScannedRepositories = kept
 }
 
-func updateScannedRepositoryStatus(pCatalog *profilesv1.ProfileCatalogSource, repo profilesv1.Repository, newTags []string, appendToExisting bool) {
-	for i, scannedRepo := range pCatalog.Status.ScannedRepositories {
+func hasRepository(repos []profilesv1.Repository, url string) bool {
+	for _, repo := range repos {
+		if repo.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+// scannedTags returns the tags of the repository recorded in the status mapped to their SHA.
+// Tags recorded before SHAs were tracked map to an empty SHA.
+func scannedTags(status profilesv1.ProfileCatalogSourceStatus, url string) map[string]string {
+	for _, scannedRepo := range status.ScannedRepositories {
+		if scannedRepo.URL != url {
+			continue
+		}
+		tags := make(map[string]string, len(scannedRepo.Tags))
+		for _, tag := range scannedRepo.Tags {
+			tags[tag] = scannedRepo.Commits[tag]
+		}
+		return tags
+	}
+	return nil
+}
+
+// scannedVerification returns the digest of the verification the tags of the repository recorded in
+// the status were scanned with.
+func scannedVerification(status profilesv1.ProfileCatalogSourceStatus, url string) string {
+	for _, scannedRepo := range status.ScannedRepositories {
+		if scannedRepo.URL == url {
+			return scannedRepo.Verification
+		}
+	}
+	return ""
+}
+
+// verificationDigest returns a digest of the verification mode and the trusted keys the tags of the
+// repository are verified with, or an empty string if they aren't verified.
+func verificationDigest(repo profilesv1.Repository, keys *git.TrustedKeys) string {
+	if repo.Verification == nil || keys == nil {
+		return ""
+	}
+	mode := repo.Verification.Mode
+	if mode == "" {
+		mode = profilesv1.RecordVerificationMode
+	}
+	sum := sha256.Sum256([]byte(mode + "\n" + keys.Digest()))
+	return hex.EncodeToString(sum[:])
+}
+
+// allTags returns the sorted tags of both maps.
+func allTags(tags, scanned map[string]string) []string {
+	var all []string
+	for tag := range tags {
+		all = append(all, tag)
+	}
+	for tag := range scanned {
+		if _, ok := tags[tag]; !ok {
+			all = append(all, tag)
+		}
+	}
+	sort.Strings(all)
+	return all
+}
+
+// updateScannedRepositoryStatus records the tags currently in the repository as scanned with the
+// verification. Tags which have been removed from the repository are dropped.
+func updateScannedRepositoryStatus(status *profilesv1.ProfileCatalogSourceStatus, repo profilesv1.Repository, tags map[string]string, verification string) {
+	scanned := profilesv1.ScannedRepository{
+		URL:          repo.URL,
+		Commits:      tags,
+		Verification: verification,
+	}
+	for tag := range tags {
+		scanned.Tags = append(scanned.Tags, tag)
+	}
+	sort.Strings(scanned.Tags)
+
+	for i, scannedRepo := range status.ScannedRepositories {
 		if scannedRepo.URL == repo.URL {
-			if appendToExisting {
-				pCatalog.Status.ScannedRepositories[i].Tags = append(scannedRepo.Tags, newTags...)
-			} else {
-				pCatalog.Status.ScannedRepositories[i].Tags = newTags
-			}
+			scanned.Conditions = scannedRepo.Conditions
+			status.ScannedRepositories[i] = scanned
 			return
 		}
 	}
-	pCatalog.Status.ScannedRepositories = append(pCatalog.Status.ScannedRepositories, profilesv1.ScannedRepository{
-		URL:  repo.URL,
-		Tags: newTags,
-	})
+	status.ScannedRepositories = append(status.ScannedRepositories, scanned)
+}
+
+// setRepositoryCondition sets the condition of the scanned repository with the given URL. A repository
+// which failed to be scanned the first time is added to the scanned repositories without tags.
+func setRepositoryCondition(status *profilesv1.ProfileCatalogSourceStatus, url string, condition metav1.Condition) {
+	for i := range status.ScannedRepositories {
+		if status.ScannedRepositories[i].URL == url {
+			apimeta.SetStatusCondition(&status.ScannedRepositories[i].Conditions, condition)
+			return
+		}
+	}
+	scanned := profilesv1.ScannedRepository{URL: url}
+	apimeta.SetStatusCondition(&scanned.Conditions, condition)
+	status.ScannedRepositories = append(status.ScannedRepositories, scanned)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ProfileCatalogSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.recorder = mgr.GetEventRecorderFor("profilecatalogsource-controller")
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&profilesv1.ProfileCatalogSource{}).
+		For(&profilesv1.ProfileCatalogSource{}, builder.WithPredicates(catalogSourceChanged)).
 		Complete(r)
 }
+
+// catalogSourceChanged ignores updates of the status of catalog sources, which would otherwise
+// trigger another scan after every scan.
+var catalogSourceChanged = predicate.Or(
+	predicate.GenerationChangedPredicate{},
+	predicate.LabelChangedPredicate{},
+	predicate.AnnotationChangedPredicate{},
+)
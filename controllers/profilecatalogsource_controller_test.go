@@ -2,20 +2,28 @@ package controllers_test
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"fmt"
 	"time"
 
 	"github.com/fluxcd/pkg/apis/meta"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/git"
 	"github.com/weaveworks/profiles/pkg/scanner"
 	"github.com/weaveworks/profiles/pkg/scanner/fakes"
+	"golang.org/x/crypto/ssh"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -64,7 +72,7 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 			query := func() []profilesv1.ProfileCatalogEntry {
 				return catalogReconciler.Profiles.Search("foo")
 			}
-			Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{ProfileDescription: profilesv1.ProfileDescription{Description: "bar"}, Name: "foo", CatalogSource: "catalog"}))
+			Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{ProfileDescription: profilesv1.ProfileDescription{Description: "bar"}, Name: "foo", CatalogSource: "catalog", CatalogNamespace: namespace, CatalogScope: profilesv1.NamespacedCatalogScope}))
 			Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog"}, catalogSource)).To(Succeed())
 
 			By("adding more items to ProfileCatalogSource")
@@ -83,8 +91,10 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 				ProfileDescription: profilesv1.ProfileDescription{
 					Description: "I am new here",
 				},
-				Name:          pName,
-				CatalogSource: "catalog",
+				Name:             pName,
+				CatalogSource:    "catalog",
+				CatalogNamespace: namespace,
+				CatalogScope:     profilesv1.NamespacedCatalogScope,
 			}))
 
 			By("deleting the ProfileCatalogSource")
@@ -96,6 +106,12 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 
 	When("providing a repo to scan", func() {
 		var catalogSource *profilesv1.ProfileCatalogSource
+		// rescan forces a reconciliation loop, updates of the status don't trigger one
+		rescan := func(label string) {
+			Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+			catalogSource.Labels = map[string]string{"rescan": label}
+			Expect(k8sClient.Update(ctx, catalogSource)).Should(Succeed())
+		}
 		BeforeEach(func() {
 			fakeRepoScanner = new(fakes.FakeRepoScanner)
 			catalogReconciler.SetNewScanner(
@@ -103,11 +119,19 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 					return fakeRepoScanner
 				},
 			)
-			fakeRepoScanner.ScanRepositoryReturnsOnCall(0, []profilesv1.ProfileCatalogEntry{
-				{
-					Name: "foo",
+			fakeRepoScanner.ScanRepositoryReturnsOnCall(0, scanner.ScanResult{
+				Profiles: []profilesv1.ProfileCatalogEntry{
+					{
+						Name: "foo",
+						Tag:  "foo",
+						URL:  "github.com/weaveworks/profiles-examples",
+					},
 				},
-			}, []string{"foo"}, nil)
+				Tags: map[string]string{"foo": "sha-foo"},
+			}, nil)
+			fakeRepoScanner.ScanRepositoryReturns(scanner.ScanResult{
+				Tags: map[string]string{"foo": "sha-foo"},
+			}, nil)
 
 			By("creating a new ProfileCatalogSource")
 			catalogSource = &profilesv1.ProfileCatalogSource{
@@ -123,7 +147,7 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 					Repos: []profilesv1.Repository{
 						{
 							URL: "github.com/weaveworks/profiles-examples",
-							SecretRef: &meta.LocalObjectReference{
+							SecretRef: &meta.NamespacedObjectReference{
 								Name: "my-secret",
 							},
 						},
@@ -139,7 +163,7 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 					Name:      "my-secret",
 					Namespace: namespace,
 				},
-				Data: map[string][]byte{},
+				Data: map[string][]byte{"username": []byte("user"), "password": []byte("password")},
 			}
 			Expect(k8sClient.Create(ctx, secret)).Should(Succeed())
 			Expect(k8sClient.Create(ctx, catalogSource)).Should(Succeed())
@@ -147,7 +171,7 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 
 		AfterEach(func() {
 			Expect(k8sClient.Delete(ctx, catalogSource)).Should(Succeed())
-			catalogReconciler.Profiles.Remove("catalog-2")
+			catalogReconciler.Profiles.Remove(types.NamespacedName{Namespace: namespace, Name: "catalog-2"})
 		})
 
 		It("scans the repository", func() {
@@ -155,29 +179,143 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 			query := func() []profilesv1.ProfileCatalogEntry {
 				return catalogReconciler.Profiles.Search("foo")
 			}
-			Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: "catalog-2"}))
+			Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "foo", URL: "github.com/weaveworks/profiles-examples", CatalogSource: "catalog-2", CatalogNamespace: namespace, CatalogScope: profilesv1.NamespacedCatalogScope}))
 
 			By("only searching for new tags")
+			rescan("1")
 			Eventually(func() int {
 				return fakeRepoScanner.ScanRepositoryCallCount()
 			}).Should(Equal(2))
-			repo, secret, tags := fakeRepoScanner.ScanRepositoryArgsForCall(0)
-			Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.LocalObjectReference{Name: "my-secret"}}))
-			Expect(secret.Name).To(Equal("my-secret"))
+			_, repo, auth, _, tags := fakeRepoScanner.ScanRepositoryArgsForCall(0)
+			Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.NamespacedObjectReference{Name: "my-secret"}}))
+			Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(Equal(&githttp.BasicAuth{Username: "user", Password: "password"}))
 			Expect(tags).To(BeNil())
 
-			repo, secret, tags = fakeRepoScanner.ScanRepositoryArgsForCall(1)
-			Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.LocalObjectReference{Name: "my-secret"}}))
-			Expect(secret.Name).To(Equal("my-secret"))
-			Expect(tags).To(ConsistOf("foo"))
+			_, repo, auth, _, tags = fakeRepoScanner.ScanRepositoryArgsForCall(1)
+			Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.NamespacedObjectReference{Name: "my-secret"}}))
+			Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(Equal(&githttp.BasicAuth{Username: "user", Password: "password"}))
+			Expect(tags).To(Equal(map[string]string{"foo": "sha-foo"}))
 
 			Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
 			Expect(catalogSource.Status.ScannedRepositories).To(ConsistOf(
-				profilesv1.ScannedRepository{
-					URL:  "github.com/weaveworks/profiles-examples",
-					Tags: []string{"foo"},
-				},
+				MatchFields(IgnoreExtras, Fields{
+					"URL":     Equal("github.com/weaveworks/profiles-examples"),
+					"Tags":    Equal([]string{"foo"}),
+					"Commits": Equal(map[string]string{"foo": "sha-foo"}),
+				}),
 			))
+
+			By("not duplicating entries")
+			Expect(query()).To(HaveLen(1))
+		})
+
+		It("reports the scan in the status and in events", func() {
+			Eventually(func() bool {
+				Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+				return apimeta.IsStatusConditionTrue(catalogSource.Status.Conditions, profilesv1.ReadyCondition)
+			}, 2*time.Second).Should(BeTrue())
+			Expect(catalogSource.Status.Profiles).To(Equal(1))
+			Expect(catalogSource.Status.Versions).To(Equal(1))
+			Expect(catalogSource.Status.LastScanTime).NotTo(BeNil())
+			Expect(catalogSource.Status.ObservedGeneration).To(Equal(catalogSource.Generation))
+			Expect(apimeta.IsStatusConditionFalse(catalogSource.Status.Conditions, profilesv1.ScanningCondition)).To(BeTrue())
+			Expect(apimeta.IsStatusConditionFalse(catalogSource.Status.Conditions, profilesv1.ScanFailedCondition)).To(BeTrue())
+			Expect(apimeta.IsStatusConditionFalse(catalogSource.Status.ScannedRepositories[0].Conditions, profilesv1.ScanFailedCondition)).To(BeTrue())
+			Eventually(func() []string {
+				return eventReasons(namespace, "catalog-2")
+			}, 2*time.Second).Should(ContainElements(profilesv1.ScanStartedReason, profilesv1.ScanSucceededReason))
+
+			By("failing to scan the repository")
+			fakeRepoScanner.ScanRepositoryReturns(scanner.ScanResult{}, fmt.Errorf("failed to list tags"))
+			rescan("1")
+			Eventually(func() bool {
+				Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+				return apimeta.IsStatusConditionTrue(catalogSource.Status.Conditions, profilesv1.ScanFailedCondition)
+			}, 2*time.Second).Should(BeTrue())
+			Expect(apimeta.IsStatusConditionFalse(catalogSource.Status.Conditions, profilesv1.ReadyCondition)).To(BeTrue())
+			condition := apimeta.FindStatusCondition(catalogSource.Status.ScannedRepositories[0].Conditions, profilesv1.ScanFailedCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Message).To(Equal("failed to list tags"))
+
+			By("keeping the profiles of the repository")
+			Expect(catalogSource.Status.ScannedRepositories[0].Tags).To(Equal([]string{"foo"}))
+			Expect(catalogSource.Status.Profiles).To(Equal(1))
+			Eventually(func() []string {
+				return eventReasons(namespace, "catalog-2")
+			}, 2*time.Second).Should(ContainElement(profilesv1.ScanFailedReason))
+		})
+
+		It("requires the git mirror for auth providers other than Generic", func() {
+			Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+			catalogSource.Spec.Repos[0].AuthProvider = profilesv1.TokenAuthProvider
+			Expect(k8sClient.Update(ctx, catalogSource)).Should(Succeed())
+
+			Eventually(func() string {
+				Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+				if len(catalogSource.Status.ScannedRepositories) == 0 {
+					return ""
+				}
+				condition := apimeta.FindStatusCondition(catalogSource.Status.ScannedRepositories[0].Conditions, profilesv1.ScanFailedCondition)
+				if condition == nil || condition.Status != metav1.ConditionTrue {
+					return ""
+				}
+				return condition.Message
+			}, 2*time.Second).Should(ContainSubstring("requires the git mirror"))
+		})
+
+		When("tags are removed or moved", func() {
+			It("prunes and rescans them", func() {
+				query := func() []profilesv1.ProfileCatalogEntry {
+					return catalogReconciler.Profiles.Search("foo")
+				}
+				Eventually(query, 2*time.Second).Should(HaveLen(1))
+				rescan("1")
+				Eventually(func() int {
+					return fakeRepoScanner.ScanRepositoryCallCount()
+				}).Should(Equal(2))
+
+				By("moving the tag to a new commit")
+				fakeRepoScanner.ScanRepositoryReturnsOnCall(2, scanner.ScanResult{
+					Profiles: []profilesv1.ProfileCatalogEntry{
+						{
+							Name: "foo-renamed",
+							Tag:  "foo",
+							URL:  "github.com/weaveworks/profiles-examples",
+						},
+					},
+					Tags:      map[string]string{"foo": "sha-moved"},
+					StaleTags: []string{"foo"},
+				}, nil)
+				fakeRepoScanner.ScanRepositoryReturns(scanner.ScanResult{
+					Tags: map[string]string{"foo": "sha-moved"},
+				}, nil)
+				Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+				catalogSource.Labels = map[string]string{"some": "label"}
+				Expect(k8sClient.Update(ctx, catalogSource)).Should(Succeed())
+
+				Eventually(query, 2*time.Second).Should(ConsistOf(profilesv1.ProfileCatalogEntry{Name: "foo-renamed", Tag: "foo", URL: "github.com/weaveworks/profiles-examples", CatalogSource: "catalog-2", CatalogNamespace: namespace, CatalogScope: profilesv1.NamespacedCatalogScope}))
+
+				By("removing the tag from the repository")
+				fakeRepoScanner.ScanRepositoryReturns(scanner.ScanResult{
+					StaleTags: []string{"foo"},
+				}, nil)
+				Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+				catalogSource.Labels = map[string]string{"some": "other-label"}
+				Expect(k8sClient.Update(ctx, catalogSource)).Should(Succeed())
+
+				Eventually(query, 2*time.Second).Should(BeEmpty())
+				Eventually(func() []profilesv1.ScannedRepository {
+					Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
+					return catalogSource.Status.ScannedRepositories
+				}, 2*time.Second).Should(ConsistOf(
+					MatchFields(IgnoreExtras, Fields{
+						"URL":     Equal("github.com/weaveworks/profiles-examples"),
+						"Tags":    BeEmpty(),
+						"Commits": BeEmpty(),
+					}),
+				))
+			})
 		})
 
 		When("the catalog gets wiped", func() {
@@ -186,66 +324,243 @@ var _ = Describe("ProfileCatalogSourceController", func() {
 				query := func() []profilesv1.ProfileCatalogEntry {
 					return catalogReconciler.Profiles.Search("foo")
 				}
-				Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: "catalog-2"}))
+				Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "foo", URL: "github.com/weaveworks/profiles-examples", CatalogSource: "catalog-2", CatalogNamespace: namespace, CatalogScope: profilesv1.NamespacedCatalogScope}))
 
 				Eventually(func() []profilesv1.ScannedRepository {
 					Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
 					return catalogSource.Status.ScannedRepositories
 				}, 2*time.Second).Should(ConsistOf(
-					profilesv1.ScannedRepository{
-						URL:  "github.com/weaveworks/profiles-examples",
-						Tags: []string{"foo"},
-					},
+					MatchFields(IgnoreExtras, Fields{
+						"URL":     Equal("github.com/weaveworks/profiles-examples"),
+						"Tags":    Equal([]string{"foo"}),
+						"Commits": Equal(map[string]string{"foo": "sha-foo"}),
+					}),
 				))
-				Expect(fakeRepoScanner.ScanRepositoryCallCount()).To(Equal(2))
+				rescan("1")
+				Eventually(func() int {
+					return fakeRepoScanner.ScanRepositoryCallCount()
+				}).Should(Equal(2))
 
 				By("rescanning the repository when the catalog gets reset")
-				fakeRepoScanner.ScanRepositoryReturnsOnCall(2, []profilesv1.ProfileCatalogEntry{
-					{
-						Name: "bar",
-					},
-					{
-						Name: "baz",
+				fakeRepoScanner.ScanRepositoryReturnsOnCall(2, scanner.ScanResult{
+					Profiles: []profilesv1.ProfileCatalogEntry{
+						{
+							Name: "bar",
+						},
+						{
+							Name: "baz",
+						},
 					},
-				}, []string{"bar", "baz"}, nil)
-
-				catalogReconciler.Profiles.Remove("catalog-2")
-				//force a reconciliation loop
-				catalogSource.Labels = map[string]string{"some": "label"}
-				Expect(k8sClient.Update(ctx, catalogSource)).Should(Succeed())
+					Tags: map[string]string{"bar": "sha-bar", "baz": "sha-baz"},
+				}, nil)
+				fakeRepoScanner.ScanRepositoryReturns(scanner.ScanResult{
+					Tags: map[string]string{"bar": "sha-bar", "baz": "sha-baz"},
+				}, nil)
 
+				catalogReconciler.Profiles.Remove(types.NamespacedName{Namespace: namespace, Name: "catalog-2"})
+				rescan("2")
+				Eventually(func() int {
+					return fakeRepoScanner.ScanRepositoryCallCount()
+				}, time.Second*2).Should(Equal(3))
+				rescan("3")
 				Eventually(func() int {
 					return fakeRepoScanner.ScanRepositoryCallCount()
 				}, time.Second*2).Should(Equal(4))
-				repo, secret, tags := fakeRepoScanner.ScanRepositoryArgsForCall(2)
-				Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.LocalObjectReference{Name: "my-secret"}}))
-				Expect(secret.Name).To(Equal("my-secret"))
+				_, repo, auth, _, tags := fakeRepoScanner.ScanRepositoryArgsForCall(2)
+				Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.NamespacedObjectReference{Name: "my-secret"}}))
+				Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(Equal(&githttp.BasicAuth{Username: "user", Password: "password"}))
 				Expect(tags).To(BeNil())
 
 				query = func() []profilesv1.ProfileCatalogEntry {
 					return catalogReconciler.Profiles.Search("baz")
 				}
-				Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{Name: "baz", CatalogSource: "catalog-2"}))
+				Eventually(query, 2*time.Second).Should(ContainElement(profilesv1.ProfileCatalogEntry{Name: "baz", CatalogSource: "catalog-2", CatalogNamespace: namespace, CatalogScope: profilesv1.NamespacedCatalogScope}))
 				Eventually(func() []profilesv1.ScannedRepository {
 					Expect(k8sClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "catalog-2"}, catalogSource)).To(Succeed())
 					return catalogSource.Status.ScannedRepositories
 				}, 2*time.Second).Should(ConsistOf(
-					profilesv1.ScannedRepository{
-						URL:  "github.com/weaveworks/profiles-examples",
-						Tags: []string{"bar", "baz"},
-					},
+					MatchFields(IgnoreExtras, Fields{
+						"URL":     Equal("github.com/weaveworks/profiles-examples"),
+						"Tags":    Equal([]string{"bar", "baz"}),
+						"Commits": Equal(map[string]string{"bar": "sha-bar", "baz": "sha-baz"}),
+					}),
 				))
 
-				repo, secret, tags = fakeRepoScanner.ScanRepositoryArgsForCall(2)
-				Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.LocalObjectReference{Name: "my-secret"}}))
-				Expect(secret.Name).To(Equal("my-secret"))
+				_, repo, auth, _, tags = fakeRepoScanner.ScanRepositoryArgsForCall(2)
+				Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.NamespacedObjectReference{Name: "my-secret"}}))
+				Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(Equal(&githttp.BasicAuth{Username: "user", Password: "password"}))
 				Expect(tags).To(BeNil())
 
-				repo, secret, tags = fakeRepoScanner.ScanRepositoryArgsForCall(3)
-				Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.LocalObjectReference{Name: "my-secret"}}))
-				Expect(secret.Name).To(Equal("my-secret"))
-				Expect(tags).To(ConsistOf("bar", "baz"))
+				_, repo, auth, _, tags = fakeRepoScanner.ScanRepositoryArgsForCall(3)
+				Expect(repo).To(Equal(profilesv1.Repository{URL: "github.com/weaveworks/profiles-examples", SecretRef: &meta.NamespacedObjectReference{Name: "my-secret"}}))
+				Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(Equal(&githttp.BasicAuth{Username: "user", Password: "password"}))
+				Expect(tags).To(Equal(map[string]string{"bar": "sha-bar", "baz": "sha-baz"}))
 			})
 		})
 	})
+
+	When("the repositories are mirrored", func() {
+		var (
+			catalogSource *profilesv1.ProfileCatalogSource
+			mirror        *fakes.FakeMirror
+		)
+
+		BeforeEach(func() {
+			mirror = new(fakes.FakeMirror)
+			fakeRepoScanner = new(fakes.FakeRepoScanner)
+			fakeRepoScanner.ScanRepositoryReturns(scanner.ScanResult{
+				Profiles: []profilesv1.ProfileCatalogEntry{{Name: "mirrored", Tag: "v0.1.0", URL: "github.com/weaveworks/profiles-examples"}},
+				Tags:     map[string]string{"v0.1.0": "sha-1"},
+			}, nil)
+			catalogReconciler.SetMirror(mirror)
+			catalogReconciler.SetNewMirrorScanner(func(m scanner.Mirror, gitClient scanner.GitClient, logger logr.Logger) scanner.RepoScanner {
+				Expect(m).To(Equal(mirror))
+				return fakeRepoScanner
+			})
+
+			catalogSource = &profilesv1.ProfileCatalogSource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "catalog-mirrored",
+					Namespace: namespace,
+				},
+				Spec: profilesv1.ProfileCatalogSourceSpec{
+					Repos: []profilesv1.Repository{{URL: "github.com/weaveworks/profiles-examples"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, catalogSource)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, catalogSource)).Should(Succeed())
+			catalogReconciler.Profiles.Remove(types.NamespacedName{Namespace: namespace, Name: "catalog-mirrored"})
+			catalogReconciler.SetMirror(nil)
+		})
+
+		It("scans the mirrors", func() {
+			Eventually(func() []profilesv1.ProfileCatalogEntry {
+				return catalogReconciler.Profiles.Search("mirrored")
+			}, 2*time.Second).Should(HaveLen(1))
+			_, repo, auth, _, tags := fakeRepoScanner.ScanRepositoryArgsForCall(0)
+			Expect(repo.URL).To(Equal("github.com/weaveworks/profiles-examples"))
+			Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(BeNil())
+			Expect(tags).To(BeNil())
+		})
+
+		It("scans with the auth provider of the repository", func() {
+			tokenSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: namespace},
+				Data:       map[string][]byte{"token": []byte("glpat-token"), "username": []byte("oauth2")},
+			}
+			Expect(k8sClient.Create(ctx, tokenSecret)).To(Succeed())
+			tokenSource := &profilesv1.ProfileCatalogSource{
+				ObjectMeta: metav1.ObjectMeta{Name: "catalog-token", Namespace: namespace},
+				Spec: profilesv1.ProfileCatalogSourceSpec{
+					Repos: []profilesv1.Repository{{
+						URL:          "https://gitlab.com/weaveworks/private-profiles",
+						SecretRef:    &meta.NamespacedObjectReference{Name: "token"},
+						AuthProvider: profilesv1.TokenAuthProvider,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, tokenSource)).To(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(ctx, tokenSource)).To(Succeed())
+				catalogReconciler.Profiles.Remove(types.NamespacedName{Namespace: namespace, Name: "catalog-token"})
+			}()
+
+			Eventually(func() git.AuthProvider {
+				for i := 0; i < fakeRepoScanner.ScanRepositoryCallCount(); i++ {
+					_, repo, auth, _, _ := fakeRepoScanner.ScanRepositoryArgsForCall(i)
+					if repo.URL == "https://gitlab.com/weaveworks/private-profiles" {
+						return auth
+					}
+				}
+				return nil
+			}, 2*time.Second).ShouldNot(BeNil())
+			for i := 0; i < fakeRepoScanner.ScanRepositoryCallCount(); i++ {
+				_, repo, auth, _, _ := fakeRepoScanner.ScanRepositoryArgsForCall(i)
+				if repo.URL == "https://gitlab.com/weaveworks/private-profiles" {
+					Expect(auth.AuthMethod(ctx, repo.URL)).To(Equal(&githttp.BasicAuth{Username: "oauth2", Password: "glpat-token"}))
+				}
+			}
+		})
+
+		It("verifies the tags with the keys of the verification secret", func() {
+			public, _, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			sshKey, err := ssh.NewPublicKey(public)
+			Expect(err).NotTo(HaveOccurred())
+			keysSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "trusted-keys", Namespace: namespace},
+				Data:       map[string][]byte{"authorized_keys": ssh.MarshalAuthorizedKey(sshKey)},
+			}
+			Expect(k8sClient.Create(ctx, keysSecret)).To(Succeed())
+			verified := &profilesv1.ProfileCatalogSource{
+				ObjectMeta: metav1.ObjectMeta{Name: "catalog-verified", Namespace: namespace},
+				Spec: profilesv1.ProfileCatalogSourceSpec{
+					Repos: []profilesv1.Repository{{
+						URL:          "github.com/weaveworks/signed-profiles",
+						Verification: &profilesv1.Verification{SecretRef: meta.NamespacedObjectReference{Name: "trusted-keys"}},
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, verified)).To(Succeed())
+			defer func() {
+				Expect(k8sClient.Delete(ctx, verified)).To(Succeed())
+				catalogReconciler.Profiles.Remove(types.NamespacedName{Namespace: namespace, Name: "catalog-verified"})
+			}()
+
+			Eventually(func() *git.TrustedKeys {
+				for i := 0; i < fakeRepoScanner.ScanRepositoryCallCount(); i++ {
+					_, repo, _, keys, _ := fakeRepoScanner.ScanRepositoryArgsForCall(i)
+					if repo.URL == "github.com/weaveworks/signed-profiles" {
+						return keys
+					}
+				}
+				return nil
+			}, 2*time.Second).ShouldNot(BeNil())
+
+			By("scanning all tags again when the verification changes")
+			scannedVerification := func() string {
+				latest := &profilesv1.ProfileCatalogSource{}
+				Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(verified), latest)).To(Succeed())
+				if len(latest.Status.ScannedRepositories) == 0 {
+					return ""
+				}
+				return latest.Status.ScannedRepositories[0].Verification
+			}
+			Eventually(scannedVerification, 2*time.Second).ShouldNot(BeEmpty())
+			recorded := scannedVerification()
+			calls := fakeRepoScanner.ScanRepositoryCallCount()
+			Eventually(func() error {
+				latest := &profilesv1.ProfileCatalogSource{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(verified), latest); err != nil {
+					return err
+				}
+				latest.Spec.Repos[0].Verification.Mode = profilesv1.EnforceVerificationMode
+				return k8sClient.Update(ctx, latest)
+			}, 2*time.Second).Should(Succeed())
+			Eventually(scannedVerification, 2*time.Second).ShouldNot(Equal(recorded))
+			for i := calls; i < fakeRepoScanner.ScanRepositoryCallCount(); i++ {
+				_, repo, _, _, tags := fakeRepoScanner.ScanRepositoryArgsForCall(i)
+				if repo.URL == "github.com/weaveworks/signed-profiles" {
+					Expect(tags).To(BeNil())
+					break
+				}
+			}
+		})
+	})
 })
+
+// eventReasons returns the reasons of the events recorded for the object with the given name.
+func eventReasons(namespace, name string) []string {
+	events := &corev1.EventList{}
+	Expect(k8sClient.List(context.Background(), events, client.InNamespace(namespace))).To(Succeed())
+	var reasons []string
+	for _, event := range events.Items {
+		if event.InvolvedObject.Name == name {
+			reasons = append(reasons, event.Reason)
+		}
+	}
+	return reasons
+}
@@ -42,11 +42,12 @@ import (
 )
 
 var (
-	cfg               *rest.Config
-	k8sClient         client.Client
-	testEnv           *envtest.Environment
-	catalogReconciler *controllers.ProfileCatalogSourceReconciler
-	fakeRepoScanner   *fakes.FakeRepoScanner
+	cfg                      *rest.Config
+	k8sClient                client.Client
+	testEnv                  *envtest.Environment
+	catalogReconciler        *controllers.ProfileCatalogSourceReconciler
+	clusterCatalogReconciler *controllers.ClusterProfileCatalogSourceReconciler
+	fakeRepoScanner          *fakes.FakeRepoScanner
 )
 
 func TestAPIs(t *testing.T) {
@@ -100,6 +101,17 @@ var _ = BeforeSuite(func() {
 	err = catalogReconciler.SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
+	clusterCatalogReconciler = controllers.NewClusterCatalogSourceReconciler(
+		k8sManager.GetClient(),
+		ctrl.Log.WithName("controllers").WithName("clusterprofilecatalog"),
+		scheme.Scheme,
+		profiles,
+		"default",
+	)
+
+	err = clusterCatalogReconciler.SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
 	go func() {
 		err = k8sManager.Start(ctrl.SetupSignalHandler())
 		Expect(err).ToNot(HaveOccurred())
@@ -17,21 +17,38 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
 	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta1"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	"google.golang.org/grpc/test/bufconn"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/auth"
+	"github.com/weaveworks/profiles/pkg/certs"
 	"github.com/weaveworks/profiles/pkg/gateway"
+	"github.com/weaveworks/profiles/pkg/git"
 	pgrpc "github.com/weaveworks/profiles/pkg/grpc"
 	"github.com/weaveworks/profiles/pkg/interrupt"
 	"github.com/weaveworks/profiles/pkg/manager"
+	"github.com/weaveworks/profiles/pkg/metrics"
+	"github.com/weaveworks/profiles/pkg/mirror"
+	"github.com/weaveworks/profiles/pkg/ratelimit"
+	"github.com/weaveworks/profiles/pkg/receiver"
+	"github.com/weaveworks/profiles/pkg/tracing"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -46,6 +63,14 @@ import (
 	// +kubebuilder:scaffold:imports
 )
 
+const (
+	gatewayModeEndpoint = "endpoint"
+	gatewayModeServer   = "server"
+	gatewayModeBufconn  = "bufconn"
+
+	bufconnSize = 1024 * 1024
+)
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -62,13 +87,87 @@ func init() {
 }
 
 func main() {
-	var enableLeaderElection bool
-	var metricsAddr, probeAddr, apiAddr, grpcAddr string
+	var enableLeaderElection, enableWebhooks, tokenReview, clientCertificates, subjectAccessReview, singlePort, exposeGitMirror bool
+	var metricsAddr, probeAddr, apiAddr, grpcAddr, sharedNamespaces, clusterCatalogNamespace string
+	var requestsPerSecond float64
+	var burst int
+	var rateLimitConfig string
+	var tracingConfig tracing.Config
+	var gitMirrorDir, gitMirrorAddr, gitMirrorURL string
+	var webhookReceiverAddr, webhookReceiverSecretFile string
+	var gatewayMode, grpcCertFile, grpcKeyFile, grpcClientCAFile, apiCertFile, apiKeyFile, apiClientCAFile, gatewayCAFile, gatewayServerName string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&apiAddr, "profiles-api-bind-address", ":8000", "The address the profiles catalog api binds to.")
 	flag.StringVar(&grpcAddr, "profiles-grpc-bind-address", ":50051", "The address the profiles catalog grpc server binds to.")
+	flag.StringVar(&sharedNamespaces, "catalog-shared-namespaces", "",
+		"Comma separated list of namespaces whose catalog sources are visible to all callers of the profiles catalog api. "+
+			"Catalog sources in other namespaces are only visible to callers from the same namespace. "+
+			"If not set, catalog sources in all namespaces are visible to all callers.")
+	flag.StringVar(&clusterCatalogNamespace, "cluster-catalog-namespace", "profiles-system",
+		"The namespace GitRepository resources for scanning repositories of ClusterProfileCatalogSources are created in, "+
+			"unless the repository references a secret in another namespace.")
+	flag.BoolVar(&tokenReview, "auth-token-review", false,
+		"Authenticate callers of the profiles catalog api by their bearer token using the Kubernetes TokenReview API.")
+	flag.BoolVar(&clientCertificates, "auth-client-certificates", false,
+		"Authenticate callers of the profiles catalog grpc server by their verified TLS client certificate.")
+	flag.BoolVar(&subjectAccessReview, "auth-subject-access-review", false,
+		"Only serve the catalog sources the caller is allowed to get, checked with the Kubernetes SubjectAccessReview API. "+
+			"Requires --auth-token-review or --auth-client-certificates.")
+	flag.StringVar(&grpcCertFile, "grpc-tls-cert-file", "",
+		"The PEM encoded certificate the profiles catalog grpc server is served with. The file is reloaded when it changes.")
+	flag.StringVar(&grpcKeyFile, "grpc-tls-key-file", "", "The PEM encoded private key of --grpc-tls-cert-file.")
+	flag.StringVar(&grpcClientCAFile, "grpc-tls-client-ca-file", "",
+		"The PEM encoded CA bundle client certificates presented to the profiles catalog grpc server are verified with.")
+	flag.StringVar(&apiCertFile, "api-tls-cert-file", "",
+		"The PEM encoded certificate the profiles catalog api is served with. The file is reloaded when it changes.")
+	flag.StringVar(&apiKeyFile, "api-tls-key-file", "", "The PEM encoded private key of --api-tls-cert-file.")
+	flag.StringVar(&apiClientCAFile, "api-tls-client-ca-file", "",
+		"The PEM encoded CA bundle client certificates presented to the profiles catalog api are verified with. "+
+			"Authenticating api callers by these certificates with --auth-client-certificates requires --gateway-mode server.")
+	flag.StringVar(&gatewayCAFile, "gateway-grpc-ca-file", "",
+		"The PEM encoded CA bundle the profiles catalog api verifies the grpc server certificate with. "+
+			"If not set, the system roots are used. Requires --grpc-tls-cert-file.")
+	flag.StringVar(&gatewayServerName, "gateway-grpc-server-name", "localhost",
+		"The name the profiles catalog api expects in the grpc server certificate.")
+	flag.StringVar(&gatewayMode, "gateway-mode", gatewayModeEndpoint,
+		"How the profiles catalog api reaches the grpc server. One of: "+
+			"endpoint (dial the grpc bind address), server (call the catalog service in-process), "+
+			"bufconn (dial the grpc server over an in-memory connection).")
+	flag.BoolVar(&singlePort, "single-port", false,
+		"Serve the profiles catalog grpc server on the profiles catalog api address instead of its own address. "+
+			"Requires --gateway-mode server or bufconn.")
+	flag.Float64Var(&requestsPerSecond, "rate-limit", 0,
+		"The number of requests per second each client may send to the profiles catalog api and grpc server. "+
+			"Clients are identified by their username if authenticated, otherwise by their IP address. 0 disables rate limiting.")
+	flag.IntVar(&burst, "rate-limit-burst", 20, "The number of requests each client may send at once when rate limiting is enabled.")
+	flag.StringVar(&rateLimitConfig, "rate-limit-config", "",
+		"A YAML file, for example a mounted ConfigMap, configuring the rate limits of all and of single clients. "+
+			"Overrides --rate-limit and --rate-limit-burst.")
+	flag.StringVar(&tracingConfig.Endpoint, "tracing-otlp-endpoint", "",
+		"The host:port of an OTLP gRPC receiver to export traces of reconciles, scans and api calls to. If empty, no traces are exported.")
+	flag.BoolVar(&tracingConfig.Insecure, "tracing-otlp-insecure", false, "Connect to the OTLP receiver without TLS.")
+	flag.Float64Var(&tracingConfig.SampleRatio, "tracing-sample-ratio", 1,
+		"The fraction of traces to sample, between 0 and 1. Traces continued from a sampled caller are always sampled.")
 
+	flag.StringVar(&gitMirrorDir, "git-mirror-dir", "",
+		"The directory to keep bare mirrors of the tags of the catalog repositories in. If set, repositories are scanned "+
+			"from their mirrors, which are served over HTTP at --git-mirror-bind-address.")
+	flag.StringVar(&gitMirrorAddr, "git-mirror-bind-address", "127.0.0.1:8090",
+		"The address the git mirror server binds to. Addresses other than localhost require --git-mirror-expose.")
+	flag.BoolVar(&exposeGitMirror, "git-mirror-expose", false,
+		"Allow the git mirror server to bind to addresses other than localhost. The mirrors are served without authentication, "+
+			"so everyone reaching the address can clone the mirrors of all repositories, including private ones.")
+	flag.StringVar(&gitMirrorURL, "git-mirror-url", "",
+		"The URL the git mirror server is reachable at, for example http://profiles-git-mirror.profiles-system:8090. "+
+			"The catalog lists the URLs of the mirrors of the profiles, which installations fetch the profiles from. Requires --git-mirror-expose.")
+	flag.StringVar(&webhookReceiverAddr, "webhook-receiver-bind-address", "",
+		"The address the receiver of push webhooks of git providers binds to. If empty, the receiver is disabled.")
+	flag.StringVar(&webhookReceiverSecretFile, "webhook-receiver-secret-file", "",
+		"The file containing the secret the push webhooks are signed with. Required by --webhook-receiver-bind-address.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the defaulting and validating admission webhooks of the profile resources on port 9443. "+
+			"The serving certificate is read from /tmp/k8s-webhook-server/serving-certs.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -80,6 +179,13 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	tracingConfig.ServiceName = "profiles-controller"
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Namespace:              "",
 		Scheme:                 scheme,
@@ -95,16 +201,80 @@ func main() {
 	}
 
 	profileCatalog := catalog.New()
+	if err := metrics.RegisterCatalog(profileCatalog); err != nil {
+		setupLog.Error(err, "unable to register catalog metrics")
+		os.Exit(1)
+	}
 
-	if err = controllers.NewCatalogSourceReconciler(
+	var services []interrupt.Service
+	catalogReconciler := controllers.NewCatalogSourceReconciler(
 		mgr.GetClient(),
 		ctrl.Log.WithName("controllers").WithName("ProfileCatalogSource"),
 		mgr.GetScheme(),
 		profileCatalog,
-	).SetupWithManager(mgr); err != nil {
+	)
+	clusterCatalogReconciler := controllers.NewClusterCatalogSourceReconciler(
+		mgr.GetClient(),
+		ctrl.Log.WithName("controllers").WithName("ClusterProfileCatalogSource"),
+		mgr.GetScheme(),
+		profileCatalog,
+		clusterCatalogNamespace,
+	)
+	if gitMirrorDir != "" {
+		if !exposeGitMirror && !mirror.IsLocalAddress(gitMirrorAddr) {
+			setupLog.Error(fmt.Errorf("git mirror server not exposed"), "--git-mirror-bind-address other than localhost requires --git-mirror-expose")
+			os.Exit(1)
+		}
+		if gitMirrorURL != "" && (!exposeGitMirror || mirror.IsLocalAddress(gitMirrorAddr)) {
+			// Flux fetches the profiles of installations from the URL listed in the catalog
+			setupLog.Error(fmt.Errorf("git mirror server not exposed"),
+				"--git-mirror-url requires --git-mirror-expose and a --git-mirror-bind-address other than localhost")
+			os.Exit(1)
+		}
+		gitMirror := mirror.New(gitMirrorDir, gitMirrorURL, &git.Client{})
+		catalogReconciler.SetMirror(gitMirror)
+		clusterCatalogReconciler.SetMirror(gitMirror)
+		services = append(services, mirror.NewServer(setupLog, gitMirrorAddr, gitMirror))
+	}
+	if webhookReceiverAddr != "" {
+		if webhookReceiverSecretFile == "" {
+			setupLog.Error(fmt.Errorf("no webhook secret configured"), "--webhook-receiver-bind-address requires --webhook-receiver-secret-file")
+			os.Exit(1)
+		}
+		secret, err := ioutil.ReadFile(webhookReceiverSecretFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read webhook secret")
+			os.Exit(1)
+		}
+		webhookReceiver, err := receiver.New(ctrl.Log.WithName("receiver"), mgr.GetClient(), bytes.TrimSpace(secret))
+		if err != nil {
+			setupLog.Error(err, "invalid webhook secret", "file", webhookReceiverSecretFile)
+			os.Exit(1)
+		}
+		services = append(services, receiver.NewServer(setupLog, webhookReceiverAddr, webhookReceiver))
+	}
+	if err = catalogReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ProfileCatalogSource")
 		os.Exit(1)
 	}
+	if err = clusterCatalogReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterProfileCatalogSource")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if err = (&profilesv1.ProfileCatalogSource{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ProfileCatalogSource")
+			os.Exit(1)
+		}
+		if err = (&profilesv1.ClusterProfileCatalogSource{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterProfileCatalogSource")
+			os.Exit(1)
+		}
+		if err = (&profilesv1.ProfileInstallation{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ProfileInstallation")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
@@ -116,17 +286,149 @@ func main() {
 		os.Exit(1)
 	}
 
-	grpcServer := pgrpc.NewServer(setupLog, profileCatalog, grpcAddr)
-	setupLog.Info(fmt.Sprintf("starting profiles grpc server at %s", grpcAddr))
+	var visibility api.Visibility = api.AllNamespaces{}
+	if sharedNamespaces != "" {
+		visibility = api.NewSharedNamespaces(strings.Split(sharedNamespaces, ",")...)
+	}
 
+	var authenticators auth.Authenticators
+	if tokenReview {
+		authenticators = append(authenticators, auth.NewTokenReviewAuthenticator(mgr.GetClient()))
+	}
+	if clientCertificates {
+		authenticators = append(authenticators, auth.CertificateAuthenticator{})
+	}
+	var grpcOpts []pgrpc.Option
+	var gatewayOpts []gateway.Option
+	if grpcCertFile != "" {
+		grpcCerts, err := certs.NewWatcher(setupLog, grpcCertFile, grpcKeyFile, grpcClientCAFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load grpc server certificates")
+			os.Exit(1)
+		}
+		services = append(services, grpcCerts)
+		grpcOpts = append(grpcOpts, pgrpc.WithTLS(grpcCerts.ServerConfig()))
+
+		dialTLS := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: gatewayServerName}
+		if gatewayCAFile != "" {
+			gatewayCerts, err := certs.NewWatcher(setupLog, "", "", gatewayCAFile)
+			if err != nil {
+				setupLog.Error(err, "unable to load gateway CA")
+				os.Exit(1)
+			}
+			services = append(services, gatewayCerts)
+			dialTLS = gatewayCerts.ClientConfig(gatewayServerName)
+		}
+		gatewayOpts = append(gatewayOpts, gateway.WithDialTLS(dialTLS))
+	} else if gatewayCAFile != "" {
+		setupLog.Error(fmt.Errorf("no grpc server certificate configured"), "--gateway-grpc-ca-file requires --grpc-tls-cert-file")
+		os.Exit(1)
+	} else if clientCertificates && !(singlePort && apiCertFile != "") {
+		setupLog.Error(fmt.Errorf("no grpc server certificate configured"),
+			"--auth-client-certificates requires --grpc-tls-cert-file, or --api-tls-cert-file with --single-port")
+		os.Exit(1)
+	}
+	if apiCertFile != "" {
+		apiCerts, err := certs.NewWatcher(setupLog, apiCertFile, apiKeyFile, apiClientCAFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load api server certificates")
+			os.Exit(1)
+		}
+		services = append(services, apiCerts)
+		gatewayOpts = append(gatewayOpts, gateway.WithTLS(apiCerts.ServerConfig()))
+	}
+	if clientCertificates && apiClientCAFile != "" && gatewayMode != gatewayModeServer {
+		setupLog.Error(fmt.Errorf("client certificates of api callers can't be forwarded to the grpc server"),
+			"--auth-client-certificates with --api-tls-client-ca-file requires --gateway-mode server")
+		os.Exit(1)
+	}
+
+	rateLimits := ratelimit.Config{Quota: ratelimit.Quota{RequestsPerSecond: requestsPerSecond, Burst: burst}}
+	if rateLimitConfig != "" {
+		rateLimits, err = ratelimit.LoadConfig(rateLimitConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to load rate limit config")
+			os.Exit(1)
+		}
+	}
+	var limiter *ratelimit.Limiter
+	if rateLimits.RequestsPerSecond > 0 || len(rateLimits.Clients) > 0 {
+		// clients are checked by their address before their credentials are reviewed, and charged
+		// once, by their identity if they are authenticated
+		limiter = ratelimit.New(rateLimits)
+		grpcOpts = append(grpcOpts, pgrpc.WithInterceptors(
+			ratelimit.UnaryServerInterceptor(limiter),
+			ratelimit.StreamServerInterceptor(limiter),
+		))
+	}
+	if len(authenticators) > 0 {
+		grpcOpts = append(grpcOpts, pgrpc.WithInterceptors(
+			auth.UnaryServerInterceptor(authenticators),
+			auth.StreamServerInterceptor(authenticators),
+		))
+	}
+	if limiter != nil {
+		grpcOpts = append(grpcOpts, pgrpc.WithInterceptors(
+			ratelimit.UnaryCallerInterceptor(limiter),
+			ratelimit.StreamCallerInterceptor(limiter),
+		))
+	}
+	if subjectAccessReview {
+		if len(authenticators) == 0 {
+			setupLog.Error(fmt.Errorf("no authentication configured"), "--auth-subject-access-review requires authentication")
+			os.Exit(1)
+		}
+		visibility = api.AllOf{visibility, auth.NewSubjectAccessReviewer(mgr.GetClient(), ctrl.Log.WithName("auth"), time.Minute)}
+	}
+
+	var inMemory *bufconn.Listener
+	switch gatewayMode {
+	case gatewayModeEndpoint:
+		if singlePort {
+			setupLog.Error(fmt.Errorf("invalid gateway mode %q", gatewayMode), "--single-port requires --gateway-mode server or bufconn")
+			os.Exit(1)
+		}
+	case gatewayModeServer:
+	case gatewayModeBufconn:
+		inMemory = bufconn.Listen(bufconnSize)
+		grpcOpts = append(grpcOpts, pgrpc.WithListener(inMemory))
+		gatewayOpts = append(gatewayOpts, gateway.WithDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return inMemory.DialContext(ctx)
+		}))
+	default:
+		setupLog.Error(fmt.Errorf("unknown gateway mode %q", gatewayMode), "invalid --gateway-mode")
+		os.Exit(1)
+	}
+
+	grpcBindAddr := grpcAddr
+	if singlePort {
+		grpcBindAddr = ""
+	}
+	grpcServer := pgrpc.NewServer(setupLog, profileCatalog, visibility, grpcBindAddr, grpcOpts...)
+	if singlePort {
+		setupLog.Info(fmt.Sprintf("starting profiles grpc server at: %s", apiAddr))
+	} else {
+		setupLog.Info(fmt.Sprintf("starting profiles grpc server at %s", grpcAddr))
+	}
+
+	if gatewayMode == gatewayModeServer {
+		gatewayOpts = append(gatewayOpts, gateway.WithCatalogServer(grpcServer.CatalogServer()))
+	}
+	if singlePort {
+		gatewayOpts = append(gatewayOpts, gateway.WithGRPCHandler(grpcServer))
+	}
 	setupLog.Info(fmt.Sprintf("starting gateway server at: %s", apiAddr))
-	gatewayServer := gateway.NewServer(setupLog, apiAddr, grpcAddr)
+	gatewayServer := gateway.NewServer(setupLog, apiAddr, grpcAddr, gatewayOpts...)
 
 	setupLog.Info("starting manager")
 	managerServer := manager.NewServer(setupLog, mgr)
 
-	handler := interrupt.NewInterruptHandler(setupLog, grpcServer, gatewayServer, managerServer)
+	services = append(services, grpcServer, gatewayServer, managerServer)
+	handler := interrupt.NewInterruptHandler(setupLog, services...)
 	if err := handler.ListenAndGracefulShutdown(); err != nil {
 		setupLog.Error(err, "failed to listen and graceful shutdown services")
 	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "failed to flush traces")
+	}
 }
@@ -2,19 +2,18 @@ package api
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/go-logr/logr"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/types"
 
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/metrics"
 	"github.com/weaveworks/profiles/pkg/protos"
 )
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
 //counterfeiter:generate -o fakes/fake_catalog.go . Catalog
-// Catalog is an interface for the Catalog
+// Catalog is an interface for a consistent, point-in-time view of the Catalog
 type Catalog interface {
 	// Get will return a specific profile from the catalog
 	Get(sourceName, profileName string) *profilesv1.ProfileCatalogEntry
@@ -26,6 +25,20 @@ type Catalog interface {
 	Search(query string) []profilesv1.ProfileCatalogEntry
 	// SearchAll will return a list of all profiles
 	SearchAll() []profilesv1.ProfileCatalogEntry
+	// Generation returns the generation of the catalog the view was taken from
+	Generation() uint64
+	// Resolve returns the catalog source with the given name, or an error if there is none or the name is ambiguous
+	Resolve(sourceName string) (types.NamespacedName, error)
+	// Profiles returns the profiles listed by the catalog source
+	Profiles(source types.NamespacedName) []profilesv1.ProfileCatalogEntry
+}
+
+//counterfeiter:generate -o fakes/fake_snapshotter.go . Snapshotter
+// Snapshotter hands out views of the Catalog. Every request is served from a single view
+// so the results and the generation returned to the caller are consistent.
+type Snapshotter interface {
+	// Snapshot returns a view containing the catalog sources for which visible returns true
+	Snapshot(visible func(source types.NamespacedName) bool) Catalog
 }
 
 // CatalogAPI defines the GRPC profiles catalog service API.
@@ -35,36 +48,65 @@ type CatalogAPI interface {
 
 // ProfilesCatalogService is the profiles catalog service implementor.
 type ProfilesCatalogService struct {
-	profileCatalog Catalog
+	profileCatalog Snapshotter
+	visibility     Visibility
 	logger         logr.Logger
 }
 
 var _ protos.ProfilesServiceServer = &ProfilesCatalogService{}
 
 // NewCatalogAPI returns a profiles catalog api implementation.
-func NewCatalogAPI(profileCatalog Catalog, logger logr.Logger) *ProfilesCatalogService {
+func NewCatalogAPI(profileCatalog Snapshotter, visibility Visibility, logger logr.Logger) *ProfilesCatalogService {
 	return &ProfilesCatalogService{
 		profileCatalog: profileCatalog,
+		visibility:     visibility,
 		logger:         logger,
 	}
 }
 
+// snapshot returns a view of the catalog containing the catalog sources visible to the caller.
+// If namespace is set, the view is restricted to the catalog sources in that namespace.
+func (p *ProfilesCatalogService) snapshot(ctx context.Context, namespace string) Catalog {
+	return p.profileCatalog.Snapshot(func(source types.NamespacedName) bool {
+		if namespace != "" && source.Namespace != namespace {
+			return false
+		}
+		return p.visibility.Visible(ctx, source)
+	})
+}
+
+// recordLookup counts a lookup of method as a hit if the profile was found, otherwise as a miss.
+func recordLookup(method string, found bool) {
+	result := metrics.LookupMiss
+	if found {
+		result = metrics.LookupHit
+	}
+	metrics.CatalogLookups.WithLabelValues(method, result).Inc()
+}
+
 // Get will return a specific profile from the catalog
 func (p *ProfilesCatalogService) Get(ctx context.Context, request *protos.GetRequest) (*protos.GetResponse, error) {
 	sourceName := request.GetSourceName()
 	profileName := request.GetProfileName()
-	logger := p.logger.WithValues("func", "Get", "catalog", sourceName, "profile", profileName)
+	logger := p.logger.WithValues("func", "Get", "namespace", request.GetNamespace(), "catalog", sourceName, "profile", profileName)
 	if sourceName == "" || profileName == "" {
-		errMsg := fmt.Errorf("missing query param: sourceName: %q, profileName: %q", sourceName, profileName)
-		logger.Error(errMsg, "profile and/or catalog not set")
-		return nil, status.Errorf(codes.InvalidArgument, errMsg.Error())
+		err := missingArguments(field{"sourceName", sourceName}, field{"profileName", profileName})
+		logger.Error(err, "profile and/or catalog not set")
+		return nil, err
 	}
-	result := p.profileCatalog.Get(sourceName, profileName)
+	snapshot := p.snapshot(ctx, request.GetNamespace())
+	if err := ambiguousCatalog(snapshot, sourceName); err != nil {
+		logger.Error(err, "catalog is ambiguous")
+		return nil, err
+	}
+	result := snapshot.Get(sourceName, profileName)
+	recordLookup("Get", result != nil)
 	if result == nil {
-		return nil, status.Errorf(codes.NotFound, "profile not found")
+		return nil, profileNotFound(snapshot, request.GetNamespace(), sourceName, profileName, "")
 	}
 	return &protos.GetResponse{
-		Item: protos.TransformCatalogEntry(result),
+		Item:       protos.TransformCatalogEntry(result),
+		Generation: snapshot.Generation(),
 	}, nil
 }
 
@@ -73,18 +115,25 @@ func (p *ProfilesCatalogService) GetWithVersion(ctx context.Context, request *pr
 	sourceName := request.GetSourceName()
 	profileName := request.GetProfileName()
 	version := request.GetVersion()
-	logger := p.logger.WithValues("func", "GetWithVersion", "catalog", sourceName, "profile", profileName, "version", version)
+	logger := p.logger.WithValues("func", "GetWithVersion", "namespace", request.GetNamespace(), "catalog", sourceName, "profile", profileName, "version", version)
 	if sourceName == "" || profileName == "" || version == "" {
-		errMsg := fmt.Errorf("missing query param: sourceName: %q, profileName: %q, version: %q", sourceName, profileName, version)
-		logger.Error(errMsg, "catalog, profile and/or version not set")
-		return nil, status.Errorf(codes.InvalidArgument, errMsg.Error())
+		err := missingArguments(field{"sourceName", sourceName}, field{"profileName", profileName}, field{"version", version})
+		logger.Error(err, "catalog, profile and/or version not set")
+		return nil, err
+	}
+	snapshot := p.snapshot(ctx, request.GetNamespace())
+	if err := ambiguousCatalog(snapshot, sourceName); err != nil {
+		logger.Error(err, "catalog is ambiguous")
+		return nil, err
 	}
-	result := p.profileCatalog.GetWithVersion(logger, sourceName, profileName, version)
+	result := snapshot.GetWithVersion(logger, sourceName, profileName, version)
+	recordLookup("GetWithVersion", result != nil)
 	if result == nil {
-		return nil, status.Errorf(codes.NotFound, "profile not found")
+		return nil, profileNotFound(snapshot, request.GetNamespace(), sourceName, profileName, version)
 	}
 	return &protos.GetWithVersionResponse{
-		Item: protos.TransformCatalogEntry(result),
+		Item:       protos.TransformCatalogEntry(result),
+		Generation: snapshot.Generation(),
 	}, nil
 }
 
@@ -93,37 +142,60 @@ func (p *ProfilesCatalogService) ProfilesGreaterThanVersion(ctx context.Context,
 	sourceName := request.GetSourceName()
 	profileName := request.GetProfileName()
 	version := request.GetVersion()
-	logger := p.logger.WithValues("func", "ProfilesGreaterThanVersion", "catalog", sourceName, "profile", profileName, "version", version)
+	logger := p.logger.WithValues("func", "ProfilesGreaterThanVersion", "namespace", request.GetNamespace(), "catalog", sourceName, "profile", profileName, "version", version)
 	if sourceName == "" || profileName == "" || version == "" {
-		errMsg := fmt.Errorf("missing query param: sourceName: %q, profileName: %q, version: %q", sourceName, profileName, version)
-		logger.Error(errMsg, "catalog, profile and/or version not set")
-		return nil, status.Errorf(codes.InvalidArgument, errMsg.Error())
+		err := missingArguments(field{"sourceName", sourceName}, field{"profileName", profileName}, field{"version", version})
+		logger.Error(err, "catalog, profile and/or version not set")
+		return nil, err
 	}
-	result := p.profileCatalog.ProfilesGreaterThanVersion(logger, sourceName, profileName, version)
+	snapshot := p.snapshot(ctx, request.GetNamespace())
+	if err := ambiguousCatalog(snapshot, sourceName); err != nil {
+		logger.Error(err, "catalog is ambiguous")
+		return nil, err
+	}
+	result := snapshot.ProfilesGreaterThanVersion(logger, sourceName, profileName, version)
+	recordLookup("ProfilesGreaterThanVersion", len(result) > 0)
 	if len(result) == 0 {
-		return nil, status.Errorf(codes.NotFound, "profile not found")
+		return nil, profileNotFound(snapshot, request.GetNamespace(), sourceName, profileName, version)
 	}
 	logger.Info("profile found", "profile", result)
 	return &protos.ProfilesGreaterThanVersionResponse{
-		Items: protos.TransformCatalogEntryList(result),
+		Items:      protos.TransformCatalogEntryList(result),
+		Generation: snapshot.Generation(),
 	}, nil
 }
 
 // Search will return a list of profiles which match query
 func (p *ProfilesCatalogService) Search(ctx context.Context, request *protos.SearchRequest) (*protos.SearchResponse, error) {
 	query := request.GetName()
-	logger := p.logger.WithValues("func", "Search", "name", query)
+	logger := p.logger.WithValues("func", "Search", "namespace", request.GetNamespace(), "name", query)
+	snapshot := p.snapshot(ctx, request.GetNamespace())
 	var result []profilesv1.ProfileCatalogEntry
 	if query == "" {
 		logger.Info("Searching for all available profiles")
-		result = p.profileCatalog.SearchAll()
+		result = snapshot.SearchAll()
 	} else {
 		logger.Info("Searching for profiles matching name", "name", query)
-		result = p.profileCatalog.Search(query)
+		result = snapshot.Search(query)
+	}
+	if request.GetVerified() {
+		result = verifiedProfiles(result)
 	}
 
 	logger.Info("found profiles", "profiles", result)
 	return &protos.SearchResponse{
-		Items: protos.TransformCatalogEntryList(result),
+		Items:      protos.TransformCatalogEntryList(result),
+		Generation: snapshot.Generation(),
 	}, nil
 }
+
+// verifiedProfiles returns the profiles whose tag or commit is signed by a trusted key of their repository.
+func verifiedProfiles(profiles []profilesv1.ProfileCatalogEntry) []profilesv1.ProfileCatalogEntry {
+	var verified []profilesv1.ProfileCatalogEntry
+	for _, profile := range profiles {
+		if profile.Verified {
+			verified = append(verified, profile)
+		}
+	}
+	return verified
+}
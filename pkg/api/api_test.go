@@ -6,24 +6,34 @@ import (
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/types"
 
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
 	"github.com/weaveworks/profiles/pkg/api"
 	catfakes "github.com/weaveworks/profiles/pkg/api/fakes"
+	"github.com/weaveworks/profiles/pkg/catalog"
 	"github.com/weaveworks/profiles/pkg/protos"
 )
 
 var _ = Describe("API", func() {
 	var (
-		catalogAPI  api.CatalogAPI
-		fakeCatalog *catfakes.FakeCatalog
+		catalogAPI      api.CatalogAPI
+		fakeCatalog     *catfakes.FakeCatalog
+		fakeSnapshotter *catfakes.FakeSnapshotter
+		fakeVisibility  *catfakes.FakeVisibility
 	)
 
 	BeforeEach(func() {
 		fakeCatalog = new(catfakes.FakeCatalog)
-		catalogAPI = api.NewCatalogAPI(fakeCatalog, logr.Discard())
+		fakeCatalog.GenerationReturns(3)
+		fakeSnapshotter = new(catfakes.FakeSnapshotter)
+		fakeSnapshotter.SnapshotReturns(fakeCatalog)
+		fakeVisibility = new(catfakes.FakeVisibility)
+		fakeVisibility.VisibleReturns(true)
+		catalogAPI = api.NewCatalogAPI(fakeSnapshotter, fakeVisibility, logr.Discard())
 	})
 
 	Context("Get", func() {
@@ -50,6 +60,7 @@ var _ = Describe("API", func() {
 						Name:          "nginx-1",
 						Description:   "nginx 1",
 					},
+					Generation: 3,
 				}
 				Expect(result).To(Equal(expected))
 			})
@@ -119,6 +130,7 @@ var _ = Describe("API", func() {
 						Description:   "nginx 1",
 						Tag:           "v0.0.1",
 					},
+					Generation: 3,
 				}
 				Expect(result).To(Equal(expected))
 			})
@@ -204,6 +216,7 @@ var _ = Describe("API", func() {
 							Description:   "nginx 1",
 						},
 					},
+					Generation: 3,
 				}
 				Expect(result).To(Equal(expected))
 			})
@@ -243,15 +256,56 @@ var _ = Describe("API", func() {
 							Description:   "redis 1",
 						},
 					},
+					Generation: 3,
 				}
 				Expect(result).To(Equal(expected))
 			})
 		})
+		When("only verified profiles are requested", func() {
+			BeforeEach(func() {
+				fakeCatalog.SearchAllReturns([]profilesv1.ProfileCatalogEntry{
+					{Name: "nginx-1", CatalogSource: "foo", Verified: true, SigningKey: "SHA256:key"},
+					{Name: "redis-1", CatalogSource: "foo"},
+				})
+			})
+			It("returns the verified profiles", func() {
+				result, err := catalogAPI.Search(context.Background(), &protos.SearchRequest{Verified: true})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Items).To(Equal([]*protos.ProfileCatalogEntry{
+					{CatalogSource: "foo", Name: "nginx-1", Verified: true, SigningKey: "SHA256:key"},
+				}))
+			})
+		})
 		When("there are no profiles", func() {
 			It("returns an empty response", func() {
 				result, err := catalogAPI.Search(context.Background(), &protos.SearchRequest{})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(result.Items).To(BeEmpty())
+				Expect(result.Generation).To(Equal(uint64(3)))
+			})
+		})
+		It("serves the results and the generation from a single snapshot", func() {
+			_, err := catalogAPI.Search(context.Background(), &protos.SearchRequest{Name: "nginx"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeSnapshotter.SnapshotCallCount()).To(Equal(1))
+		})
+		It("serves the catalog sources visible to the caller", func() {
+			fakeVisibility.VisibleStub = func(_ context.Context, source types.NamespacedName) bool {
+				return source.Namespace != "hidden"
+			}
+			_, err := catalogAPI.Search(context.Background(), &protos.SearchRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			visible := fakeSnapshotter.SnapshotArgsForCall(0)
+			Expect(visible(types.NamespacedName{Namespace: "default", Name: "foo"})).To(BeTrue())
+			Expect(visible(types.NamespacedName{Namespace: "hidden", Name: "foo"})).To(BeFalse())
+		})
+		When("a namespace is given", func() {
+			It("only serves the catalog sources in that namespace", func() {
+				_, err := catalogAPI.Search(context.Background(), &protos.SearchRequest{Namespace: "team-a"})
+				Expect(err).NotTo(HaveOccurred())
+				visible := fakeSnapshotter.SnapshotArgsForCall(0)
+				Expect(visible(types.NamespacedName{Namespace: "team-a", Name: "foo"})).To(BeTrue())
+				Expect(visible(types.NamespacedName{Namespace: "team-b", Name: "foo"})).To(BeFalse())
 			})
 		})
 	})
@@ -283,6 +337,7 @@ var _ = Describe("API", func() {
 						Description:   "nginx 1",
 						Tag:           "v0.0.2",
 					}},
+					Generation: 3,
 				}
 				Expect(result).To(Equal(expected))
 			})
@@ -341,4 +396,162 @@ var _ = Describe("API", func() {
 			})
 		})
 	})
+	Context("error details", func() {
+		var profiles []profilesv1.ProfileCatalogEntry
+
+		BeforeEach(func() {
+			profiles = []profilesv1.ProfileCatalogEntry{
+				{CatalogSource: "foo", CatalogNamespace: "default", Name: "nginx", Tag: "v0.1.0"},
+				{CatalogSource: "foo", CatalogNamespace: "default", Name: "nginx", Tag: "nginx/v0.2.0"},
+				{CatalogSource: "foo", CatalogNamespace: "default", Name: "nginx-ingress", Tag: "v1.0.0"},
+				{CatalogSource: "foo", CatalogNamespace: "default", Name: "podinfo", Tag: "v1.0.0"},
+				{CatalogSource: "bar", CatalogNamespace: "default", Name: "nginx", Tag: "v0.1.0"},
+				{CatalogSource: "bar", CatalogNamespace: "default", Name: "podinfo", Tag: "v2.0.0"},
+			}
+			fakeCatalog.SearchAllStub = func() []profilesv1.ProfileCatalogEntry {
+				return profiles
+			}
+			fakeCatalog.ResolveStub = func(sourceName string) (types.NamespacedName, error) {
+				switch sourceName {
+				case "foo", "bar", "empty":
+					return types.NamespacedName{Namespace: "default", Name: sourceName}, nil
+				}
+				return types.NamespacedName{}, catalog.ErrSourceNotFound
+			}
+			fakeCatalog.ProfilesStub = func(source types.NamespacedName) []profilesv1.ProfileCatalogEntry {
+				var result []profilesv1.ProfileCatalogEntry
+				for _, p := range profiles {
+					if p.CatalogSource == source.Name && p.CatalogNamespace == source.Namespace {
+						result = append(result, p)
+					}
+				}
+				return result
+			}
+		})
+
+		errorInfo := func(err error) *errdetails.ErrorInfo {
+			for _, detail := range status.Convert(err).Details() {
+				if info, ok := detail.(*errdetails.ErrorInfo); ok {
+					return info
+				}
+			}
+			return nil
+		}
+
+		When("arguments are missing", func() {
+			It("lists the missing fields", func() {
+				_, err := catalogAPI.GetWithVersion(context.Background(), &protos.GetWithVersionRequest{ProfileName: "nginx"})
+				details := status.Convert(err).Details()
+				Expect(details).To(HaveLen(2))
+				Expect(details[0].(*errdetails.ErrorInfo).Reason).To(Equal(api.ReasonMissingArguments))
+				Expect(details[1].(*errdetails.BadRequest).FieldViolations).To(ConsistOf(
+					&errdetails.BadRequest_FieldViolation{Field: "sourceName", Description: "sourceName must not be empty"},
+					&errdetails.BadRequest_FieldViolation{Field: "version", Description: "version must not be empty"},
+				))
+			})
+		})
+
+		When("the catalog doesn't exist", func() {
+			It("suggests similar catalog names", func() {
+				_, err := catalogAPI.Get(context.Background(), &protos.GetRequest{SourceName: "fo", ProfileName: "nginx", Namespace: "default"})
+				info := errorInfo(err)
+				Expect(info.Reason).To(Equal(api.ReasonCatalogNotFound))
+				Expect(info.Domain).To(Equal(api.ErrorDomain))
+				Expect(info.Metadata).To(Equal(map[string]string{
+					api.MetadataCatalog:     "fo",
+					api.MetadataNamespace:   "default",
+					api.MetadataProfile:     "nginx",
+					api.MetadataSuggestions: "foo",
+				}))
+			})
+		})
+
+		When("the catalog exists in several namespaces", func() {
+			BeforeEach(func() {
+				fakeCatalog.ResolveReturns(types.NamespacedName{}, &catalog.AmbiguousSourceError{
+					Name:    "foo",
+					Sources: []types.NamespacedName{{Namespace: "default", Name: "foo"}, {Namespace: "team-a", Name: "foo"}},
+				})
+			})
+
+			It("asks for the namespace", func() {
+				_, err := catalogAPI.Get(context.Background(), &protos.GetRequest{SourceName: "foo", ProfileName: "nginx"})
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+				Expect(fakeCatalog.GetCallCount()).To(BeZero())
+				info := errorInfo(err)
+				Expect(info.Reason).To(Equal(api.ReasonAmbiguousCatalog))
+				Expect(info.Metadata).To(Equal(map[string]string{
+					api.MetadataCatalog:    "foo",
+					api.MetadataNamespaces: "default,team-a",
+				}))
+				Expect(status.Convert(err).Details()[1].(*errdetails.BadRequest).FieldViolations[0].Field).To(Equal("namespace"))
+			})
+		})
+
+		When("the profile doesn't exist", func() {
+			It("suggests similar profile names", func() {
+				_, err := catalogAPI.Get(context.Background(), &protos.GetRequest{SourceName: "foo", ProfileName: "ngnix"})
+				Expect(status.Code(err)).To(Equal(codes.NotFound))
+				Expect(errorInfo(err).Reason).To(Equal(api.ReasonProfileNotFound))
+				Expect(errorInfo(err).Metadata).To(HaveKeyWithValue(api.MetadataSuggestions, "nginx"))
+				Expect(errorInfo(err).Metadata).To(HaveKeyWithValue(api.MetadataNamespace, "default"))
+			})
+		})
+
+		When("the catalog doesn't list any profile", func() {
+			It("reports the profile as not found", func() {
+				_, err := catalogAPI.Get(context.Background(), &protos.GetRequest{SourceName: "empty", ProfileName: "nginx"})
+				Expect(status.Code(err)).To(Equal(codes.NotFound))
+				Expect(errorInfo(err).Reason).To(Equal(api.ReasonProfileNotFound))
+				Expect(errorInfo(err).Metadata).NotTo(HaveKey(api.MetadataSuggestions))
+			})
+		})
+
+		When("the version doesn't exist", func() {
+			It("lists the known versions", func() {
+				_, err := catalogAPI.GetWithVersion(context.Background(), &protos.GetWithVersionRequest{SourceName: "foo", ProfileName: "nginx", Version: "v0.3.0"})
+				Expect(errorInfo(err).Reason).To(Equal(api.ReasonVersionNotFound))
+				Expect(errorInfo(err).Metadata).To(HaveKeyWithValue(api.MetadataVersion, "v0.3.0"))
+				Expect(errorInfo(err).Metadata).To(HaveKeyWithValue(api.MetadataKnownVersions, "v0.1.0,v0.2.0"))
+			})
+		})
+
+		When("another catalog lists the profile", func() {
+			It("only considers the profiles of the requested catalog", func() {
+				_, err := catalogAPI.GetWithVersion(context.Background(), &protos.GetWithVersionRequest{SourceName: "foo", ProfileName: "podinfo", Version: "v2.0.0"})
+				Expect(errorInfo(err).Reason).To(Equal(api.ReasonVersionNotFound))
+				Expect(errorInfo(err).Metadata).To(HaveKeyWithValue(api.MetadataKnownVersions, "v1.0.0"))
+				Expect(fakeCatalog.ProfilesArgsForCall(0)).To(Equal(types.NamespacedName{Namespace: "default", Name: "foo"}))
+			})
+		})
+	})
+})
+
+var _ = Describe("SharedNamespaces", func() {
+	var visibility *api.SharedNamespaces
+
+	BeforeEach(func() {
+		visibility = api.NewSharedNamespaces("profiles-system")
+	})
+
+	It("makes shared namespaces and cluster scoped catalog sources visible to all callers", func() {
+		Expect(visibility.Visible(context.Background(), types.NamespacedName{Namespace: "profiles-system", Name: "foo"})).To(BeTrue())
+		Expect(visibility.Visible(context.Background(), types.NamespacedName{Name: "foo"})).To(BeTrue())
+		Expect(visibility.Visible(context.Background(), types.NamespacedName{Namespace: "team-a", Name: "foo"})).To(BeFalse())
+	})
+
+	It("makes the namespace of the caller visible to the caller", func() {
+		ctx := api.NewContextWithCaller(context.Background(), api.Caller{Namespace: "team-a"})
+		Expect(visibility.Visible(ctx, types.NamespacedName{Namespace: "team-a", Name: "foo"})).To(BeTrue())
+		Expect(visibility.Visible(ctx, types.NamespacedName{Namespace: "team-b", Name: "foo"})).To(BeFalse())
+		Expect(visibility.Visible(ctx, types.NamespacedName{Namespace: "profiles-system", Name: "foo"})).To(BeTrue())
+	})
+})
+
+var _ = Describe("AllOf", func() {
+	It("makes catalog sources visible only if all visibilities agree", func() {
+		visibility := api.AllOf{api.AllNamespaces{}, api.NewSharedNamespaces("profiles-system")}
+		Expect(visibility.Visible(context.Background(), types.NamespacedName{Namespace: "profiles-system", Name: "foo"})).To(BeTrue())
+		Expect(visibility.Visible(context.Background(), types.NamespacedName{Namespace: "team-a", Name: "foo"})).To(BeFalse())
+	})
 })
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/catalog"
+)
+
+// ErrorDomain is the domain of the ErrorInfo details of the catalog api errors.
+const ErrorDomain = "profiles.weave.works"
+
+// Reasons of the ErrorInfo details of the catalog api errors.
+const (
+	// ReasonMissingArguments is returned if required request fields are empty. The BadRequest details list the fields.
+	ReasonMissingArguments = "MISSING_ARGUMENTS"
+	// ReasonAmbiguousCatalog is returned if catalog sources with the requested name exist in several namespaces.
+	// The BadRequest details ask for the namespace, the metadata lists the namespaces.
+	ReasonAmbiguousCatalog = "AMBIGUOUS_CATALOG"
+	// ReasonCatalogNotFound is returned if no visible catalog source has the requested name.
+	ReasonCatalogNotFound = "CATALOG_NOT_FOUND"
+	// ReasonProfileNotFound is returned if the catalog source doesn't list the requested profile, including
+	// if it doesn't list any profile.
+	ReasonProfileNotFound = "PROFILE_NOT_FOUND"
+	// ReasonVersionNotFound is returned if the profile has no version matching the request.
+	ReasonVersionNotFound = "VERSION_NOT_FOUND"
+)
+
+// Keys of the ErrorInfo metadata of the catalog api errors.
+const (
+	MetadataCatalog       = "catalog"
+	MetadataNamespace     = "namespace"
+	MetadataNamespaces    = "namespaces"
+	MetadataProfile       = "profile"
+	MetadataVersion       = "version"
+	MetadataSuggestions   = "suggestions"
+	MetadataKnownVersions = "knownVersions"
+)
+
+// maxSuggestions is the maximum number of similar names suggested in a not found error.
+const maxSuggestions = 3
+
+// field is a request field which is required.
+type field struct {
+	name  string
+	value string
+}
+
+// missingArguments returns an InvalidArgument error listing the empty fields in its BadRequest details.
+// It returns nil if no field is empty.
+func missingArguments(fields ...field) error {
+	var (
+		params     []string
+		violations []*errdetails.BadRequest_FieldViolation
+	)
+	for _, f := range fields {
+		params = append(params, fmt.Sprintf("%s: %q", f.name, f.value))
+		if f.value == "" {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       f.name,
+				Description: fmt.Sprintf("%s must not be empty", f.name),
+			})
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return withDetails(
+		status.New(codes.InvalidArgument, "missing query param: "+strings.Join(params, ", ")),
+		&errdetails.ErrorInfo{Reason: ReasonMissingArguments, Domain: ErrorDomain},
+		&errdetails.BadRequest{FieldViolations: violations},
+	)
+}
+
+// ambiguousCatalog returns an InvalidArgument error asking for the namespace if catalog sources named
+// sourceName exist in several namespaces of the snapshot. It returns nil otherwise.
+func ambiguousCatalog(snapshot Catalog, sourceName string) error {
+	_, err := snapshot.Resolve(sourceName)
+	var ambiguous *catalog.AmbiguousSourceError
+	if !errors.As(err, &ambiguous) {
+		return nil
+	}
+	var namespaces []string
+	for _, source := range ambiguous.Sources {
+		namespaces = append(namespaces, source.Namespace)
+	}
+	return withDetails(
+		status.New(codes.InvalidArgument, ambiguous.Error()),
+		&errdetails.ErrorInfo{Reason: ReasonAmbiguousCatalog, Domain: ErrorDomain, Metadata: map[string]string{
+			MetadataCatalog:    sourceName,
+			MetadataNamespaces: strings.Join(namespaces, ","),
+		}},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       "namespace",
+			Description: fmt.Sprintf("catalog source %q exists in several namespaces, namespace must be set", sourceName),
+		}}},
+	)
+}
+
+// profileNotFound returns a NotFound error explaining which part of the request didn't match the catalog,
+// suggesting similar catalog or profile names, or the known versions of the profile. Profiles are only looked
+// up in the catalog source the name resolves to.
+func profileNotFound(snapshot Catalog, namespace, sourceName, profileName, version string) error {
+	metadata := map[string]string{
+		MetadataCatalog: sourceName,
+		MetadataProfile: profileName,
+	}
+	if namespace != "" {
+		metadata[MetadataNamespace] = namespace
+	}
+	if version != "" {
+		metadata[MetadataVersion] = version
+	}
+
+	source, err := snapshot.Resolve(sourceName)
+	if err != nil {
+		var catalogs []string
+		for _, p := range snapshot.SearchAll() {
+			catalogs = append(catalogs, p.CatalogSource)
+		}
+		setList(metadata, MetadataSuggestions, similar(sourceName, catalogs))
+		return withDetails(
+			status.New(codes.NotFound, "profile not found"),
+			&errdetails.ErrorInfo{Reason: ReasonCatalogNotFound, Domain: ErrorDomain, Metadata: metadata},
+		)
+	}
+	if source.Namespace != "" {
+		metadata[MetadataNamespace] = source.Namespace
+	}
+
+	var profiles, versions []string
+	for _, p := range snapshot.Profiles(source) {
+		profiles = append(profiles, p.Name)
+		if p.Name == profileName {
+			versions = append(versions, profilesv1.GetVersionFromTag(p.Tag))
+		}
+	}
+
+	reason := ReasonVersionNotFound
+	if len(versions) == 0 {
+		reason = ReasonProfileNotFound
+		setList(metadata, MetadataSuggestions, similar(profileName, profiles))
+	} else {
+		setList(metadata, MetadataKnownVersions, unique(versions))
+	}
+	return withDetails(
+		status.New(codes.NotFound, "profile not found"),
+		&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain, Metadata: metadata},
+	)
+}
+
+// withDetails returns the error of st with the given details attached.
+func withDetails(st *status.Status, details ...protoiface.MessageV1) error {
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// setList sets key to the comma separated values, if there are any.
+func setList(metadata map[string]string, key string, values []string) {
+	if len(values) > 0 {
+		metadata[key] = strings.Join(values, ",")
+	}
+}
+
+// similar returns up to maxSuggestions of the candidates closest to name, ordered by their edit distance.
+// Candidates which differ from name in more than half of its characters are not considered similar.
+func similar(name string, candidates []string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+	var suggestions []suggestion
+	for _, candidate := range unique(candidates) {
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(candidate))
+		if strings.Contains(strings.ToLower(candidate), strings.ToLower(name)) || distance <= len(name)/2 {
+			suggestions = append(suggestions, suggestion{name: candidate, distance: distance})
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+	var names []string
+	for i := 0; i < len(suggestions) && i < maxSuggestions; i++ {
+		names = append(names, suggestions[i].name)
+	}
+	return names
+}
+
+// unique returns the sorted distinct values.
+func unique(values []string) []string {
+	seen := map[string]struct{}{}
+	var result []string
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// levenshtein returns the number of single character edits needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(rb)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -7,9 +7,20 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/weaveworks/profiles/api/v1alpha1"
 	"github.com/weaveworks/profiles/pkg/api"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type FakeCatalog struct {
+	GenerationStub        func() uint64
+	generationMutex       sync.RWMutex
+	generationArgsForCall []struct {
+	}
+	generationReturns struct {
+		result1 uint64
+	}
+	generationReturnsOnCall map[int]struct {
+		result1 uint64
+	}
 	GetStub        func(string, string) *v1alpha1.ProfileCatalogEntry
 	getMutex       sync.RWMutex
 	getArgsForCall []struct {
@@ -36,6 +47,17 @@ type FakeCatalog struct {
 	getWithVersionReturnsOnCall map[int]struct {
 		result1 *v1alpha1.ProfileCatalogEntry
 	}
+	ProfilesStub        func(types.NamespacedName) []v1alpha1.ProfileCatalogEntry
+	profilesMutex       sync.RWMutex
+	profilesArgsForCall []struct {
+		arg1 types.NamespacedName
+	}
+	profilesReturns struct {
+		result1 []v1alpha1.ProfileCatalogEntry
+	}
+	profilesReturnsOnCall map[int]struct {
+		result1 []v1alpha1.ProfileCatalogEntry
+	}
 	ProfilesGreaterThanVersionStub        func(logr.Logger, string, string, string) []v1alpha1.ProfileCatalogEntry
 	profilesGreaterThanVersionMutex       sync.RWMutex
 	profilesGreaterThanVersionArgsForCall []struct {
@@ -50,6 +72,19 @@ type FakeCatalog struct {
 	profilesGreaterThanVersionReturnsOnCall map[int]struct {
 		result1 []v1alpha1.ProfileCatalogEntry
 	}
+	ResolveStub        func(string) (types.NamespacedName, error)
+	resolveMutex       sync.RWMutex
+	resolveArgsForCall []struct {
+		arg1 string
+	}
+	resolveReturns struct {
+		result1 types.NamespacedName
+		result2 error
+	}
+	resolveReturnsOnCall map[int]struct {
+		result1 types.NamespacedName
+		result2 error
+	}
 	SearchStub        func(string) []v1alpha1.ProfileCatalogEntry
 	searchMutex       sync.RWMutex
 	searchArgsForCall []struct {
@@ -75,6 +110,59 @@ type FakeCatalog struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeCatalog) Generation() uint64 {
+	fake.generationMutex.Lock()
+	ret, specificReturn := fake.generationReturnsOnCall[len(fake.generationArgsForCall)]
+	fake.generationArgsForCall = append(fake.generationArgsForCall, struct {
+	}{})
+	stub := fake.GenerationStub
+	fakeReturns := fake.generationReturns
+	fake.recordInvocation("Generation", []interface{}{})
+	fake.generationMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCatalog) GenerationCallCount() int {
+	fake.generationMutex.RLock()
+	defer fake.generationMutex.RUnlock()
+	return len(fake.generationArgsForCall)
+}
+
+func (fake *FakeCatalog) GenerationCalls(stub func() uint64) {
+	fake.generationMutex.Lock()
+	defer fake.generationMutex.Unlock()
+	fake.GenerationStub = stub
+}
+
+func (fake *FakeCatalog) GenerationReturns(result1 uint64) {
+	fake.generationMutex.Lock()
+	defer fake.generationMutex.Unlock()
+	fake.GenerationStub = nil
+	fake.generationReturns = struct {
+		result1 uint64
+	}{result1}
+}
+
+func (fake *FakeCatalog) GenerationReturnsOnCall(i int, result1 uint64) {
+	fake.generationMutex.Lock()
+	defer fake.generationMutex.Unlock()
+	fake.GenerationStub = nil
+	if fake.generationReturnsOnCall == nil {
+		fake.generationReturnsOnCall = make(map[int]struct {
+			result1 uint64
+		})
+	}
+	fake.generationReturnsOnCall[i] = struct {
+		result1 uint64
+	}{result1}
+}
+
 func (fake *FakeCatalog) Get(arg1 string, arg2 string) *v1alpha1.ProfileCatalogEntry {
 	fake.getMutex.Lock()
 	ret, specificReturn := fake.getReturnsOnCall[len(fake.getArgsForCall)]
@@ -201,6 +289,67 @@ func (fake *FakeCatalog) GetWithVersionReturnsOnCall(i int, result1 *v1alpha1.Pr
 	}{result1}
 }
 
+func (fake *FakeCatalog) Profiles(arg1 types.NamespacedName) []v1alpha1.ProfileCatalogEntry {
+	fake.profilesMutex.Lock()
+	ret, specificReturn := fake.profilesReturnsOnCall[len(fake.profilesArgsForCall)]
+	fake.profilesArgsForCall = append(fake.profilesArgsForCall, struct {
+		arg1 types.NamespacedName
+	}{arg1})
+	stub := fake.ProfilesStub
+	fakeReturns := fake.profilesReturns
+	fake.recordInvocation("Profiles", []interface{}{arg1})
+	fake.profilesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCatalog) ProfilesCallCount() int {
+	fake.profilesMutex.RLock()
+	defer fake.profilesMutex.RUnlock()
+	return len(fake.profilesArgsForCall)
+}
+
+func (fake *FakeCatalog) ProfilesCalls(stub func(types.NamespacedName) []v1alpha1.ProfileCatalogEntry) {
+	fake.profilesMutex.Lock()
+	defer fake.profilesMutex.Unlock()
+	fake.ProfilesStub = stub
+}
+
+func (fake *FakeCatalog) ProfilesArgsForCall(i int) types.NamespacedName {
+	fake.profilesMutex.RLock()
+	defer fake.profilesMutex.RUnlock()
+	argsForCall := fake.profilesArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCatalog) ProfilesReturns(result1 []v1alpha1.ProfileCatalogEntry) {
+	fake.profilesMutex.Lock()
+	defer fake.profilesMutex.Unlock()
+	fake.ProfilesStub = nil
+	fake.profilesReturns = struct {
+		result1 []v1alpha1.ProfileCatalogEntry
+	}{result1}
+}
+
+func (fake *FakeCatalog) ProfilesReturnsOnCall(i int, result1 []v1alpha1.ProfileCatalogEntry) {
+	fake.profilesMutex.Lock()
+	defer fake.profilesMutex.Unlock()
+	fake.ProfilesStub = nil
+	if fake.profilesReturnsOnCall == nil {
+		fake.profilesReturnsOnCall = make(map[int]struct {
+			result1 []v1alpha1.ProfileCatalogEntry
+		})
+	}
+	fake.profilesReturnsOnCall[i] = struct {
+		result1 []v1alpha1.ProfileCatalogEntry
+	}{result1}
+}
+
 func (fake *FakeCatalog) ProfilesGreaterThanVersion(arg1 logr.Logger, arg2 string, arg3 string, arg4 string) []v1alpha1.ProfileCatalogEntry {
 	fake.profilesGreaterThanVersionMutex.Lock()
 	ret, specificReturn := fake.profilesGreaterThanVersionReturnsOnCall[len(fake.profilesGreaterThanVersionArgsForCall)]
@@ -265,6 +414,70 @@ func (fake *FakeCatalog) ProfilesGreaterThanVersionReturnsOnCall(i int, result1
 	}{result1}
 }
 
+func (fake *FakeCatalog) Resolve(arg1 string) (types.NamespacedName, error) {
+	fake.resolveMutex.Lock()
+	ret, specificReturn := fake.resolveReturnsOnCall[len(fake.resolveArgsForCall)]
+	fake.resolveArgsForCall = append(fake.resolveArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.ResolveStub
+	fakeReturns := fake.resolveReturns
+	fake.recordInvocation("Resolve", []interface{}{arg1})
+	fake.resolveMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCatalog) ResolveCallCount() int {
+	fake.resolveMutex.RLock()
+	defer fake.resolveMutex.RUnlock()
+	return len(fake.resolveArgsForCall)
+}
+
+func (fake *FakeCatalog) ResolveCalls(stub func(string) (types.NamespacedName, error)) {
+	fake.resolveMutex.Lock()
+	defer fake.resolveMutex.Unlock()
+	fake.ResolveStub = stub
+}
+
+func (fake *FakeCatalog) ResolveArgsForCall(i int) string {
+	fake.resolveMutex.RLock()
+	defer fake.resolveMutex.RUnlock()
+	argsForCall := fake.resolveArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCatalog) ResolveReturns(result1 types.NamespacedName, result2 error) {
+	fake.resolveMutex.Lock()
+	defer fake.resolveMutex.Unlock()
+	fake.ResolveStub = nil
+	fake.resolveReturns = struct {
+		result1 types.NamespacedName
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCatalog) ResolveReturnsOnCall(i int, result1 types.NamespacedName, result2 error) {
+	fake.resolveMutex.Lock()
+	defer fake.resolveMutex.Unlock()
+	fake.ResolveStub = nil
+	if fake.resolveReturnsOnCall == nil {
+		fake.resolveReturnsOnCall = make(map[int]struct {
+			result1 types.NamespacedName
+			result2 error
+		})
+	}
+	fake.resolveReturnsOnCall[i] = struct {
+		result1 types.NamespacedName
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeCatalog) Search(arg1 string) []v1alpha1.ProfileCatalogEntry {
 	fake.searchMutex.Lock()
 	ret, specificReturn := fake.searchReturnsOnCall[len(fake.searchArgsForCall)]
@@ -382,12 +595,18 @@ func (fake *FakeCatalog) SearchAllReturnsOnCall(i int, result1 []v1alpha1.Profil
 func (fake *FakeCatalog) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.generationMutex.RLock()
+	defer fake.generationMutex.RUnlock()
 	fake.getMutex.RLock()
 	defer fake.getMutex.RUnlock()
 	fake.getWithVersionMutex.RLock()
 	defer fake.getWithVersionMutex.RUnlock()
+	fake.profilesMutex.RLock()
+	defer fake.profilesMutex.RUnlock()
 	fake.profilesGreaterThanVersionMutex.RLock()
 	defer fake.profilesGreaterThanVersionMutex.RUnlock()
+	fake.resolveMutex.RLock()
+	defer fake.resolveMutex.RUnlock()
 	fake.searchMutex.RLock()
 	defer fake.searchMutex.RUnlock()
 	fake.searchAllMutex.RLock()
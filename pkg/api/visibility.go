@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+//counterfeiter:generate -o fakes/fake_visibility.go . Visibility
+// Visibility decides which catalog sources are visible to the caller of a request.
+type Visibility interface {
+	// Visible returns true if the catalog source is visible to the caller in ctx. The namespace
+	// of cluster scoped catalog sources is empty
+	Visible(ctx context.Context, source types.NamespacedName) bool
+}
+
+// AllNamespaces makes the catalog sources of every namespace visible to all callers.
+type AllNamespaces struct{}
+
+// Visible always returns true.
+func (AllNamespaces) Visible(context.Context, types.NamespacedName) bool {
+	return true
+}
+
+// SharedNamespaces makes cluster scoped catalog sources and the catalog sources in the shared
+// namespaces visible to all callers. Catalog sources in any other namespace are only visible to
+// callers from that namespace.
+type SharedNamespaces struct {
+	namespaces map[string]struct{}
+}
+
+// NewSharedNamespaces returns a Visibility sharing the catalog sources of the given namespaces.
+func NewSharedNamespaces(namespaces ...string) *SharedNamespaces {
+	shared := make(map[string]struct{}, len(namespaces))
+	for _, namespace := range namespaces {
+		shared[namespace] = struct{}{}
+	}
+	return &SharedNamespaces{namespaces: shared}
+}
+
+// Visible returns true if the catalog source is cluster scoped, in a shared namespace or in the
+// namespace of the caller.
+func (s *SharedNamespaces) Visible(ctx context.Context, source types.NamespacedName) bool {
+	if source.Namespace == "" {
+		return true
+	}
+	if _, ok := s.namespaces[source.Namespace]; ok {
+		return true
+	}
+	caller, ok := CallerFromContext(ctx)
+	return ok && caller.Namespace != "" && caller.Namespace == source.Namespace
+}
+
+// AllOf makes a catalog source visible only if it is visible according to all of visibilities.
+type AllOf []Visibility
+
+// Visible returns true if all visibilities return true.
+func (a AllOf) Visible(ctx context.Context, source types.NamespacedName) bool {
+	for _, visibility := range a {
+		if !visibility.Visible(ctx, source) {
+			return false
+		}
+	}
+	return true
+}
+
+// Caller describes who is making a request to the catalog api.
+type Caller struct {
+	// Username of the caller
+	Username string
+	// UID of the caller, if known
+	UID string
+	// Groups the caller belongs to
+	Groups []string
+	// Namespace the caller belongs to, for example the namespace of its service account
+	Namespace string
+}
+
+type callerKey struct{}
+
+// NewContextWithCaller returns a copy of ctx carrying the caller of the request.
+func NewContextWithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller of the request, if known.
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	return caller, ok
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/profiles/pkg/api"
+)
+
+// ErrNoCredentials is returned by an Authenticator if the request carries no credentials it understands.
+var ErrNoCredentials = errors.New("no credentials provided")
+
+const serviceAccountPrefix = "system:serviceaccount:"
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+//counterfeiter:generate -o fakes/fake_authenticator.go . Authenticator
+// Authenticator identifies the caller of a request.
+type Authenticator interface {
+	// Authenticate returns the caller of the request in ctx. It returns ErrNoCredentials if the
+	// request carries no credentials the Authenticator understands.
+	Authenticate(ctx context.Context) (api.Caller, error)
+}
+
+//counterfeiter:generate -o fakes/fake_kubernetes.go . Kubernetes
+// Kubernetes is the interface used to create TokenReviews and SubjectAccessReviews.
+type Kubernetes interface {
+	Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error
+}
+
+// Authenticators tries each Authenticator in turn until one finds credentials in the request.
+type Authenticators []Authenticator
+
+// Authenticate returns the result of the first Authenticator which finds credentials in the request.
+func (a Authenticators) Authenticate(ctx context.Context) (api.Caller, error) {
+	for _, authenticator := range a {
+		caller, err := authenticator.Authenticate(ctx)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return caller, err
+	}
+	return api.Caller{}, ErrNoCredentials
+}
+
+// UnaryServerInterceptor rejects unary requests which can't be authenticated and adds the caller to
+// the context of the request.
+func UnaryServerInterceptor(authenticator Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, authenticator)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streams which can't be authenticated and adds the caller to the
+// context of the stream.
+func StreamServerInterceptor(authenticator Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), authenticator)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, authenticator Authenticator) (context.Context, error) {
+	caller, err := authenticator.Authenticate(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to authenticate: %s", err)
+	}
+	return api.NewContextWithCaller(ctx, caller), nil
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// newCaller returns the caller for the given user. The namespace of service accounts is taken from
+// their username.
+func newCaller(username, uid string, groups []string) api.Caller {
+	caller := api.Caller{
+		Username: username,
+		UID:      uid,
+		Groups:   groups,
+	}
+	if strings.HasPrefix(username, serviceAccountPrefix) {
+		parts := strings.Split(strings.TrimPrefix(username, serviceAccountPrefix), ":")
+		if len(parts) == 2 {
+			caller.Namespace = parts[0]
+		}
+	}
+	return caller
+}
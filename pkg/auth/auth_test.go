@@ -0,0 +1,85 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/auth"
+	"github.com/weaveworks/profiles/pkg/auth/fakes"
+)
+
+var _ = Describe("Authenticators", func() {
+	var (
+		first, second *fakes.FakeAuthenticator
+	)
+
+	BeforeEach(func() {
+		first = new(fakes.FakeAuthenticator)
+		second = new(fakes.FakeAuthenticator)
+	})
+
+	It("returns the caller of the first authenticator which finds credentials", func() {
+		first.AuthenticateReturns(api.Caller{}, auth.ErrNoCredentials)
+		second.AuthenticateReturns(api.Caller{Username: "jane"}, nil)
+
+		caller, err := auth.Authenticators{first, second}.Authenticate(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(caller).To(Equal(api.Caller{Username: "jane"}))
+	})
+
+	It("does not try further authenticators if credentials are invalid", func() {
+		first.AuthenticateReturns(api.Caller{}, errors.New("invalid token"))
+
+		_, err := auth.Authenticators{first, second}.Authenticate(context.Background())
+		Expect(err).To(MatchError("invalid token"))
+		Expect(second.AuthenticateCallCount()).To(Equal(0))
+	})
+
+	It("returns ErrNoCredentials if no authenticator finds credentials", func() {
+		_, err := auth.Authenticators{}.Authenticate(context.Background())
+		Expect(err).To(MatchError(auth.ErrNoCredentials))
+	})
+})
+
+var _ = Describe("UnaryServerInterceptor", func() {
+	var (
+		fakeAuthenticator *fakes.FakeAuthenticator
+		interceptor       grpc.UnaryServerInterceptor
+	)
+
+	BeforeEach(func() {
+		fakeAuthenticator = new(fakes.FakeAuthenticator)
+		interceptor = auth.UnaryServerInterceptor(fakeAuthenticator)
+	})
+
+	It("adds the caller to the context of the request", func() {
+		fakeAuthenticator.AuthenticateReturns(api.Caller{Username: "system:serviceaccount:team-a:default", Namespace: "team-a"}, nil)
+
+		var caller api.Caller
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			caller, _ = api.CallerFromContext(ctx)
+			return nil, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(caller.Namespace).To(Equal("team-a"))
+	})
+
+	It("rejects requests which can't be authenticated", func() {
+		fakeAuthenticator.AuthenticateReturns(api.Caller{}, auth.ErrNoCredentials)
+
+		called := false
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		})
+		Expect(status.Code(err)).To(Equal(codes.Unauthenticated))
+		Expect(called).To(BeFalse())
+	})
+})
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/weaveworks/profiles/pkg/api"
+)
+
+// CertificateAuthenticator authenticates callers by the verified client certificate of the TLS
+// connection. The common name of the certificate is the username of the caller and its
+// organizations are the groups, as for Kubernetes client certificates.
+type CertificateAuthenticator struct{}
+
+// Authenticate returns the caller identified by the client certificate of the request.
+func (CertificateAuthenticator) Authenticate(ctx context.Context) (api.Caller, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return api.Caller{}, ErrNoCredentials
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return api.Caller{}, ErrNoCredentials
+	}
+	subject := tlsInfo.State.VerifiedChains[0][0].Subject
+	return newCaller(subject.CommonName, "", subject.Organization), nil
+}
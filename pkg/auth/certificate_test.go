@@ -0,0 +1,40 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/auth"
+)
+
+var _ = Describe("CertificateAuthenticator", func() {
+	It("returns the user of the verified client certificate", func() {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "jane", Organization: []string{"platform"}}}
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+		})
+
+		caller, err := auth.CertificateAuthenticator{}.Authenticate(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(caller).To(Equal(api.Caller{Username: "jane", Groups: []string{"platform"}}))
+	})
+
+	When("the connection has no verified client certificate", func() {
+		It("returns ErrNoCredentials", func() {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{}})
+			_, err := auth.CertificateAuthenticator{}.Authenticate(ctx)
+			Expect(err).To(MatchError(auth.ErrNoCredentials))
+
+			_, err = auth.CertificateAuthenticator{}.Authenticate(context.Background())
+			Expect(err).To(MatchError(auth.ErrNoCredentials))
+		})
+	})
+})
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/api"
+)
+
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// maxDecisions is the number of cached decisions, the least recently used decision is evicted first.
+const maxDecisions = 1024
+
+// SubjectAccessReviewer makes catalog sources visible to callers which are allowed to get the
+// ProfileCatalogSource or ClusterProfileCatalogSource, checked with the Kubernetes
+// SubjectAccessReview API. Decisions are cached for the configured ttl.
+type SubjectAccessReviewer struct {
+	kClient Kubernetes
+	logger  logr.Logger
+	ttl     time.Duration
+
+	decisions *cache.LRUExpireCache
+}
+
+var _ api.Visibility = &SubjectAccessReviewer{}
+
+type reviewKey struct {
+	username string
+	groups   string
+	source   types.NamespacedName
+}
+
+// NewSubjectAccessReviewer returns a SubjectAccessReviewer caching decisions for ttl.
+func NewSubjectAccessReviewer(kClient Kubernetes, logger logr.Logger, ttl time.Duration) *SubjectAccessReviewer {
+	return &SubjectAccessReviewer{
+		kClient:   kClient,
+		logger:    logger,
+		ttl:       ttl,
+		decisions: cache.NewLRUExpireCache(maxDecisions),
+	}
+}
+
+// Visible returns true if the caller of the request is allowed to get the catalog source.
+// Unauthenticated callers can't see any catalog source.
+func (s *SubjectAccessReviewer) Visible(ctx context.Context, source types.NamespacedName) bool {
+	caller, ok := api.CallerFromContext(ctx)
+	if !ok || caller.Username == "" {
+		return false
+	}
+	key := reviewKey{username: caller.Username, groups: strings.Join(caller.Groups, ","), source: source}
+
+	if allowed, ok := s.decisions.Get(key); ok {
+		return allowed.(bool)
+	}
+
+	resource := "profilecatalogsources"
+	if source.Namespace == "" {
+		resource = "clusterprofilecatalogsources"
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   caller.Username,
+			UID:    caller.UID,
+			Groups: caller.Groups,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: source.Namespace,
+				Verb:      "get",
+				Group:     profilesv1.GroupVersion.Group,
+				Resource:  resource,
+				Name:      source.Name,
+			},
+		},
+	}
+	if err := s.kClient.Create(ctx, review); err != nil {
+		s.logger.Error(err, "failed to review access to catalog source", "user", caller.Username, "source", source)
+		return false
+	}
+
+	s.decisions.Add(key, review.Status.Allowed, s.ttl)
+	return review.Status.Allowed
+}
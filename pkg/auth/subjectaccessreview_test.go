@@ -0,0 +1,95 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/auth"
+	"github.com/weaveworks/profiles/pkg/auth/fakes"
+)
+
+var _ = Describe("SubjectAccessReviewer", func() {
+	var (
+		fakeKubernetes *fakes.FakeKubernetes
+		reviewer       *auth.SubjectAccessReviewer
+		ctx            context.Context
+		source         types.NamespacedName
+	)
+
+	BeforeEach(func() {
+		fakeKubernetes = new(fakes.FakeKubernetes)
+		fakeKubernetes.CreateStub = func(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+			review := obj.(*authorizationv1.SubjectAccessReview)
+			review.Status.Allowed = review.Spec.ResourceAttributes.Namespace == "team-a"
+			return nil
+		}
+		reviewer = auth.NewSubjectAccessReviewer(fakeKubernetes, logr.Discard(), time.Minute)
+		ctx = api.NewContextWithCaller(context.Background(), api.Caller{Username: "jane", Groups: []string{"devs"}})
+		source = types.NamespacedName{Namespace: "team-a", Name: "catalog"}
+	})
+
+	It("checks whether the caller can get the catalog source", func() {
+		Expect(reviewer.Visible(ctx, source)).To(BeTrue())
+		Expect(reviewer.Visible(ctx, types.NamespacedName{Namespace: "team-b", Name: "catalog"})).To(BeFalse())
+
+		_, obj, _ := fakeKubernetes.CreateArgsForCall(0)
+		review := obj.(*authorizationv1.SubjectAccessReview)
+		Expect(review.Spec.User).To(Equal("jane"))
+		Expect(review.Spec.Groups).To(Equal([]string{"devs"}))
+		Expect(*review.Spec.ResourceAttributes).To(Equal(authorizationv1.ResourceAttributes{
+			Namespace: "team-a",
+			Verb:      "get",
+			Group:     "weave.works",
+			Resource:  "profilecatalogsources",
+			Name:      "catalog",
+		}))
+	})
+
+	It("checks cluster scoped catalog sources against clusterprofilecatalogsources", func() {
+		reviewer.Visible(ctx, types.NamespacedName{Name: "platform"})
+
+		_, obj, _ := fakeKubernetes.CreateArgsForCall(0)
+		Expect(obj.(*authorizationv1.SubjectAccessReview).Spec.ResourceAttributes.Resource).To(Equal("clusterprofilecatalogsources"))
+	})
+
+	It("caches decisions", func() {
+		Expect(reviewer.Visible(ctx, source)).To(BeTrue())
+		Expect(reviewer.Visible(ctx, source)).To(BeTrue())
+		Expect(fakeKubernetes.CreateCallCount()).To(Equal(1))
+	})
+
+	It("evicts the least recently used decision when the cache is full", func() {
+		Expect(reviewer.Visible(ctx, source)).To(BeTrue())
+		for i := 0; i < 1024; i++ {
+			reviewer.Visible(ctx, types.NamespacedName{Namespace: "team-b", Name: fmt.Sprintf("catalog-%d", i)})
+		}
+		Expect(fakeKubernetes.CreateCallCount()).To(Equal(1025))
+
+		Expect(reviewer.Visible(ctx, source)).To(BeTrue())
+		Expect(fakeKubernetes.CreateCallCount()).To(Equal(1026))
+	})
+
+	When("the caller is unknown", func() {
+		It("hides the catalog source", func() {
+			Expect(reviewer.Visible(context.Background(), source)).To(BeFalse())
+			Expect(fakeKubernetes.CreateCallCount()).To(Equal(0))
+		})
+	})
+
+	When("the review fails", func() {
+		It("hides the catalog source", func() {
+			fakeKubernetes.CreateReturns(errors.New("nope"))
+			Expect(reviewer.Visible(ctx, source)).To(BeFalse())
+		})
+	})
+})
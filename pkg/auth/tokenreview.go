@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/weaveworks/profiles/pkg/api"
+)
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+
+const (
+	// maxReviews is the number of cached token reviews, the least recently used review is evicted first.
+	maxReviews = 1024
+	// reviewTTL is how long the result of a token review is cached. It is short, so revoked tokens are
+	// rejected soon after.
+	reviewTTL = 10 * time.Second
+)
+
+// TokenReviewAuthenticator authenticates bearer tokens using the Kubernetes TokenReview API. Results
+// are cached by the hash of the token for a few seconds.
+type TokenReviewAuthenticator struct {
+	kClient   Kubernetes
+	audiences []string
+	reviews   *cache.LRUExpireCache
+}
+
+// review is the cached result of a token review.
+type review struct {
+	caller        api.Caller
+	authenticated bool
+}
+
+// NewTokenReviewAuthenticator returns a TokenReviewAuthenticator. If audiences are given, tokens must
+// be issued for at least one of them.
+func NewTokenReviewAuthenticator(kClient Kubernetes, audiences ...string) *TokenReviewAuthenticator {
+	return &TokenReviewAuthenticator{
+		kClient:   kClient,
+		audiences: audiences,
+		reviews:   cache.NewLRUExpireCache(maxReviews),
+	}
+}
+
+// Authenticate reviews the bearer token in the authorization metadata of the request.
+func (t *TokenReviewAuthenticator) Authenticate(ctx context.Context) (api.Caller, error) {
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return api.Caller{}, ErrNoCredentials
+	}
+	key := sha256.Sum256([]byte(token))
+	if cached, ok := t.reviews.Get(key); ok {
+		return cached.(review).result()
+	}
+	tokenReview := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: t.audiences,
+		},
+	}
+	if err := t.kClient.Create(ctx, tokenReview); err != nil {
+		return api.Caller{}, fmt.Errorf("failed to review token: %w", err)
+	}
+	user := tokenReview.Status.User
+	r := review{
+		caller:        newCaller(user.Username, user.UID, user.Groups),
+		authenticated: tokenReview.Status.Authenticated,
+	}
+	t.reviews.Add(key, r, reviewTTL)
+	return r.result()
+}
+
+func (r review) result() (api.Caller, error) {
+	if !r.authenticated {
+		return api.Caller{}, fmt.Errorf("invalid token")
+	}
+	return r.caller, nil
+}
+
+// bearerToken returns the token of the authorization metadata of the request. The gateway forwards
+// the Authorization header of http requests as authorization metadata.
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, value := range md.Get("authorization") {
+		if len(value) > len("bearer ") && strings.EqualFold(value[:len("bearer ")], "bearer ") {
+			return value[len("bearer "):], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/metadata"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/auth"
+	"github.com/weaveworks/profiles/pkg/auth/fakes"
+)
+
+var _ = Describe("TokenReviewAuthenticator", func() {
+	var (
+		fakeKubernetes *fakes.FakeKubernetes
+		authenticator  *auth.TokenReviewAuthenticator
+		ctx            context.Context
+	)
+
+	BeforeEach(func() {
+		fakeKubernetes = new(fakes.FakeKubernetes)
+		authenticator = auth.NewTokenReviewAuthenticator(fakeKubernetes, "profiles")
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer my-token"))
+	})
+
+	It("returns the user of a valid token", func() {
+		fakeKubernetes.CreateStub = func(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+			review := obj.(*authenticationv1.TokenReview)
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{
+				Username: "system:serviceaccount:team-a:pctl",
+				UID:      "1234",
+				Groups:   []string{"system:serviceaccounts"},
+			}
+			return nil
+		}
+
+		caller, err := authenticator.Authenticate(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(caller).To(Equal(api.Caller{
+			Username:  "system:serviceaccount:team-a:pctl",
+			UID:       "1234",
+			Groups:    []string{"system:serviceaccounts"},
+			Namespace: "team-a",
+		}))
+
+		_, obj, _ := fakeKubernetes.CreateArgsForCall(0)
+		Expect(obj.(*authenticationv1.TokenReview).Spec).To(Equal(authenticationv1.TokenReviewSpec{
+			Token:     "my-token",
+			Audiences: []string{"profiles"},
+		}))
+	})
+
+	It("caches the review of a token", func() {
+		fakeKubernetes.CreateStub = func(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+			review := obj.(*authenticationv1.TokenReview)
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "jane"}
+			return nil
+		}
+
+		for i := 0; i < 2; i++ {
+			caller, err := authenticator.Authenticate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(caller.Username).To(Equal("jane"))
+		}
+		Expect(fakeKubernetes.CreateCallCount()).To(Equal(1))
+
+		By("reviewing other tokens")
+		_, err := authenticator.Authenticate(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer other-token")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fakeKubernetes.CreateCallCount()).To(Equal(2))
+	})
+
+	When("the token is invalid", func() {
+		It("returns an error", func() {
+			_, err := authenticator.Authenticate(ctx)
+			Expect(err).To(MatchError("invalid token"))
+			_, err = authenticator.Authenticate(ctx)
+			Expect(err).To(MatchError("invalid token"))
+			Expect(fakeKubernetes.CreateCallCount()).To(Equal(1))
+		})
+	})
+
+	When("the token can't be reviewed", func() {
+		It("returns an error", func() {
+			fakeKubernetes.CreateReturns(errors.New("nope"))
+			_, err := authenticator.Authenticate(ctx)
+			Expect(err).To(MatchError("failed to review token: nope"))
+
+			By("not caching the failure")
+			_, err = authenticator.Authenticate(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(fakeKubernetes.CreateCallCount()).To(Equal(2))
+		})
+	})
+
+	When("the request carries no bearer token", func() {
+		It("returns ErrNoCredentials", func() {
+			_, err := authenticator.Authenticate(context.Background())
+			Expect(err).To(MatchError(auth.ErrNoCredentials))
+			Expect(fakeKubernetes.CreateCallCount()).To(Equal(0))
+		})
+	})
+})
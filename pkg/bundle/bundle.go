@@ -0,0 +1,318 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/git"
+)
+
+const (
+	// ManifestFile is the file in the bundle which lists its entries
+	ManifestFile = "catalog.yaml"
+	// ManifestVersion is the version of the bundle format
+	ManifestVersion = "v1"
+
+	profilesDir     = "profiles"
+	repositoriesDir = "repositories"
+)
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+//counterfeiter:generate -o fakes/fake_git_client.go . GitClient
+//GitClient reads profile definitions from and mirrors the repositories of catalog entries
+type GitClient interface {
+	ReadFile(ctx context.Context, source profilesv1.Source, file string) ([]byte, error)
+	MirrorTags(ctx context.Context, url string, auth git.AuthProvider, dir string, tags []string) error
+}
+
+//Catalog lists the entries to export, for example a catalog.Catalog or one of its snapshots
+type Catalog interface {
+	SearchAll() []profilesv1.ProfileCatalogEntry
+}
+
+//Manifest lists the entries of a bundle
+type Manifest struct {
+	// Version is the version of the bundle format
+	Version string `json:"version"`
+	// Entries are the exported catalog entries
+	Entries []Entry `json:"entries"`
+}
+
+//Entry is an exported catalog entry
+type Entry struct {
+	profilesv1.ProfileCatalogEntry `json:",inline"`
+	// ProfileFile is the path of the profile definition of the entry in the bundle
+	ProfileFile string `json:"profileFile"`
+	// Repository is the path of the mirror of the repository of the entry in the bundle. It is
+	// empty if the bundle doesn't include the repositories.
+	Repository string `json:"repository,omitempty"`
+}
+
+//ExportOptions configure the content of a bundle
+type ExportOptions struct {
+	// IncludeRepositories adds a bare mirror of the tagged commits of every repository to the bundle
+	IncludeRepositories bool
+	// TempDir is the directory the repositories are mirrored in before they are added to the bundle.
+	// Defaults to the system temp directory.
+	TempDir string
+}
+
+//ImportOptions configure how a bundle is imported
+type ImportOptions struct {
+	// Name is the name of the ProfileCatalogSource listing the entries
+	Name string
+	// Namespace is the namespace of the ProfileCatalogSource
+	Namespace string
+	// MirrorDir is the directory the repositories of the bundle are extracted to. Repositories
+	// are not extracted if it is empty.
+	MirrorDir string
+	// MirrorURL is the URL MirrorDir is served at, for example by a git server in the cluster.
+	// The URLs of the entries are set to the repositories below it. Defaults to MirrorDir.
+	MirrorURL string
+}
+
+//Bundler exports catalogs to bundles and imports them again
+type Bundler struct {
+	gitClient GitClient
+}
+
+//New returns a Bundler reading profile definitions and repositories with the git client
+func New(gitClient GitClient) *Bundler {
+	return &Bundler{gitClient: gitClient}
+}
+
+//Export writes the entries of the catalog, their profile definitions and optionally their repositories
+//to w as a gzipped tarball
+func (b *Bundler) Export(ctx context.Context, catalog Catalog, w io.Writer, opts ExportOptions) error {
+	entries := catalog.SearchAll()
+	manifest := Manifest{Version: ManifestVersion}
+	files := map[string][]byte{}
+	var fileNames []string
+	repositories := map[string][]string{}
+	var urls []string
+	for _, entry := range entries {
+		profilePath := profilePathFromTag(entry.Tag)
+		file := path.Join(profilesDir, git.UniqueRepositoryName(entry.URL), entry.Tag, git.ProfileFile)
+		if _, ok := files[file]; !ok {
+			data, err := b.gitClient.ReadFile(ctx, profilesv1.Source{URL: entry.URL, Tag: entry.Tag, Path: profilePath}, git.ProfileFile)
+			if err != nil {
+				return fmt.Errorf("failed to read the profile definition of %s/%s at %s: %w", entry.CatalogSource, entry.Name, entry.Tag, err)
+			}
+			files[file] = data
+			fileNames = append(fileNames, file)
+		}
+
+		exported := Entry{ProfileCatalogEntry: entry, ProfileFile: file}
+		if opts.IncludeRepositories {
+			exported.Repository = path.Join(repositoriesDir, git.UniqueRepositoryName(entry.URL)+".git")
+			if _, ok := repositories[entry.URL]; !ok {
+				urls = append(urls, entry.URL)
+			}
+			repositories[entry.URL] = append(repositories[entry.URL], entry.Tag)
+		}
+		manifest.Entries = append(manifest.Entries, exported)
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeFile(tarWriter, ManifestFile, data); err != nil {
+		return err
+	}
+	for _, file := range fileNames {
+		if err := writeFile(tarWriter, file, files[file]); err != nil {
+			return err
+		}
+	}
+
+	if len(repositories) > 0 {
+		tempDir, err := ioutil.TempDir(opts.TempDir, "profiles-bundle")
+		if err != nil {
+			return fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		for _, url := range urls {
+			name := git.UniqueRepositoryName(url) + ".git"
+			dir := filepath.Join(tempDir, name)
+			if err := b.gitClient.MirrorTags(ctx, url, nil, dir, repositories[url]); err != nil {
+				return fmt.Errorf("failed to mirror %q: %w", url, err)
+			}
+			if err := writeDir(tarWriter, dir, path.Join(repositoriesDir, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return gzipWriter.Close()
+}
+
+//Import reads a bundle written by Export and returns an inline ProfileCatalogSource listing its entries. The
+//repositories of the bundle are extracted to the mirror directory and the entries refer to those mirrors.
+func (b *Bundler) Import(r io.Reader, opts ImportOptions) (*profilesv1.ProfileCatalogSource, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	var manifest *Manifest
+	files := map[string][]byte{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid file %q in bundle", header.Name)
+		}
+
+		switch {
+		case name == ManifestFile:
+			data, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			manifest = &Manifest{}
+			if err := yaml.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %w", ManifestFile, err)
+			}
+		case strings.HasPrefix(name, profilesDir+"/"):
+			data, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			files[name] = data
+		case strings.HasPrefix(name, repositoriesDir+"/") && opts.MirrorDir != "":
+			if err := extractFile(tarReader, header, filepath.Join(opts.MirrorDir, filepath.FromSlash(strings.TrimPrefix(name, repositoriesDir+"/")))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("bundle has no %s", ManifestFile)
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported bundle version %q", manifest.Version)
+	}
+
+	source := &profilesv1.ProfileCatalogSource{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ProfileCatalogSource",
+			APIVersion: profilesv1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+		},
+	}
+	for _, entry := range manifest.Entries {
+		// verify the entry matches its profile definition
+		data, ok := files[path.Clean(entry.ProfileFile)]
+		if !ok {
+			return nil, fmt.Errorf("bundle has no profile definition for %s at %s", entry.Name, entry.Tag)
+		}
+		def := &profilesv1.ProfileDefinition{}
+		if err := yaml.Unmarshal(data, def); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", entry.ProfileFile, err)
+		}
+		if def.Name != entry.Name {
+			return nil, fmt.Errorf("profile definition %s is for profile %q, not %q", entry.ProfileFile, def.Name, entry.Name)
+		}
+
+		profile := entry.ProfileCatalogEntry
+		// the catalog sets the source of the entries of the imported catalog source
+		profile.CatalogSource, profile.CatalogNamespace, profile.CatalogScope = "", "", ""
+		if entry.Repository != "" && opts.MirrorDir != "" {
+			name := strings.TrimPrefix(path.Clean(entry.Repository), repositoriesDir+"/")
+			profile.URL = filepath.Join(opts.MirrorDir, name)
+			if opts.MirrorURL != "" {
+				profile.URL = strings.TrimSuffix(opts.MirrorURL, "/") + "/" + name
+			}
+		}
+		source.Spec.Profiles = append(source.Spec.Profiles, profile)
+	}
+	return source, nil
+}
+
+// profilePathFromTag returns the directory of the profile of a tag, the tag nginx/v0.1.0 is of the profile in nginx.
+func profilePathFromTag(tag string) string {
+	if i := strings.LastIndex(tag, "/"); i >= 0 {
+		return tag[:i]
+	}
+	return ""
+}
+
+func writeFile(w *tar.Writer, name string, data []byte) error {
+	if err := w.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeDir writes the regular files of dir to the tarball below prefix.
+func writeDir(w *tar.Writer, dir, prefix string) error {
+	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return writeFile(w, path.Join(prefix, filepath.ToSlash(rel)), data)
+	})
+}
+
+func extractFile(r io.Reader, header *tar.Header, file string) error {
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", file, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/bundle"
+	"github.com/weaveworks/profiles/pkg/bundle/fakes"
+	"github.com/weaveworks/profiles/pkg/catalog"
+	"github.com/weaveworks/profiles/pkg/git"
+)
+
+const nginxProfile = `apiVersion: weave.works/v1alpha1
+kind: ProfileDefinition
+metadata:
+  name: nginx
+spec:
+  description: nginx
+  artifacts:
+  - name: config
+    kustomize:
+      path: nginx/config
+`
+
+var _ = Describe("Bundler", func() {
+	var (
+		tempDir string
+		cat     *catalog.Catalog
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "bundle")
+		Expect(err).NotTo(HaveOccurred())
+		cat = catalog.New()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	When("the bundle doesn't include the repositories", func() {
+		var gitClient *fakes.FakeGitClient
+
+		BeforeEach(func() {
+			gitClient = &fakes.FakeGitClient{}
+			gitClient.ReadFileReturns([]byte(nginxProfile), nil)
+			cat.Append(types.NamespacedName{Namespace: "team-a", Name: "nginx-catalog"},
+				profilesv1.ProfileCatalogEntry{Name: "nginx", Tag: "nginx/v0.1.0", URL: "https://github.com/weaveworks/profiles-examples"},
+				profilesv1.ProfileCatalogEntry{Name: "nginx", Tag: "nginx/v0.2.0", URL: "https://github.com/weaveworks/profiles-examples"},
+			)
+		})
+
+		It("exports the entries and their profile definitions", func() {
+			var buf bytes.Buffer
+			Expect(bundle.New(gitClient).Export(context.TODO(), cat, &buf, bundle.ExportOptions{})).To(Succeed())
+			Expect(gitClient.ReadFileCallCount()).To(Equal(2))
+			_, source, file := gitClient.ReadFileArgsForCall(0)
+			Expect(source).To(Equal(profilesv1.Source{URL: "https://github.com/weaveworks/profiles-examples", Tag: "nginx/v0.1.0", Path: "nginx"}))
+			Expect(file).To(Equal(git.ProfileFile))
+			Expect(gitClient.MirrorTagsCallCount()).To(Equal(0))
+			Expect(tarFiles(buf.Bytes())).To(ConsistOf(
+				bundle.ManifestFile,
+				"profiles/ab8914722fee2066-github.com-weaveworks-profiles-examples/nginx/v0.1.0/profile.yaml",
+				"profiles/ab8914722fee2066-github.com-weaveworks-profiles-examples/nginx/v0.2.0/profile.yaml",
+			))
+
+			source2, err := bundle.New(gitClient).Import(&buf, bundle.ImportOptions{Name: "imported", Namespace: "team-b", MirrorDir: tempDir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(source2.Name).To(Equal("imported"))
+			Expect(source2.Namespace).To(Equal("team-b"))
+			Expect(source2.Kind).To(Equal("ProfileCatalogSource"))
+			Expect(source2.Spec.Profiles).To(Equal([]profilesv1.ProfileCatalogEntry{
+				{Name: "nginx", Tag: "nginx/v0.1.0", URL: "https://github.com/weaveworks/profiles-examples"},
+				{Name: "nginx", Tag: "nginx/v0.2.0", URL: "https://github.com/weaveworks/profiles-examples"},
+			}))
+		})
+
+		When("a profile definition can't be read", func() {
+			It("fails", func() {
+				gitClient.ReadFileReturns(nil, errors.New("boom"))
+				err := bundle.New(gitClient).Export(context.TODO(), cat, &bytes.Buffer{}, bundle.ExportOptions{})
+				Expect(err).To(MatchError(ContainSubstring("failed to read the profile definition of nginx-catalog/nginx at nginx/v0.1.0: boom")))
+			})
+		})
+
+		When("the profile definition doesn't match the entry", func() {
+			It("fails to import the bundle", func() {
+				gitClient.ReadFileReturns([]byte("metadata:\n  name: other\n"), nil)
+				var buf bytes.Buffer
+				Expect(bundle.New(gitClient).Export(context.TODO(), cat, &buf, bundle.ExportOptions{})).To(Succeed())
+				_, err := bundle.New(gitClient).Import(&buf, bundle.ImportOptions{Name: "imported"})
+				Expect(err).To(MatchError(ContainSubstring(`is for profile "other", not "nginx"`)))
+			})
+		})
+	})
+
+	When("the bundle includes the repositories", func() {
+		var repoDir string
+
+		BeforeEach(func() {
+			repoDir = filepath.Join(tempDir, "profiles-examples")
+			createRepository(repoDir, "nginx/v0.1.0")
+			cat.Append(types.NamespacedName{Name: "nginx-catalog"},
+				profilesv1.ProfileCatalogEntry{Name: "nginx", Tag: "nginx/v0.1.0", URL: repoDir})
+		})
+
+		It("imports the repositories into the mirror directory", func() {
+			var buf bytes.Buffer
+			bundler := bundle.New(&git.Client{})
+			Expect(bundler.Export(context.TODO(), cat, &buf, bundle.ExportOptions{IncludeRepositories: true, TempDir: tempDir})).To(Succeed())
+
+			mirrorDir := filepath.Join(tempDir, "mirror")
+			data := buf.Bytes()
+			source, err := bundler.Import(bytes.NewReader(data), bundle.ImportOptions{Name: "imported", MirrorDir: mirrorDir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(source.Spec.Profiles).To(HaveLen(1))
+			mirror := source.Spec.Profiles[0].URL
+			Expect(filepath.Dir(mirror)).To(Equal(mirrorDir))
+
+			def, err := (&git.Client{}).GetProfileDefinition(context.TODO(), profilesv1.Source{URL: mirror, Tag: "nginx/v0.1.0", Path: "nginx"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(def.Name).To(Equal("nginx"))
+
+			source, err = bundler.Import(bytes.NewReader(data), bundle.ImportOptions{Name: "imported", MirrorDir: mirrorDir, MirrorURL: "http://git-mirror.profiles-system/"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(source.Spec.Profiles[0].URL).To(Equal("http://git-mirror.profiles-system/" + filepath.Base(mirror)))
+		})
+	})
+
+	Describe("Import", func() {
+		It("rejects files outside the mirror directory", func() {
+			_, err := bundle.New(nil).Import(bytes.NewReader(tarball("../escape", "data")), bundle.ImportOptions{MirrorDir: tempDir})
+			Expect(err).To(MatchError(`invalid file "../escape" in bundle`))
+		})
+
+		It("requires a manifest", func() {
+			_, err := bundle.New(nil).Import(bytes.NewReader(tarball("profiles/profile.yaml", nginxProfile)), bundle.ImportOptions{})
+			Expect(err).To(MatchError("bundle has no catalog.yaml"))
+		})
+	})
+})
+
+// createRepository creates a repository with the nginx profile and the tag.
+func createRepository(dir, tag string) {
+	repo, err := extgogit.PlainInit(dir, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.MkdirAll(filepath.Join(dir, "nginx"), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(dir, "nginx", git.ProfileFile), []byte(nginxProfile), 0644)).To(Succeed())
+	worktree, err := repo.Worktree()
+	Expect(err).NotTo(HaveOccurred())
+	_, err = worktree.Add("nginx/profile.yaml")
+	Expect(err).NotTo(HaveOccurred())
+	hash, err := worktree.Commit("add nginx", &extgogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = repo.CreateTag(tag, hash, nil)
+	Expect(err).NotTo(HaveOccurred())
+}
+
+// tarFiles returns the names of the files in the gzipped tarball.
+func tarFiles(data []byte) []string {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	Expect(err).NotTo(HaveOccurred())
+	tarReader := tar.NewReader(gzipReader)
+	var names []string
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	return names
+}
+
+// tarball returns a gzipped tarball with the file.
+func tarball(name, content string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+	_, err := tarWriter.Write([]byte(content))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+	return buf.Bytes()
+}
@@ -1,85 +1,394 @@
 package catalog
 
 import (
+	"errors"
+	"fmt"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/fluxcd/pkg/version"
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
 
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
 )
 
 // Catalog provides an in-memory cache of profiles from the cluster which can be queried easily.
-//type Catalog map[string][]profilesv1.ProfileCatalogEntry
+// Reads are served from an immutable Snapshot which is atomically swapped on every update, so
+// readers never observe a partially applied write.
 type Catalog struct {
-	m sync.Map
+	// mu serialises writers so that read-modify-write updates such as Append cannot lose data.
+	mu       sync.Mutex
+	snapshot atomic.Value
+}
+
+// Snapshot is an immutable, point-in-time view of the catalog. Catalog sources are keyed by their
+// namespaced name, sources with the same name in different namespaces are kept apart. Cluster scoped
+// catalog sources are keyed by their name and an empty namespace.
+type Snapshot struct {
+	generation uint64
+	sources    map[types.NamespacedName][]profilesv1.ProfileCatalogEntry
+	// keys are the keys of sources ordered by namespace and name, computed once when the snapshot is published.
+	keys []types.NamespacedName
+	// names indexes the ordered keys by the name of the catalog source.
+	names map[string][]types.NamespacedName
+	// visible restricts a filtered view to some catalog sources, it is nil if the view is not filtered.
+	visible func(source types.NamespacedName) bool
+}
+
+// ErrSourceNotFound is returned by Resolve if no catalog source has the requested name.
+var ErrSourceNotFound = errors.New("catalog source not found")
+
+// AmbiguousSourceError is returned by Resolve if catalog sources with the requested name exist
+// in several namespaces. The namespace must be given to select one of them.
+type AmbiguousSourceError struct {
+	Name    string
+	Sources []types.NamespacedName
+}
+
+func (e *AmbiguousSourceError) Error() string {
+	namespaces := make([]string, len(e.Sources))
+	for i, source := range e.Sources {
+		namespaces[i] = source.Namespace
+		if source.Namespace == "" {
+			namespaces[i] = "<cluster>"
+		}
+	}
+	return fmt.Sprintf("catalog source %q exists in several namespaces (%s), the namespace must be set", e.Name, strings.Join(namespaces, ", "))
 }
 
 // New creates a new, empty catalog.
 func New() *Catalog {
-	return &Catalog{
-		m: sync.Map{},
+	c := &Catalog{}
+	c.snapshot.Store(newSnapshot(0, map[types.NamespacedName][]profilesv1.ProfileCatalogEntry{}))
+	return c
+}
+
+// newSnapshot returns a snapshot of sources with its keys ordered and indexed by name.
+func newSnapshot(generation uint64, sources map[types.NamespacedName][]profilesv1.ProfileCatalogEntry) *Snapshot {
+	keys := make([]types.NamespacedName, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Namespace != keys[j].Namespace {
+			return keys[i].Namespace < keys[j].Namespace
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	names := make(map[string][]types.NamespacedName, len(keys))
+	for _, key := range keys {
+		names[key.Name] = append(names[key.Name], key)
+	}
+	return &Snapshot{
+		generation: generation,
+		sources:    sources,
+		keys:       keys,
+		names:      names,
 	}
 }
 
-// Append the existing profiles with new profiles
-func (c *Catalog) Append(sourceName string, profiles ...profilesv1.ProfileCatalogEntry) {
-	existingProfiles, ok := c.m.Load(sourceName)
-	if !ok {
-		c.AddOrReplace(sourceName, profiles...)
+// Snapshot returns the current view of the catalog. The returned value is never modified,
+// subsequent updates to the catalog result in a new Snapshot with a higher generation.
+func (c *Catalog) Snapshot() *Snapshot {
+	return c.snapshot.Load().(*Snapshot)
+}
+
+// Generation returns the generation of the current snapshot. It is incremented on every update.
+func (c *Catalog) Generation() uint64 {
+	return c.Snapshot().Generation()
+}
+
+// update applies fn to a copy of the current sources and publishes the result as a new snapshot.
+// fn must not modify the slices contained in the map, only replace or delete them. If fn reports
+// that nothing changed, no new snapshot is published.
+func (c *Catalog) update(fn func(sources map[types.NamespacedName][]profilesv1.ProfileCatalogEntry) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := c.Snapshot()
+	sources := make(map[types.NamespacedName][]profilesv1.ProfileCatalogEntry, len(current.sources))
+	for k, v := range current.sources {
+		sources[k] = v
+	}
+	if !fn(sources) {
 		return
 	}
-	c.AddOrReplace(sourceName, append(existingProfiles.([]profilesv1.ProfileCatalogEntry), profiles...)...)
+	c.snapshot.Store(newSnapshot(current.generation+1, sources))
+}
+
+// Append adds profiles to the catalog. Entries are keyed by their name, tag and URL, profiles
+// matching an existing entry replace it rather than being added a second time.
+func (c *Catalog) Append(source types.NamespacedName, profiles ...profilesv1.ProfileCatalogEntry) {
+	c.update(func(sources map[types.NamespacedName][]profilesv1.ProfileCatalogEntry) bool {
+		sources[source] = merge(sources[source], withSource(source, profiles))
+		return true
+	})
+}
+
+// Sync discards the entries of the repository `url` for the given stale tags and appends
+// the profiles in a single update, so readers never observe the catalog in between.
+func (c *Catalog) Sync(source types.NamespacedName, url string, staleTags []string, profiles ...profilesv1.ProfileCatalogEntry) {
+	stale := make(map[string]struct{}, len(staleTags))
+	for _, tag := range staleTags {
+		stale[tag] = struct{}{}
+	}
+	c.update(func(sources map[types.NamespacedName][]profilesv1.ProfileCatalogEntry) bool {
+		var kept []profilesv1.ProfileCatalogEntry
+		for _, p := range sources[source] {
+			if _, ok := stale[p.Tag]; ok && p.URL == url {
+				continue
+			}
+			kept = append(kept, p)
+		}
+		sources[source] = merge(kept, withSource(source, profiles))
+		return true
+	})
+}
+
+// RemoveRepository discards all entries of the repository `url` from the catalog.
+func (c *Catalog) RemoveRepository(source types.NamespacedName, url string) {
+	c.update(func(sources map[types.NamespacedName][]profilesv1.ProfileCatalogEntry) bool {
+		existing, ok := sources[source]
+		if !ok {
+			return false
+		}
+		kept := make([]profilesv1.ProfileCatalogEntry, 0, len(existing))
+		for _, p := range existing {
+			if p.URL != url {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == len(existing) {
+			return false
+		}
+		sources[source] = kept
+		return true
+	})
+}
+
+// entryKey identifies an entry within a catalog source.
+type entryKey struct {
+	name, tag, url string
+}
+
+func keyOf(p profilesv1.ProfileCatalogEntry) entryKey {
+	return entryKey{name: p.Name, tag: p.Tag, url: p.URL}
+}
+
+// merge returns a new slice containing existing followed by profiles. Profiles with the same key
+// as an earlier entry replace that entry in place.
+func merge(existing, profiles []profilesv1.ProfileCatalogEntry) []profilesv1.ProfileCatalogEntry {
+	result := make([]profilesv1.ProfileCatalogEntry, 0, len(existing)+len(profiles))
+	index := make(map[entryKey]int, len(existing)+len(profiles))
+	for _, p := range append(existing[:len(existing):len(existing)], profiles...) {
+		if i, ok := index[keyOf(p)]; ok {
+			result[i] = p
+			continue
+		}
+		index[keyOf(p)] = len(result)
+		result = append(result, p)
+	}
+	return result
 }
 
 // AddOrReplace replaces the catalog by replacing existing profiles with new profiles if it exists
 // otherwise it creates it
-func (c *Catalog) AddOrReplace(sourceName string, profiles ...profilesv1.ProfileCatalogEntry) {
-	for i := range profiles {
-		profiles[i].CatalogSource = sourceName
-	}
-	c.m.Store(sourceName, profiles)
+func (c *Catalog) AddOrReplace(source types.NamespacedName, profiles ...profilesv1.ProfileCatalogEntry) {
+	c.update(func(sources map[types.NamespacedName][]profilesv1.ProfileCatalogEntry) bool {
+		sources[source] = withSource(source, profiles)
+		return true
+	})
 }
 
 // Remove removes the specified catalog.
-func (c *Catalog) Remove(sourceName string) {
-	c.m.Delete(sourceName)
+func (c *Catalog) Remove(source types.NamespacedName) {
+	c.update(func(sources map[types.NamespacedName][]profilesv1.ProfileCatalogEntry) bool {
+		if _, ok := sources[source]; !ok {
+			return false
+		}
+		delete(sources, source)
+		return true
+	})
+}
+
+// withSource returns a copy of profiles with the catalog source, its namespace and scope set. The
+// input is copied so callers can't mutate the entries of a published snapshot.
+func withSource(source types.NamespacedName, profiles []profilesv1.ProfileCatalogEntry) []profilesv1.ProfileCatalogEntry {
+	scope := profilesv1.NamespacedCatalogScope
+	if source.Namespace == "" {
+		scope = profilesv1.ClusterCatalogScope
+	}
+	result := make([]profilesv1.ProfileCatalogEntry, len(profiles))
+	for i, p := range profiles {
+		p.CatalogSource = source.Name
+		p.CatalogNamespace = source.Namespace
+		p.CatalogScope = scope
+		result[i] = p
+	}
+	return result
 }
 
 // Search returns profile descriptions that contain `name` in their names.
 func (c *Catalog) Search(name string) []profilesv1.ProfileCatalogEntry {
+	return c.Snapshot().Search(name)
+}
+
+// SearchAll returns `all` profile descriptions.
+func (c *Catalog) SearchAll() []profilesv1.ProfileCatalogEntry {
+	return c.Snapshot().SearchAll()
+}
+
+// Get returns the profile description `profileName`.
+func (c *Catalog) Get(sourceName, profileName string) *profilesv1.ProfileCatalogEntry {
+	return c.Snapshot().Get(sourceName, profileName)
+}
+
+// Count returns the number of distinct profiles and the number of profile versions listed by the catalog source.
+func (c *Catalog) Count(source types.NamespacedName) (profiles, versions int) {
+	return c.Snapshot().Count(source)
+}
+
+// CatalogExists checks if the catalog exists
+func (c *Catalog) CatalogExists(source types.NamespacedName) bool {
+	return c.Snapshot().CatalogExists(source)
+}
+
+// GetWithVersion returns the profile description `profileName` with the given version.
+func (c *Catalog) GetWithVersion(logger logr.Logger, sourceName, profileName, profileVersion string) *profilesv1.ProfileCatalogEntry {
+	return c.Snapshot().GetWithVersion(logger, sourceName, profileName, profileVersion)
+}
+
+// ProfilesGreaterThanVersion returns all profiles which are of a greater version for a given profile with a version.
+// If set to "latest" all versions are returned. Versions are ordered in descending order
+func (c *Catalog) ProfilesGreaterThanVersion(logger logr.Logger, sourceName, profileName, profileVersion string) []profilesv1.ProfileCatalogEntry {
+	return c.Snapshot().ProfilesGreaterThanVersion(logger, sourceName, profileName, profileVersion)
+}
+
+// Generation returns the generation of the snapshot.
+func (s *Snapshot) Generation() uint64 {
+	return s.generation
+}
+
+// Filter returns a view of the snapshot which only contains the catalog sources for which visible
+// returns true. A nil func returns the snapshot unchanged. The view shares the sources of the
+// snapshot, visible is called lazily and at most once per catalog source.
+func (s *Snapshot) Filter(visible func(source types.NamespacedName) bool) *Snapshot {
+	if visible == nil {
+		return s
+	}
+	if s.visible != nil {
+		parent, child := s.visible, visible
+		visible = func(source types.NamespacedName) bool {
+			return parent(source) && child(source)
+		}
+	}
+	view := *s
+	view.visible = memoize(visible)
+	return &view
+}
+
+// memoize returns a func which calls visible once per catalog source and remembers the result.
+func memoize(visible func(source types.NamespacedName) bool) func(source types.NamespacedName) bool {
+	var (
+		mu   sync.Mutex
+		seen = map[types.NamespacedName]bool{}
+	)
+	return func(source types.NamespacedName) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if v, ok := seen[source]; ok {
+			return v
+		}
+		v := visible(source)
+		seen[source] = v
+		return v
+	}
+}
+
+// has returns true if the catalog source exists and is part of the view.
+func (s *Snapshot) has(source types.NamespacedName) bool {
+	if _, ok := s.sources[source]; !ok {
+		return false
+	}
+	return s.visible == nil || s.visible(source)
+}
+
+// sourceKeys returns the keys of the catalog sources in the view ordered by namespace and name.
+func (s *Snapshot) sourceKeys() []types.NamespacedName {
+	if s.visible == nil {
+		return s.keys
+	}
+	var keys []types.NamespacedName
+	for _, key := range s.keys {
+		if s.visible(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Resolve returns the key of the catalog source `sourceName`. It returns ErrSourceNotFound if no
+// catalog source has that name and an *AmbiguousSourceError if it exists in several namespaces.
+func (s *Snapshot) Resolve(sourceName string) (types.NamespacedName, error) {
+	var matches []types.NamespacedName
+	for _, key := range s.names[sourceName] {
+		if s.visible == nil || s.visible(key) {
+			matches = append(matches, key)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return types.NamespacedName{}, ErrSourceNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return types.NamespacedName{}, &AmbiguousSourceError{Name: sourceName, Sources: matches}
+	}
+}
+
+// source returns the profiles of the catalog source `sourceName`. Nothing is returned if the name
+// is ambiguous, see Resolve.
+func (s *Snapshot) source(sourceName string) ([]profilesv1.ProfileCatalogEntry, bool) {
+	key, err := s.Resolve(sourceName)
+	if err != nil {
+		return nil, false
+	}
+	return s.sources[key], true
+}
+
+// Search returns profile descriptions that contain `name` in their names.
+func (s *Snapshot) Search(name string) []profilesv1.ProfileCatalogEntry {
 	var ret []profilesv1.ProfileCatalogEntry
-	c.m.Range(func(key, value interface{}) bool {
-		for _, p := range value.([]profilesv1.ProfileCatalogEntry) {
+	for _, key := range s.sourceKeys() {
+		for _, p := range s.sources[key] {
 			if strings.Contains(p.Name, name) {
 				ret = append(ret, p)
 			}
 		}
-		return true
-	})
+	}
 	return ret
 }
 
 // SearchAll returns `all` profile descriptions.
-func (c *Catalog) SearchAll() []profilesv1.ProfileCatalogEntry {
+func (s *Snapshot) SearchAll() []profilesv1.ProfileCatalogEntry {
 	var ret []profilesv1.ProfileCatalogEntry
-	c.m.Range(func(key, value interface{}) bool {
-		ret = append(ret, value.([]profilesv1.ProfileCatalogEntry)...)
-		return true
-	})
+	for _, key := range s.sourceKeys() {
+		ret = append(ret, s.sources[key]...)
+	}
 	return ret
 }
 
 // Get returns the profile description `profileName`.
-func (c *Catalog) Get(sourceName, profileName string) *profilesv1.ProfileCatalogEntry {
-	profiles, ok := c.m.Load(sourceName)
+func (s *Snapshot) Get(sourceName, profileName string) *profilesv1.ProfileCatalogEntry {
+	profiles, ok := s.source(sourceName)
 	if !ok {
 		return nil
 	}
-	for _, p := range profiles.([]profilesv1.ProfileCatalogEntry) {
+	for _, p := range profiles {
 		if p.Name == profileName && p.CatalogSource == sourceName {
 			return &p
 		}
@@ -87,28 +396,47 @@ func (c *Catalog) Get(sourceName, profileName string) *profilesv1.ProfileCatalog
 	return nil
 }
 
+// Profiles returns the profiles listed by the catalog source.
+func (s *Snapshot) Profiles(source types.NamespacedName) []profilesv1.ProfileCatalogEntry {
+	if !s.has(source) {
+		return nil
+	}
+	return s.sources[source]
+}
+
+// Count returns the number of distinct profiles and the number of profile versions listed by the catalog source.
+func (s *Snapshot) Count(source types.NamespacedName) (profiles, versions int) {
+	if !s.has(source) {
+		return 0, 0
+	}
+	names := map[string]struct{}{}
+	for _, p := range s.sources[source] {
+		names[p.Name] = struct{}{}
+	}
+	return len(names), len(s.sources[source])
+}
+
 // CatalogExists checks if the catalog exists
-func (c *Catalog) CatalogExists(sourceName string) bool {
-	_, ok := c.m.Load(sourceName)
-	return ok
+func (s *Snapshot) CatalogExists(source types.NamespacedName) bool {
+	return s.has(source)
 }
 
 // GetWithVersion returns the profile description `profileName` with the given version.
-func (c *Catalog) GetWithVersion(logger logr.Logger, sourceName, profileName, profileVersion string) *profilesv1.ProfileCatalogEntry {
-	profiles, ok := c.m.Load(sourceName)
+func (s *Snapshot) GetWithVersion(logger logr.Logger, sourceName, profileName, profileVersion string) *profilesv1.ProfileCatalogEntry {
+	profiles, ok := s.source(sourceName)
 	if !ok {
 		return nil
 	}
 
 	if profileVersion == "latest" {
-		versions := c.ProfilesGreaterThanVersion(logger, sourceName, profileName, profileVersion)
+		versions := s.ProfilesGreaterThanVersion(logger, sourceName, profileName, profileVersion)
 		if len(versions) == 0 {
 			return nil
 		}
 		return &versions[0]
 	}
 
-	for _, p := range profiles.([]profilesv1.ProfileCatalogEntry) {
+	for _, p := range profiles {
 		if p.Name == profileName && p.CatalogSource == sourceName && profilesv1.GetVersionFromTag(p.Tag) == profileVersion {
 			return &p
 		}
@@ -123,9 +451,9 @@ type profileDescriptionWithVersion struct {
 
 // ProfilesGreaterThanVersion returns all profiles which are of a greater version for a given profile with a version.
 // If set to "latest" all versions are returned. Versions are ordered in descending order
-func (c *Catalog) ProfilesGreaterThanVersion(logger logr.Logger, sourceName, profileName, profileVersion string) []profilesv1.ProfileCatalogEntry {
+func (s *Snapshot) ProfilesGreaterThanVersion(logger logr.Logger, sourceName, profileName, profileVersion string) []profilesv1.ProfileCatalogEntry {
 	var profilesWithValidVersion []profileDescriptionWithVersion
-	profiles, ok := c.m.Load(sourceName)
+	profiles, ok := s.source(sourceName)
 	if !ok {
 		return nil
 	}
@@ -133,7 +461,7 @@ func (c *Catalog) ProfilesGreaterThanVersion(logger logr.Logger, sourceName, pro
 	if err != nil && profileVersion != "latest" {
 		return nil
 	}
-	for _, p := range profiles.([]profilesv1.ProfileCatalogEntry) {
+	for _, p := range profiles {
 		tag := profilesv1.GetVersionFromTag(p.Tag)
 		v, err := version.ParseVersion(tag)
 		if err != nil {
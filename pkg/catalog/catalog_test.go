@@ -1,9 +1,13 @@
 package catalog_test
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
 
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
 	"github.com/weaveworks/profiles/pkg/catalog"
@@ -11,43 +15,47 @@ import (
 
 var _ = Describe("Catalog", func() {
 	var (
-		c       *catalog.Catalog
-		catName string
-		logger  = logr.Discard()
+		c            *catalog.Catalog
+		catName      string
+		catNamespace string
+		catSource    types.NamespacedName
+		logger       = logr.Discard()
 	)
 
 	BeforeEach(func() {
 		c = catalog.New()
 		catName = "whiskers"
+		catNamespace = "default"
+		catSource = types.NamespacedName{Namespace: catNamespace, Name: catName}
 	})
 
 	It("manages an in memory list of profiles", func() {
 		By("adding profiles to the list")
-		Expect(c.CatalogExists(catName)).To(BeFalse())
+		Expect(c.CatalogExists(catSource)).To(BeFalse())
 		profiles := []profilesv1.ProfileCatalogEntry{
 			{Name: "foo"},
 			{Name: "bar"},
 			{Name: "alsofoo"},
 		}
-		c.Append(catName, profiles...)
-		Expect(c.CatalogExists(catName)).To(BeTrue())
+		c.Append(catSource, profiles...)
+		Expect(c.CatalogExists(catSource)).To(BeTrue())
 
 		By("returning all the profiles available")
 		Expect(c.SearchAll()).To(ConsistOf(
-			profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName},
-			profilesv1.ProfileCatalogEntry{Name: "bar", CatalogSource: catName},
-			profilesv1.ProfileCatalogEntry{Name: "alsofoo", CatalogSource: catName},
+			profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			profilesv1.ProfileCatalogEntry{Name: "bar", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			profilesv1.ProfileCatalogEntry{Name: "alsofoo", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 		))
 
 		By("returning all matching profiles based on query string")
 		Expect(c.Search("foo")).To(ConsistOf(
-			profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName},
-			profilesv1.ProfileCatalogEntry{Name: "alsofoo", CatalogSource: catName},
+			profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			profilesv1.ProfileCatalogEntry{Name: "alsofoo", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 		))
 
 		By("getting details for a specific named profile in a catalog")
 		Expect(c.Get(catName, "foo")).To(Equal(
-			&profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName},
+			&profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 		))
 
 		By("replacing profiles in a catalog source")
@@ -55,24 +63,214 @@ var _ = Describe("Catalog", func() {
 			{Name: "foo"},
 			{Name: "bar"},
 		}
-		c.AddOrReplace(catName, profiles...)
-		Expect(c.Search("foo")).To(ConsistOf(profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName}))
+		c.AddOrReplace(catSource, profiles...)
+		Expect(c.Search("foo")).To(ConsistOf(profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope}))
 
 		By("appending profiles in a catalog source")
 		profiles = []profilesv1.ProfileCatalogEntry{
 			{Name: "bar-2"},
 		}
-		c.Append(catName, profiles...)
+		c.Append(catSource, profiles...)
 		Expect(c.Search("bar")).To(ConsistOf(
-			profilesv1.ProfileCatalogEntry{Name: "bar", CatalogSource: catName},
-			profilesv1.ProfileCatalogEntry{Name: "bar-2", CatalogSource: catName},
+			profilesv1.ProfileCatalogEntry{Name: "bar", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			profilesv1.ProfileCatalogEntry{Name: "bar-2", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 		))
 
 		By("removing a catalog source")
-		c.Remove(catName)
+		c.Remove(catSource)
 		Expect(c.Search("foo")).To(BeEmpty())
 	})
 
+	Describe("Append", func() {
+		It("replaces entries with the same name, tag and url instead of duplicating them", func() {
+			c.Append(catSource,
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", URL: "github.com/a/b"},
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", URL: "github.com/c/d"},
+			)
+			c.Append(catSource,
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", URL: "github.com/a/b", ProfileDescription: profilesv1.ProfileDescription{Description: "rescanned"}},
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.2.0", URL: "github.com/a/b"},
+			)
+
+			Expect(c.SearchAll()).To(Equal([]profilesv1.ProfileCatalogEntry{
+				{Name: "foo", Tag: "v0.1.0", URL: "github.com/a/b", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope, ProfileDescription: profilesv1.ProfileDescription{Description: "rescanned"}},
+				{Name: "foo", Tag: "v0.1.0", URL: "github.com/c/d", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+				{Name: "foo", Tag: "v0.2.0", URL: "github.com/a/b", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			}))
+		})
+	})
+
+	Describe("Sync", func() {
+		It("discards the entries of stale tags of the repository and appends the new profiles", func() {
+			c.Append(catSource,
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", URL: "github.com/a/b"},
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.2.0", URL: "github.com/a/b"},
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.2.0", URL: "github.com/c/d"},
+			)
+			generation := c.Generation()
+
+			c.Sync(catSource, "github.com/a/b", []string{"v0.1.0", "v0.2.0"},
+				profilesv1.ProfileCatalogEntry{Name: "bar", Tag: "v0.2.0", URL: "github.com/a/b"},
+			)
+
+			Expect(c.Generation()).To(Equal(generation + 1))
+			Expect(c.SearchAll()).To(ConsistOf(
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.2.0", URL: "github.com/c/d", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+				profilesv1.ProfileCatalogEntry{Name: "bar", Tag: "v0.2.0", URL: "github.com/a/b", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			))
+		})
+	})
+
+	Describe("Count", func() {
+		It("counts the distinct profiles and the versions of the catalog source", func() {
+			c.Append(catSource,
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", URL: "github.com/a/b"},
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.2.0", URL: "github.com/a/b"},
+				profilesv1.ProfileCatalogEntry{Name: "bar", Tag: "v0.1.0", URL: "github.com/c/d"},
+			)
+			c.Append(types.NamespacedName{Namespace: catNamespace, Name: "other"},
+				profilesv1.ProfileCatalogEntry{Name: "baz", Tag: "v0.1.0", URL: "github.com/e/f"},
+			)
+
+			profiles, versions := c.Count(catSource)
+			Expect(profiles).To(Equal(2))
+			Expect(versions).To(Equal(3))
+		})
+	})
+
+	Describe("RemoveRepository", func() {
+		It("discards all entries of the repository", func() {
+			c.Append(catSource,
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", URL: "github.com/a/b"},
+				profilesv1.ProfileCatalogEntry{Name: "bar", Tag: "v0.1.0", URL: "github.com/c/d"},
+			)
+
+			c.RemoveRepository(catSource, "github.com/a/b")
+			Expect(c.SearchAll()).To(ConsistOf(
+				profilesv1.ProfileCatalogEntry{Name: "bar", Tag: "v0.1.0", URL: "github.com/c/d", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			))
+		})
+	})
+
+	Describe("namespaces", func() {
+		var otherSource types.NamespacedName
+
+		BeforeEach(func() {
+			otherSource = types.NamespacedName{Namespace: "another", Name: catName}
+			c.AddOrReplace(catSource, profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0"})
+			c.AddOrReplace(otherSource, profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.2.0"})
+		})
+
+		It("keeps catalog sources with the same name in different namespaces apart", func() {
+			Expect(c.SearchAll()).To(Equal([]profilesv1.ProfileCatalogEntry{
+				{Name: "foo", Tag: "v0.2.0", CatalogSource: catName, CatalogNamespace: "another", CatalogScope: profilesv1.NamespacedCatalogScope},
+				{Name: "foo", Tag: "v0.1.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			}))
+
+			c.Remove(otherSource)
+			Expect(c.CatalogExists(otherSource)).To(BeFalse())
+			Expect(c.SearchAll()).To(ConsistOf(
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			))
+		})
+
+		It("does not resolve a catalog source name which exists in several namespaces", func() {
+			_, err := c.Snapshot().Resolve(catName)
+			Expect(err).To(MatchError(&catalog.AmbiguousSourceError{Name: catName, Sources: []types.NamespacedName{otherSource, catSource}}))
+			Expect(c.Get(catName, "foo")).To(BeNil())
+			Expect(c.ProfilesGreaterThanVersion(logger, catName, "foo", "latest")).To(BeEmpty())
+
+			_, err = c.Snapshot().Resolve("unknown")
+			Expect(err).To(MatchError(catalog.ErrSourceNotFound))
+		})
+
+		It("filters a snapshot by catalog source", func() {
+			snapshot := c.Snapshot().Filter(func(source types.NamespacedName) bool {
+				return source.Namespace == catNamespace
+			})
+
+			Expect(snapshot.Generation()).To(Equal(c.Generation()))
+			Expect(snapshot.CatalogExists(otherSource)).To(BeFalse())
+			Expect(snapshot.Resolve(catName)).To(Equal(catSource))
+			Expect(snapshot.Get(catName, "foo")).To(Equal(
+				&profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.1.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+			))
+			Expect(c.Snapshot().Filter(nil).SearchAll()).To(HaveLen(2))
+		})
+
+		It("asks for the visibility of every catalog source at most once per view", func() {
+			calls := map[types.NamespacedName]int{}
+			snapshot := c.Snapshot().Filter(func(source types.NamespacedName) bool {
+				calls[source]++
+				return source.Namespace == catNamespace
+			})
+
+			Expect(snapshot.SearchAll()).To(HaveLen(1))
+			Expect(snapshot.Get(catName, "foo")).NotTo(BeNil())
+			Expect(snapshot.Search("foo")).To(HaveLen(1))
+			Expect(calls).To(Equal(map[types.NamespacedName]int{catSource: 1, otherSource: 1}))
+
+			By("combining the filters of a filtered view")
+			Expect(snapshot.Filter(func(types.NamespacedName) bool { return false }).SearchAll()).To(BeEmpty())
+		})
+
+		It("lists profiles of cluster scoped catalog sources first", func() {
+			clusterSource := types.NamespacedName{Name: catName}
+			c.AddOrReplace(clusterSource, profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.3.0"})
+
+			Expect(c.SearchAll()[0]).To(Equal(
+				profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.3.0", CatalogSource: catName, CatalogScope: profilesv1.ClusterCatalogScope},
+			))
+			Expect(c.SearchAll()).To(HaveLen(3))
+		})
+	})
+
+	Describe("Snapshot", func() {
+		It("increments the generation on every update", func() {
+			Expect(c.Generation()).To(Equal(uint64(0)))
+			c.AddOrReplace(catSource, profilesv1.ProfileCatalogEntry{Name: "foo"})
+			Expect(c.Generation()).To(Equal(uint64(1)))
+			c.Append(catSource, profilesv1.ProfileCatalogEntry{Name: "bar"})
+			Expect(c.Generation()).To(Equal(uint64(2)))
+			c.Remove(catSource)
+			Expect(c.Generation()).To(Equal(uint64(3)))
+
+			By("not incrementing the generation when nothing changed")
+			c.Remove(catSource)
+			Expect(c.Generation()).To(Equal(uint64(3)))
+		})
+
+		It("is not affected by later updates", func() {
+			profiles := []profilesv1.ProfileCatalogEntry{{Name: "foo"}}
+			c.AddOrReplace(catSource, profiles...)
+			snapshot := c.Snapshot()
+
+			profiles[0].Name = "mutated"
+			c.Append(catSource, profilesv1.ProfileCatalogEntry{Name: "bar"})
+			c.Remove(catSource)
+
+			Expect(snapshot.Generation()).To(Equal(uint64(1)))
+			Expect(snapshot.CatalogExists(catSource)).To(BeTrue())
+			Expect(snapshot.SearchAll()).To(ConsistOf(profilesv1.ProfileCatalogEntry{Name: "foo", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope}))
+			Expect(c.CatalogExists(catSource)).To(BeFalse())
+		})
+
+		It("does not lose concurrent appends", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					c.Append(catSource, profilesv1.ProfileCatalogEntry{Name: fmt.Sprintf("foo-%d", i)})
+				}(i)
+			}
+			wg.Wait()
+
+			Expect(c.SearchAll()).To(HaveLen(50))
+			Expect(c.Generation()).To(Equal(uint64(50)))
+		})
+	})
+
 	Describe("GetWithVersion", func() {
 		It("returns the profile with the matching version", func() {
 
@@ -81,33 +279,33 @@ var _ = Describe("Catalog", func() {
 				{Name: "foo", Tag: "0.2.0"},
 				{Name: "foo"},
 			}
-			c.AddOrReplace(catName, profiles...)
+			c.AddOrReplace(catSource, profiles...)
 
 			Expect(c.GetWithVersion(logger, catName, "foo", "v0.1.0")).To(Equal(
-				&profilesv1.ProfileCatalogEntry{ProfileDescription: profilesv1.ProfileDescription{Description: "install foo"}, Name: "foo", Tag: "v0.1.0", CatalogSource: catName},
+				&profilesv1.ProfileCatalogEntry{ProfileDescription: profilesv1.ProfileDescription{Description: "install foo"}, Name: "foo", Tag: "v0.1.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 			))
 		})
 
 		When("version is set to latest", func() {
 			It("returns the latest version", func() {
 				profiles := []profilesv1.ProfileCatalogEntry{{Name: "foo", Tag: "foo/v0.1.0"}, {Name: "foo", Tag: "foo/0.2.0"}, {Name: "bar", Tag: "bar/0.3.0"}, {Name: "foo"}}
-				c.AddOrReplace(catName, profiles...)
+				c.AddOrReplace(catSource, profiles...)
 
 				Expect(c.GetWithVersion(logger, catName, "foo", "latest")).To(Equal(
-					&profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "foo/0.2.0", CatalogSource: catName},
+					&profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "foo/0.2.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 				))
 
 				profiles = []profilesv1.ProfileCatalogEntry{{Name: "foo", Tag: "0.2.0"}, {Name: "foo", Tag: "v0.3.0"}, {Name: "foo"}}
-				c.AddOrReplace(catName, profiles...)
+				c.AddOrReplace(catSource, profiles...)
 				Expect(c.GetWithVersion(logger, catName, "foo", "latest")).To(Equal(
-					&profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.3.0", CatalogSource: catName},
+					&profilesv1.ProfileCatalogEntry{Name: "foo", Tag: "v0.3.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 				))
 			})
 
 			When("no profile has a valid version", func() {
 				It("returns nil", func() {
 					profiles := []profilesv1.ProfileCatalogEntry{{Name: "foo", Tag: "vsda012!.1.0"}, {Name: "foo", Tag: "!0.!2.0"}, {Name: "foo"}}
-					c.AddOrReplace(catName, profiles...)
+					c.AddOrReplace(catSource, profiles...)
 
 					Expect(c.GetWithVersion(logger, catName, "foo", "latest")).To(BeNil())
 				})
@@ -130,12 +328,12 @@ var _ = Describe("Catalog", func() {
 				{Name: "foo2", Tag: "v0.3.1"},
 				{Name: "foo"},
 			}
-			c.AddOrReplace(catName, profiles...)
+			c.AddOrReplace(catSource, profiles...)
 
 			Expect(c.ProfilesGreaterThanVersion(logger, catName, "foo", "v0.1.0")).To(Equal(
 				[]profilesv1.ProfileCatalogEntry{
-					{Name: "foo", Tag: "v0.3.0", CatalogSource: catName},
-					{Name: "foo", Tag: "v0.2.0", CatalogSource: catName},
+					{Name: "foo", Tag: "v0.3.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
+					{Name: "foo", Tag: "v0.2.0", CatalogSource: catName, CatalogNamespace: catNamespace, CatalogScope: profilesv1.NamespacedCatalogScope},
 				},
 			))
 		})
@@ -0,0 +1,207 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+)
+
+// Watcher loads a PEM encoded certificate and key, and optionally a CA bundle, from disk and reloads
+// them when the files change, for example when cert-manager rotates the certificate.
+type Watcher struct {
+	logger   logr.Logger
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	pool        *x509.CertPool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewWatcher returns a Watcher for the given files. Either the certificate and key, the CA or all of
+// them must be set. The files are loaded immediately.
+func NewWatcher(logger logr.Logger, certFile, keyFile, caFile string) (*Watcher, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both the certificate and the key file must be set")
+	}
+	if certFile == "" && caFile == "" {
+		return nil, errors.New("no certificate or CA file set")
+	}
+	w := &Watcher{
+		logger:   logger.WithName("certs"),
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		stop:     make(chan struct{}),
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Start watches the files until Stop is called. The directories of the files are watched, rather than
+// the files themselves, as Kubernetes updates mounted secrets by replacing a symlink.
+func (w *Watcher) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	dirs := map[string]struct{}{}
+	for _, file := range []string{w.certFile, w.keyFile, w.caFile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = struct{}{}
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.stop:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if err := w.load(); err != nil {
+				// keep serving the previous certificate until the files are consistent again
+				w.logger.Error(err, "failed to reload certificates", "event", event.String())
+				continue
+			}
+			w.logger.Info("reloaded certificates", "event", event.String())
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger.Error(err, "error watching certificates")
+		}
+	}
+}
+
+// Stop stops watching the files.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *Watcher) load() error {
+	var certificate *tls.Certificate
+	if w.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(w.certFile, w.keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate: %w", err)
+		}
+		certificate = &cert
+	}
+	var pool *x509.CertPool
+	if w.caFile != "" {
+		ca, err := ioutil.ReadFile(w.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificates found in CA file %s", w.caFile)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.certificate = certificate
+	w.pool = pool
+	return nil
+}
+
+func (w *Watcher) current() (*tls.Certificate, *x509.CertPool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.certificate, w.pool
+}
+
+// ServerConfig returns a TLS configuration for a server serving the current certificate. If a CA is
+// set, client certificates signed by it are verified when clients present one.
+func (w *Watcher) ServerConfig() *tls.Config {
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		certificate, _ := w.current()
+		if certificate == nil {
+			return nil, errors.New("no certificate configured")
+		}
+		return certificate, nil
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: getCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			_, pool := w.current()
+			if pool == nil {
+				return nil, nil
+			}
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: getCertificate,
+				ClientCAs:      pool,
+				ClientAuth:     tls.VerifyClientCertIfGiven,
+				NextProtos:     []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns a TLS configuration for a client verifying the server against the current CA,
+// or the system roots if no CA is set. The current certificate, if any, is presented to the server.
+func (w *Watcher) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certificate, _ := w.current()
+			if certificate == nil {
+				return &tls.Certificate{}, nil
+			}
+			return certificate, nil
+		},
+		// the server certificate is verified in VerifyConnection against the CA loaded at the time of
+		// the handshake, which the static RootCAs can't do.
+		InsecureSkipVerify: true, // #nosec G402
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("server presented no certificate")
+			}
+			_, pool := w.current()
+			opts := x509.VerifyOptions{
+				DNSName:       serverName,
+				Roots:         pool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range state.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := state.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
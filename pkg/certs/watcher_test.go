@@ -0,0 +1,137 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/weaveworks/profiles/pkg/certs"
+)
+
+var _ = Describe("Watcher", func() {
+	var (
+		dir                       string
+		certFile, keyFile, caFile string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "certs")
+		Expect(err).NotTo(HaveOccurred())
+		certFile = filepath.Join(dir, "tls.crt")
+		keyFile = filepath.Join(dir, "tls.key")
+		caFile = filepath.Join(dir, "ca.crt")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("serves the certificate and reloads it when the files change", func() {
+		first := writeCertificate(certFile, keyFile, caFile, "first")
+		watcher, err := certs.NewWatcher(zap.New(), certFile, keyFile, caFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(handshake(watcher)).To(Equal(first))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error)
+		go func() { done <- watcher.Start(ctx) }()
+		// give the watcher time to watch the directory
+		time.Sleep(100 * time.Millisecond)
+
+		second := writeCertificate(certFile, keyFile, caFile, "second")
+		Eventually(func() string { return handshake(watcher) }).Should(Equal(second))
+
+		watcher.Stop()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("keeps the previous certificate when the files are invalid", func() {
+		first := writeCertificate(certFile, keyFile, caFile, "first")
+		watcher, err := certs.NewWatcher(zap.New(), certFile, keyFile, caFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = watcher.Start(ctx) }()
+		time.Sleep(100 * time.Millisecond)
+
+		Expect(ioutil.WriteFile(keyFile, []byte("garbage"), 0600)).To(Succeed())
+		Consistently(func() string { return handshake(watcher) }, 300*time.Millisecond).Should(Equal(first))
+	})
+
+	When("the files can't be loaded", func() {
+		It("returns an error", func() {
+			_, err := certs.NewWatcher(zap.New(), certFile, keyFile, "")
+			Expect(err).To(MatchError(ContainSubstring("failed to load certificate")))
+		})
+	})
+
+	When("only the certificate or the key is set", func() {
+		It("returns an error", func() {
+			_, err := certs.NewWatcher(zap.New(), certFile, "", "")
+			Expect(err).To(MatchError("both the certificate and the key file must be set"))
+		})
+	})
+})
+
+// writeCertificate writes a self-signed certificate for localhost with the given common name, which
+// is also its own CA, and returns the common name.
+func writeCertificate(certFile, keyFile, caFile, commonName string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(certFile, certPEM, 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(caFile, certPEM, 0600)).To(Succeed())
+	return commonName
+}
+
+// handshake connects a client using the watcher's client configuration to a server using its server
+// configuration and returns the common name of the certificate the server presented.
+func handshake(watcher *certs.Watcher) string {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	serverConn := tls.Server(server, watcher.ServerConfig())
+	go func() { _ = serverConn.Handshake() }()
+
+	clientConn := tls.Client(client, watcher.ClientConfig("localhost"))
+	if err := clientConn.Handshake(); err != nil {
+		return err.Error()
+	}
+	return clientConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
@@ -0,0 +1,302 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+// DefaultBackoff is the backoff of retried calls of clients which don't set one. Calls are attempted
+// up to Steps times.
+var DefaultBackoff = wait.Backoff{
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+	Cap:      5 * time.Second,
+}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+//counterfeiter:generate -o fakes/fake_catalog.go . Catalog
+// Catalog queries the profiles catalog API
+type Catalog interface {
+	// Get returns the latest version of a profile
+	Get(ctx context.Context, sourceName, profileName string) (*profilesv1.ProfileCatalogEntry, error)
+	// GetWithVersion returns a version of a profile
+	GetWithVersion(ctx context.Context, sourceName, profileName, version string) (*profilesv1.ProfileCatalogEntry, error)
+	// ProfilesGreaterThanVersion returns the versions of a profile greater than version
+	ProfilesGreaterThanVersion(ctx context.Context, sourceName, profileName, version string) ([]profilesv1.ProfileCatalogEntry, error)
+	// Search returns the profiles whose name contains name, or all profiles if name is empty
+	Search(ctx context.Context, name string, opts ...SearchOption) ([]profilesv1.ProfileCatalogEntry, error)
+}
+
+// SearchOption configures a search.
+type SearchOption func(*protos.SearchRequest)
+
+// Verified only returns the profiles whose tag or commit is signed by a trusted key of their repository.
+func Verified() SearchOption {
+	return func(req *protos.SearchRequest) {
+		req.Verified = true
+	}
+}
+
+// Client calls the profiles catalog API, retrying calls which failed because the API is unavailable
+// or rate limited. Errors are grpc status errors, so status.Code returns codes.NotFound for unknown profiles.
+type Client struct {
+	service     protos.ProfilesServiceClient
+	conn        *grpc.ClientConn
+	namespace   string
+	backoff     wait.Backoff
+	tls         *tls.Config
+	insecure    bool
+	token       string
+	dialOptions []grpc.DialOption
+}
+
+var _ Catalog = &Client{}
+
+// Option configures the client.
+type Option func(*Client)
+
+// WithNamespace returns the profiles visible to the namespace, see the namespace of the requests.
+func WithNamespace(namespace string) Option {
+	return func(c *Client) {
+		c.namespace = namespace
+	}
+}
+
+// WithBackoff retries failed calls with the given backoff instead of DefaultBackoff. Set Steps to 1
+// to disable retries.
+func WithBackoff(backoff wait.Backoff) Option {
+	return func(c *Client) {
+		c.backoff = backoff
+	}
+}
+
+// WithTLS dials the grpc API over TLS using the given configuration instead of the system roots.
+// Only supported by Dial.
+func WithTLS(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tls = config
+	}
+}
+
+// WithInsecure dials the grpc API in plaintext. Only supported by Dial.
+func WithInsecure() Option {
+	return func(c *Client) {
+		c.insecure = true
+	}
+}
+
+// WithToken authenticates calls with the bearer token, sent as authorization metadata of grpc calls
+// or as Authorization header of HTTP requests. Not supported by service proxy clients, because the
+// Kubernetes api server authenticates the requests it proxies with the Authorization header.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithDialOptions adds options to dialing the grpc API, for example grpc.WithBlock. Only supported by Dial.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *Client) {
+		c.dialOptions = append(c.dialOptions, opts...)
+	}
+}
+
+// New returns a client calling the given service, for example one returned by NewServiceProxyProfilesServiceClient.
+// It fails if an option only supported by Dial is set, or a token is set for a service proxy client.
+func New(service protos.ProfilesServiceClient, opts ...Option) (*Client, error) {
+	c := newClient(service, opts)
+	if c.tls != nil || c.insecure || len(c.dialOptions) > 0 {
+		return nil, fmt.Errorf("TLS, insecure and dial options are only supported when dialing the grpc API")
+	}
+	if httpClient, ok := service.(*httpProfilesServiceClient); ok && httpClient.serviceProxy && c.token != "" {
+		return nil, fmt.Errorf("tokens are not supported through the Kubernetes api server proxy, which authenticates requests with the Authorization header")
+	}
+	return c, nil
+}
+
+// newClient returns a client calling the given service configured by the options.
+func newClient(service protos.ProfilesServiceClient, opts []Option) *Client {
+	c := &Client{
+		service: service,
+		backoff: DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Dial returns a client calling the grpc API at address, over TLS unless WithInsecure is set.
+// Close the client to close the connection.
+func Dial(ctx context.Context, address string, opts ...Option) (*Client, error) {
+	c := newClient(nil, opts)
+	dialOpts := []grpc.DialOption{}
+	if c.insecure {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	} else {
+		config := c.tls
+		if config == nil {
+			config = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	}
+	if c.token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(tokenCredentials{token: c.token, secure: !c.insecure}))
+	}
+	conn, err := grpc.DialContext(ctx, address, append(dialOpts, c.dialOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	c.conn = conn
+	c.service = protos.NewProfilesServiceClient(conn)
+	return c, nil
+}
+
+// Close closes the connection of a client returned by Dial.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// ProfilesService returns the service the client calls, for callers which need the raw responses.
+func (c *Client) ProfilesService() protos.ProfilesServiceClient {
+	return c.service
+}
+
+// Get returns the latest version of a profile.
+func (c *Client) Get(ctx context.Context, sourceName, profileName string) (*profilesv1.ProfileCatalogEntry, error) {
+	var resp *protos.GetResponse
+	ctx = c.outgoingContext(ctx)
+	err := c.retry(ctx, func() (err error) {
+		resp, err = c.service.Get(ctx, &protos.GetRequest{SourceName: sourceName, ProfileName: profileName, Namespace: c.namespace})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetItem() == nil {
+		return nil, status.Errorf(codes.NotFound, "profile %s/%s not found", sourceName, profileName)
+	}
+	return protos.TransformProtoCatalogEntry(resp.Item), nil
+}
+
+// GetWithVersion returns a version of a profile.
+func (c *Client) GetWithVersion(ctx context.Context, sourceName, profileName, version string) (*profilesv1.ProfileCatalogEntry, error) {
+	var resp *protos.GetWithVersionResponse
+	ctx = c.outgoingContext(ctx)
+	err := c.retry(ctx, func() (err error) {
+		resp, err = c.service.GetWithVersion(ctx, &protos.GetWithVersionRequest{SourceName: sourceName, ProfileName: profileName, Version: version, Namespace: c.namespace})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetItem() == nil {
+		return nil, status.Errorf(codes.NotFound, "profile %s/%s version %s not found", sourceName, profileName, version)
+	}
+	return protos.TransformProtoCatalogEntry(resp.Item), nil
+}
+
+// ProfilesGreaterThanVersion returns the versions of a profile greater than version.
+func (c *Client) ProfilesGreaterThanVersion(ctx context.Context, sourceName, profileName, version string) ([]profilesv1.ProfileCatalogEntry, error) {
+	var resp *protos.ProfilesGreaterThanVersionResponse
+	ctx = c.outgoingContext(ctx)
+	err := c.retry(ctx, func() (err error) {
+		resp, err = c.service.ProfilesGreaterThanVersion(ctx, &protos.ProfilesGreaterThanVersionRequest{SourceName: sourceName, ProfileName: profileName, Version: version, Namespace: c.namespace})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return protos.TransformProtoCatalogEntryList(resp.Items), nil
+}
+
+// Search returns the profiles whose name contains name, or all profiles if name is empty.
+func (c *Client) Search(ctx context.Context, name string, opts ...SearchOption) ([]profilesv1.ProfileCatalogEntry, error) {
+	req := &protos.SearchRequest{Name: name, Namespace: c.namespace}
+	for _, opt := range opts {
+		opt(req)
+	}
+	var resp *protos.SearchResponse
+	ctx = c.outgoingContext(ctx)
+	err := c.retry(ctx, func() (err error) {
+		resp, err = c.service.Search(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return protos.TransformProtoCatalogEntryList(resp.Items), nil
+}
+
+// outgoingContext adds the token to the authorization metadata of calls of clients returned by New.
+// Clients returned by Dial send it as per RPC credentials.
+func (c *Client) outgoingContext(ctx context.Context) context.Context {
+	if c.token == "" || c.conn != nil {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
+
+// retry calls call until it succeeds, fails with an error which isn't retryable, the backoff is
+// exhausted or the context is done. The delay of a rate limited call is at least the one the API requested.
+func (c *Client) retry(ctx context.Context, call func() error) error {
+	backoff := c.backoff
+	for {
+		err := call()
+		if err == nil || backoff.Steps <= 1 {
+			return err
+		}
+		st := status.Convert(err)
+		switch st.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		default:
+			return err
+		}
+
+		delay := backoff.Step()
+		for _, detail := range st.Details() {
+			if retry, ok := detail.(*errdetails.RetryInfo); ok && retry.GetRetryDelay().AsDuration() > delay {
+				delay = retry.GetRetryDelay().AsDuration()
+			}
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// tokenCredentials authenticate grpc calls with a bearer token.
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (c tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
@@ -0,0 +1,226 @@
+package client_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/client"
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		listener   *bufconn.Listener
+		grpcServer *grpc.Server
+		catalog    *catalogServer
+		c          *client.Client
+	)
+
+	BeforeEach(func() {
+		listener = bufconn.Listen(1024 * 1024)
+		catalog = &catalogServer{}
+		grpcServer = grpc.NewServer()
+		protos.RegisterProfilesServiceServer(grpcServer, catalog)
+		go func() {
+			_ = grpcServer.Serve(listener)
+		}()
+
+		var err error
+		c, err = client.Dial(context.TODO(), "bufnet",
+			client.WithInsecure(),
+			client.WithToken("my-token"),
+			client.WithNamespace("team-a"),
+			client.WithBackoff(wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}),
+			client.WithDialOptions(grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+				return listener.Dial()
+			})),
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(c.Close()).To(Succeed())
+		grpcServer.Stop()
+	})
+
+	It("returns the catalog entries", func() {
+		entry, err := c.Get(context.TODO(), "nginx-catalog", "nginx")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry).To(Equal(&profilesv1.ProfileCatalogEntry{
+			Tag:              "nginx/v0.1.0",
+			CatalogSource:    "nginx-catalog",
+			CatalogNamespace: "team-a",
+			CatalogScope:     profilesv1.NamespacedCatalogScope,
+			URL:              "https://github.com/weaveworks/profiles-examples",
+			Name:             "nginx",
+			ProfileDescription: profilesv1.ProfileDescription{
+				Description:   "nginx",
+				Maintainer:    "weaveworks",
+				Prerequisites: []string{"kubernetes 1.19"},
+			},
+		}))
+		Expect(catalog.namespace).To(Equal("team-a"))
+		Expect(catalog.authorization).To(ConsistOf("Bearer my-token"))
+
+		entries, err := c.Search(context.TODO(), "nginx")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[1].Tag).To(Equal("nginx/v0.2.0"))
+	})
+
+	When("the profile does not exist", func() {
+		It("returns the error without retrying", func() {
+			catalog.errs = []error{status.Error(codes.NotFound, "profile not found")}
+			_, err := c.GetWithVersion(context.TODO(), "nginx-catalog", "nginx", "v0.3.0")
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+			Expect(catalog.calls).To(Equal(1))
+		})
+	})
+
+	When("the catalog is unavailable", func() {
+		It("retries the call", func() {
+			catalog.errs = []error{status.Error(codes.Unavailable, "unavailable"), status.Error(codes.Unavailable, "unavailable")}
+			entries, err := c.ProfilesGreaterThanVersion(context.TODO(), "nginx-catalog", "nginx", "v0.1.0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(catalog.calls).To(Equal(3))
+		})
+
+		It("gives up when the backoff is exhausted", func() {
+			catalog.errs = []error{status.Error(codes.Unavailable, "1"), status.Error(codes.Unavailable, "2"), status.Error(codes.Unavailable, "3")}
+			_, err := c.Search(context.TODO(), "")
+			Expect(status.Convert(err).Message()).To(Equal("3"))
+			Expect(catalog.calls).To(Equal(3))
+		})
+	})
+
+	When("the call is rate limited", func() {
+		It("waits for the delay requested by the catalog", func() {
+			st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").
+				WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(200 * time.Millisecond)})
+			Expect(err).NotTo(HaveOccurred())
+			catalog.errs = []error{st.Err()}
+
+			start := time.Now()
+			_, err = c.Get(context.TODO(), "nginx-catalog", "nginx")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+			Expect(catalog.calls).To(Equal(2))
+		})
+	})
+})
+
+var _ = Describe("New", func() {
+	It("returns the entries of the given service", func() {
+		server := &catalogServer{}
+		c, err := client.New(&catalogServerClient{server: server})
+		Expect(err).NotTo(HaveOccurred())
+		entries, err := c.Search(context.TODO(), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(server.verified).To(BeFalse())
+
+		_, err = c.Search(context.TODO(), "", client.Verified())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.verified).To(BeTrue())
+	})
+
+	It("fails for options which only apply to dialing", func() {
+		_, err := client.New(&catalogServerClient{server: &catalogServer{}}, client.WithInsecure())
+		Expect(err).To(MatchError(ContainSubstring("only supported when dialing")))
+		_, err = client.New(&catalogServerClient{server: &catalogServer{}}, client.WithTLS(&tls.Config{}))
+		Expect(err).To(HaveOccurred())
+		_, err = client.New(&catalogServerClient{server: &catalogServer{}}, client.WithDialOptions(grpc.WithBlock()))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// catalogServer fails calls with errs in order, then returns nginx entries.
+type catalogServer struct {
+	protos.UnimplementedProfilesServiceServer
+	errs          []error
+	calls         int
+	namespace     string
+	authorization []string
+	verified      bool
+}
+
+func (s *catalogServer) call(ctx context.Context, namespace string) error {
+	s.calls++
+	s.namespace = namespace
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.authorization = md.Get("authorization")
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func entry(version string) *protos.ProfileCatalogEntry {
+	return &protos.ProfileCatalogEntry{
+		Tag:              "nginx/" + version,
+		CatalogSource:    "nginx-catalog",
+		CatalogNamespace: "team-a",
+		CatalogScope:     profilesv1.NamespacedCatalogScope,
+		Url:              "https://github.com/weaveworks/profiles-examples",
+		Name:             "nginx",
+		Description:      "nginx",
+		Maintainer:       "weaveworks",
+		Prerequisites:    []string{"kubernetes 1.19"},
+	}
+}
+
+func (s *catalogServer) Get(ctx context.Context, in *protos.GetRequest) (*protos.GetResponse, error) {
+	if err := s.call(ctx, in.Namespace); err != nil {
+		return nil, err
+	}
+	return &protos.GetResponse{Item: entry("v0.1.0")}, nil
+}
+
+func (s *catalogServer) GetWithVersion(ctx context.Context, in *protos.GetWithVersionRequest) (*protos.GetWithVersionResponse, error) {
+	if err := s.call(ctx, in.Namespace); err != nil {
+		return nil, err
+	}
+	return &protos.GetWithVersionResponse{Item: entry(in.Version)}, nil
+}
+
+func (s *catalogServer) ProfilesGreaterThanVersion(ctx context.Context, in *protos.ProfilesGreaterThanVersionRequest) (*protos.ProfilesGreaterThanVersionResponse, error) {
+	if err := s.call(ctx, in.Namespace); err != nil {
+		return nil, err
+	}
+	return &protos.ProfilesGreaterThanVersionResponse{Items: []*protos.ProfileCatalogEntry{entry("v0.2.0")}}, nil
+}
+
+func (s *catalogServer) Search(ctx context.Context, in *protos.SearchRequest) (*protos.SearchResponse, error) {
+	s.verified = in.Verified
+	if err := s.call(ctx, in.Namespace); err != nil {
+		return nil, err
+	}
+	return &protos.SearchResponse{Items: []*protos.ProfileCatalogEntry{entry("v0.1.0"), entry("v0.2.0")}}, nil
+}
+
+// catalogServerClient calls the server directly.
+type catalogServerClient struct {
+	protos.ProfilesServiceClient
+	server *catalogServer
+}
+
+func (c *catalogServerClient) Search(ctx context.Context, in *protos.SearchRequest, _ ...grpc.CallOption) (*protos.SearchResponse, error) {
+	return c.server.Search(ctx, in)
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"k8s.io/client-go/rest"
+
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+// httpProfilesServiceClient calls the catalog api through the grpc-gateway.
+type httpProfilesServiceClient struct {
+	baseURL    string
+	httpClient *http.Client
+	// serviceProxy is set if the api server proxy of the service is called
+	serviceProxy bool
+}
+
+var _ protos.ProfilesServiceClient = &httpProfilesServiceClient{}
+
+// NewHTTPProfilesServiceClient returns a ProfilesServiceClient which calls the HTTP api of the catalog at baseURL,
+// for example http://localhost:8000. Failed requests return the grpc status the gateway translated to HTTP.
+// The authorization metadata of the context is sent as Authorization header, CallOptions are ignored.
+func NewHTTPProfilesServiceClient(baseURL string, httpClient *http.Client) protos.ProfilesServiceClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &httpProfilesServiceClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// ServiceProxyURL returns the URL of the port of a service proxied by the Kubernetes api server.
+func ServiceProxyURL(config *rest.Config, namespace, service, port string) string {
+	name := service
+	if port != "" {
+		name += ":" + port
+	}
+	return fmt.Sprintf("%s/api/v1/namespaces/%s/services/%s/proxy",
+		strings.TrimSuffix(config.Host, "/"), url.PathEscape(namespace), url.PathEscape(name))
+}
+
+// NewServiceProxyProfilesServiceClient returns a ProfilesServiceClient which calls the HTTP api of the catalog
+// through the Kubernetes api server proxy of its service, authenticating with the credentials of config.
+// The api server doesn't forward these credentials, so the catalog API can't authenticate the caller.
+func NewServiceProxyProfilesServiceClient(config *rest.Config, namespace, service, port string) (protos.ProfilesServiceClient, error) {
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport for the kubernetes api: %w", err)
+	}
+	return &httpProfilesServiceClient{
+		baseURL:      strings.TrimSuffix(ServiceProxyURL(config, namespace, service, port), "/"),
+		httpClient:   &http.Client{Transport: transport, Timeout: config.Timeout},
+		serviceProxy: true,
+	}, nil
+}
+
+func (c *httpProfilesServiceClient) Get(ctx context.Context, in *protos.GetRequest, _ ...grpc.CallOption) (*protos.GetResponse, error) {
+	out := &protos.GetResponse{}
+	path := fmt.Sprintf("/v1/profiles/%s/%s", url.PathEscape(in.GetSourceName()), url.PathEscape(in.GetProfileName()))
+	return out, c.get(ctx, path, url.Values{"namespace": {in.GetNamespace()}}, out)
+}
+
+func (c *httpProfilesServiceClient) GetWithVersion(ctx context.Context, in *protos.GetWithVersionRequest, _ ...grpc.CallOption) (*protos.GetWithVersionResponse, error) {
+	out := &protos.GetWithVersionResponse{}
+	path := fmt.Sprintf("/v1/profiles/%s/%s/%s",
+		url.PathEscape(in.GetSourceName()), url.PathEscape(in.GetProfileName()), url.PathEscape(in.GetVersion()))
+	return out, c.get(ctx, path, url.Values{"namespace": {in.GetNamespace()}}, out)
+}
+
+func (c *httpProfilesServiceClient) ProfilesGreaterThanVersion(ctx context.Context, in *protos.ProfilesGreaterThanVersionRequest, _ ...grpc.CallOption) (*protos.ProfilesGreaterThanVersionResponse, error) {
+	out := &protos.ProfilesGreaterThanVersionResponse{}
+	path := fmt.Sprintf("/v1/profiles/%s/%s/%s/available_updates",
+		url.PathEscape(in.GetSourceName()), url.PathEscape(in.GetProfileName()), url.PathEscape(in.GetVersion()))
+	return out, c.get(ctx, path, url.Values{"namespace": {in.GetNamespace()}}, out)
+}
+
+func (c *httpProfilesServiceClient) Search(ctx context.Context, in *protos.SearchRequest, _ ...grpc.CallOption) (*protos.SearchResponse, error) {
+	out := &protos.SearchResponse{}
+	query := url.Values{"name": {in.GetName()}, "namespace": {in.GetNamespace()}}
+	if in.GetVerified() {
+		query.Set("verified", "true")
+	}
+	return out, c.get(ctx, "/v1/profiles", query, out)
+}
+
+// get decodes the response to a GET of the path into out.
+func (c *httpProfilesServiceClient) get(ctx context.Context, path string, query url.Values, out proto.Message) error {
+	for key, values := range query {
+		if len(values) == 0 || values[0] == "" {
+			delete(query, key)
+		}
+	}
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create request: %s", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+		req.Header.Set("Authorization", md.Get("authorization")[0])
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return status.Errorf(codes.Unavailable, "failed to GET %q: %s", u, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to read response: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp.StatusCode, resp.Header, body)
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, out); err != nil {
+		return status.Errorf(codes.Internal, "failed to decode response: %s", err)
+	}
+	return nil
+}
+
+// responseError returns the grpc status of a failed response. Responses which are not a
+// protos.ErrorResponse, for example from a proxy, are mapped by their HTTP status code.
+// The Retry-After header is returned as RetryInfo detail.
+func responseError(statusCode int, header http.Header, body []byte) error {
+	var st *status.Status
+	var response protos.ErrorResponse
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, &response); err == nil && response.GetError().GetStatus() != "" {
+		if c, ok := code.Code_value[response.GetError().GetStatus()]; ok {
+			st = status.New(codes.Code(c), response.GetError().GetMessage())
+		}
+	}
+	if st == nil {
+		st = status.Newf(statusCodeToCode(statusCode), "request failed with status code %d: %s", statusCode, strings.TrimSpace(string(body)))
+	}
+
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds >= 0 {
+		if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(seconds) * time.Second)}); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// statusCodeToCode returns the grpc code of an HTTP status code.
+func statusCodeToCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
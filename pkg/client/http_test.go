@@ -0,0 +1,148 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/rest"
+
+	"github.com/weaveworks/profiles/pkg/client"
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+var _ = Describe("HTTPProfilesServiceClient", func() {
+	var (
+		server     *httptest.Server
+		requests   []*http.Request
+		statusCode int
+		header     string
+		body       string
+		catalog    protos.ProfilesServiceClient
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		statusCode = http.StatusOK
+		header = ""
+		body = `{"item":{"tag":"nginx/v0.1.0","catalogSource":"nginx-catalog","name":"nginx","catalogNamespace":"team-a"},"generation":"3"}`
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+			if header != "" {
+				w.Header().Set("Retry-After", header)
+			}
+			w.WriteHeader(statusCode)
+			_, _ = w.Write([]byte(body))
+		}))
+		catalog = client.NewHTTPProfilesServiceClient(server.URL+"/", nil)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("gets a profile", func() {
+		resp, err := catalog.Get(context.TODO(), &protos.GetRequest{SourceName: "nginx-catalog", ProfileName: "nginx", Namespace: "team-a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Item.Tag).To(Equal("nginx/v0.1.0"))
+		Expect(resp.Item.CatalogNamespace).To(Equal("team-a"))
+		Expect(resp.Generation).To(Equal(uint64(3)))
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.String()).To(Equal("/v1/profiles/nginx-catalog/nginx?namespace=team-a"))
+	})
+
+	It("gets a profile version", func() {
+		_, err := catalog.GetWithVersion(context.TODO(), &protos.GetWithVersionRequest{SourceName: "nginx-catalog", ProfileName: "nginx", Version: "v0.1.0"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests[0].URL.String()).To(Equal("/v1/profiles/nginx-catalog/nginx/v0.1.0"))
+	})
+
+	It("lists the available updates", func() {
+		body = `{"items":[{"tag":"nginx/v0.2.0","name":"nginx"}],"generation":"3"}`
+		resp, err := catalog.ProfilesGreaterThanVersion(context.TODO(), &protos.ProfilesGreaterThanVersionRequest{SourceName: "nginx-catalog", ProfileName: "nginx", Version: "v0.1.0"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Items).To(HaveLen(1))
+		Expect(requests[0].URL.String()).To(Equal("/v1/profiles/nginx-catalog/nginx/v0.1.0/available_updates"))
+	})
+
+	It("searches profiles", func() {
+		body = `{"items":[{"tag":"nginx/v0.2.0","name":"nginx"}],"unknown":true}`
+		resp, err := catalog.Search(context.TODO(), &protos.SearchRequest{Name: "ngi nx"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Items[0].Name).To(Equal("nginx"))
+		Expect(requests[0].URL.String()).To(Equal("/v1/profiles?name=ngi+nx"))
+	})
+
+	It("sends the token of the client as Authorization header", func() {
+		c, err := client.New(catalog, client.WithToken("my-token"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = c.Get(context.TODO(), "nginx-catalog", "nginx")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer my-token"))
+	})
+
+	When("the request fails", func() {
+		It("returns the grpc status of the error response", func() {
+			statusCode = http.StatusNotFound
+			body = `{"error":{"code":404,"status":"NOT_FOUND","message":"profile nginx not found"}}`
+			_, err := catalog.Get(context.TODO(), &protos.GetRequest{SourceName: "nginx-catalog", ProfileName: "nginx"})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+			Expect(status.Convert(err).Message()).To(Equal("profile nginx not found"))
+		})
+
+		It("returns the Retry-After header as retry info", func() {
+			statusCode = http.StatusTooManyRequests
+			header = "2"
+			body = `{"error":{"code":429,"status":"RESOURCE_EXHAUSTED","message":"rate limit exceeded"}}`
+			_, err := catalog.Search(context.TODO(), &protos.SearchRequest{})
+			st := status.Convert(err)
+			Expect(st.Code()).To(Equal(codes.ResourceExhausted))
+			Expect(st.Details()).To(HaveLen(1))
+			Expect(st.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration()).To(Equal(2 * time.Second))
+		})
+
+		It("maps other responses by their status code", func() {
+			statusCode = http.StatusServiceUnavailable
+			body = `no endpoints available for service "profiles-catalog-service"`
+			_, err := catalog.Search(context.TODO(), &protos.SearchRequest{})
+			Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			Expect(status.Convert(err).Message()).To(ContainSubstring("no endpoints available"))
+		})
+	})
+
+	Describe("ServiceProxyURL", func() {
+		It("returns the api server proxy URL of the service", func() {
+			config := &rest.Config{Host: "https://kubernetes:6443/"}
+			Expect(client.ServiceProxyURL(config, "profiles-system", "profiles-catalog-service", "http")).
+				To(Equal("https://kubernetes:6443/api/v1/namespaces/profiles-system/services/profiles-catalog-service:http/proxy"))
+			Expect(client.ServiceProxyURL(config, "profiles-system", "profiles-catalog-service", "")).
+				To(Equal("https://kubernetes:6443/api/v1/namespaces/profiles-system/services/profiles-catalog-service/proxy"))
+		})
+	})
+
+	Describe("NewServiceProxyProfilesServiceClient", func() {
+		It("calls the catalog through the api server proxy", func() {
+			catalog, err := client.NewServiceProxyProfilesServiceClient(&rest.Config{Host: server.URL, BearerToken: "kube-token"},
+				"profiles-system", "profiles-catalog-service", "http")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = catalog.Get(context.TODO(), &protos.GetRequest{SourceName: "nginx-catalog", ProfileName: "nginx"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests[0].URL.Path).To(Equal("/api/v1/namespaces/profiles-system/services/profiles-catalog-service:http/proxy/v1/profiles/nginx-catalog/nginx"))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer kube-token"))
+		})
+
+		It("can't be used with a token", func() {
+			catalog, err := client.NewServiceProxyProfilesServiceClient(&rest.Config{Host: server.URL, BearerToken: "kube-token"},
+				"profiles-system", "profiles-catalog-service", "http")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.New(catalog, client.WithToken("my-token"))
+			Expect(err).To(MatchError(ContainSubstring("not supported through the Kubernetes api server proxy")))
+		})
+	})
+})
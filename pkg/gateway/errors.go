@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+
+	gruntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+// errorHandler writes the errors of the catalog api as a protos.ErrorResponse, flattening the ErrorInfo and
+// BadRequest details of the grpc status into the body. RetryInfo details are returned as Retry-After header.
+func errorHandler(_ context.Context, _ *gruntime.ServeMux, _ gruntime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+	st := status.Convert(err)
+	body := errorBody(st)
+	for _, detail := range st.Details() {
+		if retry, ok := detail.(*errdetails.RetryInfo); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.GetRetryDelay().AsDuration().Seconds()))))
+		}
+	}
+	data, err := protojson.Marshal(&protos.ErrorResponse{Error: body})
+	if err != nil {
+		http.Error(w, `{"error":{"code":500,"status":"INTERNAL","message":"failed to marshal error"}}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(body.Code))
+	_, _ = w.Write(data)
+}
+
+func errorBody(st *status.Status) *protos.ErrorBody {
+	body := &protos.ErrorBody{
+		Code:    int32(gruntime.HTTPStatusFromCode(st.Code())),
+		Status:  code.Code(st.Code()).String(),
+		Message: st.Message(),
+	}
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			body.Reason = d.GetReason()
+			body.Metadata = d.GetMetadata()
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				body.FieldViolations = append(body.FieldViolations, &protos.FieldViolation{
+					Field:       v.GetField(),
+					Description: v.GetDescription(),
+				})
+			}
+		}
+	}
+	return body
+}
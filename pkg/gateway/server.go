@@ -2,70 +2,244 @@ package gateway
 
 import (
 	"context"
+	"crypto/tls"
+	_ "embed"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	gruntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 
 	"github.com/weaveworks/profiles/pkg/protos"
 )
 
 const timeout = 10 * time.Second
 
+//go:embed docs.html
+var docsPage []byte
+
 // Server contains details for the gateway server.
 type Server struct {
-	logger   logr.Logger
+	logger logr.Logger
+	// mu guards server and stopped, which Start and Stop are called with concurrently
+	mu       sync.Mutex
 	server   *http.Server
+	stopped  bool
 	apiAddr  string
 	grpcAddr string
+	tls      *tls.Config
+	dialTLS  *tls.Config
+	dialer   func(context.Context, string) (net.Conn, error)
+	catalog  protos.ProfilesServiceServer
+	grpc     http.Handler
+}
+
+// Option configures the gateway server.
+type Option func(*Server)
+
+// WithTLS serves the gateway over TLS using the given configuration.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tls = config
+	}
+}
+
+// WithDialTLS dials the grpc server over TLS using the given configuration instead of plaintext.
+func WithDialTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.dialTLS = config
+	}
+}
+
+// WithDialer dials the grpc server with the given dialer instead of over the network, for example
+// through an in-memory listener the grpc server serves.
+func WithDialer(dialer func(context.Context, string) (net.Conn, error)) Option {
+	return func(s *Server) {
+		s.dialer = dialer
+	}
+}
+
+// WithCatalogServer calls the given catalog service directly instead of dialing the grpc server. The
+// address and the verified client certificates of the caller are passed to the service as its grpc peer.
+func WithCatalogServer(catalog protos.ProfilesServiceServer) Option {
+	return func(s *Server) {
+		s.catalog = catalog
+	}
+}
+
+// WithGRPCHandler serves grpc requests received on the api address with the given handler, so the
+// grpc server and the gateway share a single port. Without TLS, HTTP/2 is served in cleartext (h2c).
+func WithGRPCHandler(handler http.Handler) Option {
+	return func(s *Server) {
+		s.grpc = handler
+	}
 }
 
 // NewServer creates a new grpc-gateway server.
-func NewServer(logger logr.Logger, apiAddr string, grpcAddr string) *Server {
+func NewServer(logger logr.Logger, apiAddr string, grpcAddr string, opts ...Option) *Server {
 	logger = logger.WithName("gateway-server")
-	return &Server{
+	s := &Server{
 		logger:   logger,
 		apiAddr:  apiAddr,
 		grpcAddr: grpcAddr,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// Start starts the grpc-gateway server using from Endpoint.
+// Start starts the grpc-gateway server, either calling the catalog service directly or dialing the grpc server.
 func (s *Server) Start(ctx context.Context) error {
-	// setup grpc-gateway to connect to the grpc server
-	mux := gruntime.NewServeMux()
-	gopts := []grpc.DialOption{grpc.WithInsecure()}
-	if err := protos.RegisterProfilesServiceHandlerFromEndpoint(context.Background(), mux, s.grpcAddr, gopts); err != nil {
-		s.logger.Error(err, "failed to register service handler from endpoint")
+	mux := gruntime.NewServeMux(gruntime.WithErrorHandler(errorHandler))
+	if err := s.registerHandlers(mux); err != nil {
+		return err
+	}
+	if err := registerDocs(mux); err != nil {
+		s.logger.Error(err, "failed to register api docs")
 		return err
 	}
 
+	var handler http.Handler = mux
+	if s.catalog != nil {
+		handler = withPeer(handler)
+	}
+	handler = otelhttp.NewHandler(handler, "gateway")
+	if s.grpc != nil {
+		handler = grpcHandlerFunc(s.grpc, handler)
+		if s.tls == nil {
+			handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+	}
+
 	s.logger.Info(fmt.Sprintf("starting profiles grpc-gateway server at %s", s.apiAddr))
-	server := &http.Server{Addr: s.apiAddr, Handler: mux}
+	server := &http.Server{Addr: s.apiAddr, Handler: handler, TLSConfig: s.tls}
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.server = server
+	s.mu.Unlock()
 
 	g, _ := errgroup.WithContext(ctx)
 	g.Go(func() error {
 		// ignore server is closing error because the server receives that on graceful shutdown.
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if s.tls != nil {
+			// the certificate is provided by the TLS configuration
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			s.logger.Error(err, "unable to start profiles api server")
 			return err
 		}
 		return nil
 	})
-	s.server = server
 	return g.Wait()
 }
 
-// Stop does a graceful shutdown of the server using a timeout of 10 seconds.
+// registerHandlers registers the catalog service handlers on mux.
+func (s *Server) registerHandlers(mux *gruntime.ServeMux) error {
+	if s.catalog != nil {
+		if err := protos.RegisterProfilesServiceHandlerServer(context.Background(), mux, s.catalog); err != nil {
+			s.logger.Error(err, "failed to register service handler from server")
+			return err
+		}
+		return nil
+	}
+
+	// setup grpc-gateway to connect to the grpc server
+	gopts := []grpc.DialOption{grpc.WithInsecure()}
+	if s.dialTLS != nil {
+		gopts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(s.dialTLS))}
+	}
+	if s.dialer != nil {
+		gopts = append(gopts, grpc.WithContextDialer(s.dialer))
+	}
+	gopts = append(gopts, grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()))
+	if err := protos.RegisterProfilesServiceHandlerFromEndpoint(context.Background(), mux, s.grpcAddr, gopts); err != nil {
+		s.logger.Error(err, "failed to register service handler from endpoint")
+		return err
+	}
+	return nil
+}
+
+// registerDocs serves the OpenAPI document of the catalog api at /openapi.json and a page rendering it at /docs.
+func registerDocs(mux *gruntime.ServeMux) error {
+	if err := mux.HandlePath(http.MethodGet, "/openapi.json", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(protos.OpenAPI)
+	}); err != nil {
+		return err
+	}
+	return mux.HandlePath(http.MethodGet, "/docs", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(docsPage)
+	})
+}
+
+// withPeer adds the address and the TLS state of the HTTP connection to the request context as its grpc
+// peer, so the catalog service called in-process identifies callers as if they had dialed the grpc server.
+func withPeer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p := &peer.Peer{Addr: addr}
+		if r.TLS != nil {
+			p.AuthInfo = credentials.TLSInfo{
+				State:          *r.TLS,
+				CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(peer.NewContext(r.Context(), p)))
+	})
+}
+
+// grpcHandlerFunc routes grpc requests to grpcHandler and all other requests to httpHandler.
+func grpcHandlerFunc(grpcHandler http.Handler, httpHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
+
+// Stop does a graceful shutdown of the server using a timeout of 10 seconds. A server stopped before
+// it is started doesn't serve.
 func (s *Server) Stop() {
+	s.mu.Lock()
+	server := s.server
+	s.stopped = true
+	s.mu.Unlock()
+	if server == nil {
+		s.logger.Info("server stopped")
+		return
+	}
+
 	serverTimeoutContext, timeout := context.WithTimeout(context.Background(), timeout)
 	defer timeout()
-	if err := s.server.Shutdown(serverTimeoutContext); err != nil {
+	if err := server.Shutdown(serverTimeoutContext); err != nil {
 		s.logger.Error(err, "Failed to gracefully shutdown server... terminating.")
 	}
 	s.logger.Info("server stopped")
@@ -0,0 +1,334 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/catalog"
+	"github.com/weaveworks/profiles/pkg/gateway"
+	pgrpc "github.com/weaveworks/profiles/pkg/grpc"
+	"github.com/weaveworks/profiles/pkg/protos"
+	"github.com/weaveworks/profiles/pkg/ratelimit"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		apiAddr    string
+		grpcServer *pgrpc.Server
+		server     *gateway.Server
+	)
+
+	BeforeEach(func() {
+		profileCatalog := catalog.New()
+		profileCatalog.AddOrReplace(types.NamespacedName{Namespace: "default", Name: "catalog"}, profilesv1.ProfileCatalogEntry{
+			Name: "nginx",
+			Tag:  "v0.1.0",
+		})
+		grpcServer = pgrpc.NewServer(zap.New(), profileCatalog, api.AllNamespaces{}, "")
+		apiAddr = freeAddr()
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	When("the grpc server shares the api port", func() {
+		It("serves both the api and grpc requests", func() {
+			server = gateway.NewServer(zap.New(), apiAddr, "",
+				gateway.WithCatalogServer(grpcServer.CatalogServer()),
+				gateway.WithGRPCHandler(grpcServer),
+			)
+			go func() { _ = server.Start(context.Background()) }()
+
+			Eventually(func() (string, error) {
+				return get(apiAddr, "/v1/profiles")
+			}).Should(ContainSubstring(`"name":"nginx"`))
+
+			conn, err := grpc.Dial(apiAddr, grpc.WithInsecure())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			resp, err := protos.NewProfilesServiceClient(conn).Search(context.Background(), &protos.SearchRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Items).To(HaveLen(1))
+			Expect(resp.Items[0].Name).To(Equal("nginx"))
+		})
+	})
+
+	When("the server is stopped before it is started", func() {
+		It("doesn't serve", func() {
+			server = gateway.NewServer(zap.New(), apiAddr, "", gateway.WithCatalogServer(grpcServer.CatalogServer()))
+			server.Stop()
+			Expect(server.Start(context.Background())).To(Succeed())
+			_, err := get(apiAddr, "/v1/profiles")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("the catalog service is called in-process", func() {
+		It("passes the address of the caller as the grpc peer", func() {
+			catalogServer := &peerRecorder{}
+			server = gateway.NewServer(zap.New(), apiAddr, "", gateway.WithCatalogServer(catalogServer))
+			go func() { _ = server.Start(context.Background()) }()
+
+			Eventually(func() (string, error) {
+				return get(apiAddr, "/v1/profiles")
+			}).Should(ContainSubstring("{"))
+			p := catalogServer.last()
+			Expect(p).NotTo(BeNil())
+			Expect(p.Addr.(*net.TCPAddr).IP.IsLoopback()).To(BeTrue())
+			Expect(p.AuthInfo).To(BeNil())
+		})
+	})
+
+	When("the gateway dials the grpc server", func() {
+		It("limits the HTTP clients by their own address", func() {
+			limiter := ratelimit.New(ratelimit.Config{Quota: ratelimit.Quota{RequestsPerSecond: 0.001, Burst: 1}})
+			profileCatalog := catalog.New()
+			grpcAddr := freeAddr()
+			grpcServer = pgrpc.NewServer(zap.New(), profileCatalog, api.AllNamespaces{}, grpcAddr,
+				pgrpc.WithInterceptors(ratelimit.UnaryServerInterceptor(limiter), ratelimit.StreamServerInterceptor(limiter)),
+				pgrpc.WithInterceptors(ratelimit.UnaryCallerInterceptor(limiter), ratelimit.StreamCallerInterceptor(limiter)),
+			)
+			go func() { _ = grpcServer.Start(context.Background()) }()
+			defer grpcServer.Stop()
+			server = gateway.NewServer(zap.New(), apiAddr, grpcAddr)
+			go func() { _ = server.Start(context.Background()) }()
+
+			first, second := clientFrom("127.0.0.2"), clientFrom("127.0.0.3")
+			Eventually(func() (int, error) {
+				return status(first, apiAddr, "/v1/profiles")
+			}).Should(Equal(http.StatusOK))
+			Expect(status(first, apiAddr, "/v1/profiles")).To(Equal(http.StatusTooManyRequests))
+
+			By("not sharing the quota with another client")
+			Expect(status(second, apiAddr, "/v1/profiles")).To(Equal(http.StatusOK))
+		})
+	})
+
+	When("the request fails", func() {
+		It("returns the error details in the body", func() {
+			server = gateway.NewServer(zap.New(), apiAddr, "", gateway.WithCatalogServer(grpcServer.CatalogServer()))
+			go func() { _ = server.Start(context.Background()) }()
+
+			var resp *http.Response
+			Eventually(func() error {
+				var err error
+				resp, err = http.Get("http://" + apiAddr + "/v1/profiles/catalog/ngnix")
+				return err
+			}).Should(Succeed())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			var body map[string]interface{}
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body).To(Equal(map[string]interface{}{"error": map[string]interface{}{
+				"code":    float64(http.StatusNotFound),
+				"status":  "NOT_FOUND",
+				"message": "profile not found",
+				"reason":  api.ReasonProfileNotFound,
+				"metadata": map[string]interface{}{
+					api.MetadataCatalog:     "catalog",
+					api.MetadataNamespace:   "default",
+					api.MetadataProfile:     "ngnix",
+					api.MetadataSuggestions: "nginx",
+				},
+			}}))
+		})
+	})
+})
+
+// peerRecorder records the grpc peer of the last search request.
+type peerRecorder struct {
+	protos.UnimplementedProfilesServiceServer
+	mu   sync.Mutex
+	peer *peer.Peer
+}
+
+func (r *peerRecorder) Search(ctx context.Context, _ *protos.SearchRequest) (*protos.SearchResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peer, _ = peer.FromContext(ctx)
+	return &protos.SearchResponse{}, nil
+}
+
+func (r *peerRecorder) last() *peer.Peer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.peer
+}
+
+var _ = Describe("API docs", func() {
+	var (
+		apiAddr string
+		catalog *recordingCatalog
+		server  *gateway.Server
+	)
+
+	BeforeEach(func() {
+		apiAddr = freeAddr()
+		catalog = &recordingCatalog{}
+		server = gateway.NewServer(zap.New(), apiAddr, "", gateway.WithCatalogServer(catalog))
+		go func() { _ = server.Start(context.Background()) }()
+		Eventually(func() error {
+			_, err := get(apiAddr, "/openapi.json")
+			return err
+		}).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("serves the docs page", func() {
+		resp, err := get(apiAddr, "/docs")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp).To(ContainSubstring("openapi.json"))
+	})
+
+	It("serves an OpenAPI document matching the registered routes", func() {
+		resp, err := get(apiAddr, "/openapi.json")
+		Expect(err).NotTo(HaveOccurred())
+		var spec openAPI
+		Expect(json.Unmarshal([]byte(resp), &spec)).To(Succeed())
+
+		documented := map[string]bool{}
+		for path, operations := range spec.Paths {
+			for method, operation := range operations {
+				documented[operation.OperationID] = true
+				Expect(strings.ToUpper(method)).To(Equal(http.MethodGet), "unexpected method of %s", operation.OperationID)
+
+				// every parameter is sent with its own name as value, or true if it is a boolean, so the
+				// decoded request must contain all of them
+				query := url.Values{}
+				requestPath := path
+				for _, param := range operation.Parameters {
+					switch {
+					case param.In == "path":
+						requestPath = strings.Replace(requestPath, "{"+param.Name+"}", param.Name, 1)
+					case param.In == "query" && param.Type == "boolean":
+						query.Set(param.Name, "true")
+					case param.In == "query":
+						query.Set(param.Name, param.Name)
+					}
+				}
+				_, err := get(apiAddr, requestPath+"?"+query.Encode())
+				Expect(err).NotTo(HaveOccurred(), operation.OperationID)
+				Expect("ProfilesService_"+catalog.method).To(Equal(operation.OperationID), "%s %s is routed to another method", method, path)
+
+				fields := map[string]interface{}{}
+				Expect(json.Unmarshal(catalog.request, &fields)).To(Succeed())
+				for _, param := range operation.Parameters {
+					var value interface{} = param.Name
+					if param.Type == "boolean" {
+						value = true
+					}
+					Expect(fields).To(HaveKeyWithValue(param.Name, value), "parameter %s of %s is not decoded", param.Name, operation.OperationID)
+				}
+			}
+		}
+
+		for _, method := range protos.ProfilesService_ServiceDesc.Methods {
+			Expect(documented).To(HaveKey("ProfilesService_"+method.MethodName), "%s is not documented", method.MethodName)
+		}
+	})
+})
+
+// openAPI is the part of an OpenAPI v2 document describing the routes.
+type openAPI struct {
+	Paths map[string]map[string]struct {
+		OperationID string `json:"operationId"`
+		Parameters  []struct {
+			Name string `json:"name"`
+			In   string `json:"in"`
+			Type string `json:"type"`
+		} `json:"parameters"`
+	} `json:"paths"`
+}
+
+// recordingCatalog records the last method called and its request.
+type recordingCatalog struct {
+	method  string
+	request []byte
+}
+
+func (c *recordingCatalog) record(method string, request proto.Message) {
+	c.method = method
+	c.request, _ = protojson.Marshal(request)
+}
+
+func (c *recordingCatalog) Get(_ context.Context, request *protos.GetRequest) (*protos.GetResponse, error) {
+	c.record("Get", request)
+	return &protos.GetResponse{}, nil
+}
+
+func (c *recordingCatalog) GetWithVersion(_ context.Context, request *protos.GetWithVersionRequest) (*protos.GetWithVersionResponse, error) {
+	c.record("GetWithVersion", request)
+	return &protos.GetWithVersionResponse{}, nil
+}
+
+func (c *recordingCatalog) ProfilesGreaterThanVersion(_ context.Context, request *protos.ProfilesGreaterThanVersionRequest) (*protos.ProfilesGreaterThanVersionResponse, error) {
+	c.record("ProfilesGreaterThanVersion", request)
+	return &protos.ProfilesGreaterThanVersionResponse{}, nil
+}
+
+func (c *recordingCatalog) Search(_ context.Context, request *protos.SearchRequest) (*protos.SearchResponse, error) {
+	c.record("Search", request)
+	return &protos.SearchResponse{}, nil
+}
+
+func get(addr, path string) (string, error) {
+	resp, err := http.Get("http://" + addr + path)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	return string(body), nil
+}
+
+// clientFrom returns an HTTP client connecting from the given local address.
+func clientFrom(ip string) *http.Client {
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	return &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+}
+
+func status(client *http.Client, addr, path string) (int, error) {
+	resp, err := client.Get("http://" + addr + path)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func freeAddr() string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer lis.Close()
+	return lis.Addr().String()
+}
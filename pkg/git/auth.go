@@ -0,0 +1,552 @@
+package git
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxcd/source-controller/pkg/git/gogit"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+)
+
+const (
+	//DefaultGitHubAPIURL is the URL of the GitHub API installation tokens of GitHub Apps are minted with
+	DefaultGitHubAPIURL = "https://api.github.com"
+	//gitHubAppUsername is the username git servers of GitHub expect with installation tokens
+	gitHubAppUsername = "x-access-token"
+	//gitHubTokenExpiryMargin is how long before they expire cached installation tokens are minted again
+	gitHubTokenExpiryMargin = 5 * time.Minute
+	//defaultTokenUsername is the username of tokens without one, git servers only check the token
+	defaultTokenUsername = "git"
+	//defaultSSHUsername is the username of SSH URLs without one
+	defaultSSHUsername = "git"
+)
+
+//AuthProvider provides the credentials git repositories are accessed with. The credentials are requested
+//for every operation, so providers can mint or rotate them.
+type AuthProvider interface {
+	//AuthMethod returns the credentials for the repository at url, or nil to access it anonymously
+	AuthMethod(ctx context.Context, url string) (transport.AuthMethod, error)
+}
+
+//NewAuthProvider returns the auth provider of a repository with the name of the provider and the secret
+//the provider reads the credentials from. The Generic provider, which is used if provider is empty,
+//accesses repositories anonymously if secret is nil, the other providers require a secret.
+func NewAuthProvider(provider string, secret *corev1.Secret) (AuthProvider, error) {
+	if provider == "" || provider == profilesv1.GenericAuthProvider {
+		return &secretAuth{secret: secret}, nil
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("the %s auth provider requires a secret", provider)
+	}
+	switch provider {
+	case profilesv1.TokenAuthProvider:
+		return newTokenAuth(secret)
+	case profilesv1.GitHubAppAuthProvider:
+		return newGitHubAppAuth(secret)
+	case profilesv1.SSHAuthProvider:
+		return newSSHAuth(secret)
+	}
+	return nil, fmt.Errorf("unknown auth provider %q", provider)
+}
+
+//authMethod returns the auth method of the provider for the URL, or nil if the provider is nil
+func authMethod(ctx context.Context, url string, auth AuthProvider) (transport.AuthMethod, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	method, err := auth.AuthMethod(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials for %q: %w", url, err)
+	}
+	return method, nil
+}
+
+//secretAuth reads the credentials from the fields of the secret the way Flux does
+type secretAuth struct {
+	secret *corev1.Secret
+}
+
+func (a *secretAuth) AuthMethod(_ context.Context, url string) (transport.AuthMethod, error) {
+	if a.secret == nil {
+		return nil, nil
+	}
+	authStrategy, err := gogit.AuthSecretStrategyForURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth strategy from URL %q: %w", url, err)
+	}
+	method, err := authStrategy.Method(*a.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth method: %w", err)
+	}
+	return method.AuthMethod, nil
+}
+
+//tokenAuth authenticates with a personal access, deploy or project token over basic auth. Tokens are
+//rotated by updating the secret, the token of the secret is read for every scan.
+type tokenAuth struct {
+	username string
+	token    string
+}
+
+func newTokenAuth(secret *corev1.Secret) (*tokenAuth, error) {
+	token := strings.TrimSpace(string(secret.Data["token"]))
+	if token == "" {
+		return nil, fmt.Errorf("secret %s/%s has no token field", secret.Namespace, secret.Name)
+	}
+	username := strings.TrimSpace(string(secret.Data["username"]))
+	if username == "" {
+		username = defaultTokenUsername
+	}
+	return &tokenAuth{username: username, token: token}, nil
+}
+
+func (a *tokenAuth) AuthMethod(context.Context, string) (transport.AuthMethod, error) {
+	return &githttp.BasicAuth{Username: a.username, Password: a.token}, nil
+}
+
+//gitHubAppAuth authenticates with installation tokens of a GitHub App. The tokens are minted when they are
+//first needed and cached until shortly before they expire.
+type gitHubAppAuth struct {
+	apiURL         string
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	//keyFingerprint is the SHA256 of the public key, which keeps the tokens of providers with other keys apart
+	keyFingerprint string
+}
+
+//gitHubAppTokens caches the installation tokens of GitHub Apps, so scans of the same installation with the
+//same private key share them
+var gitHubAppTokens = &tokenCache{tokens: map[string]cachedToken{}}
+
+//gitHubAPIClient mints installation tokens. The timeout keeps a hanging GitHub API from blocking the scans of
+//an installation forever
+var gitHubAPIClient = &http.Client{Timeout: 30 * time.Second}
+
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+	//minting mints the token of a key once for all concurrent scans needing it
+	minting singleflight.Group
+}
+
+//get returns the cached token of the key unless it expires soon
+func (c *tokenCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.tokens[key]
+	if !ok || !time.Now().Add(gitHubTokenExpiryMargin).Before(cached.expiresAt) {
+		return "", false
+	}
+	return cached.token, true
+}
+
+func (c *tokenCache) set(key string, token cachedToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = token
+}
+
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+func newGitHubAppAuth(secret *corev1.Secret) (*gitHubAppAuth, error) {
+	appID, err := strconv.ParseInt(strings.TrimSpace(string(secret.Data["appID"])), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s has no valid appID field: %w", secret.Namespace, secret.Name, err)
+	}
+	installationID, err := strconv.ParseInt(strings.TrimSpace(string(secret.Data["installationID"])), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s has no valid installationID field: %w", secret.Namespace, secret.Name, err)
+	}
+	key, err := parseRSAPrivateKey(secret.Data["privateKey"])
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s has no valid privateKey field: %w", secret.Namespace, secret.Name, err)
+	}
+	apiURL := strings.TrimSuffix(strings.TrimSpace(string(secret.Data["apiURL"])), "/")
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+	fingerprint := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	return &gitHubAppAuth{
+		apiURL:         apiURL,
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		keyFingerprint: hex.EncodeToString(fingerprint[:]),
+	}, nil
+}
+
+//parseRSAPrivateKey parses the PEM encoded private key of a GitHub App, which GitHub issues in PKCS #1
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func (a *gitHubAppAuth) AuthMethod(ctx context.Context, _ string) (transport.AuthMethod, error) {
+	token, err := a.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &githttp.BasicAuth{Username: gitHubAppUsername, Password: token}, nil
+}
+
+//token returns the cached installation token, or mints a new one if it expires soon. Tokens are minted
+//outside of the lock of the cache, so minting the token of one installation doesn't block the others.
+func (a *gitHubAppAuth) token(ctx context.Context) (string, error) {
+	// a secret with the IDs of an installation but another key must not get the tokens of the installation
+	key := fmt.Sprintf("%s/%d/%d/%s", a.apiURL, a.appID, a.installationID, a.keyFingerprint)
+	if token, ok := gitHubAppTokens.get(key); ok {
+		return token, nil
+	}
+
+	result := gitHubAppTokens.minting.DoChan(key, func() (interface{}, error) {
+		if token, ok := gitHubAppTokens.get(key); ok {
+			return token, nil
+		}
+		// the token is shared by all waiting scans, so it is minted without the context of one of them
+		minted, err := a.mintToken(context.Background())
+		if err != nil {
+			return "", err
+		}
+		gitHubAppTokens.set(key, minted)
+		return minted.token, nil
+	})
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-result:
+		if r.Err != nil {
+			return "", r.Err
+		}
+		return r.Val.(string), nil
+	}
+}
+
+//mintToken requests an installation token from the GitHub API, authenticating as the app with a JWT
+func (a *gitHubAppAuth) mintToken(ctx context.Context) (cachedToken, error) {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return cachedToken{}, err
+	}
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", a.apiURL, a.installationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return cachedToken{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := gitHubAPIClient.Do(req)
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("failed to mint installation token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return cachedToken{}, fmt.Errorf("failed to mint installation token: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return cachedToken{}, fmt.Errorf("failed to mint installation token of installation %d: %s: %s", a.installationID, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return cachedToken{}, fmt.Errorf("failed to decode installation token: %w", err)
+	}
+	if token.Token == "" {
+		return cachedToken{}, errors.New("failed to mint installation token: the response has no token")
+	}
+	return cachedToken{token: token.Token, expiresAt: token.ExpiresAt}, nil
+}
+
+//jwt returns a JSON web token of the app, signed with its private key and valid for 10 minutes. The token
+//is issued a minute in the past to allow for clock drift.
+func (a *gitHubAppAuth) jwt(now time.Time) (string, error) {
+	claims, err := json.Marshal(struct {
+		IssuedAt  int64 `json:"iat"`
+		ExpiresAt int64 `json:"exp"`
+		Issuer    int64 `json:"iss"`
+	}{now.Add(-time.Minute).Unix(), now.Add(9 * time.Minute).Unix(), a.appID})
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+//sshAuth authenticates with an SSH key and only accepts the host keys known_hosts lists for the host of
+//the repository. Unlike the Generic provider, only the host key algorithms of the known keys are
+//negotiated, so servers with several host keys can't present one which isn't listed.
+type sshAuth struct {
+	signer     ssh.Signer
+	knownHosts []knownHost
+}
+
+//knownHost is a line of a known_hosts file
+type knownHost struct {
+	revoked  bool
+	patterns []string
+	key      ssh.PublicKey
+}
+
+func newSSHAuth(secret *corev1.Secret) (*sshAuth, error) {
+	identity := secret.Data["identity"]
+	if len(identity) == 0 {
+		return nil, fmt.Errorf("secret %s/%s has no identity field", secret.Namespace, secret.Name)
+	}
+	var signer ssh.Signer
+	var err error
+	if password, ok := secret.Data["password"]; ok {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(identity, password)
+	} else {
+		signer, err = ssh.ParsePrivateKey(identity)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s has no valid identity field: %w", secret.Namespace, secret.Name, err)
+	}
+	knownHosts, err := parseKnownHosts(secret.Data["known_hosts"])
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s has no valid known_hosts field: %w", secret.Namespace, secret.Name, err)
+	}
+	return &sshAuth{signer: signer, knownHosts: knownHosts}, nil
+}
+
+//parseKnownHosts parses the lines of a known_hosts file. Certificate authorities are not supported.
+func parseKnownHosts(data []byte) ([]knownHost, error) {
+	var hosts []knownHost
+	for rest := data; len(rest) > 0; {
+		marker, patterns, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rest = next
+		if marker != "" && marker != "revoked" {
+			continue
+		}
+		hosts = append(hosts, knownHost{revoked: marker == "revoked", patterns: patterns, key: key})
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no host keys found")
+	}
+	return hosts, nil
+}
+
+func (a *sshAuth) AuthMethod(_ context.Context, url string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Protocol != "ssh" {
+		return nil, fmt.Errorf("the SSH auth provider does not support %s URLs", endpoint.Protocol)
+	}
+	user := endpoint.User
+	if user == "" {
+		user = defaultSSHUsername
+	}
+	port := endpoint.Port
+	if port <= 0 {
+		port = gitssh.DefaultPort
+	}
+	host := net.JoinHostPort(endpoint.Host, strconv.Itoa(port))
+
+	var keys []ssh.PublicKey
+	var algorithms []string
+	for _, known := range a.knownHosts {
+		if known.revoked || !known.matches(host) {
+			continue
+		}
+		keys = append(keys, known.key)
+		if !contains(algorithms, known.key.Type()) {
+			algorithms = append(algorithms, known.key.Type())
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("known_hosts has no host keys for %s", knownHostsAddress(host))
+	}
+	return &knownHostsPublicKeys{
+		PublicKeys: &gitssh.PublicKeys{
+			User:                  user,
+			Signer:                a.signer,
+			HostKeyCallbackHelper: gitssh.HostKeyCallbackHelper{HostKeyCallback: a.hostKeyCallback(keys)},
+		},
+		hostKeyAlgorithms: algorithms,
+	}, nil
+}
+
+//hostKeyCallback accepts the known keys of the host, unless they are revoked
+func (a *sshAuth) hostKeyCallback(keys []ssh.PublicKey) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		for _, known := range a.knownHosts {
+			if known.revoked && equalKeys(known.key, key) {
+				return fmt.Errorf("host key of %s is revoked", hostname)
+			}
+		}
+		for _, known := range keys {
+			if equalKeys(known, key) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host key %s of %s is not listed in known_hosts", ssh.FingerprintSHA256(key), hostname)
+	}
+}
+
+//matches returns whether the host patterns of the line match the host, given as host:port. Hashed host
+//names, wildcards and negated patterns are supported like OpenSSH does.
+func (h knownHost) matches(host string) bool {
+	address := knownHostsAddress(host)
+	matched := false
+	for _, pattern := range h.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !matchHostPattern(pattern, address) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+//knownHostsAddress returns the host as it is listed in known_hosts, host for the default port and
+//[host]:port for other ports
+func knownHostsAddress(host string) string {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	if port == strconv.Itoa(gitssh.DefaultPort) {
+		return hostname
+	}
+	return "[" + hostname + "]:" + port
+}
+
+func matchHostPattern(pattern, address string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[3:], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(address))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return matchWildcards(pattern, address)
+}
+
+//matchWildcards matches the address with a pattern in which * matches any characters and ? one character
+func matchWildcards(pattern, address string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(address); i >= 0; i-- {
+				if matchWildcards(pattern[1:], address[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(address) == 0 {
+				return false
+			}
+		default:
+			if len(address) == 0 || pattern[0] != address[0] {
+				return false
+			}
+		}
+		pattern, address = pattern[1:], address[1:]
+	}
+	return len(address) == 0
+}
+
+func equalKeys(a, b ssh.PublicKey) bool {
+	return a.Type() == b.Type() && string(a.Marshal()) == string(b.Marshal())
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//knownHostsPublicKeys are the public key credentials of go-git, which only negotiate the host key algorithms
+//of the known host keys
+type knownHostsPublicKeys struct {
+	*gitssh.PublicKeys
+	hostKeyAlgorithms []string
+}
+
+func (a *knownHostsPublicKeys) ClientConfig() (*ssh.ClientConfig, error) {
+	config, err := a.PublicKeys.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.HostKeyAlgorithms = a.hostKeyAlgorithms
+	return config, nil
+}
@@ -0,0 +1,488 @@
+package git_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/git"
+	"github.com/weaveworks/profiles/pkg/mirror"
+)
+
+var _ = Describe("AuthProvider", func() {
+	var (
+		ctx     = context.Background()
+		tempDir string
+		repoDir string
+		tags    map[string]string
+		m       *mirror.Mirror
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "git")
+		Expect(err).NotTo(HaveOccurred())
+		repoDir = filepath.Join(tempDir, "profiles-examples")
+		repo, err := extgogit.PlainInit(repoDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(repoDir, "nginx"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(repoDir, "nginx", git.ProfileFile), []byte("apiVersion: weave.works/v1alpha1\nkind: ProfileDefinition\nmetadata:\n  name: nginx\n"), 0644)).To(Succeed())
+		worktree, err := repo.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = worktree.Add("nginx/profile.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := worktree.Commit("nginx", &extgogit.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = repo.CreateTag("nginx/v0.1.0", hash, nil)
+		Expect(err).NotTo(HaveOccurred())
+		tags = map[string]string{"nginx/v0.1.0": hash.String()}
+
+		m = mirror.New(filepath.Join(tempDir, "mirrors"), "", &git.Client{})
+		Expect(m.Sync(ctx, repoDir, nil, tags)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	It("requires a secret for providers other than Generic", func() {
+		auth, err := git.NewAuthProvider("", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/profiles-examples")).To(BeNil())
+
+		for _, provider := range []string{profilesv1.TokenAuthProvider, profilesv1.GitHubAppAuthProvider, profilesv1.SSHAuthProvider} {
+			_, err := git.NewAuthProvider(provider, nil)
+			Expect(err).To(MatchError(ContainSubstring("requires a secret")))
+			_, err = git.NewAuthProvider(provider, &corev1.Secret{})
+			Expect(err).To(HaveOccurred())
+		}
+		_, err = git.NewAuthProvider("Unknown", &corev1.Secret{})
+		Expect(err).To(MatchError(`unknown auth provider "Unknown"`))
+	})
+
+	Describe("Token", func() {
+		It("authenticates with the token of the secret", func() {
+			server := httptest.NewServer(basicAuth(m, func(username, password string) bool {
+				return username == "oauth2" && password == "glpat-token"
+			}))
+			defer server.Close()
+			url := mirror.RepositoryURL(server.URL, repoDir)
+
+			_, err := (&git.Client{}).ListTags(ctx, url, nil)
+			Expect(err).To(HaveOccurred())
+
+			auth, err := git.NewAuthProvider(profilesv1.TokenAuthProvider, &corev1.Secret{
+				Data: map[string][]byte{"username": []byte("oauth2"), "token": []byte("glpat-token\n")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+			def, err := (&git.Client{Auth: auth}).GetProfileDefinition(ctx, profilesv1.Source{URL: url, Tag: "nginx/v0.1.0", Path: "nginx"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(def.Name).To(Equal("nginx"))
+
+			By("using the rotated token of the updated secret")
+			rotated, err := git.NewAuthProvider(profilesv1.TokenAuthProvider, &corev1.Secret{
+				Data: map[string][]byte{"token": []byte("rotated-token")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rotated.AuthMethod(ctx, url)).To(Equal(&githttp.BasicAuth{Username: "git", Password: "rotated-token"}))
+			_, err = (&git.Client{}).ListTags(ctx, url, rotated)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("GitHubApp", func() {
+		var (
+			key       *rsa.PrivateKey
+			api       *httptest.Server
+			minted    []string
+			expiresIn time.Duration
+			apiStatus int
+			secret    *corev1.Secret
+		)
+
+		BeforeEach(func() {
+			var err error
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).NotTo(HaveOccurred())
+			minted = nil
+			expiresIn = time.Hour
+			apiStatus = http.StatusCreated
+			api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal(http.MethodPost))
+				Expect(r.URL.Path).To(Equal("/app/installations/42/access_tokens"))
+				Expect(verifyJWT(r.Header.Get("Authorization"), &key.PublicKey)).To(Equal(int64(1234)))
+				if apiStatus != http.StatusCreated {
+					http.Error(w, `{"message":"Bad credentials"}`, apiStatus)
+					return
+				}
+				token := fmt.Sprintf("ghs_%d", len(minted)+1)
+				minted = append(minted, token)
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"token":%q,"expires_at":%q}`, token, time.Now().Add(expiresIn).UTC().Format(time.RFC3339))
+			}))
+			secret = &corev1.Secret{Data: map[string][]byte{
+				"appID":          []byte("1234"),
+				"installationID": []byte("42"),
+				"privateKey":     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+				"apiURL":         []byte(api.URL + "/"),
+			}}
+		})
+
+		AfterEach(func() {
+			api.Close()
+		})
+
+		// gitServer serves the mirror to clients with the last minted installation token.
+		gitServer := func() *httptest.Server {
+			return httptest.NewServer(basicAuth(m, func(username, password string) bool {
+				return username == "x-access-token" && len(minted) > 0 && password == minted[len(minted)-1]
+			}))
+		}
+
+		It("mints installation tokens and caches them until they expire", func() {
+			server := gitServer()
+			defer server.Close()
+			url := mirror.RepositoryURL(server.URL, repoDir)
+
+			auth, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+			Expect(minted).To(HaveLen(1))
+
+			By("sharing the token with providers of the same installation")
+			other, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).NotTo(HaveOccurred())
+			def, err := (&git.Client{Auth: other}).GetProfileDefinition(ctx, profilesv1.Source{URL: url, Tag: "nginx/v0.1.0", Path: "nginx"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(def.Name).To(Equal("nginx"))
+			Expect(minted).To(HaveLen(1))
+		})
+
+		It("doesn't share the token with providers of another private key", func() {
+			auth, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/private-profiles")).To(Equal(&githttp.BasicAuth{Username: "x-access-token", Password: "ghs_1"}))
+
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).NotTo(HaveOccurred())
+			secret.Data["privateKey"] = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+			other, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other.AuthMethod(ctx, "https://github.com/weaveworks/private-profiles")).To(Equal(&githttp.BasicAuth{Username: "x-access-token", Password: "ghs_2"}))
+			Expect(minted).To(HaveLen(2))
+		})
+
+		It("mints a new token when the cached one expires soon", func() {
+			expiresIn = time.Minute
+			server := gitServer()
+			defer server.Close()
+			url := mirror.RepositoryURL(server.URL, repoDir)
+
+			auth, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+			Expect(minted).To(Equal([]string{"ghs_1", "ghs_2"}))
+		})
+
+		It("returns the errors of the GitHub API", func() {
+			apiStatus = http.StatusUnauthorized
+			auth, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = (&git.Client{}).ListTags(ctx, "https://github.com/weaveworks/private-profiles", auth)
+			Expect(err).To(MatchError(ContainSubstring("401 Unauthorized: {\"message\":\"Bad credentials\"}")))
+		})
+
+		It("doesn't block the tokens of other installations while the GitHub API hangs", func() {
+			arrived, release := make(chan struct{}, 1), make(chan struct{})
+			hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				arrived <- struct{}{}
+				<-release
+				http.Error(w, "too late", http.StatusServiceUnavailable)
+			}))
+			defer hanging.Close()
+			defer close(release)
+			hangingSecret := secret.DeepCopy()
+			hangingSecret.Data["apiURL"] = []byte(hanging.URL)
+			hangingAuth, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, hangingSecret)
+			Expect(err).NotTo(HaveOccurred())
+			go func() {
+				_, _ = hangingAuth.AuthMethod(context.Background(), "https://github.com/weaveworks/private-profiles")
+			}()
+			Eventually(arrived).Should(Receive())
+
+			By("returning when the context of a scan waiting for the token is done")
+			waiting, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			_, err = hangingAuth.AuthMethod(waiting, "https://github.com/weaveworks/private-profiles")
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Consistently(arrived, 100*time.Millisecond).ShouldNot(Receive())
+
+			auth, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(auth.AuthMethod(ctx, "https://github.com/weaveworks/private-profiles")).To(Equal(&githttp.BasicAuth{Username: "x-access-token", Password: "ghs_1"}))
+		})
+
+		It("requires the ID of the app and the installation and its private key", func() {
+			delete(secret.Data, "installationID")
+			_, err := git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).To(MatchError(ContainSubstring("no valid installationID field")))
+			secret.Data["installationID"] = []byte("42")
+			secret.Data["privateKey"] = []byte("not a key")
+			_, err = git.NewAuthProvider(profilesv1.GitHubAppAuthProvider, secret)
+			Expect(err).To(MatchError(ContainSubstring("no valid privateKey field")))
+		})
+	})
+
+	Describe("SSH", func() {
+		var (
+			hostKey  ssh.Signer
+			identity []byte
+			listener net.Listener
+			url      string
+		)
+
+		BeforeEach(func() {
+			_, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			hostKey, err = ssh.NewSignerFromKey(private)
+			Expect(err).NotTo(HaveOccurred())
+			// the server prefers the ECDSA host key, which isn't listed in known_hosts
+			ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			ecdsaHostKey, err := ssh.NewSignerFromKey(ecdsaKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalECPrivateKey(clientKey)
+			Expect(err).NotTo(HaveOccurred())
+			identity = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+			clientPublicKey, err := ssh.NewPublicKey(&clientKey.PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			go serveSSH(listener, filepath.Join(tempDir, "mirrors"), []ssh.Signer{ecdsaHostKey, hostKey}, clientPublicKey)
+			url = mirror.RepositoryURL(fmt.Sprintf("ssh://git@%s", listener.Addr()), repoDir)
+		})
+
+		AfterEach(func() {
+			Expect(listener.Close()).To(Succeed())
+		})
+
+		sshAuth := func(knownHosts ...string) git.AuthProvider {
+			auth, err := git.NewAuthProvider(profilesv1.SSHAuthProvider, &corev1.Secret{Data: map[string][]byte{
+				"identity":    identity,
+				"known_hosts": []byte(strings.Join(knownHosts, "\n") + "\n"),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			return auth
+		}
+
+		It("accepts the known host keys of the host", func() {
+			address := knownhosts.Normalize(listener.Addr().String())
+			auth := sshAuth(knownhosts.Line([]string{address}, hostKey.PublicKey()))
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+
+			By("matching hashed host names")
+			auth = sshAuth(knownhosts.Line([]string{knownhosts.HashHostname(address)}, hostKey.PublicKey()))
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+
+			By("matching wildcards")
+			auth = sshAuth(knownhosts.Line([]string{"[127.0.0.*]:*"}, hostKey.PublicKey()))
+			Expect((&git.Client{}).ListTags(ctx, url, auth)).To(Equal(tags))
+		})
+
+		It("rejects host keys which aren't listed or are revoked", func() {
+			_, other, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			otherKey, err := ssh.NewSignerFromKey(other)
+			Expect(err).NotTo(HaveOccurred())
+			address := knownhosts.Normalize(listener.Addr().String())
+
+			auth := sshAuth(knownhosts.Line([]string{address}, otherKey.PublicKey()))
+			_, err = (&git.Client{}).ListTags(ctx, url, auth)
+			Expect(err).To(MatchError(ContainSubstring("is not listed in known_hosts")))
+
+			auth = sshAuth(
+				knownhosts.Line([]string{address}, hostKey.PublicKey()),
+				"@revoked "+knownhosts.Line([]string{"*"}, hostKey.PublicKey()),
+			)
+			_, err = (&git.Client{}).ListTags(ctx, url, auth)
+			Expect(err).To(MatchError(ContainSubstring("is revoked")))
+		})
+
+		It("requires host keys of the host", func() {
+			auth := sshAuth(knownhosts.Line([]string{"github.com"}, hostKey.PublicKey()))
+			_, err := (&git.Client{}).ListTags(ctx, url, auth)
+			Expect(err).To(MatchError(ContainSubstring("known_hosts has no host keys for " + knownhosts.Normalize(listener.Addr().String()))))
+
+			_, err = git.NewAuthProvider(profilesv1.SSHAuthProvider, &corev1.Secret{Data: map[string][]byte{"identity": identity}})
+			Expect(err).To(MatchError(ContainSubstring("no valid known_hosts field")))
+		})
+	})
+})
+
+// basicAuth serves the requests of clients whose basic auth credentials are valid.
+func basicAuth(handler http.Handler, valid func(username, password string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || !valid(username, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// verifyJWT verifies the signature and expiry of the bearer token and returns its issuer.
+func verifyJWT(authorization string, key *rsa.PublicKey) (int64, error) {
+	parts := strings.Split(strings.TrimPrefix(authorization, "Bearer "), ".")
+	if len(parts) != 3 {
+		return 0, errors.New("invalid JWT")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return 0, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+		Issuer    int64 `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return 0, err
+	}
+	if time.Unix(claims.ExpiresAt, 0).Before(time.Now()) {
+		return 0, errors.New("JWT expired")
+	}
+	return claims.Issuer, nil
+}
+
+// serveSSH serves the references of the bare repositories in dir over SSH to clients with the key, until the
+// listener is closed. Only listing the references with git-upload-pack is supported.
+func serveSSH(listener net.Listener, dir string, hostKeys []ssh.Signer, clientKey ssh.PublicKey) {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	for _, hostKey := range hostKeys {
+		config.AddHostKey(hostKey)
+	}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			_, channels, requests, err := ssh.NewServerConn(conn, config)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			for newChannel := range channels {
+				if newChannel.ChannelType() != "session" {
+					_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					return
+				}
+				go serveUploadPack(channel, requests, dir)
+			}
+		}()
+	}
+}
+
+// serveUploadPack advertises the references of the repository of the git-upload-pack command of the
+// session, and waits for the client to close the session.
+func serveUploadPack(channel ssh.Channel, requests <-chan *ssh.Request, dir string) {
+	defer channel.Close()
+	for req := range requests {
+		var exec struct{ Command string }
+		if req.Type != "exec" || ssh.Unmarshal(req.Payload, &exec) != nil || !strings.HasPrefix(exec.Command, "git-upload-pack ") {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+		path := strings.Trim(strings.TrimPrefix(exec.Command, "git-upload-pack "), "'")
+		status := uint32(0)
+		if err := advertiseReferences(channel, filepath.Join(dir, path)); err != nil {
+			fmt.Fprintln(channel.Stderr(), err)
+			status = 1
+		} else {
+			_, _ = io.Copy(ioutil.Discard, channel)
+		}
+		_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func advertiseReferences(w io.Writer, dir string) error {
+	endpoint, err := transport.NewEndpoint(dir)
+	if err != nil {
+		return err
+	}
+	session, err := server.DefaultServer.NewUploadPackSession(endpoint, nil)
+	if err != nil {
+		return err
+	}
+	refs, err := session.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+	return refs.Encode(w)
+}
@@ -0,0 +1,258 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	beginPGPSignature = "-----BEGIN PGP SIGNATURE-----"
+	beginSSHSignature = "-----BEGIN SSH SIGNATURE-----"
+	endSSHSignature   = "-----END SSH SIGNATURE-----"
+
+	// sshSignatureMagic prefixes SSH signatures and the data they sign
+	sshSignatureMagic = "SSHSIG"
+	// sshSignatureNamespace is the namespace git signs tags and commits in
+	sshSignatureNamespace = "git"
+)
+
+//TrustedKeys are the public keys the signatures of tags and commits are verified with
+type TrustedKeys struct {
+	gpg openpgp.EntityList
+	ssh []ssh.PublicKey
+}
+
+//ParseTrustedKeys returns the keys in the fields of the secret. Every field must contain ASCII armored GPG
+//public keys or SSH public keys in authorized_keys format.
+func ParseTrustedKeys(secret *corev1.Secret) (*TrustedKeys, error) {
+	names := make([]string, 0, len(secret.Data))
+	for name := range secret.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := &TrustedKeys{}
+	for _, name := range names {
+		data := secret.Data[name]
+		if bytes.Contains(data, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read GPG keys from %q: %w", name, err)
+			}
+			keys.gpg = append(keys.gpg, entities...)
+			continue
+		}
+		for rest := bytes.TrimSpace(data); len(rest) > 0; rest = bytes.TrimSpace(rest) {
+			key, _, _, next, err := ssh.ParseAuthorizedKey(rest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read SSH keys from %q: %w", name, err)
+			}
+			keys.ssh = append(keys.ssh, key)
+			rest = next
+		}
+	}
+	if len(keys.gpg) == 0 && len(keys.ssh) == 0 {
+		return nil, fmt.Errorf("no public keys found in secret %s/%s", secret.Namespace, secret.Name)
+	}
+	return keys, nil
+}
+
+//Digest returns a digest of the fingerprints of the keys, which changes when keys are added or removed
+func (k *TrustedKeys) Digest() string {
+	var fingerprints []string
+	for _, entity := range k.gpg {
+		fingerprints = append(fingerprints, fmt.Sprintf("gpg:%X", entity.PrimaryKey.Fingerprint))
+		for _, subkey := range entity.Subkeys {
+			fingerprints = append(fingerprints, fmt.Sprintf("gpg:%X", subkey.PublicKey.Fingerprint))
+		}
+	}
+	for _, key := range k.ssh {
+		fingerprints = append(fingerprints, "ssh:"+ssh.FingerprintSHA256(key))
+	}
+	sort.Strings(fingerprints)
+	sum := sha256.Sum256([]byte(strings.Join(fingerprints, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+//Signature is the outcome of verifying the signature of a tag
+type Signature struct {
+	//Verified is true when the tag, or the commit it references, is signed by a trusted key
+	Verified bool
+	//Key is the fingerprint of the trusted key the tag or commit is signed with
+	Key string
+}
+
+//VerifyTag verifies the signature of the tag in the repository, which must reference the commit with the
+//given SHA, so the commit which has been scanned is verified even if the tag has moved since. The signature of
+//an annotated tag is verified first, then the signature of the commit the tag references. A tag without a
+//valid signature of a trusted key is not verified, an error is only returned if the tag can't be read or
+//references another commit.
+func VerifyTag(repo *extgogit.Repository, tag, sha string, keys *TrustedKeys) (Signature, error) {
+	ref, err := repo.Tag(tag)
+	if err != nil {
+		return Signature{}, fmt.Errorf("failed to find tag %q: %w", tag, err)
+	}
+
+	var commit *object.Commit
+	tagObject, err := repo.TagObject(ref.Hash())
+	switch {
+	case err == nil:
+		commit, err = tagObject.Commit()
+	case errors.Is(err, plumbing.ErrObjectNotFound):
+		tagObject = nil
+		commit, err = repo.CommitObject(ref.Hash())
+	default:
+		return Signature{}, fmt.Errorf("failed to read tag %q: %w", tag, err)
+	}
+	if err != nil {
+		return Signature{}, fmt.Errorf("failed to read commit of tag %q: %w", tag, err)
+	}
+	if commit.Hash.String() != sha {
+		return Signature{}, fmt.Errorf("tag %q references commit %s instead of %s", tag, commit.Hash, sha)
+	}
+
+	if tagObject != nil {
+		signature, payload, err := tagSignature(tagObject)
+		if err != nil {
+			return Signature{}, err
+		}
+		if key, ok := keys.verify(signature, payload); ok {
+			return Signature{Verified: true, Key: key}, nil
+		}
+	}
+	payload, err := encodeWithoutSignature(commit.EncodeWithoutSignature)
+	if err != nil {
+		return Signature{}, err
+	}
+	if key, ok := keys.verify(commit.PGPSignature, payload); ok {
+		return Signature{Verified: true, Key: key}, nil
+	}
+	return Signature{}, nil
+}
+
+//tagSignature returns the signature of the annotated tag and the data it signs. SSH signatures are not
+//recognized by go-git and are left at the end of the message of the tag.
+func tagSignature(tag *object.Tag) (string, []byte, error) {
+	unsigned := *tag
+	signature := tag.PGPSignature
+	if i := strings.Index(tag.Message, beginSSHSignature); signature == "" && i >= 0 {
+		signature = tag.Message[i:]
+		unsigned.Message = tag.Message[:i]
+	}
+	payload, err := encodeWithoutSignature(unsigned.EncodeWithoutSignature)
+	return signature, payload, err
+}
+
+func encodeWithoutSignature(encode func(plumbing.EncodedObject) error) ([]byte, error) {
+	o := &plumbing.MemoryObject{}
+	if err := encode(o); err != nil {
+		return nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	r, err := o.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+//verify returns the fingerprint of the trusted key the GPG or SSH signature of the payload was made with
+func (k *TrustedKeys) verify(signature string, payload []byte) (string, bool) {
+	switch {
+	case strings.HasPrefix(signature, beginPGPSignature):
+		if len(k.gpg) == 0 {
+			return "", false
+		}
+		entity, err := openpgp.CheckArmoredDetachedSignature(k.gpg, bytes.NewReader(payload), strings.NewReader(signature), nil)
+		if err != nil {
+			return "", false
+		}
+		return fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint), true
+	case strings.HasPrefix(signature, beginSSHSignature):
+		key, err := verifySSHSignature(k.ssh, signature, payload)
+		if err != nil {
+			return "", false
+		}
+		return ssh.FingerprintSHA256(key), true
+	}
+	return "", false
+}
+
+//verifySSHSignature verifies an armored signature in the SSHSIG format of ssh-keygen -Y sign, which git
+//uses when gpg.format is ssh, and returns the trusted key it was made with
+func verifySSHSignature(trusted []ssh.PublicKey, armored string, payload []byte) (ssh.PublicKey, error) {
+	armored = strings.TrimSpace(armored)
+	armored = strings.TrimPrefix(armored, beginSSHSignature)
+	armored = strings.TrimSuffix(armored, endSSHSignature)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(armored), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SSH signature: %w", err)
+	}
+	if !bytes.HasPrefix(blob, []byte(sshSignatureMagic)) {
+		return nil, errors.New("invalid SSH signature")
+	}
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(blob[len(sshSignatureMagic):], &sig); err != nil {
+		return nil, fmt.Errorf("failed to decode SSH signature: %w", err)
+	}
+	if sig.Version != 1 || sig.Namespace != sshSignatureNamespace {
+		return nil, fmt.Errorf("unsupported SSH signature version %d in namespace %q", sig.Version, sig.Namespace)
+	}
+
+	var key ssh.PublicKey
+	for _, candidate := range trusted {
+		if bytes.Equal(candidate.Marshal(), sig.PublicKey) {
+			key = candidate
+			break
+		}
+	}
+	if key == nil {
+		return nil, errors.New("SSH signature is not made with a trusted key")
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported SSH signature hash algorithm %q", sig.HashAlgorithm)
+	}
+	h.Write(payload)
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h.Sum(nil)})...)
+
+	signature := &ssh.Signature{}
+	if err := ssh.Unmarshal(sig.Signature, signature); err != nil {
+		return nil, fmt.Errorf("failed to decode SSH signature: %w", err)
+	}
+	return key, key.Verify(signed, signature)
+}
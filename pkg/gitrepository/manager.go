@@ -6,8 +6,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/fluxcd/pkg/apis/meta"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/git"
+	"github.com/weaveworks/profiles/pkg/metrics"
+	"github.com/weaveworks/profiles/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -48,18 +53,24 @@ func NewManager(ctx context.Context, namespace string, kClient Kubernetes, timeo
 }
 
 //CreateAndWaitForResources creates the gitrepository resources and waits for them to be created
-func (m *Manager) CreateAndWaitForResources(r profilesv1.Repository, instances []Instance) ([]*sourcev1.GitRepository, error) {
+func (m *Manager) CreateAndWaitForResources(r profilesv1.Repository, instances []Instance) (_ []*sourcev1.GitRepository, err error) {
+	ctx, span := tracing.Start(m.ctx, "gitrepository.Manager.CreateAndWaitForResources",
+		attribute.String("repository.url", git.RedactURL(r.URL)),
+		attribute.Int("gitrepositories.count", len(instances)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	var gitResources []*sourcev1.GitRepository
 	for _, instance := range instances {
 		gitRes := makeGitRepository(r, instance.Tag, instance.Path, m.namespace)
-		if err := m.kClient.Create(m.ctx, gitRes); err != nil {
+		if err := m.kClient.Create(ctx, gitRes); err != nil {
 			return nil, fmt.Errorf("failed to create gitrepository: %w", err)
 		}
 		gitResources = append(gitResources, gitRes)
 	}
 
 	for _, gitRes := range gitResources {
-		err := m.waitForURL(gitRes)
+		err := m.waitForURL(ctx, gitRes)
 		if err != nil {
 			return nil, err
 		}
@@ -67,19 +78,29 @@ func (m *Manager) CreateAndWaitForResources(r profilesv1.Repository, instances [
 	return gitResources, nil
 }
 
-func (m *Manager) waitForURL(gitRes *sourcev1.GitRepository) error {
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+func (m *Manager) waitForURL(ctx context.Context, gitRes *sourcev1.GitRepository) (err error) {
+	ctx, span := tracing.Start(ctx, "gitrepository.Manager.waitForURL",
+		attribute.String("gitrepository.namespace", gitRes.Namespace),
+		attribute.String("gitrepository.name", gitRes.Name),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), m.timeout)
 	defer cancel()
 	for {
 		select {
-		case <-ctx.Done():
+		case <-timeoutCtx.Done():
+			metrics.GitRepositoryWait.WithLabelValues(metrics.WaitTimeout).Observe(time.Since(start).Seconds())
 			return fmt.Errorf("timed out waiting for %s/%s gitrepository.Status.URL to be populated", gitRes.Namespace, gitRes.Name)
 		case <-time.After(m.interval):
-			err := m.kClient.Get(m.ctx, client.ObjectKeyFromObject(gitRes), gitRes)
+			err := m.kClient.Get(ctx, client.ObjectKeyFromObject(gitRes), gitRes)
 			if err != nil {
+				metrics.GitRepositoryWait.WithLabelValues(metrics.WaitError).Observe(time.Since(start).Seconds())
 				return fmt.Errorf("failed to get gitrepository: %w", err)
 			}
 			if gitRes.Status.URL != "" {
+				metrics.GitRepositoryWait.WithLabelValues(metrics.WaitReady).Observe(time.Since(start).Seconds())
 				return nil
 			}
 		}
@@ -111,7 +132,8 @@ func makeGitRepository(r profilesv1.Repository, tag, path, namespace string) *so
 	}
 
 	if r.SecretRef != nil {
-		repo.Spec.SecretRef = r.SecretRef
+		// gitrepository resources are created in the namespace of the secret
+		repo.Spec.SecretRef = &meta.LocalObjectReference{Name: r.SecretRef.Name}
 	}
 	return repo
 }
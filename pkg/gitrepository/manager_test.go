@@ -24,7 +24,7 @@ var _ = Describe("Gitrepository", func() {
 		callCount int
 		repo      = profilesv1.Repository{
 			URL: "github.com/example/repo",
-			SecretRef: &meta.LocalObjectReference{
+			SecretRef: &meta.NamespacedObjectReference{
 				Name: "my-secret",
 			},
 		}
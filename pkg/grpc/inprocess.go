@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+// interceptedCatalog calls the catalog service through the unary interceptors of the grpc server, so
+// requests which don't go through the grpc server are authenticated and measured the same way.
+type interceptedCatalog struct {
+	api         protos.ProfilesServiceServer
+	interceptor grpc.UnaryServerInterceptor
+}
+
+var _ protos.ProfilesServiceServer = interceptedCatalog{}
+
+func (c interceptedCatalog) invoke(ctx context.Context, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	info := &grpc.UnaryServerInfo{
+		Server:     c.api,
+		FullMethod: "/" + protos.ProfilesService_ServiceDesc.ServiceName + "/" + method,
+	}
+	return c.interceptor(ctx, req, info, handler)
+}
+
+// Get will return a specific profile from the catalog
+func (c interceptedCatalog) Get(ctx context.Context, request *protos.GetRequest) (*protos.GetResponse, error) {
+	resp, err := c.invoke(ctx, "Get", request, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.api.Get(ctx, req.(*protos.GetRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*protos.GetResponse), nil
+}
+
+// GetWithVersion will return a specific profile from the catalog
+func (c interceptedCatalog) GetWithVersion(ctx context.Context, request *protos.GetWithVersionRequest) (*protos.GetWithVersionResponse, error) {
+	resp, err := c.invoke(ctx, "GetWithVersion", request, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.api.GetWithVersion(ctx, req.(*protos.GetWithVersionRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*protos.GetWithVersionResponse), nil
+}
+
+// ProfilesGreaterThanVersion returns all profiles which are of a greater version for a given profile with a version.
+func (c interceptedCatalog) ProfilesGreaterThanVersion(ctx context.Context, request *protos.ProfilesGreaterThanVersionRequest) (*protos.ProfilesGreaterThanVersionResponse, error) {
+	resp, err := c.invoke(ctx, "ProfilesGreaterThanVersion", request, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.api.ProfilesGreaterThanVersion(ctx, req.(*protos.ProfilesGreaterThanVersionRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*protos.ProfilesGreaterThanVersionResponse), nil
+}
+
+// Search will return a list of profiles which match query
+func (c interceptedCatalog) Search(ctx context.Context, request *protos.SearchRequest) (*protos.SearchResponse, error) {
+	resp, err := c.invoke(ctx, "Search", request, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.api.Search(ctx, req.(*protos.SearchRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*protos.SearchResponse), nil
+}
+
+// chainUnaryInterceptors returns an interceptor running the given interceptors in order, the same
+// way grpc.ChainUnaryInterceptor does.
+func chainUnaryInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		chained := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], chained
+			chained = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return chained(ctx, req)
+	}
+}
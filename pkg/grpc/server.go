@@ -2,14 +2,19 @@ package grpc
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
 
 	"github.com/go-logr/logr"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/weaveworks/profiles/pkg/api"
 	"github.com/weaveworks/profiles/pkg/catalog"
@@ -18,52 +23,137 @@ import (
 
 // Server contains details for the grpc server.
 type Server struct {
-	logger   logr.Logger
-	grpcAddr string
-	server   *grpc.Server
-	catalog  *catalog.Catalog
+	logger             logr.Logger
+	grpcAddr           string
+	server             *grpc.Server
+	catalog            *catalog.Catalog
+	visibility         api.Visibility
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+	tls                *tls.Config
+	listeners          []net.Listener
+	api                protos.ProfilesServiceServer
 }
 
-// NewServer returns a new grpc server.
-func NewServer(logger logr.Logger, catalog *catalog.Catalog, grpcAddr string) *Server {
-	logger = logger.WithName("grpc")
-	return &Server{
-		logger:   logger,
-		grpcAddr: grpcAddr,
-		catalog:  catalog,
+// Option configures the grpc server.
+type Option func(*Server)
+
+// WithInterceptors adds interceptors to the server. They run after the tracing and prometheus interceptors, in
+// the order the options are given.
+func WithInterceptors(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) Option {
+	return func(s *Server) {
+		s.unaryInterceptors = append(s.unaryInterceptors, unary)
+		s.streamInterceptors = append(s.streamInterceptors, stream)
 	}
 }
 
-// Start starts the grpc server on the given address and saves the servers state for later termination.
-func (s *Server) Start(ctx context.Context) error {
+// WithTLS serves the grpc server over TLS using the given configuration.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tls = config
+	}
+}
+
+// WithListener serves the grpc server on the given listener in addition to the grpc address, for
+// example an in-memory listener the gateway dials.
+func WithListener(lis net.Listener) Option {
+	return func(s *Server) {
+		s.listeners = append(s.listeners, lis)
+	}
+}
+
+// NewServer returns a new grpc server. Visibility decides which catalog sources are served to a caller.
+// If grpcAddr is empty the server only serves the listeners given with WithListener and requests
+// passed to ServeHTTP.
+func NewServer(logger logr.Logger, catalog *catalog.Catalog, visibility api.Visibility, grpcAddr string, opts ...Option) *Server {
+	logger = logger.WithName("grpc")
+	s := &Server{
+		logger:     logger,
+		grpcAddr:   grpcAddr,
+		catalog:    catalog,
+		visibility: visibility,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
 	// setup grpc server details
-	grpcLis, err := net.Listen("tcp", s.grpcAddr)
-	if err != nil {
-		return fmt.Errorf("failed to listen on address %s: %v", s.grpcAddr, err)
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainStreamInterceptor(s.streamChain()...),
+		grpc.ChainUnaryInterceptor(s.unaryChain()...),
+	}
+	if s.tls != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(s.tls)))
 	}
-	grpcSrv := grpc.NewServer(
-		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
-		grpc.UnaryInterceptor(grpc_prometheus.UnaryServerInterceptor),
-	)
-	s.server = grpcSrv
-	reflection.Register(grpcSrv)
+	s.server = grpc.NewServer(serverOpts...)
+	reflection.Register(s.server)
 
 	// create the catalog grpc server
-	catalogGrpcServer := api.NewCatalogAPI(s.catalog, s.logger.WithName("api"))
-	protos.RegisterProfilesServiceServer(grpcSrv, catalogGrpcServer)
+	s.api = api.NewCatalogAPI(catalogSnapshotter{catalog: s.catalog}, s.visibility, s.logger.WithName("api"))
+	protos.RegisterProfilesServiceServer(s.server, s.api)
+	return s
+}
+
+func (s *Server) streamChain() []grpc.StreamServerInterceptor {
+	return append([]grpc.StreamServerInterceptor{otelgrpc.StreamServerInterceptor(), grpc_prometheus.StreamServerInterceptor}, s.streamInterceptors...)
+}
+
+func (s *Server) unaryChain() []grpc.UnaryServerInterceptor {
+	return append([]grpc.UnaryServerInterceptor{otelgrpc.UnaryServerInterceptor(), grpc_prometheus.UnaryServerInterceptor}, s.unaryInterceptors...)
+}
+
+// Start starts the grpc server on the given address and listeners.
+func (s *Server) Start(ctx context.Context) error {
+	listeners := s.listeners
+	if s.grpcAddr != "" {
+		grpcLis, err := net.Listen("tcp", s.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on address %s: %v", s.grpcAddr, err)
+		}
+		listeners = append(listeners, grpcLis)
+		s.logger.Info(fmt.Sprintf("starting profiles grpc server at %s", s.grpcAddr))
+	}
+
 	// serve grpc apis
-	s.logger.Info(fmt.Sprintf("starting profiles grpc server at %s", s.grpcAddr))
 	g, _ := errgroup.WithContext(ctx)
-	g.Go(func() error {
-		if err := grpcSrv.Serve(grpcLis); err != nil {
-			s.logger.Error(err, "unable to start grpc api server")
-			return err
-		}
-		return nil
-	})
+	for _, lis := range listeners {
+		lis := lis
+		g.Go(func() error {
+			if err := s.server.Serve(lis); err != nil {
+				s.logger.Error(err, "unable to start grpc api server")
+				return err
+			}
+			return nil
+		})
+	}
 	return g.Wait()
 }
 
+// ServeHTTP serves a grpc request received by an HTTP/2 server, which allows serving the grpc server
+// on the same port as the gateway.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.server.ServeHTTP(w, r)
+}
+
+// CatalogServer returns the catalog service the grpc server serves, running the same unary
+// interceptors. It lets the gateway call the service in-process instead of dialing the grpc server.
+func (s *Server) CatalogServer() protos.ProfilesServiceServer {
+	return interceptedCatalog{
+		api:         s.api,
+		interceptor: chainUnaryInterceptors(s.unaryChain()),
+	}
+}
+
+// catalogSnapshotter hands out snapshots of the catalog to the catalog api.
+type catalogSnapshotter struct {
+	catalog *catalog.Catalog
+}
+
+// Snapshot returns the current snapshot of the catalog restricted to the visible catalog sources.
+func (c catalogSnapshotter) Snapshot(visible func(source types.NamespacedName) bool) api.Catalog {
+	return c.catalog.Snapshot().Filter(visible)
+}
+
 // Stop does a graceful shutdown of the grpc server.
 func (s *Server) Stop() {
 	s.server.GracefulStop()
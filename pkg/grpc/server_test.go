@@ -0,0 +1,66 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/catalog"
+	pgrpc "github.com/weaveworks/profiles/pkg/grpc"
+	"github.com/weaveworks/profiles/pkg/protos"
+)
+
+var _ = Describe("Server", func() {
+	var profileCatalog *catalog.Catalog
+
+	BeforeEach(func() {
+		profileCatalog = catalog.New()
+		profileCatalog.AddOrReplace(types.NamespacedName{Namespace: "default", Name: "catalog"}, profilesv1.ProfileCatalogEntry{
+			Name: "nginx",
+			Tag:  "v0.1.0",
+		})
+	})
+
+	Describe("CatalogServer", func() {
+		It("serves the catalog through the unary interceptors in order", func() {
+			var called []string
+			interceptor := func(name string) grpc.UnaryServerInterceptor {
+				return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+					called = append(called, name+" "+info.FullMethod)
+					return handler(ctx, req)
+				}
+			}
+			server := pgrpc.NewServer(zap.New(), profileCatalog, api.AllNamespaces{}, "",
+				pgrpc.WithInterceptors(interceptor("first"), nil),
+				pgrpc.WithInterceptors(interceptor("second"), nil),
+			)
+
+			resp, err := server.CatalogServer().Get(context.Background(), &protos.GetRequest{SourceName: "catalog", ProfileName: "nginx"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Item.Name).To(Equal("nginx"))
+			Expect(called).To(Equal([]string{
+				"first /weave.works.profiles.v1.ProfilesService/Get",
+				"second /weave.works.profiles.v1.ProfilesService/Get",
+			}))
+		})
+
+		When("an interceptor rejects the request", func() {
+			It("returns its error without calling the catalog", func() {
+				reject := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+					return nil, errors.New("rejected")
+				}
+				server := pgrpc.NewServer(zap.New(), profileCatalog, api.AllNamespaces{}, "", pgrpc.WithInterceptors(reject, nil))
+
+				_, err := server.CatalogServer().Search(context.Background(), &protos.SearchRequest{})
+				Expect(err).To(MatchError("rejected"))
+			})
+		})
+	})
+})
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/weaveworks/profiles/pkg/catalog"
+)
+
+const namespace = "profiles"
+
+// Results of a catalog lookup.
+const (
+	LookupHit  = "hit"
+	LookupMiss = "miss"
+)
+
+// Results of waiting for a GitRepository.
+const (
+	WaitReady   = "ready"
+	WaitTimeout = "timeout"
+	WaitError   = "error"
+)
+
+var (
+	// ScanDuration observes how long scanning a repository takes.
+	ScanDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "scan",
+		Name:      "duration_seconds",
+		Help:      "Duration of scanning a repository for profiles.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"repository"})
+
+	// ScanFailures counts failed repository scans.
+	ScanFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scan",
+		Name:      "failures_total",
+		Help:      "Number of failed scans of a repository.",
+	}, []string{"repository"})
+
+	// PendingTags is the number of tags of a repository which are waiting to be scanned.
+	PendingTags = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "scan",
+		Name:      "pending_tags",
+		Help:      "Number of tags of a repository which are waiting to be scanned.",
+	}, []string{"repository"})
+
+	// GitRepositoryWait observes how long it takes for a GitRepository to publish its artifact.
+	GitRepositoryWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "gitrepository",
+		Name:      "wait_duration_seconds",
+		Help:      "Duration of waiting for the artifact URL of a GitRepository.",
+		Buckets:   []float64{1, 5, 10, 20, 30, 60, 120},
+	}, []string{"result"})
+
+	// CatalogLookups counts catalog api lookups of a profile by whether it was found.
+	CatalogLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "catalog",
+		Name:      "lookups_total",
+		Help:      "Number of profile lookups in the catalog by method and result (hit or miss).",
+	}, []string{"method", "result"})
+)
+
+// DeleteRepository deletes the scan metrics of a repository which is no longer scanned. The repository
+// is the label its metrics are recorded with, its redacted URL.
+func DeleteRepository(repository string) {
+	ScanDuration.DeleteLabelValues(repository)
+	ScanFailures.DeleteLabelValues(repository)
+	PendingTags.DeleteLabelValues(repository)
+}
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(ScanDuration, ScanFailures, PendingTags, GitRepositoryWait, CatalogLookups)
+	// the grpc server metrics are registered with the default registry, which the manager doesn't serve
+	ctrlmetrics.Registry.MustRegister(grpc_prometheus.DefaultServerMetrics)
+}
+
+var (
+	profilesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "catalog", "profiles"),
+		"Number of profiles listed by a catalog source.",
+		[]string{"namespace", "source"}, nil,
+	)
+	versionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "catalog", "versions"),
+		"Number of profile versions listed by a catalog source.",
+		[]string{"namespace", "source"}, nil,
+	)
+)
+
+// CatalogCollector reports the number of profiles and versions per catalog source from the current
+// snapshot of the catalog whenever metrics are scraped.
+type CatalogCollector struct {
+	catalog *catalog.Catalog
+}
+
+var _ prometheus.Collector = CatalogCollector{}
+
+// NewCatalogCollector returns a collector for the given catalog.
+func NewCatalogCollector(profileCatalog *catalog.Catalog) CatalogCollector {
+	return CatalogCollector{catalog: profileCatalog}
+}
+
+// RegisterCatalog registers a CatalogCollector for the catalog with the controller-runtime metrics registry.
+func RegisterCatalog(profileCatalog *catalog.Catalog) error {
+	return ctrlmetrics.Registry.Register(NewCatalogCollector(profileCatalog))
+}
+
+// Describe sends the descriptors of the catalog metrics.
+func (c CatalogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- profilesDesc
+	ch <- versionsDesc
+}
+
+// Collect sends the number of profiles and versions of each catalog source.
+func (c CatalogCollector) Collect(ch chan<- prometheus.Metric) {
+	profiles := map[types.NamespacedName]map[string]struct{}{}
+	versions := map[types.NamespacedName]int{}
+	for _, entry := range c.catalog.Snapshot().SearchAll() {
+		source := types.NamespacedName{Namespace: entry.CatalogNamespace, Name: entry.CatalogSource}
+		if profiles[source] == nil {
+			profiles[source] = map[string]struct{}{}
+		}
+		profiles[source][entry.Name] = struct{}{}
+		versions[source]++
+	}
+	for source, names := range profiles {
+		ch <- prometheus.MustNewConstMetric(profilesDesc, prometheus.GaugeValue, float64(len(names)), source.Namespace, source.Name)
+		ch <- prometheus.MustNewConstMetric(versionsDesc, prometheus.GaugeValue, float64(versions[source]), source.Namespace, source.Name)
+	}
+}
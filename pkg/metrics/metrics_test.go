@@ -0,0 +1,55 @@
+package metrics_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/catalog"
+	"github.com/weaveworks/profiles/pkg/metrics"
+)
+
+var _ = Describe("CatalogCollector", func() {
+	It("reports the number of profiles and versions per catalog source", func() {
+		profileCatalog := catalog.New()
+		profileCatalog.AddOrReplace(types.NamespacedName{Namespace: "team-a", Name: "catalog"},
+			profilesv1.ProfileCatalogEntry{Name: "nginx", Tag: "v0.1.0"},
+			profilesv1.ProfileCatalogEntry{Name: "nginx", Tag: "v0.2.0"},
+			profilesv1.ProfileCatalogEntry{Name: "podinfo", Tag: "v1.0.0"},
+		)
+		profileCatalog.AddOrReplace(types.NamespacedName{Name: "platform"},
+			profilesv1.ProfileCatalogEntry{Name: "nginx", Tag: "v0.1.0"},
+		)
+
+		expected := `
+# HELP profiles_catalog_profiles Number of profiles listed by a catalog source.
+# TYPE profiles_catalog_profiles gauge
+profiles_catalog_profiles{namespace="",source="platform"} 1
+profiles_catalog_profiles{namespace="team-a",source="catalog"} 2
+# HELP profiles_catalog_versions Number of profile versions listed by a catalog source.
+# TYPE profiles_catalog_versions gauge
+profiles_catalog_versions{namespace="",source="platform"} 1
+profiles_catalog_versions{namespace="team-a",source="catalog"} 3
+`
+		Expect(testutil.CollectAndCompare(metrics.NewCatalogCollector(profileCatalog), strings.NewReader(expected))).To(Succeed())
+	})
+})
+
+var _ = Describe("DeleteRepository", func() {
+	It("deletes the scan metrics of the repository", func() {
+		metrics.ScanDuration.WithLabelValues("https://github.com/example/removed").Observe(1)
+		metrics.ScanFailures.WithLabelValues("https://github.com/example/removed").Inc()
+		metrics.PendingTags.WithLabelValues("https://github.com/example/removed").Set(2)
+		metrics.ScanFailures.WithLabelValues("https://github.com/example/kept").Inc()
+
+		metrics.DeleteRepository("https://github.com/example/removed")
+
+		Expect(testutil.CollectAndCount(metrics.ScanDuration)).To(Equal(0))
+		Expect(testutil.CollectAndCount(metrics.ScanFailures)).To(Equal(1))
+		Expect(testutil.CollectAndCount(metrics.PendingTags)).To(Equal(0))
+	})
+})
@@ -0,0 +1,352 @@
+package mirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+const (
+	uploadPackService = "git-upload-pack"
+	// maxRequestSize limits the size of upload-pack requests, which list the wanted and available commits
+	maxRequestSize = 10 << 20
+)
+
+//ServeHTTP serves the mirrors read-only over the git smart HTTP protocol, so they can be cloned from
+//<base URL>/<repository>.git. Shallow clones are supported, as Flux clones tags with a depth of 1.
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 || !strings.HasSuffix(parts[0], ".git") || parts[0] == ".git" || strings.Contains(parts[0], "..") {
+		http.NotFound(w, r)
+		return
+	}
+	dir := parts[0]
+
+	switch {
+	case r.Method == http.MethodGet && parts[1] == "info/refs":
+		if r.URL.Query().Get("service") != uploadPackService {
+			http.Error(w, "only the smart http protocol of git-upload-pack is supported", http.StatusForbidden)
+			return
+		}
+		m.withStorage(w, dir, func(s storage.Storer) error {
+			return advertiseReferences(w, s)
+		})
+	case r.Method == http.MethodPost && parts[1] == uploadPackService:
+		body := io.Reader(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer gzipReader.Close()
+			body = gzipReader
+		}
+		m.withStorage(w, dir, func(s storage.Storer) error {
+			return uploadPack(w, body, s)
+		})
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// withStorage calls serve with the storage of the mirror in dir, holding the read lock of the mirror.
+func (m *Mirror) withStorage(w http.ResponseWriter, dir string, serve func(storage.Storer) error) {
+	lock := m.lock(dir)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	fs := osfs.New(filepath.Join(m.dir, dir))
+	if _, err := fs.Stat("config"); err != nil {
+		http.NotFound(w, nil)
+		return
+	}
+	if err := serve(filesystem.NewStorage(fs, cache.NewObjectLRUDefault())); err != nil {
+		// the response has been started if the error occurred while writing it
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// advertiseReferences writes the tags of the mirror and the capabilities of the server.
+func advertiseReferences(w http.ResponseWriter, s storage.Storer) error {
+	ar := packp.NewAdvRefs()
+	for _, c := range []capability.Capability{capability.OFSDelta, capability.Shallow} {
+		if err := ar.Capabilities.Set(c); err != nil {
+			return err
+		}
+	}
+	if err := ar.Capabilities.Set(capability.Agent, capability.DefaultAgent); err != nil {
+		return err
+	}
+
+	refs, err := s.IterReferences()
+	if err != nil {
+		return err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		ar.References[ref.Name().String()] = ref.Hash()
+		// advertise the commits of annotated tags, so clients can follow them
+		if tag, err := object.GetTag(s, ref.Hash()); err == nil {
+			if commit, err := tag.Commit(); err == nil {
+				ar.Peeled[ref.Name().String()] = commit.Hash
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ar.Prefix = [][]byte{[]byte("# service=" + uploadPackService), pktline.Flush}
+
+	var buf bytes.Buffer
+	if err := ar.Encode(&buf); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, err = io.Copy(w, &buf)
+	return err
+}
+
+// uploadPack answers a round of the negotiation of an upload-pack request. The client sends its wants,
+// the depth of a shallow clone and the commits it has as shallows, followed by rounds of haves. Shallow
+// clients are first told which commits become shallow, then the first common have is acknowledged, or
+// NAK is returned if nothing is common. Once the client sends done, the objects it wants and doesn't
+// have are sent in a packfile.
+func uploadPack(w http.ResponseWriter, body io.Reader, s storage.Storer) error {
+	req := packp.NewUploadPackRequest()
+	if err := req.Decode(body); err != nil {
+		return fmt.Errorf("failed to decode upload-pack request: %w", err)
+	}
+	haves, negotiating, done, err := decodeHaves(body)
+	if err != nil {
+		return err
+	}
+
+	var common []plumbing.Hash
+	for _, have := range haves {
+		if s.HasEncodedObject(have) == nil {
+			common = append(common, have)
+		}
+	}
+	depth, _ := req.Depth.(packp.DepthCommits)
+	objects, update, err := objectsToUpload(s, req.Wants, common, req.Shallows, int(depth))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if depth > 0 {
+		if err := update.Encode(&buf); err != nil {
+			return err
+		}
+	}
+	if !negotiating {
+		// shallow clients first only send their wants to learn the shallow commits
+		return writeUploadPackResult(w, &buf)
+	}
+	// without the multi_ack capability only the first common commit is acknowledged
+	if len(common) > 0 {
+		err = pktline.NewEncoder(&buf).Encodef("ACK %s\n", common[0])
+	} else {
+		err = pktline.NewEncoder(&buf).Encodef("NAK\n")
+	}
+	if err != nil {
+		return err
+	}
+	if done {
+		if _, err := packfile.NewEncoder(&buf, s, false).Encode(objects, 10); err != nil {
+			return fmt.Errorf("failed to encode packfile: %w", err)
+		}
+	}
+	return writeUploadPackResult(w, &buf)
+}
+
+// writeUploadPackResult writes the result of an upload-pack request, which is buffered so errors can still
+// be returned with an error status.
+func writeUploadPackResult(w http.ResponseWriter, result io.Reader) error {
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, err := io.Copy(w, result)
+	return err
+}
+
+// decodeHaves reads the have lines following the wants of an upload-pack request, whether the client
+// sent any round of haves, and whether it finished negotiating.
+func decodeHaves(r io.Reader) (haves []plumbing.Hash, negotiating, done bool, err error) {
+	scanner := pktline.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(string(scanner.Bytes()))
+		switch {
+		case line == "done":
+			return haves, true, true, nil
+		case line == "":
+			// a flush ends a round of haves
+			negotiating = true
+		case strings.HasPrefix(line, "have "):
+			haves = append(haves, plumbing.NewHash(strings.TrimPrefix(line, "have ")))
+		}
+	}
+	return haves, negotiating || len(haves) > 0, false, scanner.Err()
+}
+
+// objectsToUpload returns the objects reachable from wants which the client doesn't have. The client has
+// the history of the haves up to its shallow commits. If depth is greater than 0, commits are followed up
+// to depth, and the update lists the commits whose parents are left out as shallows, and the shallow
+// commits of the client whose parents are sent as unshallows.
+func objectsToUpload(s storage.Storer, wants, haves, clientShallows []plumbing.Hash, depth int) (objects []plumbing.Hash, update packp.ShallowUpdate, err error) {
+	shallow := map[plumbing.Hash]bool{}
+	for _, hash := range clientShallows {
+		shallow[hash] = true
+	}
+	seen, err := clientObjects(s, haves, shallow)
+	if err != nil {
+		return nil, update, err
+	}
+	add := func(hash plumbing.Hash) bool {
+		if seen[hash] {
+			return false
+		}
+		seen[hash] = true
+		objects = append(objects, hash)
+		return true
+	}
+
+	// commits to walk, with their distance from the wanted commit
+	type pending struct {
+		hash  plumbing.Hash
+		depth int
+	}
+	var queue []pending
+	for _, want := range wants {
+		hash := want
+		// annotated tags reference the commit, possibly through further tags
+		for {
+			tag, err := object.GetTag(s, hash)
+			if err != nil {
+				break
+			}
+			add(tag.Hash)
+			hash = tag.Target
+		}
+		queue = append(queue, pending{hash: hash, depth: 1})
+	}
+	walked := map[plumbing.Hash]bool{}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if walked[next.hash] {
+			continue
+		}
+		walked[next.hash] = true
+		commit, err := object.GetCommit(s, next.hash)
+		if err != nil {
+			return nil, update, fmt.Errorf("failed to get commit %s: %w", next.hash, err)
+		}
+		switch {
+		case shallow[commit.Hash]:
+			// the client has the commit without its parents
+			if depth > 0 && next.depth >= depth {
+				continue
+			}
+			if depth > 0 {
+				update.Unshallows = append(update.Unshallows, commit.Hash)
+			}
+		case !add(commit.Hash):
+			// the client has the commit and its history
+			continue
+		default:
+			if err := addTree(s, commit.TreeHash, add); err != nil {
+				return nil, update, err
+			}
+		}
+		if depth > 0 && next.depth >= depth {
+			if commit.NumParents() > 0 {
+				update.Shallows = append(update.Shallows, commit.Hash)
+			}
+			continue
+		}
+		for _, parent := range commit.ParentHashes {
+			queue = append(queue, pending{hash: parent, depth: next.depth + 1})
+		}
+	}
+	return objects, update, nil
+}
+
+// clientObjects returns the objects reachable from the haves of the client, without following the
+// parents of its shallow commits.
+func clientObjects(s storage.Storer, haves []plumbing.Hash, shallow map[plumbing.Hash]bool) (map[plumbing.Hash]bool, error) {
+	seen := map[plumbing.Hash]bool{}
+	add := func(hash plumbing.Hash) bool {
+		if seen[hash] {
+			return false
+		}
+		seen[hash] = true
+		return true
+	}
+	commits := append([]plumbing.Hash{}, haves...)
+	for len(commits) > 0 {
+		hash := commits[len(commits)-1]
+		commits = commits[:len(commits)-1]
+		commit, err := object.GetCommit(s, hash)
+		if err != nil {
+			// not a commit, for example an annotated tag
+			add(hash)
+			continue
+		}
+		if !add(commit.Hash) {
+			continue
+		}
+		if err := addTree(s, commit.TreeHash, add); err != nil {
+			return nil, err
+		}
+		if !shallow[commit.Hash] {
+			commits = append(commits, commit.ParentHashes...)
+		}
+	}
+	return seen, nil
+}
+
+// addTree adds the tree and the trees and blobs it contains.
+func addTree(s storer.EncodedObjectStorer, hash plumbing.Hash, add func(plumbing.Hash) bool) error {
+	if !add(hash) {
+		return nil
+	}
+	tree, err := object.GetTree(s, hash)
+	if err != nil {
+		return fmt.Errorf("failed to get tree %s: %w", hash, err)
+	}
+	for _, entry := range tree.Entries {
+		switch entry.Mode {
+		case filemode.Dir:
+			if err := addTree(s, entry.Hash, add); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			// submodules are commits of other repositories
+		default:
+			add(entry.Hash)
+		}
+	}
+	return nil
+}
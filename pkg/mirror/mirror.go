@@ -0,0 +1,217 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/weaveworks/profiles/pkg/git"
+	"github.com/weaveworks/profiles/pkg/tracing"
+)
+
+//GitClient fetches tags into the mirrors
+type GitClient interface {
+	MirrorTags(ctx context.Context, url string, auth git.AuthProvider, dir string, tags []string) error
+}
+
+//Mirror maintains local bare mirrors of the tags of repositories, reads profile definitions from them and
+//serves them over the git smart HTTP protocol
+type Mirror struct {
+	dir       string
+	baseURL   string
+	gitClient GitClient
+
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+//New returns a Mirror keeping the mirrors in dir. baseURL is the URL the mirror is served at, for
+//example http://profiles-git-mirror.profiles-system:8090. If it is empty, URL returns the original URL.
+func New(dir, baseURL string, gitClient GitClient) *Mirror {
+	return &Mirror{
+		dir:       dir,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		gitClient: gitClient,
+		locks:     map[string]*sync.RWMutex{},
+	}
+}
+
+//URL returns the URL the mirror of the repository is served at, or url if the mirror isn't served
+func (m *Mirror) URL(url string) string {
+	return RepositoryURL(m.baseURL, url)
+}
+
+//RepositoryURL returns the URL the mirror of the repository is served at by a mirror served at baseURL,
+//or url if baseURL is empty
+func RepositoryURL(baseURL, url string) string {
+	if baseURL == "" {
+		return url
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + repositoryDir(url)
+}
+
+//Tags returns the tags in the mirror of the repository mapped to the SHA of the commit they reference.
+//It returns no tags if the repository hasn't been mirrored yet.
+func (m *Mirror) Tags(url string) (map[string]string, error) {
+	lock := m.lock(repositoryDir(url))
+	lock.RLock()
+	defer lock.RUnlock()
+	return m.tags(url)
+}
+
+func (m *Mirror) tags(url string) (map[string]string, error) {
+	repo, err := extgogit.PlainOpen(m.path(url))
+	if errors.Is(err, extgogit.ErrRepositoryNotExists) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mirror of %q: %w", url, err)
+	}
+	refs, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of the mirror of %q: %w", url, err)
+	}
+	tags := map[string]string{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		// annotated tags are listed with the commit they point to, like git servers advertise them
+		if tag, err := repo.TagObject(hash); err == nil {
+			if commit, err := tag.Commit(); err == nil {
+				hash = commit.Hash
+			}
+		}
+		tags[ref.Name().Short()] = hash.String()
+		return nil
+	})
+	return tags, err
+}
+
+//Sync updates the mirror of the repository to the tags of the repository, which map to the SHA they
+//reference. Only tags which are new or have moved are fetched, tags which are no longer in the repository
+//are deleted from the mirror.
+func (m *Mirror) Sync(ctx context.Context, url string, auth git.AuthProvider, tags map[string]string) (err error) {
+	ctx, span := tracing.Start(ctx, "Mirror.Sync", attribute.String("repository.url", git.RedactURL(url)))
+	defer func() { tracing.End(span, err) }()
+
+	lock := m.lock(repositoryDir(url))
+	lock.Lock()
+	defer lock.Unlock()
+
+	mirrored, err := m.tags(url)
+	if err != nil {
+		return err
+	}
+	var fetch []string
+	for tag, sha := range tags {
+		if mirrored[tag] != sha {
+			fetch = append(fetch, tag)
+		}
+	}
+	sort.Strings(fetch)
+	span.SetAttributes(attribute.Int("tags.fetched", len(fetch)))
+	if err := m.gitClient.MirrorTags(ctx, url, auth, m.path(url), fetch); err != nil {
+		return err
+	}
+
+	var removed []string
+	for tag := range mirrored {
+		if _, ok := tags[tag]; !ok {
+			removed = append(removed, tag)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	repo, err := extgogit.PlainOpen(m.path(url))
+	if err != nil {
+		return fmt.Errorf("failed to open mirror of %q: %w", url, err)
+	}
+	for _, tag := range removed {
+		if err := repo.Storer.RemoveReference(plumbing.NewTagReferenceName(tag)); err != nil {
+			return fmt.Errorf("failed to delete tag %s from the mirror of %q: %w", tag, url, err)
+		}
+	}
+	return nil
+}
+
+//ReadFile returns the content of the file at the tag in the mirror of the repository. The error wraps
+//os.ErrNotExist if the file doesn't exist at the tag.
+func (m *Mirror) ReadFile(url, tag, file string) ([]byte, error) {
+	lock := m.lock(repositoryDir(url))
+	lock.RLock()
+	defer lock.RUnlock()
+
+	repo, err := extgogit.PlainOpen(m.path(url))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mirror of %q: %w", url, err)
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(plumbing.NewTagReferenceName(tag)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve tag %s in the mirror of %q: %w", tag, url, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit of tag %s: %w", tag, err)
+	}
+	f, err := commit.File(file)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fmt.Errorf("%s does not exist at tag %s: %w", file, tag, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s at tag %s: %w", file, tag, err)
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at tag %s: %w", file, tag, err)
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+//VerifyTag verifies the signatures of the tag in the mirror of the repository, and of the commit it
+//references, with the trusted keys. The tag must still reference the commit with the given SHA.
+func (m *Mirror) VerifyTag(url, tag, sha string, keys *git.TrustedKeys) (git.Signature, error) {
+	lock := m.lock(repositoryDir(url))
+	lock.RLock()
+	defer lock.RUnlock()
+
+	repo, err := extgogit.PlainOpen(m.path(url))
+	if err != nil {
+		return git.Signature{}, fmt.Errorf("failed to open mirror of %q: %w", url, err)
+	}
+	return git.VerifyTag(repo, tag, sha, keys)
+}
+
+// path returns the directory of the mirror of the repository.
+func (m *Mirror) path(url string) string {
+	return filepath.Join(m.dir, repositoryDir(url))
+}
+
+// lock returns the lock of the mirror in the directory. Syncing a mirror takes the write lock,
+// reading and serving it the read lock.
+func (m *Mirror) lock(dir string) *sync.RWMutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock, ok := m.locks[dir]
+	if !ok {
+		lock = &sync.RWMutex{}
+		m.locks[dir] = lock
+	}
+	return lock
+}
+
+// repositoryDir returns the name of the directory of the mirror of the repository.
+func repositoryDir(url string) string {
+	return git.UniqueRepositoryName(url) + ".git"
+}
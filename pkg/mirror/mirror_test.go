@@ -0,0 +1,418 @@
+package mirror_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	extgogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/git"
+	"github.com/weaveworks/profiles/pkg/mirror"
+)
+
+const nginxProfile = `apiVersion: weave.works/v1alpha1
+kind: ProfileDefinition
+metadata:
+  name: nginx
+spec:
+  description: nginx
+`
+
+var _ = Describe("Mirror", func() {
+	var (
+		tempDir string
+		repoDir string
+		repo    *extgogit.Repository
+		m       *mirror.Mirror
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "mirror")
+		Expect(err).NotTo(HaveOccurred())
+		repoDir = filepath.Join(tempDir, "profiles-examples")
+		repo, err = extgogit.PlainInit(repoDir, false)
+		Expect(err).NotTo(HaveOccurred())
+		m = mirror.New(filepath.Join(tempDir, "mirrors"), "", &git.Client{})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	// commit commits the nginx profile with the description and tags the commit.
+	commit := func(description, tag string) string {
+		Expect(os.MkdirAll(filepath.Join(repoDir, "nginx"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(repoDir, "nginx", git.ProfileFile), []byte(nginxProfile+"  maintainer: "+description+"\n"), 0644)).To(Succeed())
+		worktree, err := repo.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = worktree.Add("nginx/profile.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := worktree.Commit(description, &extgogit.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = repo.CreateTag(tag, hash, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return hash.String()
+	}
+
+	It("mirrors the tags of the repository", func() {
+		tags, err := m.Tags(repoDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(BeEmpty())
+
+		first := commit("first", "nginx/v0.1.0")
+		second := commit("second", "nginx/v0.2.0")
+		Expect(m.Sync(context.TODO(), repoDir, nil, map[string]string{"nginx/v0.1.0": first, "nginx/v0.2.0": second})).To(Succeed())
+
+		tags, err = m.Tags(repoDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(Equal(map[string]string{"nginx/v0.1.0": first, "nginx/v0.2.0": second}))
+		data, err := m.ReadFile(repoDir, "nginx/v0.1.0", "nginx/profile.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("maintainer: first"))
+
+		_, err = m.ReadFile(repoDir, "nginx/v0.1.0", "other/profile.yaml")
+		Expect(err).To(MatchError(os.ErrNotExist))
+	})
+
+	It("updates moved tags and deletes removed tags", func() {
+		first := commit("first", "nginx/v0.1.0")
+		second := commit("second", "nginx/v0.2.0")
+		Expect(m.Sync(context.TODO(), repoDir, nil, map[string]string{"nginx/v0.1.0": first, "nginx/v0.2.0": second})).To(Succeed())
+
+		Expect(repo.DeleteTag("nginx/v0.1.0")).To(Succeed())
+		Expect(repo.Storer.RemoveReference(plumbing.NewTagReferenceName("nginx/v0.2.0"))).To(Succeed())
+		third := commit("third", "nginx/v0.2.0")
+		Expect(m.Sync(context.TODO(), repoDir, nil, map[string]string{"nginx/v0.2.0": third})).To(Succeed())
+
+		tags, err := m.Tags(repoDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tags).To(Equal(map[string]string{"nginx/v0.2.0": third}))
+		data, err := m.ReadFile(repoDir, "nginx/v0.2.0", "nginx/profile.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("maintainer: third"))
+	})
+
+	It("serves the mirrors over http", func() {
+		first := commit("first", "nginx/v0.1.0")
+		commit("second", "nginx/v0.2.0")
+		Expect(m.Sync(context.TODO(), repoDir, nil, map[string]string{"nginx/v0.1.0": first})).To(Succeed())
+
+		server := httptest.NewServer(m)
+		defer server.Close()
+		served := mirror.New(filepath.Join(tempDir, "mirrors"), server.URL+"/", &git.Client{})
+		url := served.URL(repoDir)
+		Expect(url).To(Equal(server.URL + "/" + git.UniqueRepositoryName(repoDir) + ".git"))
+
+		def, err := (&git.Client{}).GetProfileDefinition(context.TODO(), profilesv1.Source{URL: url, Tag: "nginx/v0.1.0", Path: "nginx"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(def.Name).To(Equal("nginx"))
+		Expect(def.Spec.Maintainer).To(Equal("first"))
+
+		_, err = (&git.Client{}).GetProfileDefinition(context.TODO(), profilesv1.Source{URL: url, Tag: "nginx/v0.2.0", Path: "nginx"})
+		Expect(err).To(HaveOccurred())
+		_, err = (&git.Client{}).GetProfileDefinition(context.TODO(), profilesv1.Source{URL: server.URL + "/unknown.git", Tag: "nginx/v0.1.0", Path: "nginx"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("serves shallow clones and fetches to git", func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		first := commit("first", "nginx/v0.1.0")
+		second := commit("second", "nginx/v0.2.0")
+		third := commit("third", "nginx/v0.3.0")
+		tags := map[string]string{"nginx/v0.1.0": first, "nginx/v0.2.0": second, "nginx/v0.3.0": third}
+		Expect(m.Sync(context.TODO(), repoDir, nil, tags)).To(Succeed())
+		server := httptest.NewServer(m)
+		defer server.Close()
+		url := mirror.RepositoryURL(server.URL, repoDir)
+		cloneDir := filepath.Join(tempDir, "clone")
+
+		gitCommand := func(dir string, args ...string) string {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_CONFIG_NOSYSTEM=1", "HOME="+tempDir)
+			out, err := cmd.CombinedOutput()
+			Expect(err).NotTo(HaveOccurred(), string(out))
+			return strings.TrimSpace(string(out))
+		}
+
+		Expect(gitCommand(tempDir, "ls-remote", "--tags", url)).To(Equal(
+			first + "\trefs/tags/nginx/v0.1.0\n" + second + "\trefs/tags/nginx/v0.2.0\n" + third + "\trefs/tags/nginx/v0.3.0"))
+
+		// Flux clones tags with a depth of 1
+		gitCommand(tempDir, "clone", "--depth", "1", "--branch", "nginx/v0.2.0", url, cloneDir)
+		Expect(gitCommand(cloneDir, "rev-parse", "HEAD")).To(Equal(second))
+		Expect(gitCommand(cloneDir, "rev-list", "--count", "HEAD")).To(Equal("1"))
+		data, err := ioutil.ReadFile(filepath.Join(cloneDir, "nginx", git.ProfileFile))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("maintainer: second"))
+
+		By("fetching the tag of a child commit into the shallow clone")
+		gitCommand(cloneDir, "fetch", "--depth", "1", "origin", "tag", "nginx/v0.3.0")
+		Expect(gitCommand(cloneDir, "show", "nginx/v0.3.0:nginx/profile.yaml")).To(ContainSubstring("maintainer: third"))
+
+		By("fetching the tag of the parent commit the shallow clone doesn't have")
+		gitCommand(cloneDir, "fetch", "--depth", "1", "origin", "tag", "nginx/v0.1.0")
+		Expect(gitCommand(cloneDir, "show", "nginx/v0.1.0:nginx/profile.yaml")).To(ContainSubstring("maintainer: first"))
+
+		By("deepening the shallow clone")
+		gitCommand(cloneDir, "fetch", "--depth", "3", "origin", "tag", "nginx/v0.3.0")
+		Expect(gitCommand(cloneDir, "rev-list", "--count", "nginx/v0.3.0")).To(Equal("3"))
+		gitCommand(cloneDir, "fsck", "--no-dangling")
+	})
+
+	It("lists annotated tags with the commit they point to", func() {
+		first := commit("first", "nginx/v0.1.0")
+		_, err := repo.CreateTag("nginx/v0.1.1", plumbing.NewHash(first), &extgogit.CreateTagOptions{
+			Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+			Message: "nginx v0.1.1",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		gitClient := &countingGitClient{Client: &git.Client{}}
+		m = mirror.New(filepath.Join(tempDir, "mirrors"), "", gitClient)
+		tags := map[string]string{"nginx/v0.1.0": first, "nginx/v0.1.1": first}
+		Expect(m.Sync(context.TODO(), repoDir, nil, tags)).To(Succeed())
+		Expect(m.Tags(repoDir)).To(Equal(tags))
+
+		By("not fetching unchanged tags again")
+		Expect(m.Sync(context.TODO(), repoDir, nil, tags)).To(Succeed())
+		Expect(gitClient.fetched).To(Equal([][]string{{"nginx/v0.1.0", "nginx/v0.1.1"}, nil}))
+
+		By("advertising the commit of annotated tags when served")
+		server := httptest.NewServer(m)
+		defer server.Close()
+		served, err := (&git.Client{}).ListTags(context.TODO(), mirror.RepositoryURL(server.URL, repoDir), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(served).To(Equal(tags))
+	})
+
+	Describe("VerifyTag", func() {
+		var (
+			gpgKey *openpgp.Entity
+			sshKey ssh.Signer
+			keys   *git.TrustedKeys
+			tagger *object.Signature
+		)
+
+		BeforeEach(func() {
+			var err error
+			gpgKey, err = openpgp.NewEntity("test", "", "test@example.com", nil)
+			Expect(err).NotTo(HaveOccurred())
+			_, private, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			sshKey, err = ssh.NewSignerFromKey(private)
+			Expect(err).NotTo(HaveOccurred())
+			keys, err = git.ParseTrustedKeys(&corev1.Secret{Data: map[string][]byte{
+				"gpg.asc":         armoredPublicKey(gpgKey),
+				"authorized_keys": ssh.MarshalAuthorizedKey(sshKey.PublicKey()),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			tagger = &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+		})
+
+		It("verifies GPG signed tags and commits", func() {
+			first := commit("first", "nginx/v0.1.0")
+			_, err := repo.CreateTag("nginx/v0.1.1", plumbing.NewHash(first), &extgogit.CreateTagOptions{
+				Tagger:  tagger,
+				Message: "nginx v0.1.1",
+				SignKey: gpgKey,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			worktree, err := repo.Worktree()
+			Expect(err).NotTo(HaveOccurred())
+			signed, err := worktree.Commit("signed", &extgogit.CommitOptions{Author: tagger, SignKey: gpgKey})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = repo.CreateTag("nginx/v0.2.0", signed, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Sync(context.TODO(), repoDir, nil, map[string]string{"nginx/v0.1.0": first, "nginx/v0.1.1": first, "nginx/v0.2.0": signed.String()})).To(Succeed())
+
+			verified := git.Signature{Verified: true, Key: fmt.Sprintf("%X", gpgKey.PrimaryKey.Fingerprint)}
+			Expect(m.VerifyTag(repoDir, "nginx/v0.1.1", first, keys)).To(Equal(verified))
+			Expect(m.VerifyTag(repoDir, "nginx/v0.2.0", signed.String(), keys)).To(Equal(verified))
+
+			By("not verifying unsigned tags")
+			Expect(m.VerifyTag(repoDir, "nginx/v0.1.0", first, keys)).To(Equal(git.Signature{}))
+
+			By("not verifying tags which reference other commits")
+			_, err = m.VerifyTag(repoDir, "nginx/v0.2.0", first, keys)
+			Expect(err).To(MatchError(fmt.Sprintf("tag %q references commit %s instead of %s", "nginx/v0.2.0", signed, first)))
+
+			By("not verifying signatures of untrusted keys")
+			otherKey, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+			Expect(err).NotTo(HaveOccurred())
+			otherKeys, err := git.ParseTrustedKeys(&corev1.Secret{Data: map[string][]byte{"gpg.asc": armoredPublicKey(otherKey)}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.VerifyTag(repoDir, "nginx/v0.1.1", first, otherKeys)).To(Equal(git.Signature{}))
+
+			_, err = m.VerifyTag(repoDir, "nginx/v0.3.0", first, keys)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("verifies SSH signed tags and commits fetched from the repository", func() {
+			first := commit("first", "nginx/v0.1.0")
+
+			// sign a copy of the commit
+			unsigned, err := repo.CommitObject(plumbing.NewHash(first))
+			Expect(err).NotTo(HaveOccurred())
+			unsigned.PGPSignature = sshSignature(sshKey, encode(unsigned.EncodeWithoutSignature))
+			signedCommit := store(repo, unsigned.Encode)
+			_, err = repo.CreateTag("nginx/v0.2.0", signedCommit, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			// sign an annotated tag of the unsigned commit
+			tag := &object.Tag{Name: "nginx/v0.2.1", Tagger: *tagger, Message: "nginx v0.2.1\n", TargetType: plumbing.CommitObject, Target: plumbing.NewHash(first)}
+			tag.Message += sshSignature(sshKey, encode(tag.EncodeWithoutSignature))
+			signedTag := store(repo, tag.Encode)
+			Expect(repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName("nginx/v0.2.1"), signedTag))).To(Succeed())
+
+			tags := map[string]string{"nginx/v0.1.0": first, "nginx/v0.2.0": signedCommit.String(), "nginx/v0.2.1": first}
+			Expect(m.Sync(context.TODO(), repoDir, nil, tags)).To(Succeed())
+			server := httptest.NewServer(m)
+			defer server.Close()
+			url := mirror.RepositoryURL(server.URL, repoDir)
+
+			verified := git.Signature{Verified: true, Key: ssh.FingerprintSHA256(sshKey.PublicKey())}
+			for _, tag := range []string{"nginx/v0.2.0", "nginx/v0.2.1"} {
+				Expect(m.VerifyTag(repoDir, tag, tags[tag], keys)).To(Equal(verified), tag)
+				Expect((&git.Client{}).VerifyTag(context.TODO(), url, nil, tag, tags[tag], keys)).To(Equal(verified), tag)
+			}
+			Expect((&git.Client{}).VerifyTag(context.TODO(), url, nil, "nginx/v0.1.0", first, keys)).To(Equal(git.Signature{}))
+
+			By("not verifying tags which have moved since they were listed")
+			_, err = (&git.Client{}).VerifyTag(context.TODO(), url, nil, "nginx/v0.2.0", first, keys)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("digests the fingerprints of the keys", func() {
+			sameKeys, err := git.ParseTrustedKeys(&corev1.Secret{Data: map[string][]byte{
+				"authorized_keys": ssh.MarshalAuthorizedKey(sshKey.PublicKey()),
+				"gpg.asc":         armoredPublicKey(gpgKey),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sameKeys.Digest()).To(Equal(keys.Digest()))
+
+			sshKeys, err := git.ParseTrustedKeys(&corev1.Secret{Data: map[string][]byte{
+				"authorized_keys": ssh.MarshalAuthorizedKey(sshKey.PublicKey()),
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sshKeys.Digest()).NotTo(Equal(keys.Digest()))
+		})
+
+		It("requires public keys", func() {
+			_, err := git.ParseTrustedKeys(&corev1.Secret{Data: map[string][]byte{"keys": []byte("not a key")}})
+			Expect(err).To(HaveOccurred())
+			_, err = git.ParseTrustedKeys(&corev1.Secret{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("IsLocalAddress", func() {
+		It("returns whether the address is localhost or a loopback IP", func() {
+			Expect(mirror.IsLocalAddress("localhost:8090")).To(BeTrue())
+			Expect(mirror.IsLocalAddress("127.0.0.1:8090")).To(BeTrue())
+			Expect(mirror.IsLocalAddress("[::1]:8090")).To(BeTrue())
+			Expect(mirror.IsLocalAddress(":8090")).To(BeFalse())
+			Expect(mirror.IsLocalAddress("0.0.0.0:8090")).To(BeFalse())
+			Expect(mirror.IsLocalAddress("10.0.0.1:8090")).To(BeFalse())
+			Expect(mirror.IsLocalAddress("8090")).To(BeFalse())
+		})
+	})
+
+	Describe("RepositoryURL", func() {
+		It("returns the URL the mirror is served at, or the url if it isn't served", func() {
+			Expect(mirror.RepositoryURL("", "https://github.com/weaveworks/profiles-examples")).To(Equal("https://github.com/weaveworks/profiles-examples"))
+			Expect(mirror.RepositoryURL("http://git-mirror:8090/", "https://github.com/weaveworks/profiles-examples")).
+				To(Equal("http://git-mirror:8090/ab8914722fee2066-github.com-weaveworks-profiles-examples.git"))
+		})
+	})
+})
+
+// countingGitClient records the tags it mirrors.
+type countingGitClient struct {
+	*git.Client
+	fetched [][]string
+}
+
+func (c *countingGitClient) MirrorTags(ctx context.Context, url string, auth git.AuthProvider, dir string, tags []string) error {
+	c.fetched = append(c.fetched, tags)
+	return c.Client.MirrorTags(ctx, url, auth, dir, tags)
+}
+
+// armoredPublicKey returns the ASCII armored public key of the entity.
+func armoredPublicKey(entity *openpgp.Entity) []byte {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(entity.Serialize(w)).To(Succeed())
+	Expect(w.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+// sshSignature returns the armored signature of the payload made with the key, like ssh-keygen -Y sign.
+func sshSignature(key ssh.Signer, payload []byte) string {
+	digest := sha512.Sum512(payload)
+	signature, err := key.Sign(rand.Reader, append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{"git", "", "sha512", digest[:]})...))
+	Expect(err).NotTo(HaveOccurred())
+	blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Version                            uint32
+		PublicKey                          []byte
+		Namespace, Reserved, HashAlgorithm string
+		Signature                          []byte
+	}{1, key.PublicKey().Marshal(), "git", "", "sha512", ssh.Marshal(signature)})...)
+
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	lines := []string{"-----BEGIN SSH SIGNATURE-----"}
+	for ; len(encoded) > 70; encoded = encoded[70:] {
+		lines = append(lines, encoded[:70])
+	}
+	lines = append(lines, encoded, "-----END SSH SIGNATURE-----")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// encode returns the object encoded by the function.
+func encode(encodeObject func(plumbing.EncodedObject) error) []byte {
+	obj := &plumbing.MemoryObject{}
+	Expect(encodeObject(obj)).To(Succeed())
+	reader, err := obj.Reader()
+	Expect(err).NotTo(HaveOccurred())
+	data, err := ioutil.ReadAll(reader)
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+// store stores the object encoded by the function in the repository and returns its hash.
+func store(repo *extgogit.Repository, encodeObject func(plumbing.EncodedObject) error) plumbing.Hash {
+	obj := repo.Storer.NewEncodedObject()
+	Expect(encodeObject(obj)).To(Succeed())
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	Expect(err).NotTo(HaveOccurred())
+	return hash
+}
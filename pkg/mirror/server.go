@@ -0,0 +1,66 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const timeout = 10 * time.Second
+
+// Server serves the mirrors over HTTP.
+type Server struct {
+	logger logr.Logger
+	addr   string
+	server *http.Server
+}
+
+// NewServer returns a server serving the mirrors of mirror at addr.
+func NewServer(logger logr.Logger, addr string, mirror *Mirror) *Server {
+	return &Server{
+		logger: logger,
+		addr:   addr,
+		server: &http.Server{Addr: addr, Handler: otelhttp.NewHandler(mirror, "git-mirror")},
+	}
+}
+
+// IsLocalAddress returns whether the address only accepts connections from the same host, because
+// its host is localhost or a loopback IP.
+func IsLocalAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Start starts the server.
+func (s *Server) Start(ctx context.Context) error {
+	s.logger.Info(fmt.Sprintf("starting git mirror server at %s", s.addr))
+	// ignore server is closing error because the server receives that on graceful shutdown.
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error(err, "unable to start git mirror server")
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the server.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Error(err, "Failed to gracefully shutdown server... terminating.")
+	}
+	s.logger.Info("server stopped")
+}
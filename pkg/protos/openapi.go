@@ -0,0 +1,8 @@
+package protos
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI v2 document of the ProfilesService REST routes, generated from profiles.proto.
+//
+//go:embed profiles.swagger.json
+var OpenAPI []byte
@@ -31,6 +31,10 @@ var _ = runtime.String
 var _ = utilities.NewDoubleArray
 var _ = metadata.Join
 
+var (
+	filter_ProfilesService_Get_0 = &utilities.DoubleArray{Encoding: map[string]int{"source_name": 0, "profile_name": 1}, Base: []int{1, 1, 2, 0, 0}, Check: []int{0, 1, 1, 2, 3}}
+)
+
 func request_ProfilesService_Get_0(ctx context.Context, marshaler runtime.Marshaler, client ProfilesServiceClient, req *http.Request, pathParams map[string]string) (proto.Message, runtime.ServerMetadata, error) {
 	var protoReq GetRequest
 	var metadata runtime.ServerMetadata
@@ -62,6 +66,13 @@ func request_ProfilesService_Get_0(ctx context.Context, marshaler runtime.Marsha
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "profile_name", err)
 	}
 
+	if err := req.ParseForm(); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(&protoReq, req.Form, filter_ProfilesService_Get_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
 	msg, err := client.Get(ctx, &protoReq, grpc.Header(&metadata.HeaderMD), grpc.Trailer(&metadata.TrailerMD))
 	return msg, metadata, err
 
@@ -98,11 +109,22 @@ func local_request_ProfilesService_Get_0(ctx context.Context, marshaler runtime.
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "profile_name", err)
 	}
 
+	if err := req.ParseForm(); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(&protoReq, req.Form, filter_ProfilesService_Get_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
 	msg, err := server.Get(ctx, &protoReq)
 	return msg, metadata, err
 
 }
 
+var (
+	filter_ProfilesService_GetWithVersion_0 = &utilities.DoubleArray{Encoding: map[string]int{"source_name": 0, "profile_name": 1, "version": 2}, Base: []int{1, 1, 2, 3, 0, 0, 0}, Check: []int{0, 1, 1, 1, 2, 3, 4}}
+)
+
 func request_ProfilesService_GetWithVersion_0(ctx context.Context, marshaler runtime.Marshaler, client ProfilesServiceClient, req *http.Request, pathParams map[string]string) (proto.Message, runtime.ServerMetadata, error) {
 	var protoReq GetWithVersionRequest
 	var metadata runtime.ServerMetadata
@@ -144,6 +166,13 @@ func request_ProfilesService_GetWithVersion_0(ctx context.Context, marshaler run
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "version", err)
 	}
 
+	if err := req.ParseForm(); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(&protoReq, req.Form, filter_ProfilesService_GetWithVersion_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
 	msg, err := client.GetWithVersion(ctx, &protoReq, grpc.Header(&metadata.HeaderMD), grpc.Trailer(&metadata.TrailerMD))
 	return msg, metadata, err
 
@@ -190,11 +219,22 @@ func local_request_ProfilesService_GetWithVersion_0(ctx context.Context, marshal
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "version", err)
 	}
 
+	if err := req.ParseForm(); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(&protoReq, req.Form, filter_ProfilesService_GetWithVersion_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
 	msg, err := server.GetWithVersion(ctx, &protoReq)
 	return msg, metadata, err
 
 }
 
+var (
+	filter_ProfilesService_ProfilesGreaterThanVersion_0 = &utilities.DoubleArray{Encoding: map[string]int{"source_name": 0, "profile_name": 1, "version": 2}, Base: []int{1, 1, 2, 3, 0, 0, 0}, Check: []int{0, 1, 1, 1, 2, 3, 4}}
+)
+
 func request_ProfilesService_ProfilesGreaterThanVersion_0(ctx context.Context, marshaler runtime.Marshaler, client ProfilesServiceClient, req *http.Request, pathParams map[string]string) (proto.Message, runtime.ServerMetadata, error) {
 	var protoReq ProfilesGreaterThanVersionRequest
 	var metadata runtime.ServerMetadata
@@ -236,6 +276,13 @@ func request_ProfilesService_ProfilesGreaterThanVersion_0(ctx context.Context, m
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "version", err)
 	}
 
+	if err := req.ParseForm(); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(&protoReq, req.Form, filter_ProfilesService_ProfilesGreaterThanVersion_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
 	msg, err := client.ProfilesGreaterThanVersion(ctx, &protoReq, grpc.Header(&metadata.HeaderMD), grpc.Trailer(&metadata.TrailerMD))
 	return msg, metadata, err
 
@@ -282,6 +329,13 @@ func local_request_ProfilesService_ProfilesGreaterThanVersion_0(ctx context.Cont
 		return nil, metadata, status.Errorf(codes.InvalidArgument, "type mismatch, parameter: %s, error: %v", "version", err)
 	}
 
+	if err := req.ParseForm(); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := runtime.PopulateQueryParameters(&protoReq, req.Form, filter_ProfilesService_ProfilesGreaterThanVersion_0); err != nil {
+		return nil, metadata, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
 	msg, err := server.ProfilesGreaterThanVersion(ctx, &protoReq)
 	return msg, metadata, err
 
@@ -335,7 +389,7 @@ func RegisterProfilesServiceHandlerServer(ctx context.Context, mux *runtime.Serv
 		var stream runtime.ServerTransportStream
 		ctx = grpc.NewContextWithServerTransportStream(ctx, &stream)
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Get")
+		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Get", runtime.WithHTTPPathPattern("/v1/profiles/{source_name}/{profile_name}"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -358,7 +412,7 @@ func RegisterProfilesServiceHandlerServer(ctx context.Context, mux *runtime.Serv
 		var stream runtime.ServerTransportStream
 		ctx = grpc.NewContextWithServerTransportStream(ctx, &stream)
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/GetWithVersion")
+		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/GetWithVersion", runtime.WithHTTPPathPattern("/v1/profiles/{source_name}/{profile_name}/{version}"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -381,7 +435,7 @@ func RegisterProfilesServiceHandlerServer(ctx context.Context, mux *runtime.Serv
 		var stream runtime.ServerTransportStream
 		ctx = grpc.NewContextWithServerTransportStream(ctx, &stream)
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/ProfilesGreaterThanVersion")
+		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/ProfilesGreaterThanVersion", runtime.WithHTTPPathPattern("/v1/profiles/{source_name}/{profile_name}/{version}/available_updates"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -404,7 +458,7 @@ func RegisterProfilesServiceHandlerServer(ctx context.Context, mux *runtime.Serv
 		var stream runtime.ServerTransportStream
 		ctx = grpc.NewContextWithServerTransportStream(ctx, &stream)
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Search")
+		rctx, err := runtime.AnnotateIncomingContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Search", runtime.WithHTTPPathPattern("/v1/profiles"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -466,7 +520,7 @@ func RegisterProfilesServiceHandlerClient(ctx context.Context, mux *runtime.Serv
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Get")
+		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Get", runtime.WithHTTPPathPattern("/v1/profiles/{source_name}/{profile_name}"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -486,7 +540,7 @@ func RegisterProfilesServiceHandlerClient(ctx context.Context, mux *runtime.Serv
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/GetWithVersion")
+		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/GetWithVersion", runtime.WithHTTPPathPattern("/v1/profiles/{source_name}/{profile_name}/{version}"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -506,7 +560,7 @@ func RegisterProfilesServiceHandlerClient(ctx context.Context, mux *runtime.Serv
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/ProfilesGreaterThanVersion")
+		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/ProfilesGreaterThanVersion", runtime.WithHTTPPathPattern("/v1/profiles/{source_name}/{profile_name}/{version}/available_updates"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -526,7 +580,7 @@ func RegisterProfilesServiceHandlerClient(ctx context.Context, mux *runtime.Serv
 		ctx, cancel := context.WithCancel(req.Context())
 		defer cancel()
 		inboundMarshaler, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
-		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Search")
+		rctx, err := runtime.AnnotateContext(ctx, mux, req, "/weave.works.profiles.v1.ProfilesService/Search", runtime.WithHTTPPathPattern("/v1/profiles"))
 		if err != nil {
 			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
 			return
@@ -5,13 +5,18 @@ import profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
 // TransformCatalogEntry takes a profilesv1 catalog entry and creates a proto catalog entry out of it.
 func TransformCatalogEntry(origin *profilesv1.ProfileCatalogEntry) *ProfileCatalogEntry {
 	return &ProfileCatalogEntry{
-		Tag:           origin.Tag,
-		CatalogSource: origin.CatalogSource,
-		Url:           origin.URL,
-		Name:          origin.Name,
-		Description:   origin.ProfileDescription.Description,
-		Maintainer:    origin.ProfileDescription.Maintainer,
-		Prerequisites: origin.ProfileDescription.Prerequisites,
+		Tag:              origin.Tag,
+		CatalogSource:    origin.CatalogSource,
+		Url:              origin.URL,
+		Name:             origin.Name,
+		Description:      origin.ProfileDescription.Description,
+		Maintainer:       origin.ProfileDescription.Maintainer,
+		Prerequisites:    origin.ProfileDescription.Prerequisites,
+		CatalogNamespace: origin.CatalogNamespace,
+		CatalogScope:     origin.CatalogScope,
+		Verified:         origin.Verified,
+		SigningKey:       origin.SigningKey,
+		MirrorUrl:        origin.MirrorURL,
 	}
 }
 
@@ -23,3 +28,32 @@ func TransformCatalogEntryList(origins []profilesv1.ProfileCatalogEntry) []*Prof
 	}
 	return result
 }
+
+// TransformProtoCatalogEntry takes a proto catalog entry and creates a profilesv1 catalog entry out of it.
+func TransformProtoCatalogEntry(origin *ProfileCatalogEntry) *profilesv1.ProfileCatalogEntry {
+	return &profilesv1.ProfileCatalogEntry{
+		Tag:              origin.GetTag(),
+		CatalogSource:    origin.GetCatalogSource(),
+		CatalogNamespace: origin.GetCatalogNamespace(),
+		CatalogScope:     origin.GetCatalogScope(),
+		URL:              origin.GetUrl(),
+		Verified:         origin.GetVerified(),
+		SigningKey:       origin.GetSigningKey(),
+		MirrorURL:        origin.GetMirrorUrl(),
+		Name:             origin.GetName(),
+		ProfileDescription: profilesv1.ProfileDescription{
+			Description:   origin.GetDescription(),
+			Maintainer:    origin.GetMaintainer(),
+			Prerequisites: origin.GetPrerequisites(),
+		},
+	}
+}
+
+// TransformProtoCatalogEntryList takes a slice of proto catalog entries and creates a profilesv1 catalog entry slice out of it.
+func TransformProtoCatalogEntryList(origins []*ProfileCatalogEntry) []profilesv1.ProfileCatalogEntry {
+	var result []profilesv1.ProfileCatalogEntry
+	for _, origin := range origins {
+		result = append(result, *TransformProtoCatalogEntry(origin))
+	}
+	return result
+}
@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/weaveworks/profiles/pkg/api"
+)
+
+// ReasonRateLimited is the reason of the ErrorInfo details of rejected requests.
+const ReasonRateLimited = "RATE_LIMITED"
+
+// retryAfterHeader is the header telling clients how many seconds to wait before retrying.
+const retryAfterHeader = "Retry-After"
+
+// forwardedForHeader is the metadata the gateway passes the address of the HTTP client in.
+const forwardedForHeader = "x-forwarded-for"
+
+// charge tracks whether the quota of a client has been used for a request.
+type charge struct {
+	// addr is the IP address of the client, empty if it's unknown
+	addr string
+	done bool
+}
+
+type chargeKey struct{}
+
+// UnaryServerInterceptor rejects unary requests of clients exceeding their quota with ResourceExhausted.
+// It must run before authentication, so clients are checked by their IP address before their
+// credentials are reviewed. The quota is used once per request: by UnaryCallerInterceptor after
+// authentication, or by the IP address of the client if the request doesn't reach it.
+func UnaryServerInterceptor(limiter *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		c := &charge{addr: peerAddr(ctx)}
+		if err := check(ctx, limiter, c.addr); err != nil {
+			return nil, err
+		}
+		defer settle(limiter, c)
+		return handler(context.WithValue(ctx, chargeKey{}, c), req)
+	}
+}
+
+// StreamServerInterceptor rejects streams of clients exceeding their quota with ResourceExhausted,
+// see UnaryServerInterceptor.
+func StreamServerInterceptor(limiter *Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		c := &charge{addr: peerAddr(ss.Context())}
+		if err := check(ss.Context(), limiter, c.addr); err != nil {
+			return err
+		}
+		defer settle(limiter, c)
+		return handler(srv, &serverStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), chargeKey{}, c)})
+	}
+}
+
+// UnaryCallerInterceptor uses the quota of the client of unary requests and rejects them with
+// ResourceExhausted if it is exceeded. It must run after authentication, so authenticated clients
+// are identified by their username, other clients by their IP address.
+func UnaryCallerInterceptor(limiter *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := use(ctx, limiter); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamCallerInterceptor uses the quota of the client of streams, see UnaryCallerInterceptor.
+func StreamCallerInterceptor(limiter *Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := use(ss.Context(), limiter); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// check rejects the request if the client at addr has exceeded its quota, without using it.
+func check(ctx context.Context, limiter *Limiter, addr string) error {
+	if addr == "" {
+		return nil
+	}
+	if allowed, retryAfter := limiter.Check(addr); !allowed {
+		return rejected(ctx, addr, retryAfter)
+	}
+	return nil
+}
+
+// use uses the quota of the caller of the request, or of its IP address if the caller is unknown.
+func use(ctx context.Context, limiter *Limiter) error {
+	c, ok := ctx.Value(chargeKey{}).(*charge)
+	if !ok {
+		c = &charge{addr: peerAddr(ctx)}
+	}
+	c.done = true
+	key := c.addr
+	if caller, ok := api.CallerFromContext(ctx); ok && caller.Username != "" {
+		key = caller.Username
+	}
+	if key == "" {
+		return nil
+	}
+	if allowed, retryAfter := limiter.Allow(key); !allowed {
+		return rejected(ctx, key, retryAfter)
+	}
+	return nil
+}
+
+// settle uses the quota of the IP address of a request which was not charged after authentication,
+// for example because the credentials were rejected.
+func settle(limiter *Limiter, c *charge) {
+	if !c.done && c.addr != "" {
+		limiter.Allow(c.addr)
+	}
+}
+
+func rejected(ctx context.Context, key string, retryAfter time.Duration) error {
+	_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterHeader, retryAfterSeconds(retryAfter)))
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(
+		&errdetails.ErrorInfo{
+			Reason:   ReasonRateLimited,
+			Domain:   api.ErrorDomain,
+			Metadata: map[string]string{"client": key},
+		},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return st.Err()
+}
+
+// peerAddr returns the IP address of the client of the request. Requests received over an in-memory
+// or a loopback connection come from the gateway in the same pod, their client is the one the gateway
+// forwards the request of. It returns an empty string if the address is unknown.
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		// not a network address, for example an in-memory connection
+		return forwardedFor(ctx)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if ip.IsLoopback() {
+		// the gateway dials the grpc bind address with --gateway-mode endpoint
+		if forwarded := forwardedFor(ctx); forwarded != "" {
+			return forwarded
+		}
+	}
+	return host
+}
+
+// forwardedFor returns the address the gateway appended to the x-forwarded-for metadata. Addresses
+// before it are set by the client and not trusted.
+func forwardedFor(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(forwardedForHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	hops := strings.Split(values[len(values)-1], ",")
+	host := strings.TrimSpace(hops[len(hops)-1])
+	if net.ParseIP(host) == nil {
+		return ""
+	}
+	return host
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// retryAfterSeconds rounds the delay up to whole seconds, as Retry-After doesn't allow fractions.
+func retryAfterSeconds(delay time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(delay.Seconds())))
+}
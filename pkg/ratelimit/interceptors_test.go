@@ -0,0 +1,142 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/weaveworks/profiles/pkg/api"
+	"github.com/weaveworks/profiles/pkg/ratelimit"
+)
+
+var _ = Describe("UnaryServerInterceptor", func() {
+	var (
+		limiter *ratelimit.Limiter
+		calls   int
+		caller  *api.Caller
+		authErr error
+		chain   func(ctx context.Context) error
+	)
+
+	BeforeEach(func() {
+		limiter = ratelimit.New(ratelimit.Config{
+			Quota: ratelimit.Quota{RequestsPerSecond: 1, Burst: 1},
+		})
+		calls = 0
+		caller = nil
+		authErr = nil
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			calls++
+			return "ok", nil
+		}
+		// authenticate stands in for the authentication interceptor running between the two rate limit interceptors
+		authenticate := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+			if authErr != nil {
+				return nil, authErr
+			}
+			if caller != nil {
+				ctx = api.NewContextWithCaller(ctx, *caller)
+			}
+			return next(ctx, req)
+		}
+		interceptors := []grpc.UnaryServerInterceptor{
+			ratelimit.UnaryServerInterceptor(limiter),
+			authenticate,
+			ratelimit.UnaryCallerInterceptor(limiter),
+		}
+		chain = func(ctx context.Context) error {
+			next := handler
+			for i := len(interceptors) - 1; i >= 0; i-- {
+				interceptor, inner := interceptors[i], next
+				next = func(ctx context.Context, req interface{}) (interface{}, error) {
+					return interceptor(ctx, req, &grpc.UnaryServerInfo{}, inner)
+				}
+			}
+			_, err := next(ctx, nil)
+			return err
+		}
+	})
+
+	peerContext := func(ip string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+	}
+
+	It("rejects clients exceeding their quota with a retry hint", func() {
+		ctx := peerContext("10.0.0.1")
+		Expect(chain(ctx)).To(Succeed())
+
+		st := status.Convert(chain(ctx))
+		Expect(st.Code()).To(Equal(codes.ResourceExhausted))
+		Expect(st.Details()).To(HaveLen(2))
+		Expect(st.Details()[0].(*errdetails.ErrorInfo).Reason).To(Equal(ratelimit.ReasonRateLimited))
+		Expect(st.Details()[1].(*errdetails.RetryInfo).RetryDelay.AsDuration()).To(BeNumerically(">", 0))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("limits requests from the same host", func() {
+		Expect(chain(peerContext("127.0.0.1"))).To(Succeed())
+		Expect(status.Code(chain(peerContext("127.0.0.1")))).To(Equal(codes.ResourceExhausted))
+	})
+
+	It("charges authenticated clients once, by their username", func() {
+		caller = &api.Caller{Username: "jane"}
+		Expect(chain(peerContext("10.0.0.1"))).To(Succeed())
+		Expect(status.Code(chain(peerContext("10.0.0.2")))).To(Equal(codes.ResourceExhausted))
+
+		By("not charging their address")
+		caller = nil
+		Expect(chain(peerContext("10.0.0.1"))).To(Succeed())
+	})
+
+	It("checks the address of clients before authenticating them", func() {
+		authErr = status.Error(codes.Unauthenticated, "nope")
+		Expect(status.Code(chain(peerContext("10.0.0.1")))).To(Equal(codes.Unauthenticated))
+
+		By("charging the address of rejected credentials")
+		err := chain(peerContext("10.0.0.1"))
+		Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		Expect(errors.Is(err, authErr)).To(BeFalse())
+	})
+
+	It("identifies the clients of the in-process gateway by the forwarded address", func() {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: bufconnAddr{}})
+		forwarded := func(value string) context.Context {
+			return metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", value))
+		}
+		Expect(chain(forwarded("1.2.3.4, 10.0.0.1"))).To(Succeed())
+		Expect(status.Code(chain(forwarded("10.0.0.1")))).To(Equal(codes.ResourceExhausted))
+		Expect(chain(forwarded("10.0.0.2"))).To(Succeed())
+
+		By("not limiting in-memory requests without a forwarded address")
+		Expect(chain(ctx)).To(Succeed())
+		Expect(chain(ctx)).To(Succeed())
+	})
+
+	It("identifies the clients of the gateway dialing over loopback by the forwarded address", func() {
+		forwarded := func(peerIP, value string) context.Context {
+			return metadata.NewIncomingContext(peerContext(peerIP), metadata.Pairs("x-forwarded-for", value))
+		}
+		Expect(chain(forwarded("127.0.0.1", "10.0.0.1"))).To(Succeed())
+		Expect(status.Code(chain(forwarded("127.0.0.1", "10.0.0.1")))).To(Equal(codes.ResourceExhausted))
+		Expect(chain(forwarded("::1", "10.0.0.2"))).To(Succeed())
+
+		By("not trusting the forwarded address of other clients")
+		Expect(chain(forwarded("10.0.0.3", "10.0.0.4"))).To(Succeed())
+		Expect(status.Code(chain(forwarded("10.0.0.3", "10.0.0.5")))).To(Equal(codes.ResourceExhausted))
+	})
+})
+
+// bufconnAddr is the address of an in-memory connection.
+type bufconnAddr struct{}
+
+func (bufconnAddr) Network() string { return "bufconn" }
+func (bufconnAddr) String() string  { return "bufconn" }
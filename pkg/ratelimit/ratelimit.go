@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"sigs.k8s.io/yaml"
+)
+
+// maxClients is the number of tracked clients above which idle clients are forgotten.
+const maxClients = 4096
+
+// Quota is the rate at which a client may send requests.
+type Quota struct {
+	// RequestsPerSecond is the sustained rate of requests. Zero means unlimited.
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	// Burst is the number of requests which may be sent at once.
+	Burst int `json:"burst"`
+}
+
+// Config configures a Limiter.
+type Config struct {
+	// Quota applies to every client without an override.
+	Quota `json:",inline"`
+	// Clients overrides the quota of single clients, keyed by username or IP address.
+	Clients map[string]Quota `json:"clients,omitempty"`
+}
+
+// LoadConfig reads a Config from a YAML file, for example a mounted ConfigMap.
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read rate limit config: %w", err)
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse rate limit config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Limiter keeps a token bucket per client.
+type Limiter struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// New returns a Limiter enforcing the quotas of config.
+func New(config Config) *Limiter {
+	return &Limiter{
+		config:  config,
+		now:     time.Now,
+		clients: map[string]*client{},
+	}
+}
+
+// Allow reports whether the client identified by key may send a request now and uses up its quota
+// if so. If not, it returns how long the client should wait before retrying.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.take(key, true)
+}
+
+// Check reports whether the client identified by key may send a request now, like Allow, but leaves
+// its quota untouched.
+func (l *Limiter) Check(key string) (bool, time.Duration) {
+	return l.take(key, false)
+}
+
+func (l *Limiter) take(key string, use bool) (bool, time.Duration) {
+	quota, ok := l.config.Clients[key]
+	if !ok {
+		quota = l.config.Quota
+	}
+	if quota.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	c := l.client(key, quota, now)
+	reservation := c.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		// the burst is too small to ever allow a request
+		return false, time.Second
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	if !use {
+		reservation.CancelAt(now)
+	}
+	return true, 0
+}
+
+func (l *Limiter) client(key string, quota Quota, now time.Time) *client {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.clients[key]; ok {
+		c.lastSeen = now
+		return c
+	}
+	if len(l.clients) >= maxClients {
+		l.evict(now)
+	}
+	c := &client{
+		limiter:  rate.NewLimiter(rate.Limit(quota.RequestsPerSecond), quota.Burst),
+		lastSeen: now,
+	}
+	l.clients[key] = c
+	return c
+}
+
+// evict forgets clients whose bucket has been full again for a while, as they would start with a
+// full bucket anyway.
+func (l *Limiter) evict(now time.Time) {
+	for key, c := range l.clients {
+		refill := time.Duration(float64(c.limiter.Burst()) / float64(c.limiter.Limit()) * float64(time.Second))
+		if now.Sub(c.lastSeen) > refill {
+			delete(l.clients, key)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package ratelimit_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/weaveworks/profiles/pkg/ratelimit"
+)
+
+var _ = Describe("Limiter", func() {
+	var limiter *ratelimit.Limiter
+
+	BeforeEach(func() {
+		limiter = ratelimit.New(ratelimit.Config{
+			Quota: ratelimit.Quota{RequestsPerSecond: 1, Burst: 2},
+			Clients: map[string]ratelimit.Quota{
+				"pipeline": {RequestsPerSecond: 100, Burst: 5},
+				"blocked":  {RequestsPerSecond: 1, Burst: 0},
+			},
+		})
+	})
+
+	It("allows requests up to the burst and then asks the client to retry", func() {
+		Expect(limiter.Allow("10.0.0.1")).To(BeTrue())
+		Expect(limiter.Allow("10.0.0.1")).To(BeTrue())
+
+		allowed, retryAfter := limiter.Allow("10.0.0.1")
+		Expect(allowed).To(BeFalse())
+		Expect(retryAfter).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+	})
+
+	It("checks clients without using their quota", func() {
+		for i := 0; i < 3; i++ {
+			Expect(limiter.Check("10.0.0.1")).To(BeTrue())
+		}
+		Expect(limiter.Allow("10.0.0.1")).To(BeTrue())
+		Expect(limiter.Allow("10.0.0.1")).To(BeTrue())
+
+		allowed, retryAfter := limiter.Check("10.0.0.1")
+		Expect(allowed).To(BeFalse())
+		Expect(retryAfter).To(BeNumerically(">", 0))
+	})
+
+	It("keeps a bucket per client", func() {
+		Expect(limiter.Allow("10.0.0.1")).To(BeTrue())
+		Expect(limiter.Allow("10.0.0.1")).To(BeTrue())
+		Expect(limiter.Allow("10.0.0.2")).To(BeTrue())
+	})
+
+	It("applies the quotas of single clients", func() {
+		for i := 0; i < 5; i++ {
+			Expect(limiter.Allow("pipeline")).To(BeTrue())
+		}
+		allowed, _ := limiter.Allow("blocked")
+		Expect(allowed).To(BeFalse())
+	})
+
+	When("no rate is set", func() {
+		It("allows all requests", func() {
+			limiter = ratelimit.New(ratelimit.Config{})
+			for i := 0; i < 100; i++ {
+				Expect(limiter.Allow("10.0.0.1")).To(BeTrue())
+			}
+		})
+	})
+})
+
+var _ = Describe("LoadConfig", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "ratelimit")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("reads the config from a YAML file", func() {
+		path := filepath.Join(dir, "config.yaml")
+		Expect(ioutil.WriteFile(path, []byte(`
+requestsPerSecond: 10
+burst: 20
+clients:
+  system:serviceaccount:ci:pipeline:
+    requestsPerSecond: 50
+    burst: 100
+`), 0600)).To(Succeed())
+
+		config, err := ratelimit.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(Equal(ratelimit.Config{
+			Quota: ratelimit.Quota{RequestsPerSecond: 10, Burst: 20},
+			Clients: map[string]ratelimit.Quota{
+				"system:serviceaccount:ci:pipeline": {RequestsPerSecond: 50, Burst: 100},
+			},
+		}))
+	})
+
+	When("the config has unknown fields", func() {
+		It("returns an error", func() {
+			path := filepath.Join(dir, "config.yaml")
+			Expect(ioutil.WriteFile(path, []byte("requestPerSecond: 10\n"), 0600)).To(Succeed())
+
+			_, err := ratelimit.LoadConfig(path)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse rate limit config")))
+		})
+	})
+})
@@ -0,0 +1,148 @@
+package receiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var errInvalidSignature = errors.New("invalid signature")
+
+// push is the push of a tag to a repository, identified by its URLs. The tag is empty if the webhook
+// isn't for a tag.
+type push struct {
+	urls []string
+	tag  string
+}
+
+// githubPayload is the payload of the push and create events of GitHub and Gitea.
+type githubPayload struct {
+	Ref        string `json:"ref"`
+	RefType    string `json:"ref_type"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+// gitlabPayload is the payload of the tag push events of GitLab.
+type gitlabPayload struct {
+	Ref     string `json:"ref"`
+	Project struct {
+		HTTPURL string `json:"git_http_url"`
+		SSHURL  string `json:"git_ssh_url"`
+		WebURL  string `json:"web_url"`
+	} `json:"project"`
+}
+
+// genericPayload is the payload of generic webhooks.
+type genericPayload struct {
+	URL string `json:"url"`
+	Tag string `json:"tag"`
+}
+
+// parsePush verifies the webhook and returns the push it reports. The sender is detected from the headers:
+//   - Gitea signs the payload with the secret in X-Gitea-Signature
+//   - GitHub signs the payload with the secret in X-Hub-Signature-256
+//   - GitLab sends the secret in X-Gitlab-Token
+//   - other senders sign the payload with the secret in X-Signature, which is sha256=<hex HMAC>, like GitHub.
+//     The payload is {"url": "<repository URL>", "tag": "<tag>"}
+func parsePush(header http.Header, body, secret []byte) (push, error) {
+	switch {
+	case header.Get("X-Gitea-Event") != "":
+		if err := verifyHMAC(secret, body, header.Get("X-Gitea-Signature")); err != nil {
+			return push{}, err
+		}
+		return parseGitHub(header.Get("X-Gitea-Event"), body)
+	case header.Get("X-GitHub-Event") != "":
+		if err := verifyHMAC(secret, body, strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")); err != nil {
+			return push{}, err
+		}
+		return parseGitHub(header.Get("X-GitHub-Event"), body)
+	case header.Get("X-Gitlab-Event") != "":
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), secret) != 1 {
+			return push{}, errInvalidSignature
+		}
+		return parseGitLab(header.Get("X-Gitlab-Event"), body)
+	default:
+		if err := verifyHMAC(secret, body, strings.TrimPrefix(header.Get("X-Signature"), "sha256=")); err != nil {
+			return push{}, err
+		}
+		var payload genericPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return push{}, fmt.Errorf("failed to decode payload: %w", err)
+		}
+		if payload.URL == "" {
+			return push{}, fmt.Errorf("payload has no url")
+		}
+		return push{urls: []string{payload.URL}, tag: payload.Tag}, nil
+	}
+}
+
+// parseGitHub parses push and create events of GitHub and Gitea, other events don't push a tag.
+func parseGitHub(event string, body []byte) (push, error) {
+	if event != "push" && event != "create" {
+		return push{}, nil
+	}
+	var payload githubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return push{}, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	p := push{urls: nonEmpty(payload.Repository.CloneURL, payload.Repository.SSHURL, payload.Repository.HTMLURL)}
+	switch {
+	case event == "create" && payload.RefType == "tag":
+		p.tag = payload.Ref
+	case event == "push" && strings.HasPrefix(payload.Ref, "refs/tags/"):
+		p.tag = strings.TrimPrefix(payload.Ref, "refs/tags/")
+	}
+	return p, nil
+}
+
+// parseGitLab parses tag push events of GitLab, other events don't push a tag.
+func parseGitLab(event string, body []byte) (push, error) {
+	if event != "Tag Push Hook" {
+		return push{}, nil
+	}
+	var payload gitlabPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return push{}, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return push{
+		urls: nonEmpty(payload.Project.HTTPURL, payload.Project.SSHURL, payload.Project.WebURL),
+		tag:  strings.TrimPrefix(payload.Ref, "refs/tags/"),
+	}, nil
+}
+
+// verifyHMAC verifies that signature is the hex encoded HMAC-SHA256 of the body with the secret.
+func verifyHMAC(secret, body []byte, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("%w: payload isn't signed", errInvalidSignature)
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidSignature, err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
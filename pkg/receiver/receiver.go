@@ -0,0 +1,166 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+)
+
+// maxPayloadSize limits the size of webhook payloads.
+const maxPayloadSize = 5 << 20
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+//counterfeiter:generate -o fakes/fake_kubernetes.go . Kubernetes
+// Kubernetes lists the catalog sources and requests their reconciliation.
+type Kubernetes interface {
+	List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error
+	Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error
+}
+
+// Receiver receives the push webhooks of git servers. When a tag is pushed to a repository, it
+// requests the reconciliation of the catalog sources scanning the repository, which rescans them.
+type Receiver struct {
+	logger  logr.Logger
+	kClient Kubernetes
+	secret  []byte
+}
+
+// New returns a Receiver verifying webhooks with the secret. The secret must not be empty, as GitLab
+// webhooks without a token would be accepted otherwise.
+func New(logger logr.Logger, kClient Kubernetes, secret []byte) (*Receiver, error) {
+	if len(bytes.TrimSpace(secret)) == 0 {
+		return nil, errors.New("webhook secret must not be empty")
+	}
+	return &Receiver{
+		logger:  logger,
+		kClient: kClient,
+		secret:  secret,
+	}, nil
+}
+
+// ServeHTTP handles a webhook of GitHub, GitLab, Gitea or a generic webhook, see parsePush.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "webhooks must be sent with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read payload: %s", err), http.StatusBadRequest)
+		return
+	}
+	push, err := parsePush(req.Header, body, r.secret)
+	if errors.Is(err, errInvalidSignature) {
+		r.logger.Info("rejected webhook", "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if push.tag == "" {
+		fmt.Fprintln(w, "ignoring event, no tag was pushed")
+		return
+	}
+
+	sources, err := r.requestReconcile(req.Context(), push.urls)
+	if err != nil {
+		r.logger.Error(err, "failed to request the reconciliation of catalog sources", "urls", push.urls)
+		http.Error(w, "failed to request the reconciliation of catalog sources", http.StatusInternalServerError)
+		return
+	}
+	r.logger.Info("requested the reconciliation of catalog sources", "urls", push.urls, "tag", push.tag, "sources", sources)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "requested the reconciliation of %d catalog sources\n", len(sources))
+}
+
+// requestReconcile annotates the catalog sources scanning any of the repositories with the time of the
+// request, which triggers their reconciliation. It returns the names of the annotated sources.
+func (r *Receiver) requestReconcile(ctx context.Context, urls []string) ([]string, error) {
+	var sources []client.Object
+	namespaced := &profilesv1.ProfileCatalogSourceList{}
+	if err := r.kClient.List(ctx, namespaced); err != nil {
+		return nil, fmt.Errorf("failed to list catalog sources: %w", err)
+	}
+	for i := range namespaced.Items {
+		if scansAny(namespaced.Items[i].Spec, urls) {
+			sources = append(sources, &namespaced.Items[i])
+		}
+	}
+	cluster := &profilesv1.ClusterProfileCatalogSourceList{}
+	if err := r.kClient.List(ctx, cluster); err != nil {
+		return nil, fmt.Errorf("failed to list cluster catalog sources: %w", err)
+	}
+	for i := range cluster.Items {
+		if scansAny(cluster.Items[i].Spec, urls) {
+			sources = append(sources, &cluster.Items[i])
+		}
+	}
+
+	requestedAt := time.Now().Format(time.RFC3339Nano)
+	var names []string
+	for _, source := range sources {
+		patch := client.MergeFrom(source.DeepCopyObject().(client.Object))
+		annotations := source.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[meta.ReconcileRequestAnnotation] = requestedAt
+		source.SetAnnotations(annotations)
+		if err := r.kClient.Patch(ctx, source, patch); err != nil {
+			return names, fmt.Errorf("failed to annotate %s: %w", client.ObjectKeyFromObject(source), err)
+		}
+		names = append(names, client.ObjectKeyFromObject(source).String())
+	}
+	return names, nil
+}
+
+// scansAny returns whether the catalog source scans any of the repositories. URLs of the same repository
+// match regardless of their scheme, credentials, port and .git suffix.
+func scansAny(spec profilesv1.ProfileCatalogSourceSpec, urls []string) bool {
+	for _, repo := range spec.Repos {
+		for _, url := range urls {
+			if repositoryKey(repo.URL) == repositoryKey(url) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// repositoryKey returns the host and path of the repository of the URL, for example
+// github.com/weaveworks/profiles-examples for both https://github.com/weaveworks/profiles-examples.git
+// and git@github.com:weaveworks/profiles-examples.git.
+func repositoryKey(url string) string {
+	key := url
+	if i := strings.Index(key, "://"); i >= 0 {
+		key = key[i+3:]
+	} else if colon := strings.Index(key, ":"); colon >= 0 && !strings.Contains(key[:colon], "/") {
+		// scp-like syntax of ssh URLs, user@host:path
+		key = key[:colon] + "/" + key[colon+1:]
+	}
+	host, path := key, ""
+	if i := strings.Index(key, "/"); i >= 0 {
+		host, path = key[:i], key[i:]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git")
+	return strings.ToLower(host + path)
+}
@@ -0,0 +1,13 @@
+package receiver_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestReceiver(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Receiver Suite")
+}
@@ -0,0 +1,179 @@
+package receiver_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/fluxcd/pkg/apis/meta"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/receiver"
+	"github.com/weaveworks/profiles/pkg/receiver/fakes"
+)
+
+const secret = "webhook-secret"
+
+var _ = Describe("Receiver", func() {
+	var (
+		kClient *fakes.FakeKubernetes
+		r       *receiver.Receiver
+	)
+
+	BeforeEach(func() {
+		kClient = new(fakes.FakeKubernetes)
+		kClient.ListStub = func(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+			switch list := list.(type) {
+			case *profilesv1.ProfileCatalogSourceList:
+				list.Items = []profilesv1.ProfileCatalogSource{
+					catalogSource("team-a", "examples", "https://github.com/weaveworks/profiles-examples"),
+					catalogSource("team-b", "other", "https://github.com/weaveworks/other"),
+					// repositories whose names match the name of profiles-examples
+					catalogSource("team-c", "owner", "https://github.com/weaveworks-profiles/examples"),
+					catalogSource("team-c", "host", "https://gitlab.com/weaveworks/profiles-examples"),
+				}
+			case *profilesv1.ClusterProfileCatalogSourceList:
+				list.Items = []profilesv1.ClusterProfileCatalogSource{{
+					ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+					Spec: profilesv1.ProfileCatalogSourceSpec{Repos: []profilesv1.Repository{
+						{URL: "ssh://git@github.com/weaveworks/profiles-examples.git"},
+					}},
+				}}
+			}
+			return nil
+		}
+		var err error
+		r, err = receiver.New(logr.Discard(), kClient, []byte(secret))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects an empty secret", func() {
+		_, err := receiver.New(logr.Discard(), kClient, nil)
+		Expect(err).To(MatchError("webhook secret must not be empty"))
+		_, err = receiver.New(logr.Discard(), kClient, []byte(" \n"))
+		Expect(err).To(MatchError("webhook secret must not be empty"))
+	})
+
+	// send sends the payload to the receiver with the headers and returns the response.
+	send := func(payload string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(payload))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// patched returns the names of the patched catalog sources and checks they are annotated.
+	patched := func() []string {
+		var names []string
+		for i := 0; i < kClient.PatchCallCount(); i++ {
+			_, obj, _, _ := kClient.PatchArgsForCall(i)
+			Expect(obj.GetAnnotations()).To(HaveKey(meta.ReconcileRequestAnnotation))
+			names = append(names, client.ObjectKeyFromObject(obj).String())
+		}
+		return names
+	}
+
+	When("GitHub pushes a tag", func() {
+		payload := `{"ref": "refs/tags/nginx/v0.1.0", "repository": {"clone_url": "https://github.com/weaveworks/profiles-examples.git", "ssh_url": "git@github.com:weaveworks/profiles-examples.git"}}`
+
+		It("requests the reconciliation of the catalog sources scanning the repository", func() {
+			w := send(payload, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(payload)})
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+			Expect(patched()).To(ConsistOf("team-a/examples", "/shared"))
+		})
+
+		It("rejects invalid signatures", func() {
+			w := send(payload, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign("other")})
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			w = send(payload, map[string]string{"X-GitHub-Event": "push"})
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+			Expect(kClient.PatchCallCount()).To(Equal(0))
+		})
+
+		It("ignores pushes of branches", func() {
+			branch := `{"ref": "refs/heads/main", "repository": {"clone_url": "https://github.com/weaveworks/profiles-examples.git"}}`
+			w := send(branch, map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(branch)})
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(kClient.ListCallCount()).To(Equal(0))
+		})
+	})
+
+	When("a tag is pushed to a repository sharing its name with other repositories", func() {
+		It("only requests the reconciliation of the catalog sources scanning the repository", func() {
+			payload := `{"url": "ssh://git@gitlab.com:2222/weaveworks/profiles-examples.git", "tag": "v1.0.0"}`
+			w := send(payload, map[string]string{"X-Signature": "sha256=" + sign(payload)})
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+			Expect(patched()).To(ConsistOf("team-c/host"))
+		})
+	})
+
+	When("Gitea creates a tag", func() {
+		It("requests the reconciliation of the catalog sources scanning the repository", func() {
+			payload := `{"ref": "v0.2.0", "ref_type": "tag", "repository": {"clone_url": "https://github.com/weaveworks/other"}}`
+			w := send(payload, map[string]string{"X-Gitea-Event": "create", "X-GitHub-Event": "create", "X-Gitea-Signature": sign(payload)})
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+			Expect(patched()).To(ConsistOf("team-b/other"))
+		})
+	})
+
+	When("GitLab pushes a tag", func() {
+		payload := `{"ref": "refs/tags/v0.2.0", "project": {"git_http_url": "https://github.com/weaveworks/other.git"}}`
+
+		It("requests the reconciliation of the catalog sources scanning the repository", func() {
+			w := send(payload, map[string]string{"X-Gitlab-Event": "Tag Push Hook", "X-Gitlab-Token": secret})
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+			Expect(patched()).To(ConsistOf("team-b/other"))
+		})
+
+		It("rejects invalid tokens", func() {
+			w := send(payload, map[string]string{"X-Gitlab-Event": "Tag Push Hook", "X-Gitlab-Token": "wrong"})
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	When("a generic webhook is sent", func() {
+		It("requests the reconciliation of the catalog sources scanning the repository", func() {
+			payload := `{"url": "https://github.com/weaveworks/profiles-examples", "tag": "v1.0.0"}`
+			w := send(payload, map[string]string{"X-Signature": "sha256=" + sign(payload)})
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+			Expect(patched()).To(ConsistOf("team-a/examples", "/shared"))
+		})
+
+		It("requires the url of the repository", func() {
+			payload := `{"tag": "v1.0.0"}`
+			w := send(payload, map[string]string{"X-Signature": "sha256=" + sign(payload)})
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	It("only accepts POST", func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hook", nil))
+		Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
+
+func catalogSource(namespace, name, url string) profilesv1.ProfileCatalogSource {
+	return profilesv1.ProfileCatalogSource{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       profilesv1.ProfileCatalogSourceSpec{Repos: []profilesv1.Repository{{URL: url}}},
+	}
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
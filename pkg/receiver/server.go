@@ -0,0 +1,60 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const timeout = 10 * time.Second
+
+// readHeaderTimeout limits how long clients may take to send the headers of a webhook.
+const readHeaderTimeout = 10 * time.Second
+
+// Server serves the webhook receiver.
+type Server struct {
+	logger logr.Logger
+	addr   string
+	server *http.Server
+}
+
+// NewServer returns a server serving the receiver at addr, under /hook.
+func NewServer(logger logr.Logger, addr string, receiver *Receiver) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/hook", receiver)
+	return &Server{
+		logger: logger,
+		addr:   addr,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           otelhttp.NewHandler(mux, "webhook-receiver"),
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+	}
+}
+
+// Start starts the server.
+func (s *Server) Start(ctx context.Context) error {
+	s.logger.Info(fmt.Sprintf("starting webhook receiver at %s", s.addr))
+	// ignore server is closing error because the server receives that on graceful shutdown.
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error(err, "unable to start webhook receiver")
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully shuts down the server.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Error(err, "Failed to gracefully shutdown server... terminating.")
+	}
+	s.logger.Info("server stopped")
+}
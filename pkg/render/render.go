@@ -0,0 +1,390 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta1"
+	"github.com/fluxcd/pkg/runtime/dependency"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/mirror"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultGitRepositoryName is the name of the GitOps repository of installations which don't set one
+	DefaultGitRepositoryName = "flux-system"
+	// DefaultGitRepositoryNamespace is the namespace of the GitOps repository of installations which don't set one
+	DefaultGitRepositoryNamespace = "flux-system"
+	// DefaultValuesKey is the key of the default values of a chart artifact in its ConfigMap
+	DefaultValuesKey = "default-values.yaml"
+)
+
+// interval is the reconcile interval of the rendered objects.
+var interval = metav1.Duration{Duration: time.Minute}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+//counterfeiter:generate -o fakes/fake_loader.go . Loader
+//Loader loads the definitions of nested profiles
+type Loader interface {
+	GetProfileDefinition(ctx context.Context, source profilesv1.Source) (*profilesv1.ProfileDefinition, error)
+}
+
+//Renderer renders the Flux objects which install a profile
+type Renderer struct {
+	loader    Loader
+	mirrorURL string
+	mirrors   map[string]string
+}
+
+//Option configures a Renderer
+type Option func(*Renderer)
+
+//WithMirrorURL makes the rendered GitRepositories fetch the profile repositories from the git mirror served
+//at baseURL, and loads nested profiles from the mirror, instead of the original repositories
+func WithMirrorURL(baseURL string) Option {
+	return func(r *Renderer) {
+		r.mirrorURL = baseURL
+	}
+}
+
+//WithRepositoryMirror makes the rendered GitRepositories of the repository at url fetch it from mirrorURL, for
+//example the URL the git mirror of the catalog controller lists for a profile. Profiles are still loaded from
+//the original repository
+func WithRepositoryMirror(url, mirrorURL string) Option {
+	return func(r *Renderer) {
+		if r.mirrors == nil {
+			r.mirrors = map[string]string{}
+		}
+		r.mirrors[url] = mirrorURL
+	}
+}
+
+//New returns a Renderer which loads nested profiles with the loader
+func New(loader Loader, opts ...Option) *Renderer {
+	r := &Renderer{loader: loader}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Render returns the Flux objects installing the profile definition as the installation. The
+// installation is defaulted like the defaulting webhook does. Its source is the location of the
+// definition, which objects of artifacts local to the profile repository reference. Values of chart
+// artifacts are read from the keys of the values ConfigMap matching their names, if given.
+func (r *Renderer) Render(ctx context.Context, installation *profilesv1.ProfileInstallation, def *profilesv1.ProfileDefinition, values *corev1.ConfigMap) ([]client.Object, error) {
+	installation = installation.DeepCopy()
+	installation.Default()
+
+	gitRepository := profilesv1.GitRepository{Name: DefaultGitRepositoryName, Namespace: DefaultGitRepositoryNamespace}
+	if installation.Spec.GitRepository != nil {
+		gitRepository = *installation.Spec.GitRepository
+	}
+
+	p := &profileRenderer{
+		Renderer:      r,
+		installation:  installation,
+		gitRepository: gitRepository,
+		values:        values,
+		objects:       map[string]bool{},
+	}
+	var source profilesv1.Source
+	if installation.Spec.Source != nil {
+		source = *installation.Spec.Source
+	}
+	var parents []string
+	if source.URL != "" {
+		parents = []string{sourceKey(source)}
+	}
+	if _, err := p.renderProfile(ctx, def, source, installation.Name, installation.Name, parents); err != nil {
+		return nil, err
+	}
+	return p.result, nil
+}
+
+// profileRenderer holds the state of rendering one installation.
+type profileRenderer struct {
+	*Renderer
+	installation  *profilesv1.ProfileInstallation
+	gitRepository profilesv1.GitRepository
+	values        *corev1.ConfigMap
+	// objects are the kinds and names of the rendered objects, result is in render order
+	objects map[string]bool
+	result  []client.Object
+}
+
+// renderProfile renders the artifacts of the profile. The names of the objects of each artifact are
+// prefixed with prefix, dir is their directory in the GitOps repository and parents are the sources
+// of the profiles which nest the profile. It returns the Kustomizations applying the profile.
+func (p *profileRenderer) renderProfile(ctx context.Context, def *profilesv1.ProfileDefinition, source profilesv1.Source, prefix, dir string, parents []string) ([]*kustomizev1.Kustomization, error) {
+	kustomizations := map[string][]*kustomizev1.Kustomization{}
+	var all []*kustomizev1.Kustomization
+	for _, artifact := range def.Spec.Artifacts {
+		name := objectName(prefix, artifact.Name)
+		artifactDir := path.Join(dir, "artifacts", artifact.Name)
+
+		var rendered []*kustomizev1.Kustomization
+		switch {
+		case artifact.Chart != nil:
+			kustomization, err := p.renderChart(artifact, source, name, artifactDir)
+			if err != nil {
+				return nil, err
+			}
+			rendered = []*kustomizev1.Kustomization{kustomization}
+		case artifact.Kustomize != nil:
+			if source.URL == "" {
+				return nil, fmt.Errorf("artifact %q is local to the profile repository, which requires the URL of the profile source", artifact.Name)
+			}
+			kustomization := p.kustomization(name, kustomizev1.CrossNamespaceSourceReference{
+				Kind:      sourcev1.GitRepositoryKind,
+				Name:      p.renderGitRepository(source),
+				Namespace: p.installation.Namespace,
+			}, path.Join(source.Path, artifact.Kustomize.Path))
+			rendered = []*kustomizev1.Kustomization{kustomization}
+		case artifact.Profile != nil && artifact.Profile.Source != nil:
+			nested, err := p.renderNestedProfile(ctx, *artifact.Profile.Source, name, artifactDir, parents)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render nested profile of artifact %q: %w", artifact.Name, err)
+			}
+			rendered = nested
+		default:
+			return nil, fmt.Errorf("artifact %q must set one of chart, kustomize or profile", artifact.Name)
+		}
+		kustomizations[artifact.Name] = rendered
+		all = append(all, rendered...)
+	}
+
+	// dependencies are resolved once all artifacts are rendered, artifacts may depend on later ones
+	for _, artifact := range def.Spec.Artifacts {
+		var dependsOn []dependency.CrossNamespaceDependencyReference
+		for _, dep := range artifact.DependsOn {
+			deps, ok := kustomizations[dep.Name]
+			if !ok {
+				return nil, fmt.Errorf("artifact %q depends on unknown artifact %q", artifact.Name, dep.Name)
+			}
+			for _, d := range deps {
+				dependsOn = append(dependsOn, dependency.CrossNamespaceDependencyReference{Name: d.Name, Namespace: d.Namespace})
+			}
+		}
+		for _, kustomization := range kustomizations[artifact.Name] {
+			kustomization.Spec.DependsOn = append(kustomization.Spec.DependsOn, dependsOn...)
+		}
+	}
+	return all, nil
+}
+
+// renderNestedProfile loads and renders the profile of a profile artifact.
+func (p *profileRenderer) renderNestedProfile(ctx context.Context, source profilesv1.Source, prefix, dir string, parents []string) ([]*kustomizev1.Kustomization, error) {
+	nested := &profilesv1.ProfileInstallation{Spec: profilesv1.ProfileInstallationSpec{Source: source.DeepCopy()}}
+	nested.Default()
+	source = *nested.Spec.Source
+
+	key := sourceKey(source)
+	for _, parent := range parents {
+		if parent == key {
+			return nil, fmt.Errorf("circular import of profile %s", key)
+		}
+	}
+
+	mirrored := source
+	mirrored.URL = mirror.RepositoryURL(p.mirrorURL, source.URL)
+	def, err := p.loader.GetProfileDefinition(ctx, mirrored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile %s: %w", key, err)
+	}
+	return p.renderProfile(ctx, def, source, prefix, dir, append(parents, key))
+}
+
+// renderChart renders the HelmRelease of a chart artifact, its source and default values, and the
+// Kustomization applying them from the GitOps repository.
+func (p *profileRenderer) renderChart(artifact profilesv1.Artifact, source profilesv1.Source, name, dir string) (*kustomizev1.Kustomization, error) {
+	chart := artifact.Chart
+	namespace := p.installation.Namespace
+	release := &helmv2.HelmRelease{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       helmv2.HelmReleaseKind,
+			APIVersion: helmv2.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: helmv2.HelmReleaseSpec{
+			Interval: interval,
+		},
+	}
+
+	if chart.Path != "" {
+		if source.URL == "" {
+			return nil, fmt.Errorf("artifact %q is local to the profile repository, which requires the URL of the profile source", artifact.Name)
+		}
+		release.Spec.Chart.Spec = helmv2.HelmChartTemplateSpec{
+			Chart: path.Join(source.Path, chart.Path),
+			SourceRef: helmv2.CrossNamespaceObjectReference{
+				Kind:      sourcev1.GitRepositoryKind,
+				Name:      p.renderGitRepository(source),
+				Namespace: namespace,
+			},
+		}
+	} else {
+		repository := &sourcev1.HelmRepository{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       sourcev1.HelmRepositoryKind,
+				APIVersion: sourcev1.GroupVersion.String(),
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: sourcev1.HelmRepositorySpec{
+				URL:      chart.URL,
+				Interval: interval,
+			},
+		}
+		p.add(repository)
+		release.Spec.Chart.Spec = helmv2.HelmChartTemplateSpec{
+			Chart:   chart.Name,
+			Version: chart.Version,
+			SourceRef: helmv2.CrossNamespaceObjectReference{
+				Kind:      sourcev1.HelmRepositoryKind,
+				Name:      repository.Name,
+				Namespace: namespace,
+			},
+		}
+	}
+
+	if chart.DefaultValues != "" {
+		defaultValues := &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      objectName(name, "defaultvalues"),
+				Namespace: namespace,
+			},
+			Data: map[string]string{DefaultValuesKey: chart.DefaultValues},
+		}
+		p.add(defaultValues)
+		release.Spec.ValuesFrom = append(release.Spec.ValuesFrom, helmv2.ValuesReference{
+			Kind:      defaultValues.Kind,
+			Name:      defaultValues.Name,
+			ValuesKey: DefaultValuesKey,
+		})
+	}
+	if p.values != nil {
+		if _, ok := p.values.Data[artifact.Name]; ok {
+			release.Spec.ValuesFrom = append(release.Spec.ValuesFrom, helmv2.ValuesReference{
+				Kind:      "ConfigMap",
+				Name:      p.values.Name,
+				ValuesKey: artifact.Name,
+			})
+		}
+	}
+	p.add(release)
+
+	return p.kustomization(name, kustomizev1.CrossNamespaceSourceReference{
+		Kind:      sourcev1.GitRepositoryKind,
+		Name:      p.gitRepository.Name,
+		Namespace: p.gitRepository.Namespace,
+	}, path.Join(dir, "helm-chart")), nil
+}
+
+// kustomization adds the Kustomization applying the path of the source.
+func (p *profileRenderer) kustomization(name string, sourceRef kustomizev1.CrossNamespaceSourceReference, sourcePath string) *kustomizev1.Kustomization {
+	kustomization := &kustomizev1.Kustomization{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       kustomizev1.KustomizationKind,
+			APIVersion: kustomizev1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: p.installation.Namespace,
+		},
+		Spec: kustomizev1.KustomizationSpec{
+			Interval:        interval,
+			Path:            sourcePath,
+			Prune:           true,
+			SourceRef:       sourceRef,
+			TargetNamespace: p.installation.Namespace,
+		},
+	}
+	p.add(kustomization)
+	return kustomization
+}
+
+// renderGitRepository adds the GitRepository of the profile source, unless an artifact already
+// added it, and returns its name.
+func (p *profileRenderer) renderGitRepository(source profilesv1.Source) string {
+	ref := source.Branch
+	if source.Tag != "" {
+		ref = source.Tag
+	}
+	urlParts := strings.Split(strings.TrimSuffix(source.URL, ".git"), "/")
+	name := objectName(p.installation.Name, urlParts[len(urlParts)-1], ref)
+
+	repository := &sourcev1.GitRepository{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       sourcev1.GitRepositoryKind,
+			APIVersion: sourcev1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: p.installation.Namespace,
+		},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:      p.repositoryURL(source.URL),
+			Interval: interval,
+			Reference: &sourcev1.GitRepositoryRef{
+				Branch: source.Branch,
+				Tag:    source.Tag,
+			},
+		},
+	}
+	p.add(repository)
+	return name
+}
+
+// repositoryURL returns the URL the rendered GitRepositories fetch the repository at url from.
+func (p *profileRenderer) repositoryURL(url string) string {
+	if mirrorURL, ok := p.mirrors[url]; ok {
+		return mirrorURL
+	}
+	return mirror.RepositoryURL(p.mirrorURL, url)
+}
+
+// add adds the object to the result unless an object of the same kind and name has been added.
+func (p *profileRenderer) add(obj client.Object) {
+	key := obj.GetObjectKind().GroupVersionKind().Kind + "/" + obj.GetName()
+	if p.objects[key] {
+		return
+	}
+	p.objects[key] = true
+	p.result = append(p.result, obj)
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// objectName joins the parts to a valid name of a Kubernetes object.
+func objectName(parts ...string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	return strings.Trim(name, "-")
+}
+
+// sourceKey identifies the profile at the source.
+func sourceKey(source profilesv1.Source) string {
+	ref := source.Branch
+	if source.Tag != "" {
+		ref = source.Tag
+	}
+	return fmt.Sprintf("%s@%s:%s", source.URL, ref, source.Path)
+}
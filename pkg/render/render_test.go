@@ -0,0 +1,290 @@
+package render_test
+
+import (
+	"context"
+	"errors"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
+	kustomizev1 "github.com/fluxcd/kustomize-controller/api/v1beta1"
+	"github.com/fluxcd/pkg/runtime/dependency"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/render"
+	"github.com/weaveworks/profiles/pkg/render/fakes"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Render", func() {
+	var (
+		fakeLoader   *fakes.FakeLoader
+		renderer     *render.Renderer
+		installation *profilesv1.ProfileInstallation
+		def          *profilesv1.ProfileDefinition
+		values       *corev1.ConfigMap
+	)
+
+	BeforeEach(func() {
+		fakeLoader = &fakes.FakeLoader{}
+		renderer = render.New(fakeLoader)
+		installation = &profilesv1.ProfileInstallation{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-nginx", Namespace: "team-a"},
+			Spec: profilesv1.ProfileInstallationSpec{
+				Source: &profilesv1.Source{
+					URL: "https://github.com/weaveworks/profiles-examples",
+					Tag: "nginx/v0.1.0",
+				},
+			},
+		}
+		def = &profilesv1.ProfileDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx"},
+			Spec: profilesv1.ProfileDefinitionSpec{
+				Artifacts: []profilesv1.Artifact{
+					{
+						Name: "server",
+						Chart: &profilesv1.Chart{
+							URL:           "https://charts.bitnami.com/bitnami",
+							Name:          "nginx",
+							Version:       "8.9.1",
+							DefaultValues: "replicaCount: 2",
+						},
+					},
+					{
+						Name:  "local-chart",
+						Chart: &profilesv1.Chart{Path: "chart"},
+					},
+					{
+						Name:      "config",
+						Kustomize: &profilesv1.Kustomize{Path: "config"},
+						DependsOn: []profilesv1.DependsOn{{Name: "server"}, {Name: "local-chart"}},
+					},
+				},
+			},
+		}
+		values = nil
+	})
+
+	It("renders the Flux objects of the artifacts", func() {
+		objects, err := renderer.Render(context.TODO(), installation, def, values)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kindsAndNames(objects)).To(Equal([]string{
+			"HelmRepository/my-nginx-server",
+			"ConfigMap/my-nginx-server-defaultvalues",
+			"HelmRelease/my-nginx-server",
+			"Kustomization/my-nginx-server",
+			"GitRepository/my-nginx-profiles-examples-nginx-v0-1-0",
+			"HelmRelease/my-nginx-local-chart",
+			"Kustomization/my-nginx-local-chart",
+			"Kustomization/my-nginx-config",
+		}))
+
+		helmRepository := objects[0].(*sourcev1.HelmRepository)
+		Expect(helmRepository.Namespace).To(Equal("team-a"))
+		Expect(helmRepository.Spec.URL).To(Equal("https://charts.bitnami.com/bitnami"))
+
+		defaultValues := objects[1].(*corev1.ConfigMap)
+		Expect(defaultValues.Data).To(Equal(map[string]string{render.DefaultValuesKey: "replicaCount: 2"}))
+
+		release := objects[2].(*helmv2.HelmRelease)
+		Expect(release.Spec.Chart.Spec).To(Equal(helmv2.HelmChartTemplateSpec{
+			Chart:     "nginx",
+			Version:   "8.9.1",
+			SourceRef: helmv2.CrossNamespaceObjectReference{Kind: sourcev1.HelmRepositoryKind, Name: "my-nginx-server", Namespace: "team-a"},
+		}))
+		Expect(release.Spec.ValuesFrom).To(ConsistOf(helmv2.ValuesReference{
+			Kind:      "ConfigMap",
+			Name:      "my-nginx-server-defaultvalues",
+			ValuesKey: render.DefaultValuesKey,
+		}))
+
+		wrapper := objects[3].(*kustomizev1.Kustomization)
+		Expect(wrapper.Spec.Path).To(Equal("my-nginx/artifacts/server/helm-chart"))
+		Expect(wrapper.Spec.SourceRef).To(Equal(kustomizev1.CrossNamespaceSourceReference{
+			Kind:      sourcev1.GitRepositoryKind,
+			Name:      render.DefaultGitRepositoryName,
+			Namespace: render.DefaultGitRepositoryNamespace,
+		}))
+
+		gitRepository := objects[4].(*sourcev1.GitRepository)
+		Expect(gitRepository.Spec.URL).To(Equal("https://github.com/weaveworks/profiles-examples"))
+		Expect(gitRepository.Spec.Reference.Tag).To(Equal("nginx/v0.1.0"))
+
+		localRelease := objects[5].(*helmv2.HelmRelease)
+		Expect(localRelease.Spec.Chart.Spec.Chart).To(Equal("nginx/chart"))
+		Expect(localRelease.Spec.Chart.Spec.SourceRef.Name).To(Equal(gitRepository.Name))
+
+		config := objects[7].(*kustomizev1.Kustomization)
+		Expect(config.Spec.Path).To(Equal("nginx/config"))
+		Expect(config.Spec.SourceRef.Name).To(Equal(gitRepository.Name))
+		Expect(config.Spec.TargetNamespace).To(Equal("team-a"))
+		Expect(config.Spec.DependsOn).To(Equal([]dependency.CrossNamespaceDependencyReference{
+			{Name: "my-nginx-server", Namespace: "team-a"},
+			{Name: "my-nginx-local-chart", Namespace: "team-a"},
+		}))
+	})
+
+	When("a values ConfigMap is given", func() {
+		BeforeEach(func() {
+			values = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-values"},
+				Data:       map[string]string{"local-chart": "replicaCount: 3"},
+			}
+		})
+
+		It("reads the values of the chart artifacts with a key from it", func() {
+			objects, err := renderer.Render(context.TODO(), installation, def, values)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects[2].(*helmv2.HelmRelease).Spec.ValuesFrom).To(HaveLen(1))
+			Expect(objects[5].(*helmv2.HelmRelease).Spec.ValuesFrom).To(ConsistOf(helmv2.ValuesReference{
+				Kind:      "ConfigMap",
+				Name:      "my-values",
+				ValuesKey: "local-chart",
+			}))
+		})
+	})
+
+	When("the profile nests another profile", func() {
+		BeforeEach(func() {
+			def.Spec.Artifacts = []profilesv1.Artifact{
+				{
+					Name: "nested",
+					Profile: &profilesv1.Profile{Source: &profilesv1.Source{
+						URL: "https://github.com/weaveworks/nested-profile",
+						Tag: "bitnami/v0.2.0",
+					}},
+				},
+				{
+					Name:      "config",
+					Kustomize: &profilesv1.Kustomize{Path: "config"},
+					DependsOn: []profilesv1.DependsOn{{Name: "nested"}},
+				},
+			}
+			fakeLoader.GetProfileDefinitionReturns(&profilesv1.ProfileDefinition{
+				Spec: profilesv1.ProfileDefinitionSpec{
+					Artifacts: []profilesv1.Artifact{
+						{Name: "crds", Kustomize: &profilesv1.Kustomize{Path: "crds"}},
+						{Name: "server", Chart: &profilesv1.Chart{Path: "chart"}},
+					},
+				},
+			}, nil)
+		})
+
+		It("renders the artifacts of the nested profile with the name of the artifact as prefix", func() {
+			objects, err := renderer.Render(context.TODO(), installation, def, values)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLoader.GetProfileDefinitionCallCount()).To(Equal(1))
+			_, source := fakeLoader.GetProfileDefinitionArgsForCall(0)
+			Expect(source).To(Equal(profilesv1.Source{
+				URL:  "https://github.com/weaveworks/nested-profile",
+				Tag:  "bitnami/v0.2.0",
+				Path: "bitnami",
+			}))
+
+			Expect(kindsAndNames(objects)).To(Equal([]string{
+				"GitRepository/my-nginx-nested-profile-bitnami-v0-2-0",
+				"Kustomization/my-nginx-nested-crds",
+				"HelmRelease/my-nginx-nested-server",
+				"Kustomization/my-nginx-nested-server",
+				"GitRepository/my-nginx-profiles-examples-nginx-v0-1-0",
+				"Kustomization/my-nginx-config",
+			}))
+			Expect(objects[1].(*kustomizev1.Kustomization).Spec.Path).To(Equal("bitnami/crds"))
+			Expect(objects[3].(*kustomizev1.Kustomization).Spec.Path).To(Equal("my-nginx/artifacts/nested/artifacts/server/helm-chart"))
+			Expect(objects[5].(*kustomizev1.Kustomization).Spec.DependsOn).To(Equal([]dependency.CrossNamespaceDependencyReference{
+				{Name: "my-nginx-nested-crds", Namespace: "team-a"},
+				{Name: "my-nginx-nested-server", Namespace: "team-a"},
+			}))
+		})
+
+		When("the repositories are mirrored", func() {
+			It("fetches the profiles from the mirror", func() {
+				objects, err := render.New(fakeLoader, render.WithMirrorURL("http://git-mirror:8090")).Render(context.TODO(), installation, def, values)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, source := fakeLoader.GetProfileDefinitionArgsForCall(0)
+				Expect(source.URL).To(Equal("http://git-mirror:8090/a08bee5af234ea6e-github.com-weaveworks-nested-profile.git"))
+				Expect(objects[0].GetName()).To(Equal("my-nginx-nested-profile-bitnami-v0-2-0"))
+				Expect(objects[0].(*sourcev1.GitRepository).Spec.URL).To(Equal("http://git-mirror:8090/a08bee5af234ea6e-github.com-weaveworks-nested-profile.git"))
+				Expect(objects[4].(*sourcev1.GitRepository).Spec.URL).To(Equal("http://git-mirror:8090/ab8914722fee2066-github.com-weaveworks-profiles-examples.git"))
+			})
+		})
+
+		When("the catalog lists the mirror of the profile repository", func() {
+			It("fetches the profile repository from the mirror", func() {
+				objects, err := render.New(fakeLoader, render.WithRepositoryMirror(
+					"https://github.com/weaveworks/profiles-examples", "http://git-mirror:8090/profiles-examples.git",
+				)).Render(context.TODO(), installation, def, values)
+				Expect(err).NotTo(HaveOccurred())
+
+				By("loading the profiles from the original repositories")
+				_, source := fakeLoader.GetProfileDefinitionArgsForCall(0)
+				Expect(source.URL).To(Equal("https://github.com/weaveworks/nested-profile"))
+				Expect(objects[0].(*sourcev1.GitRepository).Spec.URL).To(Equal("https://github.com/weaveworks/nested-profile"))
+				Expect(objects[4].(*sourcev1.GitRepository).Spec.URL).To(Equal("http://git-mirror:8090/profiles-examples.git"))
+			})
+		})
+
+		When("the nested profile nests the profile", func() {
+			BeforeEach(func() {
+				fakeLoader.GetProfileDefinitionReturns(&profilesv1.ProfileDefinition{
+					Spec: profilesv1.ProfileDefinitionSpec{
+						Artifacts: []profilesv1.Artifact{
+							{Name: "parent", Profile: &profilesv1.Profile{Source: installation.Spec.Source}},
+						},
+					},
+				}, nil)
+			})
+
+			It("fails", func() {
+				_, err := renderer.Render(context.TODO(), installation, def, values)
+				Expect(err).To(MatchError(ContainSubstring("circular import of profile https://github.com/weaveworks/profiles-examples@nginx/v0.1.0:nginx")))
+			})
+		})
+
+		When("loading the nested profile fails", func() {
+			BeforeEach(func() {
+				fakeLoader.GetProfileDefinitionReturns(nil, errors.New("boom"))
+			})
+
+			It("fails", func() {
+				_, err := renderer.Render(context.TODO(), installation, def, values)
+				Expect(err).To(MatchError(ContainSubstring(`failed to render nested profile of artifact "nested"`)))
+				Expect(err).To(MatchError(ContainSubstring("boom")))
+			})
+		})
+	})
+
+	When("an artifact depends on an unknown artifact", func() {
+		BeforeEach(func() {
+			def.Spec.Artifacts[2].DependsOn = []profilesv1.DependsOn{{Name: "nothing"}}
+		})
+
+		It("fails", func() {
+			_, err := renderer.Render(context.TODO(), installation, def, values)
+			Expect(err).To(MatchError(`artifact "config" depends on unknown artifact "nothing"`))
+		})
+	})
+
+	When("the installation has no source", func() {
+		BeforeEach(func() {
+			installation.Spec.Source = nil
+		})
+
+		It("fails to render artifacts local to the profile repository", func() {
+			_, err := renderer.Render(context.TODO(), installation, def, values)
+			Expect(err).To(MatchError(ContainSubstring(`artifact "local-chart" is local to the profile repository`)))
+		})
+	})
+})
+
+func kindsAndNames(objects []client.Object) []string {
+	var result []string
+	for _, obj := range objects {
+		result = append(result, obj.GetObjectKind().GroupVersionKind().Kind+"/"+obj.GetName())
+	}
+	return result
+}
@@ -2,44 +2,65 @@
 package fakes
 
 import (
+	"context"
 	"sync"
 
+	"github.com/weaveworks/profiles/pkg/git"
 	"github.com/weaveworks/profiles/pkg/scanner"
-	v1 "k8s.io/api/core/v1"
 )
 
 type FakeGitClient struct {
-	ListTagsStub        func(string, *v1.Secret) ([]string, error)
+	ListTagsStub        func(context.Context, string, git.AuthProvider) (map[string]string, error)
 	listTagsMutex       sync.RWMutex
 	listTagsArgsForCall []struct {
-		arg1 string
-		arg2 *v1.Secret
+		arg1 context.Context
+		arg2 string
+		arg3 git.AuthProvider
 	}
 	listTagsReturns struct {
-		result1 []string
+		result1 map[string]string
 		result2 error
 	}
 	listTagsReturnsOnCall map[int]struct {
-		result1 []string
+		result1 map[string]string
+		result2 error
+	}
+	VerifyTagStub        func(context.Context, string, git.AuthProvider, string, string, *git.TrustedKeys) (git.Signature, error)
+	verifyTagMutex       sync.RWMutex
+	verifyTagArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 git.AuthProvider
+		arg4 string
+		arg5 string
+		arg6 *git.TrustedKeys
+	}
+	verifyTagReturns struct {
+		result1 git.Signature
+		result2 error
+	}
+	verifyTagReturnsOnCall map[int]struct {
+		result1 git.Signature
 		result2 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeGitClient) ListTags(arg1 string, arg2 *v1.Secret) ([]string, error) {
+func (fake *FakeGitClient) ListTags(arg1 context.Context, arg2 string, arg3 git.AuthProvider) (map[string]string, error) {
 	fake.listTagsMutex.Lock()
 	ret, specificReturn := fake.listTagsReturnsOnCall[len(fake.listTagsArgsForCall)]
 	fake.listTagsArgsForCall = append(fake.listTagsArgsForCall, struct {
-		arg1 string
-		arg2 *v1.Secret
-	}{arg1, arg2})
+		arg1 context.Context
+		arg2 string
+		arg3 git.AuthProvider
+	}{arg1, arg2, arg3})
 	stub := fake.ListTagsStub
 	fakeReturns := fake.listTagsReturns
-	fake.recordInvocation("ListTags", []interface{}{arg1, arg2})
+	fake.recordInvocation("ListTags", []interface{}{arg1, arg2, arg3})
 	fake.listTagsMutex.Unlock()
 	if stub != nil {
-		return stub(arg1, arg2)
+		return stub(arg1, arg2, arg3)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
@@ -53,41 +74,110 @@ func (fake *FakeGitClient) ListTagsCallCount() int {
 	return len(fake.listTagsArgsForCall)
 }
 
-func (fake *FakeGitClient) ListTagsCalls(stub func(string, *v1.Secret) ([]string, error)) {
+func (fake *FakeGitClient) ListTagsCalls(stub func(context.Context, string, git.AuthProvider) (map[string]string, error)) {
 	fake.listTagsMutex.Lock()
 	defer fake.listTagsMutex.Unlock()
 	fake.ListTagsStub = stub
 }
 
-func (fake *FakeGitClient) ListTagsArgsForCall(i int) (string, *v1.Secret) {
+func (fake *FakeGitClient) ListTagsArgsForCall(i int) (context.Context, string, git.AuthProvider) {
 	fake.listTagsMutex.RLock()
 	defer fake.listTagsMutex.RUnlock()
 	argsForCall := fake.listTagsArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
 }
 
-func (fake *FakeGitClient) ListTagsReturns(result1 []string, result2 error) {
+func (fake *FakeGitClient) ListTagsReturns(result1 map[string]string, result2 error) {
 	fake.listTagsMutex.Lock()
 	defer fake.listTagsMutex.Unlock()
 	fake.ListTagsStub = nil
 	fake.listTagsReturns = struct {
-		result1 []string
+		result1 map[string]string
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeGitClient) ListTagsReturnsOnCall(i int, result1 []string, result2 error) {
+func (fake *FakeGitClient) ListTagsReturnsOnCall(i int, result1 map[string]string, result2 error) {
 	fake.listTagsMutex.Lock()
 	defer fake.listTagsMutex.Unlock()
 	fake.ListTagsStub = nil
 	if fake.listTagsReturnsOnCall == nil {
 		fake.listTagsReturnsOnCall = make(map[int]struct {
-			result1 []string
+			result1 map[string]string
 			result2 error
 		})
 	}
 	fake.listTagsReturnsOnCall[i] = struct {
-		result1 []string
+		result1 map[string]string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeGitClient) VerifyTag(arg1 context.Context, arg2 string, arg3 git.AuthProvider, arg4 string, arg5 string, arg6 *git.TrustedKeys) (git.Signature, error) {
+	fake.verifyTagMutex.Lock()
+	ret, specificReturn := fake.verifyTagReturnsOnCall[len(fake.verifyTagArgsForCall)]
+	fake.verifyTagArgsForCall = append(fake.verifyTagArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 git.AuthProvider
+		arg4 string
+		arg5 string
+		arg6 *git.TrustedKeys
+	}{arg1, arg2, arg3, arg4, arg5, arg6})
+	stub := fake.VerifyTagStub
+	fakeReturns := fake.verifyTagReturns
+	fake.recordInvocation("VerifyTag", []interface{}{arg1, arg2, arg3, arg4, arg5, arg6})
+	fake.verifyTagMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4, arg5, arg6)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeGitClient) VerifyTagCallCount() int {
+	fake.verifyTagMutex.RLock()
+	defer fake.verifyTagMutex.RUnlock()
+	return len(fake.verifyTagArgsForCall)
+}
+
+func (fake *FakeGitClient) VerifyTagCalls(stub func(context.Context, string, git.AuthProvider, string, string, *git.TrustedKeys) (git.Signature, error)) {
+	fake.verifyTagMutex.Lock()
+	defer fake.verifyTagMutex.Unlock()
+	fake.VerifyTagStub = stub
+}
+
+func (fake *FakeGitClient) VerifyTagArgsForCall(i int) (context.Context, string, git.AuthProvider, string, string, *git.TrustedKeys) {
+	fake.verifyTagMutex.RLock()
+	defer fake.verifyTagMutex.RUnlock()
+	argsForCall := fake.verifyTagArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4, argsForCall.arg5, argsForCall.arg6
+}
+
+func (fake *FakeGitClient) VerifyTagReturns(result1 git.Signature, result2 error) {
+	fake.verifyTagMutex.Lock()
+	defer fake.verifyTagMutex.Unlock()
+	fake.VerifyTagStub = nil
+	fake.verifyTagReturns = struct {
+		result1 git.Signature
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeGitClient) VerifyTagReturnsOnCall(i int, result1 git.Signature, result2 error) {
+	fake.verifyTagMutex.Lock()
+	defer fake.verifyTagMutex.Unlock()
+	fake.VerifyTagStub = nil
+	if fake.verifyTagReturnsOnCall == nil {
+		fake.verifyTagReturnsOnCall = make(map[int]struct {
+			result1 git.Signature
+			result2 error
+		})
+	}
+	fake.verifyTagReturnsOnCall[i] = struct {
+		result1 git.Signature
 		result2 error
 	}{result1, result2}
 }
@@ -97,6 +187,8 @@ func (fake *FakeGitClient) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.listTagsMutex.RLock()
 	defer fake.listTagsMutex.RUnlock()
+	fake.verifyTagMutex.RLock()
+	defer fake.verifyTagMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
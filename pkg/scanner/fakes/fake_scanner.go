@@ -2,59 +2,57 @@
 package fakes
 
 import (
+	"context"
 	"sync"
 
 	"github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/git"
 	"github.com/weaveworks/profiles/pkg/scanner"
-	v1 "k8s.io/api/core/v1"
 )
 
 type FakeRepoScanner struct {
-	ScanRepositoryStub        func(v1alpha1.Repository, *v1.Secret, []string) ([]v1alpha1.ProfileCatalogEntry, []string, error)
+	ScanRepositoryStub        func(context.Context, v1alpha1.Repository, git.AuthProvider, *git.TrustedKeys, map[string]string) (scanner.ScanResult, error)
 	scanRepositoryMutex       sync.RWMutex
 	scanRepositoryArgsForCall []struct {
-		arg1 v1alpha1.Repository
-		arg2 *v1.Secret
-		arg3 []string
+		arg1 context.Context
+		arg2 v1alpha1.Repository
+		arg3 git.AuthProvider
+		arg4 *git.TrustedKeys
+		arg5 map[string]string
 	}
 	scanRepositoryReturns struct {
-		result1 []v1alpha1.ProfileCatalogEntry
-		result2 []string
-		result3 error
+		result1 scanner.ScanResult
+		result2 error
 	}
 	scanRepositoryReturnsOnCall map[int]struct {
-		result1 []v1alpha1.ProfileCatalogEntry
-		result2 []string
-		result3 error
+		result1 scanner.ScanResult
+		result2 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeRepoScanner) ScanRepository(arg1 v1alpha1.Repository, arg2 *v1.Secret, arg3 []string) ([]v1alpha1.ProfileCatalogEntry, []string, error) {
-	var arg3Copy []string
-	if arg3 != nil {
-		arg3Copy = make([]string, len(arg3))
-		copy(arg3Copy, arg3)
-	}
+func (fake *FakeRepoScanner) ScanRepository(arg1 context.Context, arg2 v1alpha1.Repository, arg3 git.AuthProvider, arg4 *git.TrustedKeys, arg5 map[string]string) (scanner.ScanResult, error) {
 	fake.scanRepositoryMutex.Lock()
 	ret, specificReturn := fake.scanRepositoryReturnsOnCall[len(fake.scanRepositoryArgsForCall)]
 	fake.scanRepositoryArgsForCall = append(fake.scanRepositoryArgsForCall, struct {
-		arg1 v1alpha1.Repository
-		arg2 *v1.Secret
-		arg3 []string
-	}{arg1, arg2, arg3Copy})
+		arg1 context.Context
+		arg2 v1alpha1.Repository
+		arg3 git.AuthProvider
+		arg4 *git.TrustedKeys
+		arg5 map[string]string
+	}{arg1, arg2, arg3, arg4, arg5})
 	stub := fake.ScanRepositoryStub
 	fakeReturns := fake.scanRepositoryReturns
-	fake.recordInvocation("ScanRepository", []interface{}{arg1, arg2, arg3Copy})
+	fake.recordInvocation("ScanRepository", []interface{}{arg1, arg2, arg3, arg4, arg5})
 	fake.scanRepositoryMutex.Unlock()
 	if stub != nil {
-		return stub(arg1, arg2, arg3)
+		return stub(arg1, arg2, arg3, arg4, arg5)
 	}
 	if specificReturn {
-		return ret.result1, ret.result2, ret.result3
+		return ret.result1, ret.result2
 	}
-	return fakeReturns.result1, fakeReturns.result2, fakeReturns.result3
+	return fakeReturns.result1, fakeReturns.result2
 }
 
 func (fake *FakeRepoScanner) ScanRepositoryCallCount() int {
@@ -63,46 +61,43 @@ func (fake *FakeRepoScanner) ScanRepositoryCallCount() int {
 	return len(fake.scanRepositoryArgsForCall)
 }
 
-func (fake *FakeRepoScanner) ScanRepositoryCalls(stub func(v1alpha1.Repository, *v1.Secret, []string) ([]v1alpha1.ProfileCatalogEntry, []string, error)) {
+func (fake *FakeRepoScanner) ScanRepositoryCalls(stub func(context.Context, v1alpha1.Repository, git.AuthProvider, *git.TrustedKeys, map[string]string) (scanner.ScanResult, error)) {
 	fake.scanRepositoryMutex.Lock()
 	defer fake.scanRepositoryMutex.Unlock()
 	fake.ScanRepositoryStub = stub
 }
 
-func (fake *FakeRepoScanner) ScanRepositoryArgsForCall(i int) (v1alpha1.Repository, *v1.Secret, []string) {
+func (fake *FakeRepoScanner) ScanRepositoryArgsForCall(i int) (context.Context, v1alpha1.Repository, git.AuthProvider, *git.TrustedKeys, map[string]string) {
 	fake.scanRepositoryMutex.RLock()
 	defer fake.scanRepositoryMutex.RUnlock()
 	argsForCall := fake.scanRepositoryArgsForCall[i]
-	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4, argsForCall.arg5
 }
 
-func (fake *FakeRepoScanner) ScanRepositoryReturns(result1 []v1alpha1.ProfileCatalogEntry, result2 []string, result3 error) {
+func (fake *FakeRepoScanner) ScanRepositoryReturns(result1 scanner.ScanResult, result2 error) {
 	fake.scanRepositoryMutex.Lock()
 	defer fake.scanRepositoryMutex.Unlock()
 	fake.ScanRepositoryStub = nil
 	fake.scanRepositoryReturns = struct {
-		result1 []v1alpha1.ProfileCatalogEntry
-		result2 []string
-		result3 error
-	}{result1, result2, result3}
+		result1 scanner.ScanResult
+		result2 error
+	}{result1, result2}
 }
 
-func (fake *FakeRepoScanner) ScanRepositoryReturnsOnCall(i int, result1 []v1alpha1.ProfileCatalogEntry, result2 []string, result3 error) {
+func (fake *FakeRepoScanner) ScanRepositoryReturnsOnCall(i int, result1 scanner.ScanResult, result2 error) {
 	fake.scanRepositoryMutex.Lock()
 	defer fake.scanRepositoryMutex.Unlock()
 	fake.ScanRepositoryStub = nil
 	if fake.scanRepositoryReturnsOnCall == nil {
 		fake.scanRepositoryReturnsOnCall = make(map[int]struct {
-			result1 []v1alpha1.ProfileCatalogEntry
-			result2 []string
-			result3 error
+			result1 scanner.ScanResult
+			result2 error
 		})
 	}
 	fake.scanRepositoryReturnsOnCall[i] = struct {
-		result1 []v1alpha1.ProfileCatalogEntry
-		result2 []string
-		result3 error
-	}{result1, result2, result3}
+		result1 scanner.ScanResult
+		result2 error
+	}{result1, result2}
 }
 
 func (fake *FakeRepoScanner) Invocations() map[string][][]interface{} {
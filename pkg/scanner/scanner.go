@@ -2,19 +2,29 @@ package scanner
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fluxcd/pkg/version"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1beta1"
 	"github.com/go-logr/logr"
 	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/git"
 	"github.com/weaveworks/profiles/pkg/gitrepository"
-	corev1 "k8s.io/api/core/v1"
+	"github.com/weaveworks/profiles/pkg/metrics"
+	"github.com/weaveworks/profiles/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
@@ -22,7 +32,8 @@ import (
 //counterfeiter:generate -o fakes/fake_git_client.go . GitClient
 //GitClient client for interacting with git
 type GitClient interface {
-	ListTags(url string, secret *corev1.Secret) ([]string, error)
+	ListTags(ctx context.Context, url string, auth git.AuthProvider) (map[string]string, error)
+	VerifyTag(ctx context.Context, url string, auth git.AuthProvider, tag, sha string, keys *git.TrustedKeys) (git.Signature, error)
 }
 
 //counterfeiter:generate -o fakes/fake_repo_manager.go . GitRepositoryManager
@@ -38,11 +49,22 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+//counterfeiter:generate -o fakes/fake_mirror.go . Mirror
+//Mirror maintains local mirrors of the tags of repositories
+type Mirror interface {
+	Tags(url string) (map[string]string, error)
+	Sync(ctx context.Context, url string, auth git.AuthProvider, tags map[string]string) error
+	ReadFile(url, tag, file string) ([]byte, error)
+	VerifyTag(url, tag, sha string, keys *git.TrustedKeys) (git.Signature, error)
+	URL(url string) string
+}
+
 //Scanner for scanning repositorys
 type Scanner struct {
 	gitRepositoryManager GitRepositoryManager
 	gitClient            GitClient
 	httpClient           HTTPClient
+	mirror               Mirror
 	logger               logr.Logger
 }
 
@@ -56,38 +78,115 @@ func New(gitRepositoryManager GitRepositoryManager, gitClient GitClient, httpCli
 	}
 }
 
+//NewWithMirror returns a Scanner which syncs the mirror of a repository with its tags and reads the profiles
+//from the mirror. If the tags of the repository can't be listed, the tags already mirrored are scanned.
+func NewWithMirror(mirror Mirror, gitClient GitClient, logger logr.Logger) RepoScanner {
+	return &Scanner{
+		gitClient: gitClient,
+		mirror:    mirror,
+		logger:    logger,
+	}
+}
+
 //counterfeiter:generate -o fakes/fake_scanner.go . RepoScanner
 // RepoScanner is an interface for scanning repositories for profiles
 type RepoScanner interface {
-	ScanRepository(profilesv1.Repository, *corev1.Secret, []string) ([]profilesv1.ProfileCatalogEntry, []string, error)
+	ScanRepository(context.Context, profilesv1.Repository, git.AuthProvider, *git.TrustedKeys, map[string]string) (ScanResult, error)
+}
+
+// ScanResult contains the outcome of scanning a repository.
+type ScanResult struct {
+	// Profiles are the profiles found in tags which are new or have moved since they were last scanned.
+	Profiles []profilesv1.ProfileCatalogEntry
+	// Tags maps every tag currently in the repository to the SHA it references.
+	Tags map[string]string
+	// StaleTags are previously scanned tags which have been deleted or moved. Catalog
+	// entries for these tags are outdated and have to be discarded.
+	StaleTags []string
 }
 
-//ScanRepository for profiles
-func (s *Scanner) ScanRepository(repo profilesv1.Repository, secret *corev1.Secret, alreadyScannedTags []string) ([]profilesv1.ProfileCatalogEntry, []string, error) {
-	tags, err := s.gitClient.ListTags(repo.URL, secret)
+//ScanRepository for profiles. alreadyScannedTags maps the tags which have been scanned before to
+//the SHA they referenced at that time. An empty SHA means it is unknown and the tag is not rescanned.
+//If keys is not nil, the signatures of the tags of new profiles are verified with them.
+func (s *Scanner) ScanRepository(ctx context.Context, repo profilesv1.Repository, auth git.AuthProvider, keys *git.TrustedKeys, alreadyScannedTags map[string]string) (ScanResult, error) {
+	label := git.RedactURL(repo.URL)
+	ctx, span := tracing.Start(ctx, "Scanner.ScanRepository", attribute.String("repository.url", label))
+	start := time.Now()
+	result, err := s.scanRepository(ctx, repo, auth, keys, alreadyScannedTags)
+	metrics.ScanDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list tags: %w", err)
+		metrics.ScanFailures.WithLabelValues(label).Inc()
+	}
+	span.SetAttributes(attribute.Int("profiles.count", len(result.Profiles)))
+	tracing.End(span, err)
+	return result, err
+}
+
+func (s *Scanner) scanRepository(ctx context.Context, repo profilesv1.Repository, auth git.AuthProvider, keys *git.TrustedKeys, alreadyScannedTags map[string]string) (_ ScanResult, err error) {
+	tags, err := s.listTags(ctx, repo, auth)
+	if err != nil {
+		return ScanResult{}, err
 	}
 	s.logger.Info("found tags", "url", repo.URL, "tags", tags)
 
+	changes := diffTags(alreadyScannedTags, tags)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("tags.added", len(changes.added)),
+		attribute.Int("tags.moved", len(changes.moved)),
+		attribute.Int("tags.removed", len(changes.removed)),
+	)
+	for _, tag := range changes.moved {
+		s.logger.Info("tag has moved, rescanning", "url", repo.URL, "tag", tag, "old", alreadyScannedTags[tag], "new", tags[tag])
+	}
+	for _, tag := range changes.removed {
+		s.logger.Info("tag has been removed", "url", repo.URL, "tag", tag)
+	}
+
 	var instances []gitrepository.Instance
-	var newTags []string
-	for _, tag := range tags {
+	for _, tag := range append(changes.added, changes.moved...) {
 		semver, path := getSemverAndPathFromTag(tag)
-		if !containsString(alreadyScannedTags, tag) {
-			newTags = append(newTags, tag)
-			if _, err := version.ParseVersion(semver); err == nil {
-				instances = append(instances, gitrepository.Instance{
-					Tag:  tag,
-					Path: path,
-				})
+		if _, err := version.ParseVersion(semver); err == nil {
+			instances = append(instances, gitrepository.Instance{
+				Tag:  tag,
+				Path: path,
+			})
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Tag < instances[j].Tag
+	})
+	staleTags := append(changes.moved, changes.removed...)
+	sort.Strings(staleTags)
+
+	result := ScanResult{
+		Tags:      tags,
+		StaleTags: staleTags,
+	}
+	pendingTags := metrics.PendingTags.WithLabelValues(git.RedactURL(repo.URL))
+	pendingTags.Set(float64(len(instances)))
+	defer func() {
+		// the tags which haven't been scanned yet are rescanned by the next scan
+		if err != nil {
+			pendingTags.Set(0)
+		}
+	}()
+	if s.mirror != nil {
+		for _, instance := range instances {
+			profileDef, err := s.readProfileFromMirror(repo.URL, instance)
+			if err != nil {
+				return ScanResult{}, err
+			}
+			pendingTags.Dec()
+			if err := s.appendProfile(ctx, &result, repo, auth, keys, instance.Tag, profileDef); err != nil {
+				return ScanResult{}, err
 			}
 		}
+		return result, nil
 	}
 
 	gitRepositoryResources, err := s.gitRepositoryManager.CreateAndWaitForResources(repo, instances)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create gitrepository resources: %w", err)
+		return ScanResult{}, fmt.Errorf("failed to create gitrepository resources: %w", err)
 	}
 	s.logger.Info("gitrepositorys created", "gitrepositories", gitRepositoryResources)
 
@@ -97,36 +196,130 @@ func (s *Scanner) ScanRepository(repo profilesv1.Repository, secret *corev1.Secr
 		}
 	}()
 
-	var profiles []profilesv1.ProfileCatalogEntry
 	for _, gitRepo := range gitRepositoryResources {
-		profileDef, err := s.fetchProfileFromTarball(gitRepo)
+		tag := gitRepo.Spec.Reference.Tag
+		if keys != nil && !fetchedCommit(gitRepo, tags[tag]) {
+			// the tag has moved since it was listed, so the verified commit isn't the fetched one. The
+			// tag isn't recorded as scanned, so the next scan picks it up again.
+			s.logger.Info("tag has moved while scanning, skipping", "url", repo.URL, "tag", tag, "sha", tags[tag])
+			delete(result.Tags, tag)
+			pendingTags.Dec()
+			continue
+		}
+		profileDef, err := s.fetchProfileFromTarball(ctx, gitRepo)
 		if err != nil {
-			return nil, nil, err
-		}
-		if profileDef != nil && profileDef.Name != "" {
-			profiles = append(profiles, profilesv1.ProfileCatalogEntry{
-				ProfileDescription: profileDef.Spec.ProfileDescription,
-				Tag:                gitRepo.Spec.Reference.Tag,
-				URL:                repo.URL,
-				Name:               profileDef.Name,
-			})
+			return ScanResult{}, err
+		}
+		pendingTags.Dec()
+		if err := s.appendProfile(ctx, &result, repo, auth, keys, tag, profileDef); err != nil {
+			return ScanResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// appendProfile appends the catalog entry of the profile defined at the tag to the profiles of the result.
+// With trusted keys the signature of the tag is verified, and the profile is skipped if the tag isn't
+// verified and the repository enforces verification.
+func (s *Scanner) appendProfile(ctx context.Context, result *ScanResult, repo profilesv1.Repository, auth git.AuthProvider, keys *git.TrustedKeys, tag string, profileDef *profilesv1.ProfileDefinition) error {
+	if profileDef == nil || profileDef.Name == "" {
+		return nil
+	}
+	entry := profilesv1.ProfileCatalogEntry{
+		ProfileDescription: profileDef.Spec.ProfileDescription,
+		Tag:                tag,
+		URL:                repo.URL,
+		Name:               profileDef.Name,
+	}
+	if s.mirror != nil {
+		if mirrorURL := s.mirror.URL(repo.URL); mirrorURL != repo.URL {
+			entry.MirrorURL = mirrorURL
+		}
+	}
+	if keys != nil {
+		signature, err := s.verifyTag(ctx, repo.URL, auth, tag, result.Tags[tag], keys)
+		if err != nil {
+			return fmt.Errorf("failed to verify tag %s: %w", tag, err)
+		}
+		entry.Verified, entry.SigningKey = signature.Verified, signature.Key
+		if !signature.Verified {
+			s.logger.Info("tag is not signed by a trusted key", "url", repo.URL, "tag", tag)
+			if repo.Verification != nil && repo.Verification.Mode == profilesv1.EnforceVerificationMode {
+				return nil
+			}
 		}
 	}
+	result.Profiles = append(result.Profiles, entry)
+	return nil
+}
+
+// fetchedCommit returns whether the artifact of the GitRepository is the commit with the SHA. The
+// revision of the artifact of a tag is the tag and the SHA of its commit, separated by a slash.
+func fetchedCommit(gitRepo *sourcev1.GitRepository, sha string) bool {
+	if gitRepo.Status.Artifact == nil || sha == "" {
+		return false
+	}
+	return strings.HasSuffix(gitRepo.Status.Artifact.Revision, "/"+sha)
+}
 
-	return profiles, newTags, nil
+// verifyTag verifies the signature of the tag in the mirror of the repository, or in the repository itself.
+// The tag must reference the commit with the SHA it referenced when it was listed.
+func (s *Scanner) verifyTag(ctx context.Context, url string, auth git.AuthProvider, tag, sha string, keys *git.TrustedKeys) (git.Signature, error) {
+	if s.mirror != nil {
+		return s.mirror.VerifyTag(url, tag, sha, keys)
+	}
+	return s.gitClient.VerifyTag(ctx, url, auth, tag, sha, keys)
 }
 
-func containsString(list []string, value string) bool {
-	for _, v := range list {
-		if v == value {
-			return true
+// listTags returns the tags of the repository mapped to the SHA they reference. When scanning a mirror, the
+// mirror is synced with the tags, or its tags are returned if the tags of the repository can't be listed.
+func (s *Scanner) listTags(ctx context.Context, repo profilesv1.Repository, auth git.AuthProvider) (map[string]string, error) {
+	tags, err := s.gitClient.ListTags(ctx, repo.URL, auth)
+	if err != nil {
+		if s.mirror == nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		mirrored, mirrorErr := s.mirror.Tags(repo.URL)
+		if mirrorErr != nil || len(mirrored) == 0 {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		s.logger.Error(err, "failed to list tags, scanning the mirror", "url", repo.URL)
+		return mirrored, nil
+	}
+	if s.mirror != nil {
+		if err := s.mirror.Sync(ctx, repo.URL, auth, tags); err != nil {
+			return nil, fmt.Errorf("failed to sync mirror: %w", err)
 		}
 	}
-	return false
+	return tags, nil
+}
+
+// readProfileFromMirror returns the profile definition of the instance in the mirror of the repository, or
+// nil if the tag doesn't contain one.
+func (s *Scanner) readProfileFromMirror(url string, instance gitrepository.Instance) (*profilesv1.ProfileDefinition, error) {
+	data, err := s.mirror.ReadFile(url, instance.Tag, instance.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profileDef profilesv1.ProfileDefinition
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 10000).Decode(&profileDef); err != nil {
+		return nil, fmt.Errorf("failed to decode profile.yaml: %w", err)
+	}
+	return &profileDef, nil
 }
 
-func (s *Scanner) fetchProfileFromTarball(gitRepo *sourcev1.GitRepository) (*profilesv1.ProfileDefinition, error) {
-	req, err := http.NewRequest("GET", gitRepo.Status.URL, nil)
+func (s *Scanner) fetchProfileFromTarball(ctx context.Context, gitRepo *sourcev1.GitRepository) (profileDef *profilesv1.ProfileDefinition, err error) {
+	ctx, span := tracing.Start(ctx, "Scanner.fetchProfileFromTarball",
+		attribute.String("gitrepository.name", gitRepo.Name),
+		attribute.String("gitrepository.tag", gitRepo.Spec.Reference.Tag),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", gitRepo.Status.URL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -170,6 +363,35 @@ func extractProfileFromTarball(gzipStream io.Reader) (*profilesv1.ProfileDefinit
 	}
 }
 
+// tagChanges are the tags of a repository which have been added, moved or removed since it was last scanned.
+type tagChanges struct {
+	added, moved, removed []string
+}
+
+// diffTags compares the tags of a repository with the tags scanned before, both mapped to the SHA they
+// reference. A tag scanned before with an unknown SHA is considered unchanged.
+func diffTags(scanned, current map[string]string) tagChanges {
+	var changes tagChanges
+	for tag, sha := range current {
+		scannedSHA, ok := scanned[tag]
+		switch {
+		case !ok:
+			changes.added = append(changes.added, tag)
+		case scannedSHA != "" && scannedSHA != sha:
+			changes.moved = append(changes.moved, tag)
+		}
+	}
+	for tag := range scanned {
+		if _, ok := current[tag]; !ok {
+			changes.removed = append(changes.removed, tag)
+		}
+	}
+	sort.Strings(changes.added)
+	sort.Strings(changes.moved)
+	sort.Strings(changes.removed)
+	return changes
+}
+
 func getSemverAndPathFromTag(tag string) (string, string) {
 	v := tag
 	path := "profile.yaml"
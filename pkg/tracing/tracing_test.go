@@ -0,0 +1,70 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/weaveworks/profiles/pkg/tracing"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		exporter *tracetest.InMemoryExporter
+		previous trace.TracerProvider
+	)
+
+	BeforeEach(func() {
+		previous = otel.GetTracerProvider()
+		exporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	It("records spans as children of the span in the context", func() {
+		ctx, parent := tracing.Start(context.Background(), "parent")
+		_, child := tracing.Start(ctx, "child", attribute.String("repository.url", "https://github.com/org/repo"))
+		tracing.End(child, nil)
+		tracing.End(parent, nil)
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Name).To(Equal("child"))
+		Expect(spans[0].Parent.SpanID()).To(Equal(spans[1].SpanContext.SpanID()))
+		Expect(spans[0].Attributes).To(ContainElement(attribute.String("repository.url", "https://github.com/org/repo")))
+		Expect(spans[0].Status.Code).To(Equal(codes.Unset))
+	})
+
+	It("records the error of a failed span", func() {
+		_, span := tracing.Start(context.Background(), "failing")
+		tracing.End(span, errors.New("boom"))
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Status.Code).To(Equal(codes.Error))
+		Expect(spans[0].Status.Description).To(Equal("boom"))
+		Expect(spans[0].Events).To(HaveLen(1))
+		Expect(spans[0].Events[0].Name).To(Equal("exception"))
+	})
+
+	When("no endpoint is configured", func() {
+		It("leaves the tracer provider in place", func() {
+			provider := otel.GetTracerProvider()
+			shutdown, err := tracing.Setup(context.Background(), tracing.Config{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(otel.GetTracerProvider()).To(BeIdenticalTo(provider))
+			Expect(shutdown(context.Background())).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,325 @@
+package validate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"sigs.k8s.io/yaml"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+)
+
+// Severity is the severity of a finding.
+type Severity string
+
+const (
+	// SeverityError marks a definition which can't be installed.
+	SeverityError Severity = "error"
+	// SeverityWarning marks a definition which can be installed but likely not as intended.
+	SeverityWarning Severity = "warning"
+)
+
+// Rules identify the check which produced a finding.
+const (
+	RuleDefinition       = "definition"
+	RuleArtifactName     = "artifact-name"
+	RuleArtifactKind     = "artifact-kind"
+	RuleDependsOn        = "depends-on"
+	RuleDependencyCycle  = "dependency-cycle"
+	RuleChart            = "chart"
+	RuleProfileSource    = "profile-source"
+	RuleLocalPath        = "local-path"
+	RuleUnknownField     = "unknown-field"
+	RuleMissingArtifacts = "missing-artifacts"
+)
+
+// Finding is a problem found in a profile definition.
+type Finding struct {
+	// Severity is either error or warning
+	Severity Severity `json:"severity"`
+	// Rule identifies the check which produced the finding
+	Rule string `json:"rule"`
+	// Field is the path of the offending field, for example spec.artifacts[0].chart
+	Field string `json:"field,omitempty"`
+	// Artifact is the name of the offending artifact
+	Artifact string `json:"artifact,omitempty"`
+	// Message describes the problem
+	Message string `json:"message"`
+}
+
+// String returns the finding in the form `<severity>: <field>: <message> (<rule>)`.
+func (f Finding) String() string {
+	if f.Field == "" {
+		return fmt.Sprintf("%s: %s (%s)", f.Severity, f.Message, f.Rule)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", f.Severity, f.Field, f.Message, f.Rule)
+}
+
+// Findings is a list of findings.
+type Findings []Finding
+
+// HasErrors returns true if any of the findings is an error.
+func (f Findings) HasErrors() bool {
+	for _, finding := range f {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Options configures the validation.
+type Options struct {
+	// Dir is the directory of the profile definition in a checkout of the profile repository. The
+	// local paths of artifacts are resolved relative to it. If empty, local paths are not checked
+	// to exist.
+	Dir string
+}
+
+// File validates the profile definition in the given file. Local paths of the artifacts are
+// checked to exist relative to the directory of the file. An error is returned if the file can't
+// be read; problems with its contents are returned as findings.
+func File(path string) (Findings, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Bytes(data, Options{Dir: filepath.Dir(path)}), nil
+}
+
+// Bytes validates the YAML encoded profile definition.
+func Bytes(data []byte, opts Options) Findings {
+	def := &profilesv1.ProfileDefinition{}
+	strictErr := yaml.UnmarshalStrict(data, def)
+	if strictErr == nil {
+		return Definition(def, opts)
+	}
+	// unknown fields are reported, but don't stop the validation
+	if err := yaml.Unmarshal(data, def); err != nil {
+		return Findings{{Severity: SeverityError, Rule: RuleDefinition, Message: fmt.Sprintf("failed to parse profile definition: %v", err)}}
+	}
+	findings := Findings{{Severity: SeverityWarning, Rule: RuleUnknownField, Message: strictErr.Error()}}
+	return append(findings, Definition(def, opts)...)
+}
+
+// Definition validates the semantics of the profile definition:
+//  - every artifact has a unique name and exactly one of chart, profile or kustomize
+//  - the artifacts an artifact depends on exist and the dependencies don't form a cycle
+//  - charts either set a local path or a repository URL, chart name and valid version
+//  - profile artifacts set the URL of their source
+//  - local paths are relative to the profile and exist if opts.Dir is set
+func Definition(def *profilesv1.ProfileDefinition, opts Options) Findings {
+	var findings Findings
+	if def.Kind != "" && def.Kind != "ProfileDefinition" {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleDefinition, Field: "kind", Message: fmt.Sprintf("kind must be ProfileDefinition, got %q", def.Kind)})
+	}
+	if def.Name == "" {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleDefinition, Field: "metadata.name", Message: "the name of the profile must be set"})
+	}
+	if len(def.Spec.Artifacts) == 0 {
+		findings = append(findings, Finding{Severity: SeverityWarning, Rule: RuleMissingArtifacts, Field: "spec.artifacts", Message: "the profile has no artifacts"})
+	}
+
+	names := map[string]int{}
+	for i, artifact := range def.Spec.Artifacts {
+		field := fmt.Sprintf("spec.artifacts[%d]", i)
+		if artifact.Name == "" {
+			findings = append(findings, Finding{Severity: SeverityError, Rule: RuleArtifactName, Field: field + ".name", Message: "the name of the artifact must be set"})
+		} else if j, ok := names[artifact.Name]; ok {
+			findings = append(findings, Finding{Severity: SeverityError, Rule: RuleArtifactName, Field: field + ".name", Artifact: artifact.Name,
+				Message: fmt.Sprintf("the name is already used by spec.artifacts[%d]", j)})
+		} else {
+			names[artifact.Name] = i
+		}
+		findings = append(findings, validateArtifact(field, artifact, opts)...)
+	}
+
+	for i, artifact := range def.Spec.Artifacts {
+		for j, dep := range artifact.DependsOn {
+			field := fmt.Sprintf("spec.artifacts[%d].dependsOn[%d]", i, j)
+			switch _, ok := names[dep.Name]; {
+			case dep.Name == artifact.Name:
+				findings = append(findings, Finding{Severity: SeverityError, Rule: RuleDependsOn, Field: field, Artifact: artifact.Name, Message: "the artifact depends on itself"})
+			case !ok:
+				findings = append(findings, Finding{Severity: SeverityError, Rule: RuleDependsOn, Field: field, Artifact: artifact.Name,
+					Message: fmt.Sprintf("the artifact depends on %q, which does not exist", dep.Name)})
+			}
+		}
+	}
+	return append(findings, dependencyCycles(def.Spec.Artifacts)...)
+}
+
+// validateArtifact validates the kind of a single artifact and the fields of that kind.
+func validateArtifact(field string, artifact profilesv1.Artifact, opts Options) Findings {
+	var kinds []string
+	if artifact.Chart != nil {
+		kinds = append(kinds, "chart")
+	}
+	if artifact.Profile != nil {
+		kinds = append(kinds, "profile")
+	}
+	if artifact.Kustomize != nil {
+		kinds = append(kinds, "kustomize")
+	}
+	switch len(kinds) {
+	case 0:
+		return Findings{{Severity: SeverityError, Rule: RuleArtifactKind, Field: field, Artifact: artifact.Name, Message: "one of chart, profile or kustomize must be set"}}
+	case 1:
+	default:
+		return Findings{{Severity: SeverityError, Rule: RuleArtifactKind, Field: field, Artifact: artifact.Name,
+			Message: fmt.Sprintf("only one of chart, profile or kustomize may be set, got %s", strings.Join(kinds, ", "))}}
+	}
+
+	var findings Findings
+	switch {
+	case artifact.Chart != nil:
+		findings = validateChart(field+".chart", artifact.Name, *artifact.Chart, opts)
+	case artifact.Kustomize != nil:
+		findings = validateLocalPath(field+".kustomize.path", artifact.Name, artifact.Kustomize.Path, opts)
+	case artifact.Profile != nil:
+		if artifact.Profile.Source == nil || artifact.Profile.Source.URL == "" {
+			findings = append(findings, Finding{Severity: SeverityError, Rule: RuleProfileSource, Field: field + ".profile.source.url", Artifact: artifact.Name, Message: "the URL of the profile must be set"})
+		} else if err := validateURL(artifact.Profile.Source.URL, "https", "http", "ssh"); err != nil {
+			findings = append(findings, Finding{Severity: SeverityError, Rule: RuleProfileSource, Field: field + ".profile.source.url", Artifact: artifact.Name, Message: err.Error()})
+		}
+	}
+	return findings
+}
+
+// validateChart validates that a chart either sets a local path or a remote chart.
+func validateChart(field, artifact string, chart profilesv1.Chart, opts Options) Findings {
+	if chart.Path != "" {
+		findings := validateLocalPath(field+".path", artifact, chart.Path, opts)
+		if chart.URL != "" || chart.Name != "" || chart.Version != "" {
+			findings = append(findings, Finding{Severity: SeverityWarning, Rule: RuleChart, Field: field, Artifact: artifact, Message: "the url, name and version of the chart are ignored because the path is set"})
+		}
+		return findings
+	}
+
+	var findings Findings
+	if chart.URL == "" {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleChart, Field: field, Artifact: artifact, Message: "one of path or url must be set"})
+	} else if err := validateURL(chart.URL, "https", "http", "oci"); err != nil {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleChart, Field: field + ".url", Artifact: artifact, Message: err.Error()})
+	}
+	if chart.URL != "" && chart.Name == "" {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleChart, Field: field + ".name", Artifact: artifact, Message: "the name of a chart in a repository must be set"})
+	}
+	if chart.Version == "" {
+		if chart.URL != "" {
+			findings = append(findings, Finding{Severity: SeverityWarning, Rule: RuleChart, Field: field + ".version", Artifact: artifact, Message: "the version is not set, so the latest version of the chart is installed"})
+		}
+	} else if _, err := semver.NewConstraint(chart.Version); err != nil {
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleChart, Field: field + ".version", Artifact: artifact,
+			Message: fmt.Sprintf("the version %q is not a valid semver version or range: %v", chart.Version, err)})
+	}
+	return findings
+}
+
+// validateLocalPath validates that path is relative and, if opts.Dir is set, exists. Paths outside
+// of the directory of the profile are reported as warnings.
+func validateLocalPath(field, artifact, path string, opts Options) Findings {
+	if path == "" {
+		return Findings{{Severity: SeverityError, Rule: RuleLocalPath, Field: field, Artifact: artifact, Message: "the path must be set"}}
+	}
+	if filepath.IsAbs(path) {
+		return Findings{{Severity: SeverityError, Rule: RuleLocalPath, Field: field, Artifact: artifact, Message: fmt.Sprintf("the path %q must be relative to the profile", path)}}
+	}
+	var findings Findings
+	if clean := filepath.Clean(path); clean == ".." || strings.HasPrefix(clean, "../") {
+		findings = append(findings, Finding{Severity: SeverityWarning, Rule: RuleLocalPath, Field: field, Artifact: artifact, Message: fmt.Sprintf("the path %q is outside of the directory of the profile", path)})
+	}
+	if opts.Dir == "" {
+		return findings
+	}
+	if _, err := os.Stat(filepath.Join(opts.Dir, path)); err != nil {
+		message := fmt.Sprintf("the path %q does not exist", path)
+		if !os.IsNotExist(err) {
+			message = err.Error()
+		}
+		findings = append(findings, Finding{Severity: SeverityError, Rule: RuleLocalPath, Field: field, Artifact: artifact, Message: message})
+	}
+	return findings
+}
+
+// validateURL returns an error unless rawURL is an absolute URL with one of the given schemes.
+func validateURL(rawURL string, schemes ...string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("the URL %q must be absolute", rawURL)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("the scheme of the URL %q must be one of %s", rawURL, strings.Join(schemes, ", "))
+}
+
+// dependencyCycles returns a finding for every cycle in the dependencies of the artifacts.
+func dependencyCycles(artifacts []profilesv1.Artifact) Findings {
+	deps := map[string][]string{}
+	for _, artifact := range artifacts {
+		for _, dep := range artifact.DependsOn {
+			if dep.Name != artifact.Name {
+				deps[artifact.Name] = append(deps[artifact.Name], dep.Name)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var findings Findings
+	var stack []string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range deps[name] {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				cycle := append([]string{}, stack[indexOf(stack, dep):]...)
+				findings = append(findings, Finding{Severity: SeverityError, Rule: RuleDependencyCycle, Field: "spec.artifacts", Artifact: dep,
+					Message: fmt.Sprintf("the dependencies form a cycle: %s -> %s", strings.Join(cycle, " -> "), dep)})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return findings
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
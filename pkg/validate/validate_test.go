@@ -0,0 +1,178 @@
+package validate_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	profilesv1 "github.com/weaveworks/profiles/api/v1alpha1"
+	"github.com/weaveworks/profiles/pkg/validate"
+)
+
+// finding matches a finding of the given severity, rule and field.
+func finding(severity validate.Severity, rule, field string) OmegaMatcher {
+	return MatchFields(IgnoreExtras, Fields{
+		"Severity": Equal(severity),
+		"Rule":     Equal(rule),
+		"Field":    Equal(field),
+	})
+}
+
+var _ = Describe("Validate", func() {
+	var def *profilesv1.ProfileDefinition
+
+	BeforeEach(func() {
+		def = &profilesv1.ProfileDefinition{
+			TypeMeta:   metav1.TypeMeta{Kind: "ProfileDefinition", APIVersion: "weave.works/v1alpha1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx"},
+			Spec: profilesv1.ProfileDefinitionSpec{
+				Artifacts: []profilesv1.Artifact{
+					{Name: "chart", Chart: &profilesv1.Chart{URL: "https://charts.bitnami.com/bitnami", Name: "nginx", Version: "8.9.1"}},
+					{Name: "config", Kustomize: &profilesv1.Kustomize{Path: "config"}, DependsOn: []profilesv1.DependsOn{{Name: "chart"}}},
+					{Name: "ingress", Profile: &profilesv1.Profile{Source: &profilesv1.Source{URL: "https://github.com/weaveworks/profiles-examples", Tag: "ingress/v0.1.0"}}},
+				},
+			},
+		}
+	})
+
+	It("accepts a valid profile definition", func() {
+		Expect(validate.Definition(def, validate.Options{})).To(BeEmpty())
+	})
+
+	It("requires exactly one kind per artifact", func() {
+		def.Spec.Artifacts[0].Kustomize = &profilesv1.Kustomize{Path: "chart"}
+		def.Spec.Artifacts[2].Profile = nil
+		Expect(validate.Definition(def, validate.Options{})).To(ConsistOf(
+			finding(validate.SeverityError, validate.RuleArtifactKind, "spec.artifacts[0]"),
+			finding(validate.SeverityError, validate.RuleArtifactKind, "spec.artifacts[2]"),
+		))
+	})
+
+	It("requires unique artifact names", func() {
+		def.Spec.Artifacts[2].Name = "chart"
+		findings := validate.Definition(def, validate.Options{})
+		Expect(findings).To(ConsistOf(finding(validate.SeverityError, validate.RuleArtifactName, "spec.artifacts[2].name")))
+		Expect(findings[0].Message).To(ContainSubstring("spec.artifacts[0]"))
+	})
+
+	It("requires the artifacts an artifact depends on to exist", func() {
+		def.Spec.Artifacts[1].DependsOn = []profilesv1.DependsOn{{Name: "chart"}, {Name: "missing"}, {Name: "config"}}
+		Expect(validate.Definition(def, validate.Options{})).To(ConsistOf(
+			finding(validate.SeverityError, validate.RuleDependsOn, "spec.artifacts[1].dependsOn[1]"),
+			finding(validate.SeverityError, validate.RuleDependsOn, "spec.artifacts[1].dependsOn[2]"),
+		))
+	})
+
+	It("reports dependency cycles", func() {
+		def.Spec.Artifacts[0].DependsOn = []profilesv1.DependsOn{{Name: "ingress"}}
+		def.Spec.Artifacts[2].DependsOn = []profilesv1.DependsOn{{Name: "config"}}
+		findings := validate.Definition(def, validate.Options{})
+		Expect(findings).To(ConsistOf(finding(validate.SeverityError, validate.RuleDependencyCycle, "spec.artifacts")))
+		Expect(findings[0].Message).To(Equal("the dependencies form a cycle: chart -> ingress -> config -> chart"))
+	})
+
+	Describe("charts", func() {
+		It("requires the name and a valid version of a chart in a repository", func() {
+			def.Spec.Artifacts[0].Chart = &profilesv1.Chart{URL: "charts.bitnami.com/bitnami", Version: "latest"}
+			Expect(validate.Definition(def, validate.Options{})).To(ConsistOf(
+				finding(validate.SeverityError, validate.RuleChart, "spec.artifacts[0].chart.url"),
+				finding(validate.SeverityError, validate.RuleChart, "spec.artifacts[0].chart.name"),
+				finding(validate.SeverityError, validate.RuleChart, "spec.artifacts[0].chart.version"),
+			))
+		})
+
+		It("accepts version ranges and warns about missing versions", func() {
+			def.Spec.Artifacts[0].Chart.Version = "~8.9"
+			Expect(validate.Definition(def, validate.Options{})).To(BeEmpty())
+
+			def.Spec.Artifacts[0].Chart.Version = ""
+			Expect(validate.Definition(def, validate.Options{})).To(ConsistOf(
+				finding(validate.SeverityWarning, validate.RuleChart, "spec.artifacts[0].chart.version"),
+			))
+		})
+
+		It("requires a path or a URL", func() {
+			def.Spec.Artifacts[0].Chart = &profilesv1.Chart{Version: "8.9.1"}
+			Expect(validate.Definition(def, validate.Options{})).To(ConsistOf(
+				finding(validate.SeverityError, validate.RuleChart, "spec.artifacts[0].chart"),
+			))
+		})
+
+		It("warns about remote fields of a local chart", func() {
+			def.Spec.Artifacts[0].Chart.Path = "chart"
+			Expect(validate.Definition(def, validate.Options{})).To(ConsistOf(
+				finding(validate.SeverityWarning, validate.RuleChart, "spec.artifacts[0].chart"),
+			))
+		})
+	})
+
+	Describe("local paths", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "profile")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Mkdir(filepath.Join(dir, "config"), 0755)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("checks the paths exist in the profile directory", func() {
+			Expect(validate.Definition(def, validate.Options{Dir: dir})).To(BeEmpty())
+
+			def.Spec.Artifacts[0].Chart = &profilesv1.Chart{Path: "chart"}
+			Expect(validate.Definition(def, validate.Options{Dir: dir})).To(ConsistOf(
+				finding(validate.SeverityError, validate.RuleLocalPath, "spec.artifacts[0].chart.path"),
+			))
+			Expect(validate.Definition(def, validate.Options{})).To(BeEmpty())
+		})
+
+		It("rejects absolute paths and warns about paths outside of the profile", func() {
+			def.Spec.Artifacts[0].Chart = &profilesv1.Chart{Path: "/chart"}
+			def.Spec.Artifacts[1].Kustomize.Path = "../shared/config"
+			Expect(validate.Definition(def, validate.Options{})).To(ConsistOf(
+				finding(validate.SeverityError, validate.RuleLocalPath, "spec.artifacts[0].chart.path"),
+				finding(validate.SeverityWarning, validate.RuleLocalPath, "spec.artifacts[1].kustomize.path"),
+			))
+		})
+	})
+
+	Describe("Bytes", func() {
+		It("reports unknown fields and validates the rest of the definition", func() {
+			findings := validate.Bytes([]byte(`
+apiVersion: weave.works/v1alpha1
+kind: ProfileDefinition
+metadata:
+  name: nginx
+spec:
+  description: nginx
+  artifacts:
+  - name: chart
+    chart:
+      url: https://charts.bitnami.com/bitnami
+      name: nginx
+      verison: 8.9.1
+`), validate.Options{})
+			Expect(findings).To(ConsistOf(
+				finding(validate.SeverityWarning, validate.RuleUnknownField, ""),
+				finding(validate.SeverityWarning, validate.RuleChart, "spec.artifacts[0].chart.version"),
+			))
+			Expect(findings[0].Message).To(ContainSubstring("verison"))
+			Expect(findings.HasErrors()).To(BeFalse())
+		})
+
+		It("reports definitions which can't be parsed", func() {
+			findings := validate.Bytes([]byte(`spec: [`), validate.Options{})
+			Expect(findings).To(ConsistOf(finding(validate.SeverityError, validate.RuleDefinition, "")))
+			Expect(findings.HasErrors()).To(BeTrue())
+		})
+	})
+})
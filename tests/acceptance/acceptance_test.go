@@ -91,10 +91,12 @@ var _ = Describe("Acceptance", func() {
 					Maintainer:    "my aunt ethel",
 					Prerequisites: []string{"at least 20 years of kubernetes experience"},
 				},
-				Name:          profileName,
-				CatalogSource: sourceName,
-				Tag:           "0.0.1",
-				URL:           "foo.com/bar",
+				Name:             profileName,
+				CatalogSource:    sourceName,
+				CatalogNamespace: "default",
+				CatalogScope:     profilesv1.NamespacedCatalogScope,
+				Tag:              "0.0.1",
+				URL:              "foo.com/bar",
 			}
 
 			expectedNginx2 = profilesv1.ProfileCatalogEntry{
@@ -103,10 +105,12 @@ var _ = Describe("Acceptance", func() {
 					Maintainer:    "my latest version of aunt ethel",
 					Prerequisites: []string{"at least 20 years of kubernetes experience"},
 				},
-				Name:          profileName,
-				CatalogSource: sourceName,
-				Tag:           "0.0.2",
-				URL:           "foo.com/bar",
+				Name:             profileName,
+				CatalogSource:    sourceName,
+				CatalogNamespace: "default",
+				CatalogScope:     profilesv1.NamespacedCatalogScope,
+				Tag:              "0.0.2",
+				URL:              "foo.com/bar",
 			}
 		})
 
@@ -139,8 +143,10 @@ var _ = Describe("Acceptance", func() {
 							Description:   "nginx 1",
 							Prerequisites: []string{},
 						},
-						Name:          "nginx-2",
-						CatalogSource: sourceName,
+						Name:             "nginx-2",
+						CatalogSource:    sourceName,
+						CatalogNamespace: "default",
+						CatalogScope:     profilesv1.NamespacedCatalogScope,
 					},
 				))
 			})
@@ -303,10 +309,12 @@ var _ = Describe("Acceptance", func() {
 								Maintainer:    "weaveworks",
 								Prerequisites: []string{"kubernetes 1.19"},
 							},
-							Name:          "weaveworks-nginx",
-							Tag:           "weaveworks-nginx/v0.1.1",
-							URL:           "https://github.com/weaveworks/profiles-examples",
-							CatalogSource: "repo",
+							Name:             "weaveworks-nginx",
+							Tag:              "weaveworks-nginx/v0.1.1",
+							URL:              "https://github.com/weaveworks/profiles-examples",
+							CatalogSource:    "repo",
+							CatalogNamespace: namespace,
+							CatalogScope:     profilesv1.NamespacedCatalogScope,
 						}))
 
 						Expect(kClient.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: "repo"}, &catalog)).To(Succeed())
@@ -369,7 +377,7 @@ var _ = Describe("Acceptance", func() {
 								Repos: []profilesv1.Repository{
 									{
 										URL: "ssh://git@github.com/weaveworks/profiles-examples-private",
-										SecretRef: &meta.LocalObjectReference{
+										SecretRef: &meta.NamespacedObjectReference{
 											Name: secretName,
 										},
 									},
@@ -387,10 +395,12 @@ var _ = Describe("Acceptance", func() {
 								Maintainer:    "weaveworks",
 								Prerequisites: []string{"kubernetes 1.19"},
 							},
-							Name:          "weaveworks-nginx",
-							Tag:           "weaveworks-nginx/v0.2.0",
-							URL:           "ssh://git@github.com/weaveworks/profiles-examples-private",
-							CatalogSource: "repo",
+							Name:             "weaveworks-nginx",
+							Tag:              "weaveworks-nginx/v0.2.0",
+							URL:              "ssh://git@github.com/weaveworks/profiles-examples-private",
+							CatalogSource:    "repo",
+							CatalogNamespace: namespace,
+							CatalogScope:     profilesv1.NamespacedCatalogScope,
 						}))
 					})
 				})
@@ -443,8 +453,10 @@ var _ = Describe("Acceptance", func() {
 						Description:   "I am new here",
 						Prerequisites: []string{},
 					},
-					Name:          "new-profile",
-					CatalogSource: sourceName,
+					Name:             "new-profile",
+					CatalogSource:    sourceName,
+					CatalogNamespace: "default",
+					CatalogScope:     profilesv1.NamespacedCatalogScope,
 				}))
 			})
 		})